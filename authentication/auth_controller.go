@@ -1,10 +1,13 @@
 package authentication
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
 
 	// "fmt"
 	// "net/http"
@@ -14,6 +17,28 @@ import (
 	// "github.com/gin-gonic/gin"
 )
 
+var ErrNoAdmin = errors.New("el usuario no tiene permisos de administrador")
+
+// verificarFirma comprueba la firma HS256 del token con la clave de JWT_SECRET
+func verificarFirma(parts []string) error {
+	clave := os.Getenv("JWT_SECRET")
+	if clave == "" {
+		return errors.New("no está configurada la clave para verificar la firma del token")
+	}
+
+	firma, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errors.New("token Invalido")
+	}
+
+	mac := hmac.New(sha256.New, []byte(clave))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(firma, mac.Sum(nil)) {
+		return errors.New("la firma del token no es válida")
+	}
+	return nil
+}
+
 func ValidateToken(tokenString string) (string, error) {
 	tokenInvalido := errors.New("token Invalido")
 
@@ -94,3 +119,50 @@ func ValidateToken(tokenString string) (string, error) {
 	// Si el token está presente y válido
 	return empId, nil
 }
+
+// ValidateAdminToken valida el token y verifica que el usuario tenga el rol de administrador (ADMIN_ROLE).
+// A diferencia de ValidateToken, se verifica la firma antes de confiar en el rol del payload.
+func ValidateAdminToken(tokenString string) (string, error) {
+	empId, err := ValidateToken(tokenString)
+	if err != nil {
+		return "", err
+	}
+
+	parts := strings.Split(strings.Replace(tokenString, "Bearer ", "", 1), ".")
+	if err := verificarFirma(parts); err != nil {
+		fmt.Println("token de administrador sin firma valida")
+		return "", err
+	}
+
+	payloadData, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("token Invalido")
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(payloadData, &payload); err != nil {
+		return "", errors.New("token Invalido")
+	}
+
+	adminRole := os.Getenv("ADMIN_ROLE")
+	if adminRole == "" {
+		adminRole = "admin"
+	}
+
+	// El rol puede venir como un solo valor o como una lista de roles
+	switch roles := payload["role"].(type) {
+	case string:
+		if strings.EqualFold(roles, adminRole) {
+			return empId, nil
+		}
+	case []interface{}:
+		for _, role := range roles {
+			if r, ok := role.(string); ok && strings.EqualFold(r, adminRole) {
+				return empId, nil
+			}
+		}
+	}
+
+	fmt.Println("token sin rol de administrador")
+	return "", ErrNoAdmin
+}
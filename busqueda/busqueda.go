@@ -0,0 +1,169 @@
+package busqueda
+
+import (
+	"GoProcesadorExcel/documentos"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Campos por los que se pueden buscar los documentos
+const (
+	CampoCodigoGeneracion = "codigoGeneracion"
+	CampoNumeroControl    = "numeroControl"
+	CampoReceptorNit      = "receptorNit"
+	CampoIddte            = "iddte"
+)
+
+// Campos son los campos de búsqueda en el orden en que se evalúan
+var Campos = []string{CampoCodigoGeneracion, CampoNumeroControl, CampoReceptorNit, CampoIddte}
+
+// Cada valor buscado es un conjunto con los IDDTE que lo tienen, como "{correlativo}/{iddte}". Un mismo
+// IDDTE puede estar en varios lotes, por ejemplo al reenviar un documento o al invalidarlo.
+func claveIndice(empid string, campo string, valor string) string {
+	return fmt.Sprintf("%s_busqueda:%s:%s", empid, campo, valor)
+}
+
+// Identificadores son los valores de un documento que se registran en el índice; los vacíos no se registran
+type Identificadores struct {
+	CodigoGeneracion string
+	NumeroControl    string
+	ReceptorNit      string
+}
+
+// DelDocumento obtiene los identificadores del documento enviado
+func DelDocumento(documento map[string]interface{}) Identificadores {
+	identificacion := documentos.Fila(documento, "Identificacion")
+	receptor := documentos.Fila(documento, "Receptor")
+	nit := documentos.Texto(receptor, "Nit")
+	if nit == "" {
+		nit = documentos.Texto(receptor, "NumeroDocumentoIdentificacion")
+	}
+	return Identificadores{
+		CodigoGeneracion: documentos.Texto(identificacion, "CodigoGeneracion"),
+		NumeroControl:    documentos.Texto(identificacion, "NumeroControl"),
+		ReceptorNit:      nit,
+	}
+}
+
+// DelEstado obtiene los identificadores de la respuesta guardada de un IDDTE
+func DelEstado(valor string) Identificadores {
+	_, respuesta, _ := documentos.ParsearEstado(valor)
+	return Identificadores{
+		CodigoGeneracion: documentos.Texto(respuesta, "CodigoGeneracion"),
+		NumeroControl:    documentos.Texto(respuesta, "NumeroControl"),
+	}
+}
+
+// Normalizar unifica un valor de búsqueda: sin espacios y en mayúsculas; los NIT y documentos del receptor
+// además sin guiones, porque se escriben con y sin ellos. Un IDDTE se puede buscar con o sin el prefijo.
+func Normalizar(campo string, valor string) string {
+	valor = strings.ToUpper(strings.TrimSpace(valor))
+	if campo == CampoIddte && valor != "" {
+		valor = "IDDTE-" + strings.TrimPrefix(valor, "IDDTE-")
+	}
+	if campo == CampoReceptorNit {
+		valor = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, valor)
+	}
+	return valor
+}
+
+func miembro(correlativo string, iddte string) string {
+	return correlativo + "/" + iddte
+}
+
+// Indexar registra el IDDTE del lote con sus identificadores. Se puede llamar más de una vez por IDDTE.
+func Indexar(rdb *redis.Client, empid string, correlativo string, iddte string, identificadores Identificadores) {
+	ctx := context.Background()
+	valores := map[string]string{
+		CampoIddte:            iddte,
+		CampoCodigoGeneracion: identificadores.CodigoGeneracion,
+		CampoNumeroControl:    identificadores.NumeroControl,
+		CampoReceptorNit:      identificadores.ReceptorNit,
+	}
+
+	pipe := rdb.Pipeline()
+	for campo, valor := range valores {
+		if valor = Normalizar(campo, valor); valor == "" {
+			continue
+		}
+		clave := claveIndice(empid, campo, valor)
+		pipe.SAdd(ctx, clave, miembro(correlativo, iddte))
+		pipe.Expire(ctx, clave, 3*30*24*time.Hour)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error al registrar %s del lote %s en el índice de búsqueda: %v\n", iddte, correlativo, err)
+	}
+}
+
+// Coincidencia es un IDDTE encontrado en el índice
+type Coincidencia struct {
+	Correlativo string
+	IDDTE       string
+}
+
+// Buscar devuelve los IDDTE que tienen todos los valores indicados por campo, ordenados por lote e IDDTE
+func Buscar(rdb *redis.Client, empid string, valores map[string]string) ([]Coincidencia, error) {
+	var claves []string
+	for _, campo := range Campos {
+		if valor := Normalizar(campo, valores[campo]); valor != "" {
+			claves = append(claves, claveIndice(empid, campo, valor))
+		}
+	}
+	if len(claves) == 0 {
+		return nil, nil
+	}
+
+	miembros, err := rdb.SInter(context.Background(), claves...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error al buscar los documentos: %v", err)
+	}
+	coincidencias := make([]Coincidencia, 0, len(miembros))
+	for _, valor := range miembros {
+		if correlativo, iddte, ok := strings.Cut(valor, "/"); ok {
+			coincidencias = append(coincidencias, Coincidencia{Correlativo: correlativo, IDDTE: iddte})
+		}
+	}
+	sort.Slice(coincidencias, func(i, j int) bool {
+		a, b := coincidencias[i], coincidencias[j]
+		if a.Correlativo != b.Correlativo {
+			return numero(a.Correlativo) < numero(b.Correlativo)
+		}
+		return numero(strings.TrimPrefix(a.IDDTE, "IDDTE-")) < numero(strings.TrimPrefix(b.IDDTE, "IDDTE-"))
+	})
+	return coincidencias, nil
+}
+
+func numero(texto string) int {
+	valor, _ := strconv.Atoi(texto)
+	return valor
+}
+
+// Quitar elimina del índice los IDDTE cuyo lote ya venció
+func Quitar(rdb *redis.Client, empid string, valores map[string]string, vencidas []Coincidencia) {
+	if len(vencidas) == 0 {
+		return
+	}
+	miembros := make([]interface{}, len(vencidas))
+	for i, coincidencia := range vencidas {
+		miembros[i] = miembro(coincidencia.Correlativo, coincidencia.IDDTE)
+	}
+	ctx := context.Background()
+	for _, campo := range Campos {
+		if valor := Normalizar(campo, valores[campo]); valor != "" {
+			rdb.SRem(ctx, claveIndice(empid, campo, valor), miembros...)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package busqueda
+
+import "testing"
+
+func TestNormalizar(t *testing.T) {
+	casos := []struct {
+		campo, valor, esperado string
+	}{
+		{CampoReceptorNit, " 0614-250390-102-3 ", "06142503901023"},
+		{CampoCodigoGeneracion, "a1b2c3d4-0000-4000-8000-000000000001", "A1B2C3D4-0000-4000-8000-000000000001"},
+		{CampoIddte, "15", "IDDTE-15"},
+		{CampoIddte, "iddte-15", "IDDTE-15"},
+		{CampoNumeroControl, "  ", ""},
+	}
+	for _, caso := range casos {
+		if resultado := Normalizar(caso.campo, caso.valor); resultado != caso.esperado {
+			t.Errorf("Normalizar(%s, %q) = %q, se esperaba %q", caso.campo, caso.valor, resultado, caso.esperado)
+		}
+	}
+}
+
+func TestIdentificadores(t *testing.T) {
+	documento := map[string]interface{}{
+		"Identificacion": map[string]interface{}{"CodigoGeneracion": "ABC", "NumeroControl": "DTE-01-M001P001-000000000000001"},
+		"Receptor":       []interface{}{map[string]interface{}{"NumeroDocumentoIdentificacion": "06142503901023"}},
+	}
+	if identificadores := DelDocumento(documento); identificadores != (Identificadores{"ABC", "DTE-01-M001P001-000000000000001", "06142503901023"}) {
+		t.Errorf("DelDocumento = %+v", identificadores)
+	}
+
+	estado := `Código: 200, Mensaje: {"Estado": "PROCESADO", "CodigoGeneracion": "XYZ", "NumeroControl": "DTE-03-1"}`
+	if identificadores := DelEstado(estado); identificadores != (Identificadores{CodigoGeneracion: "XYZ", NumeroControl: "DTE-03-1"}) {
+		t.Errorf("DelEstado = %+v", identificadores)
+	}
+}
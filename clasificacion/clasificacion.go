@@ -0,0 +1,217 @@
+package clasificacion
+
+import (
+	"GoProcesadorExcel/documentos"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// Categorías de los errores
+const (
+	CategoriaDatos       = "datos"
+	CategoriaCatalogo    = "catalogo"
+	CategoriaDuplicado   = "duplicado"
+	CategoriaServicio    = "servicio"
+	CategoriaDesconocida = "desconocida"
+)
+
+var categorias = map[string]bool{
+	CategoriaDatos:     true,
+	CategoriaCatalogo:  true,
+	CategoriaDuplicado: true,
+	CategoriaServicio:  true,
+}
+
+// reglasPredeterminadas son las reglas que se usan si CLASIFICACION_REGLAS no indica otro archivo
+//
+//go:embed reglas.json
+var reglasPredeterminadas []byte
+
+// Regla asocia los errores que cumplen sus expresiones con una hoja, un campo y una categoría. Las
+// expresiones vacías no se evalúan; la hoja y el campo pueden usar los grupos de la expresión del mensaje ($1).
+type Regla struct {
+	Nombre       string `json:"nombre"`
+	Mensaje      string `json:"mensaje,omitempty"`
+	Codigo       string `json:"codigo,omitempty"`
+	Estado       string `json:"estado,omitempty"`
+	Hoja         string `json:"hoja,omitempty"`
+	Campo        string `json:"campo,omitempty"`
+	Categoria    string `json:"categoria"`
+	Sugerencia   string `json:"sugerencia,omitempty"`
+	Reintentable bool   `json:"reintentable"`
+}
+
+// Archivo es el formato del archivo de reglas
+type Archivo struct {
+	Reglas []Regla `json:"reglas"`
+}
+
+// Clasificacion es el resultado de clasificar un error
+type Clasificacion struct {
+	Regla        string   `json:"regla,omitempty"`
+	Categoria    string   `json:"categoria"`
+	Hoja         string   `json:"hoja,omitempty"`
+	Campo        string   `json:"campo,omitempty"`
+	Hojas        []string `json:"hojas,omitempty"`
+	Sugerencia   string   `json:"sugerencia,omitempty"`
+	Reintentable bool     `json:"reintentable"`
+}
+
+type reglaCompilada struct {
+	Regla
+	mensaje *regexp.Regexp
+	codigo  *regexp.Regexp
+	estado  *regexp.Regexp
+}
+
+// Clasificador evalúa las reglas en orden
+type Clasificador struct {
+	reglas []reglaCompilada
+}
+
+// Nuevo compila las reglas; devuelve un error si alguna expresión o categoría no es válida
+func Nuevo(reglas []Regla) (*Clasificador, error) {
+	clasificador := &Clasificador{}
+	for i, regla := range reglas {
+		if regla.Nombre == "" {
+			regla.Nombre = fmt.Sprintf("regla-%d", i+1)
+		}
+		if !categorias[regla.Categoria] {
+			return nil, fmt.Errorf("la regla %s tiene una categoría no válida: %q", regla.Nombre, regla.Categoria)
+		}
+		if regla.Mensaje == "" && regla.Codigo == "" && regla.Estado == "" {
+			return nil, fmt.Errorf("la regla %s no tiene condiciones", regla.Nombre)
+		}
+
+		compilada := reglaCompilada{Regla: regla}
+		for _, expresion := range []struct {
+			texto   string
+			destino **regexp.Regexp
+		}{
+			{regla.Mensaje, &compilada.mensaje},
+			{regla.Codigo, &compilada.codigo},
+			{regla.Estado, &compilada.estado},
+		} {
+			if expresion.texto == "" {
+				continue
+			}
+			patron, err := regexp.Compile(expresion.texto)
+			if err != nil {
+				return nil, fmt.Errorf("expresión no válida en la regla %s: %v", regla.Nombre, err)
+			}
+			*expresion.destino = patron
+		}
+		clasificador.reglas = append(clasificador.reglas, compilada)
+	}
+	return clasificador, nil
+}
+
+// Leer interpreta un archivo de reglas
+func Leer(contenido []byte) (*Clasificador, error) {
+	var archivo Archivo
+	if err := json.Unmarshal(contenido, &archivo); err != nil {
+		return nil, fmt.Errorf("error al analizar las reglas de clasificación: %v", err)
+	}
+	return Nuevo(archivo.Reglas)
+}
+
+// Cargar lee las reglas de un archivo
+func Cargar(ruta string) (*Clasificador, error) {
+	contenido, err := os.ReadFile(ruta)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer las reglas de clasificación: %v", err)
+	}
+	return Leer(contenido)
+}
+
+var (
+	predeterminado      *Clasificador
+	cargaPredeterminado sync.Once
+)
+
+// Predeterminado devuelve el clasificador del archivo indicado en CLASIFICACION_REGLAS o, si no se indica o
+// no es válido, el de las reglas incluidas en el programa
+func Predeterminado() *Clasificador {
+	cargaPredeterminado.Do(func() {
+		if ruta := os.Getenv("CLASIFICACION_REGLAS"); ruta != "" {
+			clasificador, err := Cargar(ruta)
+			if err == nil {
+				predeterminado = clasificador
+				return
+			}
+			log.Printf("No se pudieron cargar las reglas de clasificación de %s, se usan las predeterminadas: %v\n", ruta, err)
+		}
+		clasificador, err := Leer(reglasPredeterminadas)
+		if err != nil {
+			log.Fatalf("Reglas de clasificación predeterminadas no válidas: %v", err)
+		}
+		predeterminado = clasificador
+	})
+	return predeterminado
+}
+
+// Clasificar evalúa las reglas con el código, el estado de Hacienda y el mensaje de un error. La categoría,
+// la sugerencia y si es reintentable vienen de la primera regla que coincide; la hoja y el campo, de la primera
+// que los indica. Hojas reúne las hojas de todas las reglas que coinciden.
+func (c *Clasificador) Clasificar(codigo int, estado string, mensaje string) Clasificacion {
+	resultado := Clasificacion{Categoria: CategoriaDesconocida}
+	textoCodigo := strconv.Itoa(codigo)
+	encontrada := false
+	for _, regla := range c.reglas {
+		if regla.codigo != nil && !regla.codigo.MatchString(textoCodigo) {
+			continue
+		}
+		if regla.estado != nil && !regla.estado.MatchString(estado) {
+			continue
+		}
+		var grupos []int
+		if regla.mensaje != nil {
+			if grupos = regla.mensaje.FindStringSubmatchIndex(mensaje); grupos == nil {
+				continue
+			}
+		}
+
+		if !encontrada {
+			encontrada = true
+			resultado.Regla = regla.Nombre
+			resultado.Categoria = regla.Categoria
+			resultado.Sugerencia = regla.Sugerencia
+			resultado.Reintentable = regla.Reintentable
+		}
+		if regla.Hoja == "" {
+			continue
+		}
+		if resultado.Hoja == "" {
+			resultado.Hoja = regla.Hoja
+			resultado.Campo = regla.Campo
+			if regla.mensaje != nil {
+				resultado.Campo = string(regla.mensaje.ExpandString(nil, regla.Campo, mensaje, grupos))
+			}
+		}
+		if !contiene(resultado.Hojas, regla.Hoja) {
+			resultado.Hojas = append(resultado.Hojas, regla.Hoja)
+		}
+	}
+	return resultado
+}
+
+// ClasificarEstado clasifica el valor guardado en Redis para un IDDTE ("Código: 400, Mensaje: {...}")
+func (c *Clasificador) ClasificarEstado(valor string) Clasificacion {
+	codigo, mensaje, texto := documentos.ParsearEstado(valor)
+	return c.Clasificar(codigo, documentos.Texto(mensaje, "Estado"), texto)
+}
+
+func contiene(lista []string, valor string) bool {
+	for _, elemento := range lista {
+		if elemento == valor {
+			return true
+		}
+	}
+	return false
+}
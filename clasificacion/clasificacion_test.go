@@ -0,0 +1,78 @@
+package clasificacion
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// corpus son mensajes de rechazo reales de Hacienda y de la API con su clasificación esperada
+var corpus = []struct {
+	valor        string
+	categoria    string
+	hojas        string
+	campo        string
+	reintentable bool
+}{
+	{`Código: 200, Mensaje: {"Estado": "RECHAZADO", "DescripcionMsg": "[receptor.nrc] EL NRC NO EXISTE"}`, CategoriaDatos, "Receptor", "nrc", false},
+	{`Código: 200, Mensaje: {"Estado": "RECHAZADO", "DescripcionMsg": "[receptor.codActividad] VALOR NO VALIDO SEGUN CATALOGO CAT-019"}`, CategoriaCatalogo, "Receptor", "codActividad", false},
+	{`Código: 200, Mensaje: {"Estado": "RECHAZADO", "DescripcionMsg": "[identificacion.codigoGeneracion] YA EXISTE UN REGISTRO CON ESE VALOR"}`, CategoriaDuplicado, "Identificacion", "codigoGeneracion", false},
+	{`Código: 200, Mensaje: {"Estado": "RECHAZADO", "DescripcionMsg": "DOCUMENTO YA FUE REGISTRADO"}`, CategoriaDuplicado, "Identificacion", "", false},
+	{`Código: 200, Mensaje: {"Estado": "RECHAZADO", "DescripcionMsg": "[cuerpoDocumento.item[2].precioUni] EL VALOR DEBE SER MAYOR A CERO"}`, CategoriaDatos, "Detalles", "precioUni", false},
+	{`Código: 200, Mensaje: {"Estado": "RECHAZADO", "DescripcionMsg": "Error en cuerpoDocumento.item"}`, CategoriaDatos, "Detalles", "", false},
+	{`Código: 200, Mensaje: {"Estado": "RECHAZADO", "DescripcionMsg": "[documentoRelacionado] EL DOCUMENTO RELACIONADO NO EXISTE"}`, CategoriaDatos, "DocumentosRelacionados", "", false},
+	{`Código: 200, Mensaje: {"Estado": "RECHAZADO", "DescripcionMsg": "[resumen.totalPagar] EL CALCULO DEL TOTAL A PAGAR NO ES CORRECTO"}`, CategoriaDatos, "Resumen", "totalPagar", false},
+	{`Código: 200, Mensaje: {"Estado": "RECHAZADO", "DescripcionMsg": "FIRMA NO VALIDA"}`, CategoriaDatos, "", "", false},
+	{`Código: 400, Mensaje: {"Message": "Detalles[3].PrecioUnitario: debe ser mayor que 0; Receptor.Nrc: es obligatorio"}`, CategoriaDatos, "Detalles, Receptor", "PrecioUnitario", false},
+	{`Código: 400, Mensaje: {"Message": "No existe establecimiento con codigo M001"}`, CategoriaCatalogo, "Identificacion", "", false},
+	{`Código: 400, Mensaje: {"Message": "Extension.NombEntrega: longitud máxima 100"}`, CategoriaDatos, "Extension", "NombEntrega", false},
+	{`Código: 500, Mensaje: {"Message": "Internal Server Error"}`, CategoriaServicio, "", "", true},
+	{`Código: 503, Mensaje: {"Message": "Resumen.TotalPagar no cuadra"}`, CategoriaServicio, "Resumen", "TotalPagar", true},
+	{`Código: 0, Mensaje: {"Message": "Post \"https://api\": dial tcp: connection refused"}`, CategoriaServicio, "", "", true},
+	{`Código: 404, Mensaje: {"Message": "El documento no llegó a Hacienda; puede reintentarse"}`, CategoriaServicio, "", "", true},
+	{`Código: 408, Mensaje: {"Message": "Request timeout"}`, CategoriaServicio, "", "", true},
+	{`Código: 401, Mensaje: {"Message": "Token vencido"}`, CategoriaDesconocida, "", "", false},
+}
+
+func TestCorpus(t *testing.T) {
+	clasificador, err := Leer(reglasPredeterminadas)
+	if err != nil {
+		t.Fatalf("Reglas predeterminadas no válidas: %v", err)
+	}
+	for _, caso := range corpus {
+		resultado := clasificador.ClasificarEstado(caso.valor)
+		if resultado.Categoria != caso.categoria || strings.Join(resultado.Hojas, ", ") != caso.hojas ||
+			resultado.Campo != caso.campo || resultado.Reintentable != caso.reintentable {
+			t.Errorf("Clasificación inesperada para %s: %+v", caso.valor, resultado)
+		}
+		if resultado.Categoria != CategoriaDesconocida && resultado.Sugerencia == "" {
+			t.Errorf("La regla %s no tiene sugerencia", resultado.Regla)
+		}
+	}
+}
+
+func TestCargarReglas(t *testing.T) {
+	ruta := filepath.Join(t.TempDir(), "reglas.json")
+	contenido := `{"reglas": [{"nombre": "nit", "mensaje": "(?i)nit (\\w+) inv", "hoja": "Receptor", "campo": "Nit", "categoria": "datos"}]}`
+	if err := os.WriteFile(ruta, []byte(contenido), 0644); err != nil {
+		t.Fatal(err)
+	}
+	clasificador, err := Cargar(ruta)
+	if err != nil {
+		t.Fatalf("Error al cargar las reglas: %v", err)
+	}
+	if resultado := clasificador.Clasificar(400, "", "NIT 0614 inválido"); resultado.Regla != "nit" || resultado.Hoja != "Receptor" {
+		t.Errorf("Clasificación inesperada: %+v", resultado)
+	}
+
+	for _, reglas := range []string{
+		`{"reglas": [{"mensaje": "(", "categoria": "datos"}]}`,
+		`{"reglas": [{"mensaje": "x", "categoria": "otra"}]}`,
+		`{"reglas": [{"categoria": "datos"}]}`,
+	} {
+		if _, err := Leer([]byte(reglas)); err == nil {
+			t.Errorf("Las reglas %s deberían ser inválidas", reglas)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package contingencia
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// circuito lleva la cuenta de los fallos de comunicación consecutivos con la API de Hacienda.
+// Se abre con el primer fallo de una racha que alcance el límite y se cierra con la primera respuesta.
+type circuito struct {
+	mu           sync.Mutex
+	fallos       int
+	primerFallo  time.Time
+	abiertoDesde time.Time
+}
+
+var estadoCircuito circuito
+
+// RegistrarFallo registra un error de red o timeout al comunicarse con la API
+func RegistrarFallo() {
+	estadoCircuito.mu.Lock()
+	defer estadoCircuito.mu.Unlock()
+
+	if estadoCircuito.fallos == 0 {
+		estadoCircuito.primerFallo = time.Now()
+	}
+	estadoCircuito.fallos++
+	if estadoCircuito.fallos >= fallosParaAbrir() && estadoCircuito.abiertoDesde.IsZero() {
+		estadoCircuito.abiertoDesde = estadoCircuito.primerFallo
+		log.Printf("Circuito hacia la API abierto tras %d fallos consecutivos\n", estadoCircuito.fallos)
+	}
+}
+
+// RegistrarExito registra una respuesta de la API, con cualquier código de estado
+func RegistrarExito() {
+	estadoCircuito.mu.Lock()
+	defer estadoCircuito.mu.Unlock()
+
+	if !estadoCircuito.abiertoDesde.IsZero() {
+		log.Printf("Circuito hacia la API cerrado después de %v\n", time.Since(estadoCircuito.abiertoDesde).Round(time.Second))
+	}
+	estadoCircuito.fallos = 0
+	estadoCircuito.abiertoDesde = time.Time{}
+}
+
+// CircuitoAbierto indica si la API está fuera de servicio y desde cuándo
+func CircuitoAbierto() (time.Time, bool) {
+	estadoCircuito.mu.Lock()
+	defer estadoCircuito.mu.Unlock()
+	return estadoCircuito.abiertoDesde, !estadoCircuito.abiertoDesde.IsZero()
+}
+
+// superaUmbral indica si el circuito lleva abierto más tiempo que el umbral para entrar en contingencia
+func superaUmbral() bool {
+	desde, abierto := CircuitoAbierto()
+	return abierto && time.Since(desde) >= UmbralActivacion()
+}
+
+// UmbralActivacion es el tiempo que la API debe estar fuera de servicio para activar la contingencia
+// automáticamente (CONTINGENCIA_UMBRAL_MINUTOS, 10 minutos por defecto)
+func UmbralActivacion() time.Duration {
+	return time.Duration(enteroEntorno("CONTINGENCIA_UMBRAL_MINUTOS", 10)) * time.Minute
+}
+
+// PlazoTransmision es el plazo para transmitir los documentos después del fin de la contingencia
+// (CONTINGENCIA_PLAZO_HORAS, 72 horas por defecto)
+func PlazoTransmision() time.Duration {
+	return time.Duration(enteroEntorno("CONTINGENCIA_PLAZO_HORAS", 72)) * time.Hour
+}
+
+// fallosParaAbrir es el número de fallos consecutivos que abren el circuito (CONTINGENCIA_FALLOS, 3 por defecto)
+func fallosParaAbrir() int {
+	return enteroEntorno("CONTINGENCIA_FALLOS", 3)
+}
+
+func enteroEntorno(nombre string, predeterminado int) int {
+	valor, err := strconv.Atoi(os.Getenv(nombre))
+	if err != nil || valor <= 0 {
+		return predeterminado
+	}
+	return valor
+}
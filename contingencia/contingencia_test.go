@@ -0,0 +1,67 @@
+package contingencia
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCircuito(t *testing.T) {
+	os.Setenv("CONTINGENCIA_FALLOS", "2")
+	defer os.Unsetenv("CONTINGENCIA_FALLOS")
+	RegistrarExito()
+
+	RegistrarFallo()
+	if _, abierto := CircuitoAbierto(); abierto {
+		t.Fatal("El circuito no debería abrirse con un solo fallo")
+	}
+	RegistrarFallo()
+	if _, abierto := CircuitoAbierto(); !abierto {
+		t.Fatal("El circuito debería abrirse al alcanzar el límite de fallos")
+	}
+	RegistrarExito()
+	if _, abierto := CircuitoAbierto(); abierto {
+		t.Fatal("El circuito debería cerrarse con una respuesta de la API")
+	}
+}
+
+func TestDocumentoEvento(t *testing.T) {
+	inicio := time.Date(2024, 5, 10, 8, 30, 0, 0, time.UTC)
+	fin := inicio.Add(2 * time.Hour)
+	evento := &Evento{CodigoGeneracion: "EVENTO", Tipo: TipoNoDisponibilidadMH, Inicio: inicio, Fin: &fin}
+
+	documentos := []DocumentoEnCola{
+		{TipoDte: "01", Documento: map[string]interface{}{"Identificacion": map[string]interface{}{"CodigoGeneracion": "DOC-1"}}},
+		{TipoDte: "03", Documento: map[string]interface{}{}},
+	}
+	documento := DocumentoEvento(evento, documentos)
+
+	if documento["FechaInicio"] != "2024-05-10" || documento["HoraFin"] != "10:30:00" {
+		t.Errorf("Fechas inesperadas: %v", documento)
+	}
+	detalle := documento["Detalle"].([]map[string]interface{})
+	if len(detalle) != 2 || detalle[0]["CodigoGeneracion"] != "DOC-1" || detalle[1]["TipoDoc"] != "03" {
+		t.Errorf("Detalle inesperado: %v", detalle)
+	}
+	if !evento.Plazo().Equal(fin.Add(PlazoTransmision())) {
+		t.Errorf("Plazo inesperado: %v", evento.Plazo())
+	}
+}
+
+func TestCodigoDocumento(t *testing.T) {
+	casos := []struct {
+		documento map[string]interface{}
+		esperado  string
+	}{
+		{map[string]interface{}{"CodigoGeneracion": "RAIZ"}, "RAIZ"},
+		{map[string]interface{}{"Identificacion": map[string]interface{}{"CodigoGeneracion": " DOC-1 "}}, "DOC-1"},
+		{map[string]interface{}{"Identificacion": []interface{}{map[string]interface{}{"CodigoGeneracion": "DOC-2"}}}, "DOC-2"},
+		{map[string]interface{}{"Identificacion": []interface{}{}}, ""},
+		{map[string]interface{}{}, ""},
+	}
+	for _, caso := range casos {
+		if codigo := CodigoDocumento(caso.documento); codigo != caso.esperado {
+			t.Errorf("CodigoDocumento(%v) = %q, se esperaba %q", caso.documento, codigo, caso.esperado)
+		}
+	}
+}
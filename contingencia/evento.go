@@ -0,0 +1,338 @@
+package contingencia
+
+import (
+	"GoProcesadorExcel/identificadores"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Estados de un evento de contingencia
+const (
+	EstadoActiva      = "ACTIVA"      // Los documentos nuevos se guardan en la cola
+	EstadoCerrada     = "CERRADA"     // Terminó la ventana; falta reportar el evento
+	EstadoReportada   = "REPORTADA"   // Hacienda recibió el evento; faltan los documentos
+	EstadoTransmitida = "TRANSMITIDA" // Se transmitieron todos los documentos de la cola
+)
+
+// Origen de la activación de la contingencia
+const (
+	OrigenOperador   = "operador"
+	OrigenAutomatico = "automatico"
+)
+
+// TipoNoDisponibilidadMH es el tipo de contingencia por falta de disponibilidad del sistema de Hacienda
+const TipoNoDisponibilidadMH = 1
+
+var (
+	ErrContingenciaActiva = errors.New("ya existe una contingencia activa")
+	ErrSinContingencia    = errors.New("no hay una contingencia activa")
+	ErrEventoNoExiste     = errors.New("el evento de contingencia no existe")
+)
+
+// Evento es una ventana de contingencia de una empresa
+type Evento struct {
+	CodigoGeneracion string     `json:"codigoGeneracion"`
+	Tipo             int        `json:"tipoContingencia"`
+	Motivo           string     `json:"motivoContingencia,omitempty"`
+	Origen           string     `json:"origen"`
+	Estado           string     `json:"estado"`
+	Inicio           time.Time  `json:"inicio"`
+	Fin              *time.Time `json:"fin,omitempty"`
+	Documentos       int        `json:"documentos"`
+	Transmitidos     int        `json:"transmitidos"`
+	SelloRecibido    string     `json:"selloRecibido,omitempty"`
+	Mensaje          string     `json:"mensaje,omitempty"`
+}
+
+// Plazo devuelve la fecha límite para transmitir los documentos del evento
+func (e Evento) Plazo() time.Time {
+	if e.Fin == nil {
+		return time.Time{}
+	}
+	return e.Fin.Add(PlazoTransmision())
+}
+
+// DocumentoEnCola es un documento emitido durante la contingencia y pendiente de transmitir. No guarda el
+// token del usuario; la transmisión usa el de quien la solicita o la credencial de servicio.
+type DocumentoEnCola struct {
+	Lote      string                 `json:"lote"`
+	ID        string                 `json:"id"`
+	TipoDte   string                 `json:"tipoDte"`
+	Documento map[string]interface{} `json:"documento"`
+	Fecha     time.Time              `json:"fecha"`
+}
+
+func claveActiva(empid string) string  { return empid + "_contingencia_activa" }
+func claveEventos(empid string) string { return empid + "_contingencia_eventos" }
+func claveCola(empid string, codigo string) string {
+	return fmt.Sprintf("%s_contingencia_cola:%s", empid, codigo)
+}
+
+// claveEmpresas es el conjunto de empresas con eventos de contingencia sin terminar
+const claveEmpresas = "contingencia_empresas"
+
+// Activar abre una ventana de contingencia para la empresa
+func Activar(rdb *redis.Client, empid string, tipo int, motivo string, origen string) (*Evento, error) {
+	codigo, err := identificadores.NuevoCodigoGeneracion()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	ok, err := rdb.SetNX(ctx, claveActiva(empid), codigo, 0).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error al activar la contingencia: %v", err)
+	}
+	if !ok {
+		return nil, ErrContingenciaActiva
+	}
+
+	evento := &Evento{
+		CodigoGeneracion: codigo,
+		Tipo:             tipo,
+		Motivo:           motivo,
+		Origen:           origen,
+		Estado:           EstadoActiva,
+		Inicio:           time.Now(),
+	}
+	if err := GuardarEvento(rdb, empid, evento); err != nil {
+		return nil, err
+	}
+	if err := rdb.SAdd(ctx, claveEmpresas, empid).Err(); err != nil {
+		return nil, fmt.Errorf("error al registrar la empresa en contingencia: %v", err)
+	}
+	return evento, nil
+}
+
+// Cerrar termina la ventana de la contingencia activa; el evento queda pendiente de reportar
+func Cerrar(rdb *redis.Client, empid string) (*Evento, error) {
+	evento, err := ObtenerActivo(rdb, empid)
+	if err != nil {
+		return nil, err
+	}
+	if evento == nil {
+		return nil, ErrSinContingencia
+	}
+
+	fin := time.Now()
+	evento.Fin = &fin
+	evento.Estado = EstadoCerrada
+	if err := GuardarEvento(rdb, empid, evento); err != nil {
+		return nil, err
+	}
+	if err := rdb.Del(context.Background(), claveActiva(empid)).Err(); err != nil {
+		return nil, fmt.Errorf("error al desactivar la contingencia: %v", err)
+	}
+	return evento, nil
+}
+
+// ObtenerActivo devuelve el evento de contingencia activo de la empresa, o nil si no hay ninguno
+func ObtenerActivo(rdb *redis.Client, empid string) (*Evento, error) {
+	codigo, err := rdb.Get(context.Background(), claveActiva(empid)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener la contingencia activa: %v", err)
+	}
+	return ObtenerEvento(rdb, empid, codigo)
+}
+
+// ObtenerEvento devuelve un evento de contingencia de la empresa
+func ObtenerEvento(rdb *redis.Client, empid string, codigo string) (*Evento, error) {
+	contenido, err := rdb.HGet(context.Background(), claveEventos(empid), codigo).Result()
+	if err == redis.Nil {
+		return nil, ErrEventoNoExiste
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener el evento de contingencia: %v", err)
+	}
+
+	var evento Evento
+	if err := json.Unmarshal([]byte(contenido), &evento); err != nil {
+		return nil, fmt.Errorf("error al analizar el evento de contingencia: %v", err)
+	}
+	return &evento, nil
+}
+
+// GuardarEvento guarda el estado de un evento de contingencia
+func GuardarEvento(rdb *redis.Client, empid string, evento *Evento) error {
+	contenido, err := json.Marshal(evento)
+	if err != nil {
+		return fmt.Errorf("error al serializar el evento de contingencia: %v", err)
+	}
+	if err := rdb.HSet(context.Background(), claveEventos(empid), evento.CodigoGeneracion, contenido).Err(); err != nil {
+		return fmt.Errorf("error al guardar el evento de contingencia: %v", err)
+	}
+	return nil
+}
+
+// ListarEventos devuelve los eventos de contingencia de la empresa, del más reciente al más antiguo
+func ListarEventos(rdb *redis.Client, empid string) ([]Evento, error) {
+	valores, err := rdb.HGetAll(context.Background(), claveEventos(empid)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error al listar los eventos de contingencia: %v", err)
+	}
+
+	eventos := make([]Evento, 0, len(valores))
+	for _, valor := range valores {
+		var evento Evento
+		if err := json.Unmarshal([]byte(valor), &evento); err == nil {
+			eventos = append(eventos, evento)
+		}
+	}
+	sort.Slice(eventos, func(i, j int) bool { return eventos[i].Inicio.After(eventos[j].Inicio) })
+	return eventos, nil
+}
+
+// Encolar guarda un documento emitido durante la contingencia y lo cuenta en el evento
+func Encolar(rdb *redis.Client, empid string, evento *Evento, documento DocumentoEnCola) error {
+	contenido, err := json.Marshal(documento)
+	if err != nil {
+		return fmt.Errorf("error al serializar el documento en contingencia: %v", err)
+	}
+	total, err := rdb.RPush(context.Background(), claveCola(empid, evento.CodigoGeneracion), contenido).Result()
+	if err != nil {
+		return fmt.Errorf("error al guardar el documento en la cola de contingencia: %v", err)
+	}
+
+	// Actualizar el conteo sobre la versión guardada para no perder cambios de estado
+	actual, err := ObtenerEvento(rdb, empid, evento.CodigoGeneracion)
+	if err != nil {
+		return err
+	}
+	actual.Documentos = int(total)
+	return GuardarEvento(rdb, empid, actual)
+}
+
+// DocumentosEnCola devuelve los documentos pendientes de transmitir de un evento
+func DocumentosEnCola(rdb *redis.Client, empid string, codigo string) ([]DocumentoEnCola, error) {
+	valores, err := rdb.LRange(context.Background(), claveCola(empid, codigo), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la cola de contingencia: %v", err)
+	}
+
+	documentos := make([]DocumentoEnCola, 0, len(valores))
+	for _, valor := range valores {
+		var documento DocumentoEnCola
+		if err := json.Unmarshal([]byte(valor), &documento); err == nil {
+			documentos = append(documentos, documento)
+		}
+	}
+	return documentos, nil
+}
+
+// ReemplazarCola deja en la cola de un evento solo los documentos que siguen pendientes de transmitir
+func ReemplazarCola(rdb *redis.Client, empid string, codigo string, pendientes []DocumentoEnCola) error {
+	ctx := context.Background()
+	pipe := rdb.TxPipeline()
+	pipe.Del(ctx, claveCola(empid, codigo))
+	for _, documento := range pendientes {
+		contenido, err := json.Marshal(documento)
+		if err != nil {
+			return fmt.Errorf("error al serializar el documento en contingencia: %v", err)
+		}
+		pipe.RPush(ctx, claveCola(empid, codigo), contenido)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("error al actualizar la cola de contingencia: %v", err)
+	}
+	return nil
+}
+
+// Empresas devuelve las empresas con eventos de contingencia sin terminar
+func Empresas(rdb *redis.Client) ([]string, error) {
+	return rdb.SMembers(context.Background(), claveEmpresas).Result()
+}
+
+// QuitarEmpresa saca a la empresa del seguimiento cuando todos sus eventos terminaron
+func QuitarEmpresa(rdb *redis.Client, empid string) error {
+	return rdb.SRem(context.Background(), claveEmpresas, empid).Err()
+}
+
+// EventoParaEnvio devuelve el evento al que se debe asignar un documento antes de enviarlo: la
+// contingencia activa o, si la API lleva caída más tiempo que el umbral, una contingencia automática.
+// Devuelve nil si el documento se puede enviar normalmente.
+func EventoParaEnvio(rdb *redis.Client, empid string) (*Evento, error) {
+	evento, err := ObtenerActivo(rdb, empid)
+	if err != nil || evento != nil {
+		return evento, err
+	}
+	if !superaUmbral() {
+		return nil, nil
+	}
+
+	evento, err = Activar(rdb, empid, TipoNoDisponibilidadMH, "No disponibilidad de sistema del MH", OrigenAutomatico)
+	if err == ErrContingenciaActiva {
+		// Otro envío activó la contingencia al mismo tiempo
+		return ObtenerActivo(rdb, empid)
+	}
+	return evento, err
+}
+
+// MarcarDocumento asigna el documento al evento de contingencia
+func MarcarDocumento(documento map[string]interface{}, evento *Evento) {
+	documento["CodigoGeneracionContingencia"] = evento.CodigoGeneracion
+}
+
+// DocumentoEvento arma el documento del evento de contingencia con los documentos emitidos en la ventana
+func DocumentoEvento(evento *Evento, documentos []DocumentoEnCola) map[string]interface{} {
+	detalle := make([]map[string]interface{}, 0, len(documentos))
+	for i, documento := range documentos {
+		item := map[string]interface{}{
+			"NoItem":  i + 1,
+			"TipoDoc": documento.TipoDte,
+		}
+		if codigo := CodigoDocumento(documento.Documento); codigo != "" {
+			item["CodigoGeneracion"] = codigo
+		}
+		detalle = append(detalle, item)
+	}
+
+	fin := time.Now()
+	if evento.Fin != nil {
+		fin = *evento.Fin
+	}
+	return map[string]interface{}{
+		"CodigoGeneracion":   evento.CodigoGeneracion,
+		"FechaInicio":        evento.Inicio.Format("2006-01-02"),
+		"HoraInicio":         evento.Inicio.Format("15:04:05"),
+		"FechaFin":           fin.Format("2006-01-02"),
+		"HoraFin":            fin.Format("15:04:05"),
+		"TipoContingencia":   evento.Tipo,
+		"MotivoContingencia": evento.Motivo,
+		"Detalle":            detalle,
+	}
+}
+
+// CodigoDocumento obtiene el código de generación de un documento, en la raíz o en Identificacion
+func CodigoDocumento(documento map[string]interface{}) string {
+	if codigo, ok := documento["CodigoGeneracion"].(string); ok && strings.TrimSpace(codigo) != "" {
+		return strings.TrimSpace(codigo)
+	}
+	identificacion, _ := documento["Identificacion"].(map[string]interface{})
+	if filas, ok := documento["Identificacion"].([]interface{}); ok && len(filas) > 0 {
+		identificacion, _ = filas[0].(map[string]interface{})
+	}
+	if codigo, ok := identificacion["CodigoGeneracion"].(string); ok {
+		return strings.TrimSpace(codigo)
+	}
+	return ""
+}
+
+// Bloquear evita que dos procesos transmitan los eventos de la misma empresa al mismo tiempo
+func Bloquear(rdb *redis.Client, empid string) (bool, error) {
+	return rdb.SetNX(context.Background(), empid+"_contingencia_transmision", time.Now().Format(time.RFC3339), 30*time.Minute).Result()
+}
+
+// Desbloquear libera el bloqueo de transmisión de la empresa
+func Desbloquear(rdb *redis.Client, empid string) {
+	rdb.Del(context.Background(), empid+"_contingencia_transmision")
+}
@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/mapeo"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tealeg/xlsx"
+)
+
+const (
+	maxTamanoArchivo       = 50 << 20  // Tamaño máximo del archivo recibido
+	maxTamanoDescomprimido = 200 << 20 // Tamaño máximo del contenido de un ZIP una vez descomprimido
+)
+
+// Tipos de contenido detectados a partir de los primeros bytes del archivo
+const (
+	contenidoXLSX        = "xlsx"
+	contenidoZIP         = "zip"
+	contenidoXLS         = "xls"
+	contenidoTexto       = "texto"
+	contenidoDesconocido = "desconocido"
+)
+
+var (
+	firmaZIP = []byte("PK\x03\x04")
+	firmaXLS = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+)
+
+// libroRecibido es un libro de Excel listo para convertirse en un lote
+type libroRecibido struct {
+	nombre    string
+	contenido []byte
+}
+
+// loteCreado describe un lote creado a partir de un archivo recibido
+type loteCreado struct {
+	Lote        string                `json:"lote"`
+	Correlativo int                   `json:"correlativo"`
+	Archivo     string                `json:"archivo"`
+	Encabezados []mapeo.ResultadoHoja `json:"encabezados"`
+}
+
+// librosRecibidos identifica el archivo por su contenido y devuelve los libros a convertir: el mismo
+// libro si es un xlsx, uno por cada xlsx dentro de un ZIP, o uno armado con los CSV de un ZIP. Un CSV
+// suelto es la hoja raíz del documento; el resto de hojas puede venir de los valores fijos del mapeo.
+func librosRecibidos(nombre string, contenido []byte, tipoDte string, tipos mapeo.TiposColumna, configuracion *mapeo.Configuracion) ([]libroRecibido, error) {
+	switch tipoContenido(contenido) {
+	case contenidoXLSX:
+		return []libroRecibido{{nombre: nombre, contenido: contenido}}, nil
+	case contenidoZIP:
+		return librosDesdeZIP(nombre, contenido, tipoDte, tipos, configuracion)
+	case contenidoXLS:
+		return nil, errors.New("El formato xls no está soportado, guarde el archivo como xlsx")
+	case contenidoTexto:
+		libro, err := mapeo.LibroDesdeCSV([]mapeo.ArchivoCSV{{Hoja: mapeo.HojaRaiz, Contenido: contenido}}, tipoDte, tipos, configuracion)
+		if err != nil {
+			return nil, fmt.Errorf("Error al convertir el CSV: %v", err)
+		}
+		return []libroRecibido{{nombre: nombre, contenido: libro}}, nil
+	}
+	return nil, errors.New("El archivo no es un archivo Excel, un CSV ni un ZIP con archivos CSV o Excel")
+}
+
+// tipoContenido detecta el formato por los bytes del archivo y no por su extensión
+func tipoContenido(contenido []byte) string {
+	switch {
+	case bytes.HasPrefix(contenido, firmaXLS):
+		return contenidoXLS
+	case bytes.HasPrefix(contenido, firmaZIP):
+		// Un xlsx también es un ZIP; se distingue por sus partes internas
+		lector, err := zip.NewReader(bytes.NewReader(contenido), int64(len(contenido)))
+		if err != nil {
+			return contenidoDesconocido
+		}
+		partes := map[string]bool{}
+		for _, archivo := range lector.File {
+			partes[archivo.Name] = true
+		}
+		if partes["[Content_Types].xml"] && partes["xl/workbook.xml"] {
+			return contenidoXLSX
+		}
+		return contenidoZIP
+	case len(contenido) > 0 && utf8.Valid(contenido) && !bytes.ContainsRune(contenido, 0):
+		return contenidoTexto
+	}
+	return contenidoDesconocido
+}
+
+func librosDesdeZIP(nombre string, contenido []byte, tipoDte string, tipos mapeo.TiposColumna, configuracion *mapeo.Configuracion) ([]libroRecibido, error) {
+	lector, err := zip.NewReader(bytes.NewReader(contenido), int64(len(contenido)))
+	if err != nil {
+		return nil, errors.New("El archivo ZIP está dañado")
+	}
+
+	var libros []libroRecibido
+	var hojasCSV []mapeo.ArchivoCSV
+	var descomprimido int64
+
+	for _, archivo := range lector.File {
+		base := path.Base(archivo.Name)
+		if archivo.FileInfo().IsDir() || strings.HasPrefix(archivo.Name, "__MACOSX/") || strings.HasPrefix(base, ".") {
+			continue
+		}
+
+		descomprimido += int64(archivo.UncompressedSize64)
+		if descomprimido > maxTamanoDescomprimido {
+			return nil, errors.New("El contenido del ZIP supera el tamaño máximo permitido")
+		}
+
+		datos, err := leerArchivoZIP(archivo)
+		if err != nil {
+			return nil, fmt.Errorf("No se pudo leer el archivo %s del ZIP", archivo.Name)
+		}
+
+		switch tipoContenido(datos) {
+		case contenidoXLSX:
+			libros = append(libros, libroRecibido{nombre: base, contenido: datos})
+		case contenidoTexto:
+			hojasCSV = append(hojasCSV, mapeo.ArchivoCSV{Hoja: strings.TrimSuffix(base, path.Ext(base)), Contenido: datos})
+		default:
+			return nil, fmt.Errorf("El archivo %s del ZIP no es un CSV ni un archivo Excel", archivo.Name)
+		}
+	}
+
+	if len(libros) > 0 && len(hojasCSV) > 0 {
+		return nil, errors.New("El ZIP debe contener solo archivos CSV o solo archivos Excel")
+	}
+
+	if len(hojasCSV) > 0 {
+		libro, err := mapeo.LibroDesdeCSV(hojasCSV, tipoDte, tipos, configuracion)
+		if err != nil {
+			return nil, fmt.Errorf("Error al convertir los CSV: %v", err)
+		}
+		return []libroRecibido{{nombre: nombre, contenido: libro}}, nil
+	}
+
+	if len(libros) == 0 {
+		return nil, errors.New("El ZIP no contiene archivos CSV ni Excel")
+	}
+
+	// Verificar que cada libro se pueda abrir antes de crear los lotes
+	for _, libro := range libros {
+		if _, err := xlsx.OpenBinary(libro.contenido); err != nil {
+			return nil, fmt.Errorf("El archivo %s del ZIP no es un archivo Excel válido", libro.nombre)
+		}
+	}
+	return libros, nil
+}
+
+func leerArchivoZIP(archivo *zip.File) ([]byte, error) {
+	lector, err := archivo.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer lector.Close()
+	return io.ReadAll(io.LimitReader(lector, maxTamanoDescomprimido))
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/mapeo"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCSVSueltoEsHojaRaiz(t *testing.T) {
+	csv := []byte("IDDTE,CodigoCondicionOperacion\n1,1\n")
+	libros, err := librosRecibidos("facturas.csv", csv, "01", mapeo.TiposColumna{}, &mapeo.Configuracion{})
+	if err != nil {
+		t.Fatalf("El CSV suelto debería aceptarse: %v", err)
+	}
+	if len(libros) != 1 || tipoContenido(libros[0].contenido) != contenidoXLSX {
+		t.Fatalf("Se esperaba un libro de Excel armado con el CSV, se obtuvieron %d libros", len(libros))
+	}
+}
+
+func TestMoverSalidaSoloDelLote(t *testing.T) {
+	directorio := t.TempDir()
+	trabajo, _ := os.Getwd()
+	defer os.Chdir(trabajo)
+	os.Chdir(directorio)
+
+	// Dos conversiones simultáneas con su propio directorio de salida
+	for _, nombre := range []string{"1022_Lote_001", "1022_Lote_002"} {
+		dirConversion := filepath.Join(directorio, nombre)
+		os.MkdirAll(dirConversion, 0755)
+		os.WriteFile(filepath.Join(dirConversion, nombre+".json"), []byte("{}"), 0644)
+		os.WriteFile(filepath.Join(dirConversion, nombre+"20240101120000.csv"), nil, 0644)
+	}
+
+	ruta, err := moverSalida(filepath.Join(directorio, "1022_Lote_002"), "1022_Lote_002")
+	if err != nil {
+		t.Fatalf("Error al mover la salida: %v", err)
+	}
+	if ruta != filepath.Join("data", "responseJSON", "1022_Lote_002.json") {
+		t.Errorf("Ruta inesperada del JSON: %s", ruta)
+	}
+	if _, err := os.Stat(ruta); err != nil {
+		t.Errorf("El JSON del lote no se movió: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(directorio, "1022_Lote_001", "1022_Lote_001.json")); err != nil {
+		t.Error("La salida de otra conversión no debería moverse")
+	}
+	if _, err := moverSalida(filepath.Join(directorio, "1022_Lote_003"), "1022_Lote_003"); err == nil {
+		t.Error("Se esperaba un error cuando la conversión no generó el JSON")
+	}
+}
+
+func TestMoverSalidaDesdeOtraRaiz(t *testing.T) {
+	// La conversión y el directorio de trabajo del servicio están en raíces distintas
+	dirConversion := filepath.Join(t.TempDir(), "1022_Lote_004")
+	trabajo, _ := os.Getwd()
+	defer os.Chdir(trabajo)
+	os.Chdir(t.TempDir())
+
+	os.MkdirAll(dirConversion, 0755)
+	os.WriteFile(filepath.Join(dirConversion, "1022_Lote_004.json"), []byte(`{"Lote": 4}`), 0644)
+	os.WriteFile(filepath.Join(dirConversion, "1022_Lote_00420240101120000.csv"), []byte("IDDTE\n"), 0644)
+
+	ruta, err := moverSalida(dirConversion, "1022_Lote_004")
+	if err != nil {
+		t.Fatalf("Error al mover la salida: %v", err)
+	}
+	if contenido, err := os.ReadFile(ruta); err != nil || string(contenido) != `{"Lote": 4}` {
+		t.Errorf("El JSON del lote no llegó completo: %q, %v", contenido, err)
+	}
+	if _, err := os.Stat(filepath.Join(dirConversion, "1022_Lote_004.json")); !os.IsNotExist(err) {
+		t.Error("El JSON original debería quitarse del directorio de la conversión")
+	}
+}
+
+func TestCopiarYBorrar(t *testing.T) {
+	origen := filepath.Join(t.TempDir(), "1022_Lote_005.json")
+	destino := filepath.Join(t.TempDir(), "1022_Lote_005.json")
+	os.WriteFile(origen, []byte("{}"), 0644)
+
+	if err := copiarYBorrar(origen, destino); err != nil {
+		t.Fatalf("Error al copiar el archivo: %v", err)
+	}
+	if contenido, err := os.ReadFile(destino); err != nil || string(contenido) != "{}" {
+		t.Errorf("La copia no coincide: %q, %v", contenido, err)
+	}
+	if _, err := os.Stat(origen); !os.IsNotExist(err) {
+		t.Error("El original debería borrarse después de copiarlo")
+	}
+	if err := copiarYBorrar(origen, destino); err == nil {
+		t.Error("Se esperaba un error cuando el original no existe")
+	}
+}
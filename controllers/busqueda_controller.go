@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/authentication"
+	"GoProcesadorExcel/busqueda"
+	"GoProcesadorExcel/documentos"
+	"GoProcesadorExcel/registro"
+	"GoProcesadorExcel/utils"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// documentoEncontrado es un IDDTE de la búsqueda con el documento que se envió
+type documentoEncontrado struct {
+	iddteConsultado
+	Documento map[string]interface{} `json:"documento"`
+}
+
+// HandleBuscarDocumentos busca los IDDTE de la empresa por ?codigoGeneracion=, ?numeroControl=, ?receptorNit= o
+// ?iddte= con el índice que se actualiza al guardar cada resultado. Con varios parámetros se devuelven los IDDTE
+// que cumplen todos. Cada IDDTE incluye el lote, el tipo de DTE, el estado guardado y el documento enviado.
+func HandleBuscarDocumentos(c *gin.Context, rdb *redis.Client) {
+	token := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(token)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	valores := make(map[string]string)
+	for _, campo := range busqueda.Campos {
+		if valor := strings.TrimSpace(c.Query(campo)); valor != "" {
+			valores[campo] = valor
+		}
+	}
+	if len(valores) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Indique codigoGeneracion, numeroControl, receptorNit o iddte"})
+		return
+	}
+
+	coincidencias, err := busqueda.Buscar(rdb, empid, valores)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	correlativos := make([]string, 0, len(coincidencias))
+	for _, coincidencia := range coincidencias {
+		correlativos = append(correlativos, coincidencia.Correlativo)
+	}
+	fechas, err := registro.Fechas(rdb, empid, correlativos)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Los documentos y los tipos se leen una vez por lote
+	documentosLotes := make(map[string]map[string]interface{})
+	tiposLotes := make(map[string]map[string]string)
+	encontrados := []documentoEncontrado{}
+	var vencidas []busqueda.Coincidencia
+	for _, coincidencia := range coincidencias {
+		correlativo := coincidencia.Correlativo
+		valor, err := rdb.HGet(context.Background(), fmt.Sprintf("%s_Lote_%s", empid, correlativo), coincidencia.IDDTE).Result()
+		if err == redis.Nil {
+			// El lote venció después de registrarse en el índice
+			vencidas = append(vencidas, coincidencia)
+			continue
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error al obtener el estado de %s del Lote_%s", coincidencia.IDDTE, correlativo)})
+			return
+		}
+
+		if _, ok := documentosLotes[correlativo]; !ok {
+			documentosLote, err := documentos.Leer(empid, correlativo)
+			if err != nil {
+				log.Printf("No se pudieron leer los documentos del Lote_%s para la búsqueda: %v\n", correlativo, err)
+			}
+			documentosLotes[correlativo] = documentosLote
+			tiposLotes[correlativo] = utils.ObtenerTiposLote(rdb, empid, correlativo)
+		}
+
+		numero, _ := strconv.Atoi(correlativo)
+		documento, _ := documentosLotes[correlativo][strings.TrimPrefix(coincidencia.IDDTE, "IDDTE-")].(map[string]interface{})
+		encontrados = append(encontrados, documentoEncontrado{
+			iddteConsultado: nuevoIddteConsultado("Lote_"+correlativo, numero, coincidencia.IDDTE, valor, tiposLotes[correlativo][coincidencia.IDDTE], fechas[correlativo]),
+			Documento:       documento,
+		})
+	}
+	busqueda.Quitar(rdb, empid, valores, vencidas)
+
+	c.JSON(http.StatusOK, gin.H{"documentos": encontrados, "total": len(encontrados)})
+}
@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/authentication"
+	"GoProcesadorExcel/clasificacion"
+	"GoProcesadorExcel/documentos"
+	"GoProcesadorExcel/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// solicitudReintento es el cuerpo opcional de POST /lotes/:correlativo/retry
+type solicitudReintento struct {
+	IDDTEs []string `json:"iddtes"`
+}
+
+// HandleConciliacion devuelve los documentos pendientes de conciliación y los estados que la conciliación actualizó
+func HandleConciliacion(c *gin.Context, rdb *redis.Client) {
+
+	token := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(token)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	pendientes, err := utils.ListarPendientesConciliacion(rdb, empid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sort.Slice(pendientes, func(i, j int) bool { return pendientes[i].Fecha.Before(pendientes[j].Fecha) })
+
+	cambios, err := utils.ListarCambiosConciliacion(rdb, empid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pendientes": pendientes, "cambios": cambios})
+}
+
+// HandleReintentarLote vuelve a enviar los documentos fallidos de un lote. Sin cuerpo se reintentan los que las
+// reglas de clasificación marcan como reintentables (por omisión los que fallaron por timeout, 5xx o que la
+// conciliación no encontró); los pendientes de conciliación nunca se reenvían.
+func HandleReintentarLote(c *gin.Context, rdb *redis.Client) {
+
+	authToken := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(authToken)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	correlativo := c.Param("correlativo")
+	numero, err := strconv.Atoi(correlativo)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Correlativo no válido"})
+		return
+	}
+
+	var solicitud solicitudReintento
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&solicitud); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cuerpo de la solicitud inválido: %v", err)})
+			return
+		}
+	}
+
+	nombreLote := fmt.Sprintf("%s_Lote_%s", empid, correlativo)
+	estados, err := rdb.HGetAll(context.Background(), nombreLote).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los estados del lote"})
+		return
+	}
+	if len(estados) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No existe un lote con el correlativo %s", correlativo)})
+		return
+	}
+
+	documentosLote, err := documentos.Leer(empid, correlativo)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No se encontraron los documentos del lote"})
+		return
+	}
+	tipos := utils.ObtenerTiposLote(rdb, empid, correlativo)
+
+	// Sin IDDTE indicados se revisan todos los del lote
+	seleccion := solicitud.IDDTEs
+	explicitos := len(seleccion) > 0
+	if !explicitos {
+		for clave := range estados {
+			seleccion = append(seleccion, clave)
+		}
+	}
+	sort.Strings(seleccion)
+
+	reintentos := make(map[string]interface{})
+	rechazados := []gin.H{}
+	tipoLote := ""
+	for _, clave := range seleccion {
+		if !strings.HasPrefix(clave, "IDDTE-") {
+			clave = "IDDTE-" + clave
+		}
+		valor, ok := estados[clave]
+		if !ok {
+			rechazados = append(rechazados, gin.H{"iddte": clave, "error": "El IDDTE no existe en el lote"})
+			continue
+		}
+		if utils.PendienteConciliacion(rdb, empid, nombreLote, clave) {
+			rechazados = append(rechazados, gin.H{"iddte": clave, "error": "El documento está pendiente de conciliación"})
+			continue
+		}
+
+		estado := parsearEstado(valor)
+		if estado.procesado() || estado.Codigo == http.StatusAccepted {
+			if explicitos {
+				rechazados = append(rechazados, gin.H{"iddte": clave, "error": "El documento ya fue procesado o está en contingencia"})
+			}
+			continue
+		}
+		if !explicitos && !clasificacion.Predeterminado().ClasificarEstado(valor).Reintentable {
+			continue
+		}
+
+		id := strings.TrimPrefix(clave, "IDDTE-")
+		documento, ok := documentosLote[id].(map[string]interface{})
+		if !ok {
+			rechazados = append(rechazados, gin.H{"iddte": clave, "error": "No se encontró el documento enviado"})
+			continue
+		}
+		// Conservar el tipo con el que se envió el documento la primera vez
+		if tipo := tipos[clave]; tipo != "" {
+			documento["TipoDte"] = tipo
+			tipoLote = tipo
+		}
+		reintentos[id] = documento
+	}
+
+	if len(reintentos) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No hay documentos para reintentar", "rechazados": rechazados})
+		return
+	}
+
+	reintentosDir := filepath.Join("data", "reintentos")
+	if err := os.MkdirAll(reintentosDir, 0755); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear carpeta para los reintentos"})
+		return
+	}
+	contenido, err := json.Marshal(reintentos)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar los documentos a reintentar"})
+		return
+	}
+	dt := time.Now()
+	rutaArchivoJSON := filepath.Join(reintentosDir, fmt.Sprintf("%s_%d.json", nombreLote, dt.Unix()))
+	if err := os.WriteFile(rutaArchivoJSON, contenido, 0644); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar los documentos a reintentar"})
+		return
+	}
+
+	logEntry := fmt.Sprintf("\n%s - %s_Lote: %s - Reintento de %d documentos\n", dt.Format(time.Stamp), empid, correlativo, len(reintentos))
+	logWrite(logEntry, "")
+	logWrite("", "<==========================================>\n")
+
+	// El reintento usa el mismo lote para reutilizar los identificadores asignados y sobrescribir los estados
+	go func() {
+		utils.ProcesarArchivoJSON(rutaArchivoJSON, tipoLote, authToken, rdb, numero)
+		if err := os.Remove(rutaArchivoJSON); err != nil {
+			log.Printf("Error al eliminar el archivo de reintento %s: %v\n", rutaArchivoJSON, err)
+		}
+	}()
+
+	ids := make([]string, 0, len(reintentos))
+	for id := range reintentos {
+		ids = append(ids, "IDDTE-"+id)
+	}
+	sort.Strings(ids)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Se están reintentando los documentos",
+		"lote":       fmt.Sprintf("Lote_%s", correlativo),
+		"reintentos": ids,
+		"rechazados": rechazados,
+	})
+}
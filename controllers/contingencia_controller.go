@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/authentication"
+	"GoProcesadorExcel/contingencia"
+	"GoProcesadorExcel/utils"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// solicitudContingencia es el cuerpo de POST /contingencia/activar
+type solicitudContingencia struct {
+	TipoContingencia   int    `json:"tipoContingencia"`
+	MotivoContingencia string `json:"motivoContingencia"`
+}
+
+// HandleEstadoContingencia devuelve la contingencia activa de la empresa, sus eventos y el estado de la API
+func HandleEstadoContingencia(c *gin.Context, rdb *redis.Client) {
+
+	token := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(token)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	activo, err := contingencia.ObtenerActivo(rdb, empid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	eventos, err := contingencia.ListarEventos(rdb, empid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	circuito := gin.H{"abierto": false}
+	if desde, abierto := contingencia.CircuitoAbierto(); abierto {
+		circuito = gin.H{"abierto": true, "desde": desde}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"activa": activo, "eventos": eventos, "circuito": circuito})
+}
+
+// HandleActivarContingencia activa manualmente la contingencia de la empresa
+func HandleActivarContingencia(c *gin.Context, rdb *redis.Client) {
+
+	token := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(token)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var solicitud solicitudContingencia
+	if err := c.ShouldBindJSON(&solicitud); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cuerpo de la solicitud inválido"})
+		return
+	}
+	if solicitud.TipoContingencia < 1 || solicitud.TipoContingencia > 5 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El tipo de contingencia debe estar entre 1 y 5"})
+		return
+	}
+	// El tipo 5 (otro) requiere describir el motivo
+	if solicitud.TipoContingencia == 5 && strings.TrimSpace(solicitud.MotivoContingencia) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El motivo es obligatorio para el tipo de contingencia 5"})
+		return
+	}
+
+	evento, err := contingencia.Activar(rdb, empid, solicitud.TipoContingencia, strings.TrimSpace(solicitud.MotivoContingencia), contingencia.OrigenOperador)
+	if err == contingencia.ErrContingenciaActiva {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Contingencia %s activada por el operador de la empresa %s\n", evento.CodigoGeneracion, empid)
+	c.JSON(http.StatusOK, gin.H{"message": "Contingencia activada", "evento": evento})
+}
+
+// HandleDesactivarContingencia cierra la contingencia activa y transmite el evento y sus documentos
+func HandleDesactivarContingencia(c *gin.Context, rdb *redis.Client) {
+
+	token := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(token)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	evento, err := contingencia.Cerrar(rdb, empid)
+	if err == contingencia.ErrSinContingencia {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	go transmitirContingencia(rdb, empid, token, evento.CodigoGeneracion)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Contingencia cerrada, se está transmitiendo el evento", "evento": evento})
+}
+
+// HandleTransmitirContingencia reintenta la transmisión de un evento de contingencia cerrado
+func HandleTransmitirContingencia(c *gin.Context, rdb *redis.Client) {
+
+	token := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(token)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	evento, err := contingencia.ObtenerEvento(rdb, empid, c.Param("codigo"))
+	if err == contingencia.ErrEventoNoExiste {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if evento.Estado != contingencia.EstadoCerrada && evento.Estado != contingencia.EstadoReportada {
+		c.JSON(http.StatusConflict, gin.H{"error": "El evento no está pendiente de transmisión", "evento": evento})
+		return
+	}
+
+	go transmitirContingencia(rdb, empid, token, evento.CodigoGeneracion)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Se está transmitiendo el evento de contingencia", "evento": evento})
+}
+
+func transmitirContingencia(rdb *redis.Client, empid string, token string, codigo string) {
+	if err := utils.TransmitirContingencia(rdb, empid, token, codigo); err != nil {
+		log.Printf("Error al transmitir el evento de contingencia %s: %v\n", codigo, err)
+	}
+}
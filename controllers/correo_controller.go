@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/correo"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// HandleObtenerPlantillaCorreo devuelve la plantilla de correo de una empresa
+func HandleObtenerPlantillaCorreo(c *gin.Context, rdb *redis.Client) {
+	if !validarAdmin(c) {
+		return
+	}
+
+	plantilla, err := correo.ObtenerPlantilla(rdb, c.Param("empid"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"plantilla": plantilla, "smtp": correo.Habilitado()})
+}
+
+// HandleGuardarPlantillaCorreo guarda la plantilla de correo de una empresa
+func HandleGuardarPlantillaCorreo(c *gin.Context, rdb *redis.Client) {
+	if !validarAdmin(c) {
+		return
+	}
+
+	var plantilla correo.Plantilla
+	if err := c.ShouldBindJSON(&plantilla); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cuerpo de la solicitud inválido"})
+		return
+	}
+
+	if err := correo.GuardarPlantilla(rdb, c.Param("empid"), plantilla); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Plantilla de correo guardada"})
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/authentication"
+	"GoProcesadorExcel/eventos"
+	"GoProcesadorExcel/registro"
+	"GoProcesadorExcel/utils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// HandleEnvioLote recibe los documentos de un lote ya convertidos a JSON, con el mismo formato que genera
+// el conversor de Excel (un objeto con los documentos por IDDTE) o en NDJSON, un documento por línea con
+// su campo IDDTE, y los envía como un lote nuevo
+func HandleEnvioLote(c *gin.Context, rdb *redis.Client) {
+
+	authToken := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(authToken)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	tipoDte := c.GetHeader("tipoDte")
+	if tipoDte == "" {
+		tipoDte = c.Query("tipoDte")
+	}
+	if tipoDte == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Falta el parámetro tipoDte"})
+		return
+	}
+	if !utils.TipoDteSoportado(tipoDte) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Tipo de DTE no válido: %s", tipoDte)})
+		return
+	}
+
+	cuerpo, err := io.ReadAll(io.LimitReader(c.Request.Body, maxTamanoArchivo+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No se pudo leer el cuerpo de la solicitud"})
+		return
+	}
+	if len(cuerpo) > maxTamanoArchivo {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El lote supera el tamaño máximo permitido"})
+		return
+	}
+
+	var documentos map[string]interface{}
+	if esNDJSON(c.ContentType()) {
+		documentos, err = documentosDesdeNDJSON(cuerpo)
+	} else {
+		documentos, err = documentosDesdeJSON(cuerpo)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Generar el correlativo del lote igual que en la conversión de Excel
+	correlativo, err := generateCorrelativo(rdb, empid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar el correlativo"})
+		return
+	}
+
+	// Guardar los documentos donde el conversor deja los JSON para que los reportes los encuentren
+	responseJSONDir := "data/responseJSON"
+	if err := os.MkdirAll(responseJSONDir, 0755); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear carpeta para archivos JSON"})
+		return
+	}
+
+	contenido, err := json.Marshal(documentos)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar los documentos del lote"})
+		return
+	}
+
+	rutaArchivoJSON := filepath.Join(responseJSONDir, fmt.Sprintf("%s_Lote_%03d.json", empid, correlativo))
+	if err := os.WriteFile(rutaArchivoJSON, contenido, 0644); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar los documentos del lote"})
+		return
+	}
+
+	// Registrar el estado del lote con el mismo formato que los lotes convertidos desde Excel
+	dt := time.Now()
+	nombreEstado := fmt.Sprintf("%s_Lote_%03d.json:%s", empid, correlativo, tipoDte)
+	expiration := 3 * 30 * 24 * time.Hour
+	if err := rdb.Set(context.Background(), nombreEstado, fmt.Sprintln("Lote recibido en formato JSON"), expiration).Err(); err != nil {
+		log.Println("Error al guardar el estado en el historial de Redis:", err)
+	}
+	registro.RegistrarArchivo(rdb, nombreEstado)
+
+	logEntry := fmt.Sprintf("\n%s - %s_Lote: %03d - Lote recibido en formato JSON con %d documentos\n", dt.Format(time.Stamp), empid, correlativo, len(documentos))
+	logWrite(logEntry, "")
+	logWrite("", "<==========================================>\n")
+
+	eventos.Fase(rdb, empid, fmt.Sprintf("%03d", correlativo), eventos.FaseRecibido, gin.H{"origen": "json", "tipoDte": tipoDte, "documentos": len(documentos)})
+
+	// Enviar los documentos a la API en segundo plano
+	go utils.ProcesarArchivoJSON(rutaArchivoJSON, tipoDte, authToken, rdb, correlativo)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "El lote se está procesando",
+		"lote":        fmt.Sprintf("Lote_%03d", correlativo),
+		"correlativo": correlativo,
+		"documentos":  len(documentos),
+	})
+}
+
+// esNDJSON indica si el tipo de contenido corresponde a un documento JSON por línea
+func esNDJSON(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	return strings.Contains(contentType, "ndjson") || strings.Contains(contentType, "jsonl") || strings.Contains(contentType, "json-seq")
+}
+
+// documentosDesdeJSON lee un objeto con los documentos indexados por IDDTE
+func documentosDesdeJSON(cuerpo []byte) (map[string]interface{}, error) {
+	var documentos map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(cuerpo))
+	decoder.UseNumber()
+	if err := decoder.Decode(&documentos); err != nil {
+		return nil, fmt.Errorf("El cuerpo debe ser un objeto JSON con los documentos por IDDTE: %v", err)
+	}
+	if len(documentos) == 0 {
+		return nil, errors.New("El lote no contiene documentos")
+	}
+
+	for id, documento := range documentos {
+		if _, ok := documento.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("El documento del IDDTE %s debe ser un objeto JSON", id)
+		}
+	}
+	return documentos, nil
+}
+
+// documentosDesdeNDJSON lee un documento por línea; el IDDTE se toma del campo IDDTE del documento
+func documentosDesdeNDJSON(cuerpo []byte) (map[string]interface{}, error) {
+	documentos := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(cuerpo))
+	decoder.UseNumber()
+
+	for linea := 1; ; linea++ {
+		var documento map[string]interface{}
+		err := decoder.Decode(&documento)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error en el documento %d: %v", linea, err)
+		}
+
+		idValor, ok := documento["IDDTE"]
+		if !ok || idValor == nil || fmt.Sprint(idValor) == "" {
+			return nil, fmt.Errorf("El documento %d no tiene el campo IDDTE", linea)
+		}
+		id := fmt.Sprint(idValor)
+		if _, existe := documentos[id]; existe {
+			return nil, fmt.Errorf("El IDDTE %s está repetido en el documento %d", id, linea)
+		}
+
+		delete(documento, "IDDTE")
+		documentos[id] = documento
+	}
+
+	if len(documentos) == 0 {
+		return nil, errors.New("El lote no contiene documentos")
+	}
+	return documentos, nil
+}
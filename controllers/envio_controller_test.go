@@ -0,0 +1,40 @@
+package controllers
+
+import "testing"
+
+func TestDocumentosDesdeNDJSON(t *testing.T) {
+	cuerpo := []byte(`{"IDDTE": 1, "Receptor": {"Nombre": "Cliente"}}
+{"IDDTE": "2", "Receptor": {"Nombre": "Otro"}}
+`)
+
+	documentos, err := documentosDesdeNDJSON(cuerpo)
+	if err != nil {
+		t.Fatalf("Error al leer el NDJSON: %v", err)
+	}
+	if len(documentos) != 2 {
+		t.Fatalf("Se esperaban 2 documentos, se obtuvieron %d", len(documentos))
+	}
+	documento, ok := documentos["1"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("El documento del IDDTE 1 no se encontró: %v", documentos)
+	}
+	if _, ok := documento["IDDTE"]; ok {
+		t.Error("El campo IDDTE no debería enviarse dentro del documento")
+	}
+
+	if _, err := documentosDesdeNDJSON([]byte("{\"IDDTE\": 1}\n{\"IDDTE\": 1}\n")); err == nil {
+		t.Error("Se esperaba un error por el IDDTE repetido")
+	}
+	if _, err := documentosDesdeNDJSON([]byte(`{"Receptor": {}}`)); err == nil {
+		t.Error("Se esperaba un error por la falta del IDDTE")
+	}
+}
+
+func TestDocumentosDesdeJSON(t *testing.T) {
+	if _, err := documentosDesdeJSON([]byte(`{"1": {"Receptor": {}}}`)); err != nil {
+		t.Errorf("Error inesperado: %v", err)
+	}
+	if _, err := documentosDesdeJSON([]byte(`{"1": "texto"}`)); err == nil {
+		t.Error("Se esperaba un error por un documento que no es un objeto")
+	}
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/authentication"
+	"GoProcesadorExcel/eventos"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// intervaloLatido es cada cuánto se envía un comentario para mantener abierta la conexión
+const intervaloLatido = 15 * time.Second
+
+// tokenSolicitud obtiene el token del encabezado o, para EventSource y WebSocket que no permiten
+// encabezados en el navegador, del parámetro token
+func tokenSolicitud(c *gin.Context) string {
+	if token := c.GetHeader("Authorization"); token != "" {
+		return token
+	}
+	return c.Query("token")
+}
+
+// HandleEventosLote transmite con Server-Sent Events las fases y los resultados de los IDDTE de un lote.
+// Primero reenvía el historial posterior a Last-Event-ID y luego los eventos nuevos hasta el resumen final.
+func HandleEventosLote(c *gin.Context, rdb *redis.Client) {
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(tokenSolicitud(c))
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	correlativo := c.Param("correlativo")
+	ultimo := c.GetHeader("Last-Event-ID")
+	if ultimo == "" {
+		ultimo = c.Query("lastEventId")
+	}
+
+	// Suscribirse antes de leer el historial para no perder los eventos publicados entre ambos pasos
+	ctx := c.Request.Context()
+	suscripcion := rdb.Subscribe(ctx, eventos.Canal(empid))
+	defer suscripcion.Close()
+	if _, err := suscripcion.Receive(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al suscribirse a los eventos del lote"})
+		return
+	}
+
+	historial, err := eventos.Historial(rdb, empid, correlativo, ultimo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(historial) == 0 && ultimo == "" {
+		existe, _ := rdb.Exists(context.Background(), fmt.Sprintf("%s_Lote_%s", empid, correlativo)).Result()
+		if existe == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No existe un lote con el correlativo %s", correlativo)})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	terminado := false
+	for _, evento := range historial {
+		if err := escribirEvento(c, evento); err != nil {
+			return
+		}
+		ultimo = evento.ID
+		terminado = evento.Tipo == eventos.TipoResumen
+	}
+	c.Writer.Flush()
+	// Un lote ya terminado no tiene más eventos
+	if terminado {
+		return
+	}
+
+	mensajes := suscripcion.Channel()
+	latido := time.NewTicker(intervaloLatido)
+	defer latido.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-latido.C:
+			if _, err := fmt.Fprint(c.Writer, ": latido\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case mensaje, ok := <-mensajes:
+			if !ok {
+				return
+			}
+			evento, err := eventos.Decodificar(mensaje.Payload)
+			if err != nil || evento.Correlativo != correlativo || !eventos.Posterior(evento.ID, ultimo) {
+				continue
+			}
+			if err := escribirEvento(c, evento); err != nil {
+				log.Printf("Error al transmitir el evento del lote %s: %v\n", correlativo, err)
+				return
+			}
+			c.Writer.Flush()
+			ultimo = evento.ID
+			if evento.Tipo == eventos.TipoResumen {
+				return
+			}
+		}
+	}
+}
+
+func escribirEvento(c *gin.Context, evento eventos.Evento) error {
+	return sse.Encode(c.Writer, sse.Event{
+		Id:    evento.ID,
+		Event: evento.Tipo,
+		Data:  evento,
+	})
+}
@@ -2,17 +2,22 @@ package controllers
 
 import (
 	"GoProcesadorExcel/authentication"
+	"GoProcesadorExcel/eventos"
+	"GoProcesadorExcel/mapeo"
+	"GoProcesadorExcel/registro"
 	"GoProcesadorExcel/utils"
+	"GoProcesadorExcel/webhooks"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
-	"path"
 	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -46,55 +51,156 @@ func HandleExcelConversion(c *gin.Context, rdb *redis.Client) {
 	}
 	defer file.Close()
 
-	if path.Ext(fileHeader.Filename) != ".xlsx" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "El archivo no es un archivo Excel"})
+	contenido, err := io.ReadAll(io.LimitReader(file, maxTamanoArchivo+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No se pudo leer el archivo recibido"})
+		return
+	}
+	if len(contenido) > maxTamanoArchivo {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El archivo supera el tamaño máximo permitido"})
+		return
+	}
+
+	// Obtener el mapeo activo de la empresa y los tipos de columna
+	configuracion, err := mapeo.ObtenerConfiguracion(rdb, empid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el mapeo de la empresa"})
+		return
+	}
+	tipos, err := mapeo.CargarTipos()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los tipos de columna"})
+		return
+	}
+
+	// Identificar el contenido por sus bytes: un libro de Excel o un ZIP con CSVs o con varios libros
+	libros, err := librosRecibidos(fileHeader.Filename, contenido, tipoDte, tipos, configuracion)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	var lotes []loteCreado
+	var errores []gin.H
+	for _, libro := range libros {
+		lote, status, err := iniciarConversion(rdb, empid, tipoDte, authToken, libro, tipos, configuracion)
+		if err != nil {
+			if len(libros) == 1 {
+				c.JSON(status, gin.H{"error": err.Error()})
+				return
+			}
+			errores = append(errores, gin.H{"archivo": libro.nombre, "error": err.Error()})
+			continue
+		}
+		lotes = append(lotes, lote)
+	}
+
+	if len(lotes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No se pudo crear ningún lote", "errores": errores})
+		return
+	}
+
+	// Devolver una respuesta al cliente indicando que el archivo se está procesando
+	response := gin.H{"message": "El archivo se está procesando", "lotes": lotes}
+	if len(lotes) == 1 {
+		response["encabezados"] = lotes[0].Encabezados
+	}
+	if len(errores) > 0 {
+		response["errores"] = errores
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// iniciarConversion guarda un libro como un nuevo lote y lanza su conversión y envío en segundo plano
+func iniciarConversion(rdb *redis.Client, empid string, tipoDte string, authToken string, libro libroRecibido, tipos mapeo.TiposColumna, configuracion *mapeo.Configuracion) (loteCreado, int, error) {
+
 	// Crear una carpeta temporal para almacenar los archivos recibidos
 	tempDir := "data/archivos_excel"
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear carpeta temporal"})
-		return
+		return loteCreado{}, http.StatusInternalServerError, errors.New("Error al crear carpeta temporal")
 	}
 
 	// Generar el nombre del archivo con el formato Lote_{correlativo}
 	correlativo, err := generateCorrelativo(rdb, empid)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar el correlativo"})
-		return
+		return loteCreado{}, http.StatusInternalServerError, errors.New("Error al generar el correlativo")
 	}
 	nombreArchivo := fmt.Sprintf("%s_Lote_%03d.xlsx", empid, correlativo)
 	tempFilePath := filepath.Join(tempDir, nombreArchivo)
-	tempFile, err := os.Create(tempFilePath)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear archivo temporal"})
-		return
-	}
-	defer tempFile.Close()
 
 	// Escribir el archivo en el sistema de archivos
-	_, err = io.Copy(tempFile, file)
+	if err := os.WriteFile(tempFilePath, libro.contenido, 0644); err != nil {
+		return loteCreado{}, http.StatusInternalServerError, errors.New("Error al guardar archivo Excel")
+	}
+
+	// Guardar el mapeo de la empresa para el script de Python
+	mapeoFilePath := filepath.Join("data", "mapeos", fmt.Sprintf("%s_Lote_%03d.json", empid, correlativo))
+	if err := configuracion.EscribirArchivo(mapeoFilePath); err != nil {
+		return loteCreado{}, http.StatusInternalServerError, errors.New("Error al guardar el mapeo de la empresa")
+	}
+
+	// Normalizar los encabezados del libro a los nombres de campo del DTE
+	encabezados, err := mapeo.NormalizarLibro(tempFilePath, tipoDte, tipos, configuracion)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar archivo Excel"})
-		return
+		return loteCreado{}, http.StatusBadRequest, errors.New("El archivo no es un archivo Excel válido")
 	}
+	resumenEncabezados := mapeo.ResumenNormalizacion(encabezados)
 
-	// Devolver una respuesta al cliente indicando que el archivo se está procesando
-	c.JSON(http.StatusOK, gin.H{"message": "El archivo se está procesando"})
+	lote := loteCreado{
+		Lote:        fmt.Sprintf("Lote_%03d", correlativo),
+		Correlativo: correlativo,
+		Archivo:     libro.nombre,
+		Encabezados: encabezados,
+	}
 
-	// Llamar al script de Python para procesar el archivo Excel
-	cmd := exec.Command("python", "./utils/excelProcessor.py", tempFilePath, tipoDte, empid)
+	eventos.Fase(rdb, empid, fmt.Sprintf("%03d", correlativo), eventos.FaseRecibido, gin.H{"archivo": libro.nombre, "tipoDte": tipoDte})
+
+	// El script escribe el JSON y el CSV de errores en su directorio de trabajo; cada conversión usa su
+	// propio directorio para que las conversiones simultáneas no se mezclen los archivos generados. El
+	// directorio está dentro de data para que la salida se mueva sin cambiar de sistema de archivos.
+	if err := os.MkdirAll(dirConversiones, 0755); err != nil {
+		return loteCreado{}, http.StatusInternalServerError, errors.New("Error al crear carpeta temporal")
+	}
+	dirConversion, err := os.MkdirTemp(dirConversiones, fmt.Sprintf("%s_Lote_%03d_", empid, correlativo))
+	if err != nil {
+		return loteCreado{}, http.StatusInternalServerError, errors.New("Error al crear carpeta temporal")
+	}
+	cmd, err := comandoConversion(dirConversion, tempFilePath, tipoDte, empid, mapeoFilePath)
+	if err != nil {
+		os.RemoveAll(dirConversion)
+		return loteCreado{}, http.StatusInternalServerError, errors.New("Error al preparar la conversión")
+	}
 
 	// Capturar la salida estándar y la salida de error del proceso
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
 
 	dt := time.Now()
 
 	go func() {
+		defer os.RemoveAll(dirConversion)
+
+		// conversionFallida guarda el error en Redis y avisa que el lote no se va a enviar
+		conversionFallida := func(errMsg string) {
+			// Guardar el estado con expiración
+			err := rdb.Set(context.Background(), nombreArchivo, errMsg, 24*time.Hour).Err()
+			if err != nil {
+				log.Println("Error al guardar el estado en el historial de Redis:", err)
+			}
+			registro.RegistrarArchivo(rdb, nombreArchivo)
+			eventos.Fase(rdb, empid, fmt.Sprintf("%03d", correlativo), eventos.FaseConversionFallida, gin.H{"error": errMsg})
+			webhooks.Disparar(rdb, empid, webhooks.EventoConversionFallida, gin.H{
+				"lote":        lote.Lote,
+				"correlativo": fmt.Sprintf("%03d", correlativo),
+				"archivo":     libro.nombre,
+				"tipoDte":     tipoDte,
+				"error":       errMsg,
+			})
+		}
 
-		err = cmd.Run()
+		eventos.Fase(rdb, empid, fmt.Sprintf("%03d", correlativo), eventos.FaseConvirtiendo, nil)
+		err := cmd.Run()
 		if err != nil {
 			// Si la ejecución del script no fue exitosa, guardar un mensaje de error en Redis
 			errMsg := fmt.Sprintf("Error en la conversión: %v. Detalles: %s\n", err, stderr.String())
@@ -103,24 +209,34 @@ func HandleExcelConversion(c *gin.Context, rdb *redis.Client) {
 			logWrite(logEntry, stdout.String())
 			logWrite("", "<===========================================>\n")
 
-			// Guardar el estado con expiración
-			err = rdb.Set(context.Background(), nombreArchivo, errMsg, 24*time.Hour).Err()
-			if err != nil {
-				log.Println("Error al guardar el estado en el historial de Redis:", err)
-			}
+			conversionFallida(errMsg)
+			return
+		}
+
+		// Mover el JSON y el CSV de errores de esta conversión a sus carpetas
+		rutaArchivoJSON, err := moverSalida(dirConversion, fmt.Sprintf("%s_Lote_%03d", empid, correlativo))
+		if err != nil {
+			log.Printf("Error al mover los archivos generados del lote %s_Lote_%03d: %v\n", empid, correlativo, err)
+			conversionFallida(fmt.Sprintf("Error en la conversión: no se pudo obtener el archivo generado: %v\n", err))
 			return
 		}
 
+		// Las columnas desconocidas o faltantes se reportan junto con los inconvenientes del script
+		inconvenientes := stdout.String()
+		if resumenEncabezados != "" {
+			inconvenientes = resumenEncabezados + "\n" + inconvenientes
+		}
+
 		successMessage := ""
-		if stdout.String() == "" {
+		if inconvenientes == "" {
 			successMessage = fmt.Sprintln("Proceso de conversion exitoso")
-			logEntry := fmt.Sprintf("\n%s - %s_Lote: %03d - Proceso de conversión exitoso\n", dt.Format(time.Stamp), empid, correlativo)
+			logEntry := fmt.Sprintf("\n%s - %s_Lote: %03d - Proceso de conversión exitoso (mapeo versión %d)\n", dt.Format(time.Stamp), empid, correlativo, configuracion.Version)
 			logWrite(logEntry, "")
 			logWrite("", "<==========================================>\n")
 		} else {
-			successMessage = fmt.Sprintf("Proceso de conversion con inconvenientes \n %v", stdout.String())
-			logEntry := fmt.Sprintf("\n%s - %s_Lote: %03d - Proceso de conversión con inconvenientes\n", dt.Format(time.Stamp), empid, correlativo)
-			logWrite(logEntry, stdout.String())
+			successMessage = fmt.Sprintf("Proceso de conversion con inconvenientes \n %v", inconvenientes)
+			logEntry := fmt.Sprintf("\n%s - %s_Lote: %03d - Proceso de conversión con inconvenientes (mapeo versión %d)\n", dt.Format(time.Stamp), empid, correlativo, configuracion.Version)
+			logWrite(logEntry, inconvenientes)
 			logWrite("", "<==========================================>\n")
 		}
 		expiration := 3 * 30 * 24 * time.Hour
@@ -129,58 +245,21 @@ func HandleExcelConversion(c *gin.Context, rdb *redis.Client) {
 		if err != nil {
 			log.Println("Error al guardar el estado en el historial de Redis:", err)
 		}
-		// Mover archivos JSON y CSV a carpetas específicas
-		responseJSONDir := "data/responseJSON"
-		if err := os.MkdirAll(responseJSONDir, 0755); err != nil {
-			log.Println("Error al crear carpeta para archivos JSON:", err)
-			return
-		}
-
-		csvJSONDir := "data/csvErrors"
-		if err := os.MkdirAll(csvJSONDir, 0755); err != nil {
-			log.Println("Error al crear carpeta para archivos CSV:", err)
-			return
-		}
-
-		// Obtener los nombres de los archivos generados
-		files, err := filepath.Glob("*.json")
-		if err != nil {
-			log.Println("Error al obtener nombres de archivos JSON:", err)
-			return
-		}
-
-		// Mover archivos JSON a la carpeta responseJSON
-		for _, f := range files {
-			if err := moveFile(f, responseJSONDir); err != nil {
-				log.Println("Error al mover archivo JSON:", err)
-				return
-			}
-		}
-
-		// Obtener los nombres de los archivos generados
-		files, err = filepath.Glob("*.csv")
-		if err != nil {
-			log.Println("Error al obtener nombres de archivos CSV:", err)
-			return
-		}
-
-		// Mover archivos CSV a la carpeta csvErrors
-		for _, f := range files {
-			if err := moveFile(f, csvJSONDir); err != nil {
-				log.Println("Error al mover archivo CSV:", err)
-				return
-			}
-		}
-		// Obtener el nombre del archivo JSON basado en el correlativo
-		nombreArchivoJSON := fmt.Sprintf("%s_Lote_%03d.json", empid, correlativo)
-
-		// Construir la ruta completa del archivo JSON
-		rutaArchivoJSON := filepath.Join(responseJSONDir, nombreArchivoJSON)
-
+		registro.RegistrarArchivo(rdb, nombreArchivo+":"+tipoDte)
+		eventos.Fase(rdb, empid, fmt.Sprintf("%03d", correlativo), eventos.FaseConvertido, gin.H{"inconvenientes": inconvenientes})
+		webhooks.Disparar(rdb, empid, webhooks.EventoLoteConvertido, gin.H{
+			"lote":           lote.Lote,
+			"correlativo":    fmt.Sprintf("%03d", correlativo),
+			"archivo":        libro.nombre,
+			"tipoDte":        tipoDte,
+			"inconvenientes": inconvenientes,
+		})
 		// Llamar a la función para procesar el archivo JSON recibido y enviarlo a la API
 		utils.ProcesarArchivoJSON(rutaArchivoJSON, tipoDte, authToken, rdb, correlativo)
 
 	}()
+
+	return lote, http.StatusOK, nil
 }
 
 func generateCorrelativo(rdb *redis.Client, empid string) (int, error) {
@@ -192,6 +271,56 @@ func generateCorrelativo(rdb *redis.Client, empid string) (int, error) {
 	return int(val), nil
 }
 
+// comandoConversion prepara el script de Python para ejecutarse en dirConversion; las rutas se pasan
+// absolutas porque el directorio de trabajo del script ya no es el del servicio
+func comandoConversion(dirConversion string, rutaExcel string, tipoDte string, empid string, rutaMapeo string) (*exec.Cmd, error) {
+	rutas := []string{"./utils/excelProcessor.py", rutaExcel, rutaMapeo}
+	for i, ruta := range rutas {
+		absoluta, err := filepath.Abs(ruta)
+		if err != nil {
+			return nil, err
+		}
+		rutas[i] = absoluta
+	}
+
+	cmd := exec.Command("python", rutas[0], rutas[1], tipoDte, empid, rutas[2])
+	cmd.Dir = dirConversion
+	return cmd, nil
+}
+
+// dirConversiones contiene los directorios de trabajo de las conversiones en curso
+var dirConversiones = filepath.Join("data", "conversiones")
+
+// moverSalida mueve el JSON y los CSV de errores generados para un lote a data/responseJSON y
+// data/csvErrors, y devuelve la ruta final del JSON
+func moverSalida(dirConversion string, nombreLote string) (string, error) {
+	responseJSONDir := "data/responseJSON"
+	if err := os.MkdirAll(responseJSONDir, 0755); err != nil {
+		return "", fmt.Errorf("error al crear carpeta para archivos JSON: %v", err)
+	}
+
+	csvJSONDir := "data/csvErrors"
+	if err := os.MkdirAll(csvJSONDir, 0755); err != nil {
+		return "", fmt.Errorf("error al crear carpeta para archivos CSV: %v", err)
+	}
+
+	// El CSV lleva la fecha y hora de la conversión después del nombre del lote
+	archivosCSV, err := filepath.Glob(filepath.Join(dirConversion, nombreLote+"*.csv"))
+	if err != nil {
+		return "", fmt.Errorf("error al obtener nombres de archivos CSV: %v", err)
+	}
+	for _, f := range archivosCSV {
+		if err := moveFile(f, csvJSONDir); err != nil {
+			return "", fmt.Errorf("error al mover archivo CSV: %v", err)
+		}
+	}
+
+	if err := moveFile(filepath.Join(dirConversion, nombreLote+".json"), responseJSONDir); err != nil {
+		return "", fmt.Errorf("error al mover archivo JSON: %v", err)
+	}
+	return filepath.Join(responseJSONDir, nombreLote+".json"), nil
+}
+
 func moveFile(fileName, destDir string) error {
 	// Obtener el nombre del archivo sin la ruta
 	base := filepath.Base(fileName)
@@ -200,12 +329,41 @@ func moveFile(fileName, destDir string) error {
 	dst := filepath.Join(destDir, base)
 
 	err := os.Rename(src, dst)
+	if errors.Is(err, syscall.EXDEV) {
+		// El origen está en otro sistema de archivos; se copia y se borra
+		return copiarYBorrar(src, dst)
+	}
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// copiarYBorrar copia el archivo al destino y borra el original; si la copia falla se borra el destino
+// incompleto y se conserva el original
+func copiarYBorrar(src, dst string) error {
+	origen, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer origen.Close()
+
+	destino, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(destino, origen); err != nil {
+		destino.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := destino.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
 func logWrite(logentry string, stdout string) {
 	logFileName := "Lotelog.txt"
 	logFile, err := os.OpenFile(logFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -0,0 +1,407 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/clasificacion"
+	"GoProcesadorExcel/eventos"
+	"GoProcesadorExcel/registro"
+	"GoProcesadorExcel/utils"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// Límites de la página de GET /status/iddte
+const (
+	limitePredeterminadoIddte = 100
+	limiteMaximoIddte         = 1000
+)
+
+// lotesPorLectura es el número de lotes que se leen del índice en cada paso de la consulta ordenada por lote
+const lotesPorLectura = 20
+
+// maxLotesOrden es el número máximo de lotes que se cargan para ordenar por un campo distinto del lote, porque
+// ese orden necesita todos los IDDTE de la consulta
+const maxLotesOrden = 50
+
+// errConsultaAmplia indica que la consulta abarca demasiados lotes para ordenarla por un campo distinto del lote
+var errConsultaAmplia = fmt.Errorf("La consulta abarca más de %d lotes; acótela con loteDesde y loteHasta o con from y to para ordenar por un campo distinto del lote", maxLotesOrden)
+
+// parametrosConsultaIddte son los parámetros que activan la consulta paginada de GET /status/iddte; sin
+// ninguno de ellos se devuelve el historial completo como antes
+var parametrosConsultaIddte = []string{"limit", "cursor", "sort", "loteDesde", "loteHasta", "from", "to", "tipoDte", "codigo", "estado", "categoria"}
+
+// ordenesIddte son los campos por los que se puede ordenar; con el prefijo "-" el orden es descendente
+var ordenesIddte = map[string]bool{"lote": true, "codigo": true, "estado": true, "categoria": true, "tipoDte": true, "fecha": true}
+
+// consultaIddte son los filtros, el orden y la página de una consulta de IDDTE. Las listas vacías y los
+// límites en cero no filtran.
+type consultaIddte struct {
+	LoteDesde   int
+	LoteHasta   int
+	Desde       time.Time
+	Hasta       time.Time
+	TiposDte    []string
+	Codigos     []string
+	Estados     []string
+	Categorias  []string
+	Orden       string
+	Descendente bool
+	Limite      int
+	Cursor      *cursorIddte
+}
+
+// cursorIddte es la posición del último IDDTE de una página: el valor del campo de orden, el lote y el IDDTE
+type cursorIddte struct {
+	Orden string `json:"o"`
+	Valor string `json:"v"`
+	Lote  int    `json:"l"`
+	Iddte int    `json:"i"`
+}
+
+// iddteConsultado es un IDDTE en la respuesta de la consulta
+type iddteConsultado struct {
+	Lote      string `json:"lote"`
+	IDDTE     string `json:"iddte"`
+	TipoDte   string `json:"tipoDte,omitempty"`
+	Codigo    int    `json:"codigo"`
+	Estado    string `json:"estado"`
+	Categoria string `json:"categoria,omitempty"`
+	Fecha     string `json:"fecha,omitempty"`
+	Valor     string `json:"valor"`
+
+	numeroLote  int
+	numeroIddte int
+	fecha       time.Time
+}
+
+// consultaPaginada indica si la solicitud usa alguno de los parámetros de la consulta paginada
+func consultaPaginada(c *gin.Context) bool {
+	for _, parametro := range parametrosConsultaIddte {
+		if _, ok := c.GetQuery(parametro); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parsearConsultaIddte interpreta los parámetros de la consulta
+func parsearConsultaIddte(c *gin.Context) (consultaIddte, error) {
+	consulta := consultaIddte{
+		TiposDte:   listaParametro(c.Query("tipoDte")),
+		Codigos:    listaParametro(c.Query("codigo")),
+		Estados:    listaParametro(c.Query("estado")),
+		Categorias: listaParametro(c.Query("categoria")),
+		Orden:      "lote",
+		Limite:     limitePredeterminadoIddte,
+	}
+
+	var err error
+	if valor := c.Query("limit"); valor != "" {
+		if consulta.Limite, err = strconv.Atoi(valor); err != nil || consulta.Limite < 1 || consulta.Limite > limiteMaximoIddte {
+			return consulta, fmt.Errorf("El límite debe ser un número entre 1 y %d", limiteMaximoIddte)
+		}
+	}
+	if valor := c.Query("loteDesde"); valor != "" {
+		if consulta.LoteDesde, err = strconv.Atoi(valor); err != nil {
+			return consulta, errors.New("El lote inicial debe ser un número")
+		}
+	}
+	if valor := c.Query("loteHasta"); valor != "" {
+		if consulta.LoteHasta, err = strconv.Atoi(valor); err != nil {
+			return consulta, errors.New("El lote final debe ser un número")
+		}
+	}
+	if consulta.Desde, err = fechaParametro(c.Query("from")); err != nil {
+		return consulta, errors.New("Fecha inicial no válida, use el formato AAAA-MM-DD")
+	}
+	if consulta.Hasta, err = fechaParametro(c.Query("to")); err != nil {
+		return consulta, errors.New("Fecha final no válida, use el formato AAAA-MM-DD")
+	}
+
+	if orden := c.Query("sort"); orden != "" {
+		consulta.Descendente = strings.HasPrefix(orden, "-")
+		consulta.Orden = strings.TrimPrefix(orden, "-")
+		if !ordenesIddte[consulta.Orden] {
+			return consulta, fmt.Errorf("No se puede ordenar por %s", consulta.Orden)
+		}
+	}
+
+	if valor := c.Query("cursor"); valor != "" {
+		contenido, err := base64.RawURLEncoding.DecodeString(valor)
+		var cursor cursorIddte
+		if err != nil || json.Unmarshal(contenido, &cursor) != nil {
+			return consulta, errors.New("Cursor no válido")
+		}
+		if cursor.Orden != c.DefaultQuery("sort", "lote") {
+			return consulta, errors.New("El cursor no corresponde al orden solicitado")
+		}
+		consulta.Cursor = &cursor
+	}
+	return consulta, nil
+}
+
+// valorOrden devuelve el valor del IDDTE para el campo de orden; el lote y el IDDTE desempatan
+func (i iddteConsultado) valorOrden(orden string) string {
+	switch orden {
+	case "codigo":
+		return fmt.Sprintf("%04d", i.Codigo)
+	case "estado":
+		return i.Estado
+	case "categoria":
+		return i.Categoria
+	case "tipoDte":
+		return i.TipoDte
+	case "fecha":
+		return i.fecha.UTC().Format(time.RFC3339)
+	}
+	return ""
+}
+
+// compararIddte compara dos posiciones en orden ascendente
+func compararIddte(valorA string, loteA int, iddteA int, valorB string, loteB int, iddteB int) int {
+	switch {
+	case valorA != valorB:
+		return strings.Compare(valorA, valorB)
+	case loteA != loteB:
+		return loteA - loteB
+	}
+	return iddteA - iddteB
+}
+
+// ordenarYPaginar ordena los IDDTE y devuelve la página posterior al cursor y el cursor de la siguiente, vacío
+// si no hay más
+func (q consultaIddte) ordenarYPaginar(iddtes []iddteConsultado) ([]iddteConsultado, string) {
+	signo := 1
+	if q.Descendente {
+		signo = -1
+	}
+	sort.Slice(iddtes, func(a, b int) bool {
+		return signo*compararIddte(iddtes[a].valorOrden(q.Orden), iddtes[a].numeroLote, iddtes[a].numeroIddte,
+			iddtes[b].valorOrden(q.Orden), iddtes[b].numeroLote, iddtes[b].numeroIddte) < 0
+	})
+
+	inicio := 0
+	if q.Cursor != nil {
+		inicio = sort.Search(len(iddtes), func(i int) bool {
+			return signo*compararIddte(iddtes[i].valorOrden(q.Orden), iddtes[i].numeroLote, iddtes[i].numeroIddte,
+				q.Cursor.Valor, q.Cursor.Lote, q.Cursor.Iddte) > 0
+		})
+	}
+	fin := inicio + q.Limite
+	if fin >= len(iddtes) {
+		return iddtes[inicio:], ""
+	}
+
+	ultimo := iddtes[fin-1]
+	orden := q.Orden
+	if q.Descendente {
+		orden = "-" + orden
+	}
+	contenido, _ := json.Marshal(cursorIddte{Orden: orden, Valor: ultimo.valorOrden(q.Orden), Lote: ultimo.numeroLote, Iddte: ultimo.numeroIddte})
+	return iddtes[inicio:fin], base64.RawURLEncoding.EncodeToString(contenido)
+}
+
+// consultaLotes devuelve la consulta del índice de lotes con el rango de lotes, de fechas y los tipos de DTE.
+// La fecha final incluye todo el día.
+func (q consultaIddte) consultaLotes() registro.Consulta {
+	consulta := registro.Consulta{Desde: q.LoteDesde, Hasta: q.LoteHasta, FechaDesde: q.Desde, TiposDte: q.TiposDte}
+	if !q.Hasta.IsZero() {
+		consulta.FechaHasta = q.Hasta.AddDate(0, 0, 1).Add(-time.Millisecond)
+	}
+	return consulta
+}
+
+// acepta indica si el IDDTE cumple los filtros de tipo, código, estado y categoría
+func (q consultaIddte) acepta(iddte iddteConsultado) bool {
+	return contieneTexto(q.TiposDte, iddte.TipoDte) && contieneTexto(q.Codigos, strconv.Itoa(iddte.Codigo)) &&
+		contieneTexto(q.Estados, iddte.Estado) && contieneTexto(q.Categorias, iddte.Categoria)
+}
+
+func contieneTexto(lista []string, valor string) bool {
+	if len(lista) == 0 {
+		return true
+	}
+	for _, elemento := range lista {
+		if strings.EqualFold(elemento, valor) {
+			return true
+		}
+	}
+	return false
+}
+
+// nuevoIddteConsultado interpreta el estado guardado de un IDDTE. La categoría solo se asigna a los que no
+// fueron procesados ni están en contingencia.
+func nuevoIddteConsultado(lote string, numeroLote int, clave string, valor string, tipoDte string, fecha time.Time) iddteConsultado {
+	estado := parsearEstado(valor)
+	iddte := iddteConsultado{
+		Lote:        lote,
+		IDDTE:       clave,
+		TipoDte:     tipoDte,
+		Codigo:      estado.Codigo,
+		Estado:      estado.campo("Estado"),
+		Valor:       valor,
+		numeroLote:  numeroLote,
+		numeroIddte: getNumero(clave),
+		fecha:       fecha,
+	}
+	if iddte.Estado == "" {
+		iddte.Estado = "N/A"
+	}
+	if !estado.procesado() && estado.Codigo != http.StatusAccepted {
+		iddte.Categoria = clasificacion.Predeterminado().ClasificarEstado(valor).Categoria
+	}
+	if !fecha.IsZero() {
+		iddte.Fecha = fecha.Format(time.RFC3339)
+	}
+	return iddte
+}
+
+// cargarIddtes obtiene los IDDTE de los lotes indicados que cumplen los filtros de la consulta
+func cargarIddtes(rdb *redis.Client, empid string, consulta consultaIddte, correlativos []string) ([]iddteConsultado, error) {
+	ctx := context.Background()
+	fechas, err := registro.Fechas(rdb, empid, correlativos)
+	if err != nil {
+		return nil, err
+	}
+
+	var iddtes []iddteConsultado
+	for _, correlativo := range correlativos {
+		numero, _ := strconv.Atoi(correlativo)
+		estados, err := rdb.HGetAll(ctx, fmt.Sprintf("%s_Lote_%s", empid, correlativo)).Result()
+		if err != nil {
+			return nil, fmt.Errorf("error al obtener los estados del Lote_%s: %v", correlativo, err)
+		}
+		tipos := utils.ObtenerTiposLote(rdb, empid, correlativo)
+		for clave, valor := range estados {
+			iddte := nuevoIddteConsultado("Lote_"+correlativo, numero, clave, valor, tipos[clave], fechas[correlativo])
+			if consulta.acepta(iddte) {
+				iddtes = append(iddtes, iddte)
+			}
+		}
+	}
+	return iddtes, nil
+}
+
+// posteriores cuenta los IDDTE que quedan después del cursor en el orden por lote
+func (q consultaIddte) posteriores(iddtes []iddteConsultado) int {
+	if q.Cursor == nil {
+		return len(iddtes)
+	}
+	signo := 1
+	if q.Descendente {
+		signo = -1
+	}
+	cantidad := 0
+	for _, iddte := range iddtes {
+		if signo*compararIddte("", iddte.numeroLote, iddte.numeroIddte, "", q.Cursor.Lote, q.Cursor.Iddte) > 0 {
+			cantidad++
+		}
+	}
+	return cantidad
+}
+
+// totalDesdeResumen cuenta los IDDTE del lote que cumplen la consulta con los conteos por tipo de DTE, código,
+// estado y categoría de su resumen. Devuelve false si los conteos no cubren todos los IDDTE del lote, como en
+// los lotes con resultados guardados antes de que existieran.
+func (q consultaIddte) totalDesdeResumen(resumen eventos.ResumenLote) (int, bool) {
+	var total, contados int64
+	for _, conteo := range resumen.Conteos {
+		contados += conteo.Cantidad
+		if q.acepta(iddteConsultado{TipoDte: conteo.TipoDte, Codigo: conteo.Codigo, Estado: conteo.Estado, Categoria: conteo.Categoria}) {
+			total += conteo.Cantidad
+		}
+	}
+	return int(total), contados == resumen.Total
+}
+
+// totalIddtes cuenta los IDDTE que cumplen la consulta con los resúmenes de los lotes; los lotes cuyo resumen
+// no puede contarlos se cuentan cargando sus estados, uno por vez
+func totalIddtes(rdb *redis.Client, empid string, consulta consultaIddte) (int, error) {
+	correlativos, err := registro.Lotes(rdb, empid, consulta.consultaLotes())
+	if err != nil {
+		return 0, err
+	}
+	resumenes, err := eventos.ResumenesLotes(rdb, empid, correlativos)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, correlativo := range correlativos {
+		if resumen, ok := resumenes[correlativo]; ok {
+			if cantidad, ok := consulta.totalDesdeResumen(resumen); ok {
+				total += cantidad
+				continue
+			}
+		}
+		iddtes, err := cargarIddtes(rdb, empid, consulta, []string{correlativo})
+		if err != nil {
+			return 0, err
+		}
+		total += len(iddtes)
+	}
+	return total, nil
+}
+
+// consultarIddtes devuelve una página de los IDDTE de la empresa que cumplen la consulta y el total de los
+// que la cumplen
+func consultarIddtes(rdb *redis.Client, empid string, consulta consultaIddte) ([]iddteConsultado, int, string, error) {
+	// El índice de lotes reduce la consulta a los lotes del rango, las fechas y los tipos de DTE pedidos; el
+	// tipo de cada IDDTE se vuelve a comprobar porque un lote puede tener varios
+	if consulta.Orden != "lote" {
+		correlativos, err := registro.Lotes(rdb, empid, consulta.consultaLotes())
+		if err != nil {
+			return nil, 0, "", err
+		}
+		if len(correlativos) > maxLotesOrden {
+			return nil, 0, "", errConsultaAmplia
+		}
+		iddtes, err := cargarIddtes(rdb, empid, consulta, correlativos)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		total := len(iddtes)
+		pagina, siguiente := consulta.ordenarYPaginar(iddtes)
+		return pagina, total, siguiente, nil
+	}
+
+	// En el orden por lote se leen los lotes del índice desde el del cursor hasta tener más IDDTE que el
+	// límite, para saber si hay otra página
+	desde := 0
+	if consulta.Cursor != nil {
+		desde = consulta.Cursor.Lote
+	}
+	var iddtes []iddteConsultado
+	for {
+		correlativos, siguiente, err := registro.PaginaLotes(rdb, empid, consulta.consultaLotes(), desde, consulta.Descendente, lotesPorLectura)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		cargados, err := cargarIddtes(rdb, empid, consulta, correlativos)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		iddtes = append(iddtes, cargados...)
+		if siguiente == 0 || consulta.posteriores(iddtes) > consulta.Limite {
+			break
+		}
+		desde = siguiente
+	}
+
+	total, err := totalIddtes(rdb, empid, consulta)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	pagina, siguiente := consulta.ordenarYPaginar(iddtes)
+	return pagina, total, siguiente, nil
+}
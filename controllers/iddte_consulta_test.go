@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/eventos"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestConsultaIddtePaginada(t *testing.T) {
+	var iddtes []iddteConsultado
+	for lote := 1; lote <= 3; lote++ {
+		for i := 1; i <= 4; i++ {
+			valor := `Código: 200, Mensaje: {"Estado": "PROCESADO", "CodigoGeneracion": "C", "SelloRecibido": "S"}`
+			if i%2 == 0 {
+				valor = `Código: 400, Mensaje: {"Message": "Receptor.Nrc: es obligatorio"}`
+			}
+			iddtes = append(iddtes, nuevoIddteConsultado(fmt.Sprintf("Lote_%03d", lote), lote, fmt.Sprintf("IDDTE-%d", i), valor, "01", time.Time{}))
+		}
+	}
+
+	// Recorrer las páginas ordenadas por código descendente con el cursor de cada respuesta
+	vistos := make(map[string]bool)
+	cursor := ""
+	for paginas := 0; ; paginas++ {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/status/iddte?limit=5&sort=-codigo&cursor="+cursor, nil)
+		consulta, err := parsearConsultaIddte(c)
+		if err != nil {
+			t.Fatalf("Consulta no válida: %v", err)
+		}
+		pagina, siguiente := consulta.ordenarYPaginar(append([]iddteConsultado{}, iddtes...))
+		for i, iddte := range pagina {
+			if vistos[iddte.Lote+iddte.IDDTE] {
+				t.Errorf("%s %s aparece en más de una página", iddte.Lote, iddte.IDDTE)
+			}
+			vistos[iddte.Lote+iddte.IDDTE] = true
+			if paginas == 0 && i == 0 && (iddte.Codigo != 400 || iddte.Categoria != "datos") {
+				t.Errorf("El primer IDDTE debería ser un rechazo: %+v", iddte)
+			}
+		}
+		if siguiente == "" {
+			break
+		}
+		cursor = siguiente
+	}
+	if len(vistos) != len(iddtes) {
+		t.Errorf("Se recorrieron %d IDDTE de %d", len(vistos), len(iddtes))
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/status/iddte?sort=lote&cursor="+cursor, nil)
+	if _, err := parsearConsultaIddte(c); err == nil {
+		t.Error("Un cursor de otro orden debería rechazarse")
+	}
+}
+
+func TestTotalDesdeResumen(t *testing.T) {
+	resumen := eventos.ResumenLote{Total: 7, Conteos: []eventos.ConteoResultado{
+		{TipoDte: "01", Codigo: 200, Estado: "PROCESADO", Cantidad: 3},
+		{TipoDte: "01", Codigo: 400, Estado: "N/A", Categoria: "datos", Cantidad: 2},
+		{TipoDte: "03", Codigo: 400, Estado: "N/A", Categoria: "datos", Cantidad: 1},
+		{TipoDte: "03", Codigo: 500, Estado: "N/A", Categoria: "servidor", Cantidad: 1},
+	}}
+	casos := []struct {
+		consulta consultaIddte
+		total    int
+	}{
+		{consultaIddte{}, 7},
+		{consultaIddte{Codigos: []string{"400", "500"}}, 4},
+		{consultaIddte{Estados: []string{"procesado"}}, 3},
+		{consultaIddte{TiposDte: []string{"03"}, Categorias: []string{"datos"}}, 1},
+		{consultaIddte{TiposDte: []string{"01"}, Codigos: []string{"400"}, Categorias: []string{"datos"}}, 2},
+	}
+	for _, caso := range casos {
+		if total, ok := caso.consulta.totalDesdeResumen(resumen); total != caso.total || !ok {
+			t.Errorf("totalDesdeResumen(%+v) = %d, %v", caso.consulta, total, ok)
+		}
+	}
+
+	// Un lote con resultados anteriores a los conteos se cuenta cargando sus estados
+	resumen.Total = 9
+	if _, ok := (consultaIddte{}).totalDesdeResumen(resumen); ok {
+		t.Error("Los conteos incompletos no deberían usarse para el total")
+	}
+}
@@ -2,6 +2,10 @@ package controllers
 
 import (
 	"GoProcesadorExcel/authentication"
+	"GoProcesadorExcel/clasificacion"
+	"GoProcesadorExcel/correo"
+	"GoProcesadorExcel/registro"
+	"GoProcesadorExcel/utils"
 	"context"
 	"fmt"
 	"net/http"
@@ -27,8 +31,28 @@ func HandleStatusIddte(c *gin.Context, rdb *redis.Client) {
 		return
 	}
 
-	// Obtener todas las claves que coinciden con el patrón "Lote_*"
-	keys, err := rdb.Keys(context.Background(), empid+"_Lote_*").Result()
+	// Con filtros, orden o página se devuelve solo la página solicitada
+	if consultaPaginada(c) {
+		consulta, err := parsearConsultaIddte(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		iddtes, total, siguiente, err := consultarIddtes(rdb, empid, consulta)
+		if err == errConsultaAmplia {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"iddtes": iddtes, "total": total, "limit": consulta.Limite, "siguiente": siguiente})
+		return
+	}
+
+	// Obtener los lotes de la empresa del índice de lotes
+	correlativos, err := registro.Lotes(rdb, empid, registro.Consulta{})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las claves de los archivos"})
 		return
@@ -36,24 +60,13 @@ func HandleStatusIddte(c *gin.Context, rdb *redis.Client) {
 
 	// Crear un mapa para almacenar los resultados
 	historial := make(map[string]*orderedmap.OrderedMap)
+	tiposDte := make(map[string]map[string][]string)
+	clasificaciones := make(map[string]map[string]clasificacion.Clasificacion)
 
-	// Filtrar las claves para quedarnos solo con aquellas que corresponden a hashes
-	hashKeys := make([]string, 0)
-	for _, key := range keys {
-		keyType, err := rdb.Type(context.Background(), key).Result()
-		if err != nil {
-			// Manejar el error
-			continue
-		}
-		if keyType == "hash" {
-			hashKeys = append(hashKeys, key)
-		}
-	}
-
-	// Aplicar HGetAll solo a las claves que corresponden a hashes
-	for _, key := range hashKeys {
-		estados, err := rdb.HGetAll(context.Background(), key).Result()
-		if err != nil {
+	// Obtener los estados de los IDDTE de cada lote; los lotes sin resultados no se incluyen
+	for _, correlativo := range correlativos {
+		estados, err := rdb.HGetAll(context.Background(), fmt.Sprintf("%s_Lote_%s", empid, correlativo)).Result()
+		if err != nil || len(estados) == 0 {
 			// Manejar el error
 			continue
 		}
@@ -86,13 +99,24 @@ func HandleStatusIddte(c *gin.Context, rdb *redis.Client) {
 			estadosOrdenados.Set(clave, estados[clave])
 		}
 
-		lote := strings.TrimPrefix(key, empid+"_")
+		lote := "Lote_" + correlativo
 		// Agregar el mapa ordenado al historial
 		historial[lote] = estadosOrdenados
+
+		// Agrupar los IDDTE del lote por tipo de DTE
+		tipos := utils.ObtenerTiposLote(rdb, empid, correlativo)
+		if grupos := agruparPorTipo(claves, tipos); len(grupos) > 0 {
+			tiposDte[lote] = grupos
+		}
+
+		// Clasificar los errores de los IDDTE no procesados
+		if clasificados := clasificarEstados(estados); len(clasificados) > 0 {
+			clasificaciones[lote] = clasificados
+		}
 	}
 
 	// Devolver el historial como respuesta JSON
-	response := gin.H{"historial_iddtes": historial}
+	response := gin.H{"historial_iddtes": historial, "tipos_dte": tiposDte, "clasificacion": clasificaciones}
 	c.JSON(http.StatusOK, response)
 }
 
@@ -159,6 +183,51 @@ func HandleUniqueStatusIddte(c *gin.Context, rdb *redis.Client) {
 	lote := strings.TrimPrefix(nombreLote, empid+"_")
 
 	response := gin.H{lote: estadosOrdenados}
+
+	// Agrupar los IDDTE del lote por tipo de DTE
+	tipos := utils.ObtenerTiposLote(rdb, empid, correlativo)
+	if grupos := agruparPorTipo(claves, tipos); len(grupos) > 0 {
+		response["tipos_dte"] = grupos
+	}
+
+	// Clasificar los errores de los IDDTE no procesados
+	if clasificados := clasificarEstados(estados); len(clasificados) > 0 {
+		response["clasificacion"] = clasificados
+	}
+
+	// Incluir las invalidaciones de los documentos del lote
+	if invalidaciones := obtenerInvalidaciones(rdb, empid, correlativo); len(invalidaciones) > 0 {
+		response["invalidaciones"] = invalidaciones
+	}
+
+	// Incluir el envío por correo de los documentos procesados
+	if correos := correo.ObtenerEnvios(rdb, empid, correlativo); len(correos) > 0 {
+		response["correos"] = correos
+	}
 	// Devolver los estados del lote como respuesta JSON
 	c.JSON(http.StatusOK, response)
 }
+
+// agruparPorTipo agrupa los IDDTE de un lote por su tipo de DTE, conservando el orden de las claves
+func agruparPorTipo(claves []string, tipos map[string]string) map[string][]string {
+	grupos := make(map[string][]string)
+	for _, clave := range claves {
+		if tipo, ok := tipos[clave]; ok {
+			grupos[tipo] = append(grupos[tipo], clave)
+		}
+	}
+	return grupos
+}
+
+// clasificarEstados clasifica los errores de los IDDTE que no fueron procesados ni están en contingencia
+func clasificarEstados(estados map[string]string) map[string]clasificacion.Clasificacion {
+	clasificados := make(map[string]clasificacion.Clasificacion)
+	for clave, valor := range estados {
+		estado := parsearEstado(valor)
+		if estado.procesado() || estado.Codigo == http.StatusAccepted {
+			continue
+		}
+		clasificados[clave] = clasificacion.Predeterminado().ClasificarEstado(valor)
+	}
+	return clasificados
+}
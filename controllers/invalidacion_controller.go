@@ -0,0 +1,475 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/authentication"
+	"GoProcesadorExcel/documentos"
+	"GoProcesadorExcel/eventos"
+	"GoProcesadorExcel/registro"
+	"GoProcesadorExcel/utils"
+	"GoProcesadorExcel/validacion"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// Estados de la invalidación de un documento
+const (
+	InvalidacionPendiente = "PENDIENTE"
+	InvalidacionAplicada  = "INVALIDADO"
+	InvalidacionRechazada = "RECHAZADO"
+)
+
+// personaInvalidacion identifica al responsable o al solicitante de una invalidación
+type personaInvalidacion struct {
+	TipoDocumento   string `json:"tipoDocumento"`
+	NumeroDocumento string `json:"numeroDocumento"`
+	Nombre          string `json:"nombre"`
+}
+
+// solicitudInvalidacion es el cuerpo de POST /lotes/:correlativo/invalidate. Los documentos se indican
+// por IDDTE o por CodigoGeneracion; Reemplazos asocia cada uno con el CodigoGeneracion que lo reemplaza.
+type solicitudInvalidacion struct {
+	IDDTEs             []string            `json:"iddtes"`
+	CodigosGeneracion  []string            `json:"codigosGeneracion"`
+	TipoInvalidacion   string              `json:"tipoInvalidacion"`
+	MotivoInvalidacion string              `json:"motivoInvalidacion"`
+	Responsable        personaInvalidacion `json:"responsable"`
+	Solicita           personaInvalidacion `json:"solicita"`
+	Reemplazos         map[string]string   `json:"reemplazos"`
+}
+
+// marcaInvalidacion registra la invalidación de un documento de un lote
+type marcaInvalidacion struct {
+	Lote             string `json:"lote"`
+	CodigoGeneracion string `json:"codigoGeneracion"`
+	Estado           string `json:"estado"`
+	Fecha            string `json:"fecha"`
+	Mensaje          string `json:"mensaje,omitempty"`
+}
+
+// claveInvalidaciones devuelve el hash de Redis con las invalidaciones de los documentos de un lote
+func claveInvalidaciones(empid string, correlativo string) string {
+	return fmt.Sprintf("%s_Invalidaciones_Lote_%s", empid, correlativo)
+}
+
+// HandleInvalidarLote invalida documentos procesados de un lote: arma los documentos de invalidación con
+// los datos guardados de cada documento, los envía como un lote nuevo y marca los originales
+func HandleInvalidarLote(c *gin.Context, rdb *redis.Client) {
+
+	authToken := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(authToken)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	correlativo := c.Param("correlativo")
+
+	var solicitud solicitudInvalidacion
+	if err := c.ShouldBindJSON(&solicitud); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cuerpo de la solicitud inválido: %v", err)})
+		return
+	}
+	if err := solicitud.validar(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Obtener los resultados del lote original
+	nombreLote := fmt.Sprintf("%s_Lote_%s", empid, correlativo)
+	estados, err := rdb.HGetAll(context.Background(), nombreLote).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los estados del lote"})
+		return
+	}
+	if len(estados) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No existe un lote con el correlativo %s", correlativo)})
+		return
+	}
+
+	documentosLote, err := documentos.Leer(empid, correlativo)
+	if err != nil {
+		log.Printf("No se pudieron leer los documentos del lote %s: %v\n", nombreLote, err)
+		documentosLote = map[string]interface{}{}
+	}
+	tipos := utils.ObtenerTiposLote(rdb, empid, correlativo)
+	invalidaciones := obtenerInvalidaciones(rdb, empid, correlativo)
+
+	// Resolver los IDDTE solicitados, directamente o por su CodigoGeneracion
+	seleccion, rechazados := seleccionarDocumentos(solicitud, estados)
+
+	documentosInvalidacion := make(map[string]interface{})
+	codigos := make(map[string]string)
+	for _, clave := range seleccion {
+		estado := parsearEstado(estados[clave])
+		if !estado.procesado() {
+			rechazados = append(rechazados, gin.H{"iddte": clave, "error": "El documento no fue procesado por Hacienda"})
+			continue
+		}
+		if marca, ok := invalidaciones[clave]; ok && marca.Estado != InvalidacionRechazada {
+			rechazados = append(rechazados, gin.H{"iddte": clave, "error": fmt.Sprintf("El documento ya tiene una invalidación %s en el %s", strings.ToLower(marca.Estado), marca.Lote)})
+			continue
+		}
+
+		id := strings.TrimPrefix(clave, "IDDTE-")
+		original, _ := documentosLote[id].(map[string]interface{})
+		documento, err := solicitud.documento(estado, original, tipos[clave], clave)
+		if err != nil {
+			rechazados = append(rechazados, gin.H{"iddte": clave, "error": err.Error()})
+			continue
+		}
+		documentosInvalidacion[id] = documento
+		codigos[clave] = estado.campo("CodigoGeneracion")
+	}
+
+	if len(documentosInvalidacion) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No hay documentos para invalidar", "rechazados": rechazados})
+		return
+	}
+
+	// Crear el lote de invalidación
+	nuevoCorrelativo, err := generateCorrelativo(rdb, empid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar el correlativo"})
+		return
+	}
+	nuevoLote := fmt.Sprintf("Lote_%03d", nuevoCorrelativo)
+
+	// Reservar cada documento antes de enviar nada: dos solicitudes simultáneas pueden pasar la revisión
+	// anterior, pero solo una obtiene la marca pendiente del documento
+	dt := time.Now()
+	for clave, codigo := range codigos {
+		marca := marcaInvalidacion{
+			Lote:             nuevoLote,
+			CodigoGeneracion: codigo,
+			Estado:           InvalidacionPendiente,
+			Fecha:            dt.Format(time.RFC3339),
+		}
+		reservado, actual, err := reservarInvalidacion(rdb, empid, correlativo, clave, marca)
+		if err != nil {
+			log.Printf("Error al reservar la invalidación de %s: %v\n", clave, err)
+			rechazados = append(rechazados, gin.H{"iddte": clave, "error": "No se pudo registrar la invalidación del documento"})
+		} else if !reservado {
+			rechazados = append(rechazados, gin.H{"iddte": clave, "error": fmt.Sprintf("El documento ya tiene una invalidación %s en el %s", strings.ToLower(actual.Estado), actual.Lote)})
+		} else {
+			continue
+		}
+		delete(codigos, clave)
+		delete(documentosInvalidacion, strings.TrimPrefix(clave, "IDDTE-"))
+	}
+
+	if len(documentosInvalidacion) == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "No hay documentos para invalidar", "rechazados": rechazados})
+		return
+	}
+
+	if err := os.MkdirAll("data/responseJSON", 0755); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear carpeta para archivos JSON"})
+		return
+	}
+	contenido, err := json.Marshal(documentosInvalidacion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar los documentos de invalidación"})
+		return
+	}
+	rutaArchivoJSON := documentos.Ruta(empid, fmt.Sprintf("%03d", nuevoCorrelativo))
+	if err := os.WriteFile(rutaArchivoJSON, contenido, 0644); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar los documentos de invalidación"})
+		return
+	}
+
+	// Registrar el lote nuevo; los originales ya quedaron marcados como pendientes de invalidación
+	expiration := 3 * 30 * 24 * time.Hour
+	nombreEstado := fmt.Sprintf("%s_%s.json:cancel", empid, nuevoLote)
+	mensajeEstado := fmt.Sprintf("Invalidación de documentos del Lote_%s\n", correlativo)
+	if err := rdb.Set(context.Background(), nombreEstado, mensajeEstado, expiration).Err(); err != nil {
+		log.Println("Error al guardar el estado en el historial de Redis:", err)
+	}
+	registro.RegistrarArchivo(rdb, nombreEstado)
+
+	logEntry := fmt.Sprintf("\n%s - %s_Lote: %03d - Invalidación de %d documentos del Lote_%s\n", dt.Format(time.Stamp), empid, nuevoCorrelativo, len(documentosInvalidacion), correlativo)
+	logWrite(logEntry, "")
+	logWrite("", "<==========================================>\n")
+
+	eventos.Fase(rdb, empid, fmt.Sprintf("%03d", nuevoCorrelativo), eventos.FaseRecibido, gin.H{"origen": "invalidacion", "tipoDte": "cancel", "documentos": len(documentosInvalidacion), "loteOriginal": "Lote_" + correlativo})
+
+	// Enviar las invalidaciones y actualizar las marcas de los originales con el resultado
+	go func() {
+		utils.ProcesarArchivoJSON(rutaArchivoJSON, "cancel", authToken, rdb, nuevoCorrelativo)
+
+		resultados, err := rdb.HGetAll(context.Background(), fmt.Sprintf("%s_%s", empid, nuevoLote)).Result()
+		if err != nil {
+			log.Printf("Error al obtener los resultados del lote de invalidación %s: %v\n", nuevoLote, err)
+			return
+		}
+		for clave, codigo := range codigos {
+			marca := marcaInvalidacion{
+				Lote:             nuevoLote,
+				CodigoGeneracion: codigo,
+				Estado:           InvalidacionRechazada,
+				Fecha:            time.Now().Format(time.RFC3339),
+			}
+			resultado := parsearEstado(resultados[clave])
+			if resultado.procesado() {
+				marca.Estado = InvalidacionAplicada
+			} else if descripcion := resultado.campo("DescripcionMsg"); descripcion != "" {
+				marca.Mensaje = descripcion
+			} else {
+				marca.Mensaje = resultado.Texto
+			}
+			guardarInvalidacion(rdb, empid, correlativo, clave, marca)
+		}
+	}()
+
+	response := gin.H{
+		"message":     "La invalidación se está procesando",
+		"lote":        nuevoLote,
+		"correlativo": nuevoCorrelativo,
+		"documentos":  len(documentosInvalidacion),
+	}
+	if len(rechazados) > 0 {
+		response["rechazados"] = rechazados
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// validar revisa los datos comunes a todas las invalidaciones de la solicitud
+func (s solicitudInvalidacion) validar() error {
+	if len(s.IDDTEs) == 0 && len(s.CodigosGeneracion) == 0 {
+		return errors.New("Debe indicar los IDDTE o los códigos de generación a invalidar")
+	}
+
+	switch s.TipoInvalidacion {
+	case "1", "2", "3":
+	default:
+		return errors.New("El tipo de invalidación debe ser 1, 2 o 3")
+	}
+	if s.TipoInvalidacion == "3" && strings.TrimSpace(s.MotivoInvalidacion) == "" {
+		return errors.New("El motivo de la invalidación es obligatorio para el tipo de invalidación 3")
+	}
+
+	for nombre, persona := range map[string]personaInvalidacion{"responsable": s.Responsable, "solicitante": s.Solicita} {
+		if strings.TrimSpace(persona.Nombre) == "" {
+			return fmt.Errorf("Falta el nombre del %s", nombre)
+		}
+		if err := validacion.ValidarDocumentoIdentificacion(persona.TipoDocumento, persona.NumeroDocumento); err != nil {
+			return fmt.Errorf("Documento del %s inválido: %v", nombre, err)
+		}
+	}
+	return nil
+}
+
+// documento arma el documento de invalidación con el mismo formato que genera el conversor para el tipo cancel
+func (s solicitudInvalidacion) documento(estado estadoIddte, original map[string]interface{}, tipoDte string, clave string) (map[string]interface{}, error) {
+	codigo := estado.campo("CodigoGeneracion")
+	identificacion := documentos.Fila(original, "Identificacion")
+	receptor := documentos.Fila(original, "Receptor")
+
+	if tipoDte == "" {
+		tipoDte = documentos.Texto(identificacion, "TipoDte")
+	}
+	if tipoDte == "" {
+		return nil, errors.New("No se pudo determinar el tipo de DTE del documento")
+	}
+
+	establecimiento := documentos.Texto(original, "CodigoEstablecimientoMH")
+	if establecimiento == "" {
+		establecimiento = documentos.Texto(identificacion, "CodigoEstablecimientoMH")
+	}
+	if establecimiento == "" {
+		return nil, errors.New("No se encontró el código de establecimiento del documento")
+	}
+
+	// Los tipos 1 y 3 requieren el documento que reemplaza al invalidado
+	reemplazo := s.Reemplazos[clave]
+	if reemplazo == "" {
+		reemplazo = s.Reemplazos[strings.TrimPrefix(clave, "IDDTE-")]
+	}
+	if reemplazo == "" {
+		reemplazo = s.Reemplazos[codigo]
+	}
+	if reemplazo == "" && s.TipoInvalidacion != "2" {
+		return nil, fmt.Errorf("El tipo de invalidación %s requiere el código de generación del documento que lo reemplaza", s.TipoInvalidacion)
+	}
+
+	detalle := map[string]interface{}{
+		"TipoDte":                            tipoDte,
+		"CodigoGeneracion":                   codigo,
+		"SelloRecibido":                      estado.campo("SelloRecibido"),
+		"CodigoGeneracionDocumentoReemplazo": nil,
+		"TipoDteReemplazo":                   nil,
+		"NombreCliente":                      valorONulo(documentos.Texto(receptor, "Nombres")),
+		"CorreoCliente":                      valorONulo(documentos.Texto(receptor, "Correo")),
+		"TelefonoCliente":                    valorONulo(documentos.Texto(receptor, "Telefono")),
+	}
+	if reemplazo != "" {
+		detalle["CodigoGeneracionDocumentoReemplazo"] = reemplazo
+		detalle["TipoDteReemplazo"] = tipoDte
+	}
+
+	// La fecha de emisión se toma de la respuesta de la API o del documento enviado
+	for _, fecha := range []string{estado.campo("FechaEmision"), documentos.Texto(identificacion, "FechaEmision"), estado.campo("FhProcesamiento")} {
+		if fecha != "" {
+			detalle["FechaEmision"] = fecha
+			break
+		}
+	}
+
+	return map[string]interface{}{
+		"CodigoEstablecimientoMH": establecimiento,
+		"TipoInvalidacion":        s.TipoInvalidacion,
+		"MotivoInvalidacion":      valorONulo(strings.TrimSpace(s.MotivoInvalidacion)),
+		"Detalle":                 detalle,
+		"Resumen": map[string]interface{}{
+			"TipoDocIdentResponsable": s.Responsable.TipoDocumento,
+			"NumDocIdentResponsable":  strings.ReplaceAll(s.Responsable.NumeroDocumento, "-", ""),
+			"NombresResponsable":      s.Responsable.Nombre,
+			"TipoDocIdentSolicita":    s.Solicita.TipoDocumento,
+			"NumDocIdentSolicita":     strings.ReplaceAll(s.Solicita.NumeroDocumento, "-", ""),
+			"NombresSolicita":         s.Solicita.Nombre,
+		},
+	}, nil
+}
+
+// seleccionarDocumentos devuelve las claves IDDTE-n de los documentos solicitados y los que no existen en el lote
+func seleccionarDocumentos(solicitud solicitudInvalidacion, estados map[string]string) ([]string, []gin.H) {
+	var seleccion []string
+	var rechazados []gin.H
+	incluidos := make(map[string]bool)
+
+	agregar := func(clave string) {
+		if !incluidos[clave] {
+			incluidos[clave] = true
+			seleccion = append(seleccion, clave)
+		}
+	}
+
+	for _, id := range solicitud.IDDTEs {
+		clave := "IDDTE-" + strings.TrimPrefix(strings.TrimSpace(id), "IDDTE-")
+		if _, ok := estados[clave]; !ok {
+			rechazados = append(rechazados, gin.H{"iddte": id, "error": "El IDDTE no existe en el lote"})
+			continue
+		}
+		agregar(clave)
+	}
+
+	if len(solicitud.CodigosGeneracion) > 0 {
+		porCodigo := make(map[string]string)
+		for clave, valor := range estados {
+			if codigo := parsearEstado(valor).campo("CodigoGeneracion"); codigo != "" {
+				porCodigo[strings.ToUpper(codigo)] = clave
+			}
+		}
+		for _, codigo := range solicitud.CodigosGeneracion {
+			clave, ok := porCodigo[strings.ToUpper(strings.TrimSpace(codigo))]
+			if !ok {
+				rechazados = append(rechazados, gin.H{"codigoGeneracion": codigo, "error": "El código de generación no existe en el lote"})
+				continue
+			}
+			agregar(clave)
+		}
+	}
+	return seleccion, rechazados
+}
+
+// obtenerInvalidaciones devuelve las invalidaciones registradas para los documentos de un lote
+func obtenerInvalidaciones(rdb *redis.Client, empid string, correlativo string) map[string]marcaInvalidacion {
+	invalidaciones := make(map[string]marcaInvalidacion)
+	valores, err := rdb.HGetAll(context.Background(), claveInvalidaciones(empid, correlativo)).Result()
+	if err != nil {
+		log.Printf("Error al obtener las invalidaciones del lote %s: %v\n", correlativo, err)
+		return invalidaciones
+	}
+	for clave, valor := range valores {
+		var marca marcaInvalidacion
+		if err := json.Unmarshal([]byte(valor), &marca); err == nil {
+			invalidaciones[clave] = marca
+		}
+	}
+	return invalidaciones
+}
+
+// reemplazarRechazada cambia una invalidación rechazada por la nueva solo si nadie la cambió desde que se leyó
+var reemplazarRechazada = redis.NewScript(`
+if redis.call("HGET", KEYS[1], ARGV[1]) == ARGV[2] then
+	redis.call("HSET", KEYS[1], ARGV[1], ARGV[3])
+	return 1
+end
+return 0
+`)
+
+// reservarInvalidacion registra la marca pendiente de un documento con HSETNX. Si el documento ya tiene una
+// marca solo se reemplaza cuando la anterior fue rechazada; en otro caso devuelve la marca existente.
+func reservarInvalidacion(rdb *redis.Client, empid string, correlativo string, clave string, marca marcaInvalidacion) (bool, marcaInvalidacion, error) {
+	ctx := context.Background()
+	valor, err := json.Marshal(marca)
+	if err != nil {
+		return false, marcaInvalidacion{}, err
+	}
+	claveHash := claveInvalidaciones(empid, correlativo)
+
+	reservado, err := rdb.HSetNX(ctx, claveHash, clave, valor).Result()
+	if err != nil {
+		return false, marcaInvalidacion{}, err
+	}
+	if !reservado {
+		anterior, err := rdb.HGet(ctx, claveHash, clave).Result()
+		if err != nil {
+			return false, marcaInvalidacion{}, err
+		}
+		var actual marcaInvalidacion
+		if err := json.Unmarshal([]byte(anterior), &actual); err == nil && actual.Estado != InvalidacionRechazada {
+			return false, actual, nil
+		}
+		reemplazado, err := reemplazarRechazada.Run(ctx, rdb, []string{claveHash}, clave, anterior, valor).Int()
+		if err != nil {
+			return false, marcaInvalidacion{}, err
+		}
+		if reemplazado == 0 {
+			// Otra solicitud tomó el documento entre la lectura y el reemplazo
+			actual = obtenerInvalidaciones(rdb, empid, correlativo)[clave]
+			return false, actual, nil
+		}
+	}
+
+	if err := rdb.Expire(ctx, claveHash, 3*30*24*time.Hour).Err(); err != nil {
+		log.Printf("Error al establecer el tiempo de expiración en Redis para %s: %v\n", claveHash, err)
+	}
+	return true, marca, nil
+}
+
+func guardarInvalidacion(rdb *redis.Client, empid string, correlativo string, clave string, marca marcaInvalidacion) {
+	valor, err := json.Marshal(marca)
+	if err != nil {
+		log.Printf("Error al serializar la invalidación de %s: %v\n", clave, err)
+		return
+	}
+	claveHash := claveInvalidaciones(empid, correlativo)
+	if err := rdb.HSet(context.Background(), claveHash, clave, valor).Err(); err != nil {
+		log.Printf("Error al guardar la invalidación de %s en Redis: %v\n", clave, err)
+		return
+	}
+	if err := rdb.Expire(context.Background(), claveHash, 3*30*24*time.Hour).Err(); err != nil {
+		log.Printf("Error al establecer el tiempo de expiración en Redis para %s: %v\n", claveHash, err)
+	}
+}
+
+// valorONulo devuelve nil para los textos vacíos, igual que el conversor con las celdas vacías
+func valorONulo(valor string) interface{} {
+	if valor == "" {
+		return nil
+	}
+	return valor
+}
@@ -0,0 +1,42 @@
+package controllers
+
+import "testing"
+
+func TestDocumentoInvalidacion(t *testing.T) {
+	estado := parsearEstado(`Código: 200, Mensaje: {"CodigoGeneracion": "ABC-123", "SelloRecibido": "2024SELLO", "Estado": "PROCESADO", "DescripcionMsg": "RECIBIDO"}`)
+	if !estado.procesado() {
+		t.Fatalf("El estado debería interpretarse como procesado: %+v", estado)
+	}
+
+	solicitud := solicitudInvalidacion{
+		IDDTEs:           []string{"1"},
+		TipoInvalidacion: "2",
+		Responsable:      personaInvalidacion{TipoDocumento: "13", NumeroDocumento: "00016297-5", Nombre: "Victor Perez"},
+		Solicita:         personaInvalidacion{TipoDocumento: "13", NumeroDocumento: "00016297-5", Nombre: "Victor Perez"},
+	}
+	if err := solicitud.validar(); err != nil {
+		t.Fatalf("La solicitud debería ser válida: %v", err)
+	}
+
+	original := map[string]interface{}{
+		"Identificacion": map[string]interface{}{"CodigoEstablecimientoMH": "0002", "TipoDte": "01"},
+		"Receptor":       map[string]interface{}{"Nombres": "Cliente"},
+	}
+	documento, err := solicitud.documento(estado, original, "", "IDDTE-1")
+	if err != nil {
+		t.Fatalf("Error al armar el documento de invalidación: %v", err)
+	}
+
+	detalle := documento["Detalle"].(map[string]interface{})
+	if detalle["CodigoGeneracion"] != "ABC-123" || detalle["TipoDte"] != "01" || detalle["NombreCliente"] != "Cliente" {
+		t.Errorf("Detalle inesperado: %v", detalle)
+	}
+	if documento["CodigoEstablecimientoMH"] != "0002" {
+		t.Errorf("Establecimiento inesperado: %v", documento["CodigoEstablecimientoMH"])
+	}
+
+	solicitud.TipoInvalidacion = "1"
+	if _, err := solicitud.documento(estado, original, "01", "IDDTE-1"); err == nil {
+		t.Error("El tipo de invalidación 1 debería requerir el documento de reemplazo")
+	}
+}
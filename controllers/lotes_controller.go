@@ -2,11 +2,9 @@ package controllers
 
 import (
 	"GoProcesadorExcel/authentication"
+	"GoProcesadorExcel/registro"
 	"context"
-	"fmt"
 	"net/http"
-	"regexp"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
@@ -24,29 +22,50 @@ func HandleStatusConsulta(c *gin.Context, rdb *redis.Client) {
 		return
 	}
 
-	// Obtener todos los estados de los archivos guardados en Redis
-	empPrefix := fmt.Sprintf("%s_", empid)
-	estados, err := rdb.Keys(context.Background(), empPrefix+"Lote_*").Result()
+	// Los lotes se pueden filtrar por tipo de DTE y por estado con el índice de lotes de la empresa
+	var correlativos []string
+	tiposDte, estadosLote := listaParametro(c.Query("tipoDte")), listaParametro(c.Query("estado"))
+	if len(tiposDte) > 0 || len(estadosLote) > 0 {
+		correlativos, err = registro.Lotes(rdb, empid, registro.Consulta{TiposDte: tiposDte, Estados: estadosLote})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los estados de los archivos"})
+			return
+		}
+		if correlativos == nil {
+			correlativos = []string{}
+		}
+	}
+
+	// Obtener los estados de los archivos de los lotes (.xlsx y .json) registrados en el índice
+	archivos, err := registro.Archivos(rdb, empid, correlativos)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los estados de los archivos"})
 		return
 	}
 
-	// Filtrar los archivos por extensión ".xlsx"
 	xlsxFiles := make(map[string]string)
+	if len(archivos) > 0 {
+		claves := make([]string, len(archivos))
+		for i, archivo := range archivos {
+			claves[i] = empid + "_" + archivo
+		}
+		estados, err := rdb.MGet(context.Background(), claves...).Result()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los estados de los archivos"})
+			return
+		}
 
-	patronCancel := regexp.MustCompile(`\.xlsx:cancel$`)
-	patron := regexp.MustCompile(`\.xlsx:\d+$`)
-	all := regexp.MustCompile(`\.xlsx`)
-
-	for _, estado := range estados {
-		if patron.MatchString(estado) || patronCancel.MatchString(estado) || all.MatchString(estado) {
-			// Obtener el estado del archivo y agregarlo al mapa
-			status, _ := rdb.Get(context.Background(), estado).Result()
-			lote := strings.TrimPrefix(estado, empPrefix)
-
-			xlsxFiles[lote] = status
+		// Los estados vencidos se quitan del índice
+		var vencidos []string
+		for i, estado := range estados {
+			status, ok := estado.(string)
+			if !ok {
+				vencidos = append(vencidos, archivos[i])
+				continue
+			}
+			xlsxFiles[archivos[i]] = status
 		}
+		registro.QuitarArchivos(rdb, empid, vencidos)
 	}
 
 	response := gin.H{"historial_lotes": xlsxFiles}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/authentication"
+	"GoProcesadorExcel/mapeo"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// validarAdmin valida el token de administrador y responde al cliente si no es válido. El administrador
+// solo puede modificar la configuración de su propia empresa, así que el :empid debe ser el del token.
+func validarAdmin(c *gin.Context) bool {
+	empid, err := authentication.ValidateAdminToken(c.GetHeader("Authorization"))
+	if err == authentication.ErrNoAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return false
+	}
+	if empid != c.Param("empid") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "El usuario no es administrador de la empresa " + c.Param("empid")})
+		return false
+	}
+	return true
+}
+
+// HandleObtenerMapeo devuelve el mapeo activo de una empresa y las versiones guardadas
+func HandleObtenerMapeo(c *gin.Context, rdb *redis.Client) {
+	if !validarAdmin(c) {
+		return
+	}
+
+	empid := c.Param("empid")
+
+	configuracion, err := mapeo.ObtenerConfiguracion(rdb, empid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	versiones, _, err := mapeo.ListarVersiones(rdb, empid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"activo": configuracion, "versiones": versiones})
+}
+
+// HandleObtenerVersionMapeo devuelve una versión específica del mapeo de una empresa
+func HandleObtenerVersionMapeo(c *gin.Context, rdb *redis.Client) {
+	if !validarAdmin(c) {
+		return
+	}
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La versión debe ser un número"})
+		return
+	}
+
+	configuracion, err := mapeo.ObtenerVersion(rdb, c.Param("empid"), version)
+	if err == mapeo.ErrVersionNoExiste {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, configuracion)
+}
+
+// HandleGuardarMapeo valida el mapeo recibido y lo guarda como la nueva versión activa de la empresa
+func HandleGuardarMapeo(c *gin.Context, rdb *redis.Client) {
+	if !validarAdmin(c) {
+		return
+	}
+
+	var configuracion mapeo.Configuracion
+	if err := c.ShouldBindJSON(&configuracion); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El mapeo no es un JSON válido: " + err.Error()})
+		return
+	}
+
+	version, err := mapeo.GuardarConfiguracion(rdb, c.Param("empid"), &configuracion)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Mapeo guardado", "version": version})
+}
+
+// HandleActivarMapeo vuelve a activar una versión anterior del mapeo de una empresa
+func HandleActivarMapeo(c *gin.Context, rdb *redis.Client) {
+	if !validarAdmin(c) {
+		return
+	}
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La versión debe ser un número"})
+		return
+	}
+
+	err = mapeo.ActivarVersion(rdb, c.Param("empid"), version)
+	if err == mapeo.ErrVersionNoExiste {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Mapeo activado", "version": version})
+}
@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/authentication"
+	"GoProcesadorExcel/documentos"
+	"GoProcesadorExcel/representacion"
+	"GoProcesadorExcel/utils"
+	"archive/zip"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// HandlePdfIddte devuelve la representación gráfica en PDF de un IDDTE procesado
+func HandlePdfIddte(c *gin.Context, rdb *redis.Client) {
+	token := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(token)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	correlativo := c.Param("correlativo")
+	iddte := c.Param("id")
+	if !strings.HasPrefix(iddte, "IDDTE-") {
+		iddte = "IDDTE-" + iddte
+	}
+
+	nombreLote := fmt.Sprintf("%s_Lote_%s", empid, correlativo)
+	valor, err := rdb.HGet(context.Background(), nombreLote, iddte).Result()
+	if err == redis.Nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No existe el %s en el Lote_%s", iddte, correlativo)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el estado del documento"})
+		return
+	}
+	if !parsearEstado(valor).procesado() {
+		c.JSON(http.StatusConflict, gin.H{"error": "El documento no ha sido procesado por Hacienda"})
+		return
+	}
+
+	documento, err := documentos.Documento(empid, correlativo, iddte)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	plantilla, err := representacion.ObtenerPlantilla(rdb, empid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tipoDte := utils.ObtenerTiposLote(rdb, empid, correlativo)[iddte]
+	nombre, pdf, err := generarPdf(rdb, empid, correlativo, iddte, tipoDte, documento, plantilla)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", nombre))
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// HandlePdfLote devuelve un ZIP con los PDF de todos los IDDTE procesados de un lote
+func HandlePdfLote(c *gin.Context, rdb *redis.Client) {
+	token := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(token)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	correlativo := c.Param("correlativo")
+	nombreLote := fmt.Sprintf("%s_Lote_%s", empid, correlativo)
+	estados, err := rdb.HGetAll(context.Background(), nombreLote).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los estados del lote"})
+		return
+	}
+
+	procesados := make([]string, 0, len(estados))
+	for iddte, valor := range estados {
+		if parsearEstado(valor).procesado() {
+			procesados = append(procesados, iddte)
+		}
+	}
+	if len(procesados) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("El Lote_%s no tiene documentos procesados", correlativo)})
+		return
+	}
+	sort.Strings(procesados)
+
+	documentosLote, err := documentos.Leer(empid, correlativo)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No se encontraron los documentos del lote"})
+		return
+	}
+	plantilla, err := representacion.ObtenerPlantilla(rdb, empid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	tipos := utils.ObtenerTiposLote(rdb, empid, correlativo)
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("Lote_%s.zip", correlativo)))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	// Los PDF se escriben en el ZIP a medida que se generan
+	archivo := zip.NewWriter(c.Writer)
+	for _, iddte := range procesados {
+		documento, ok := documentosLote[strings.TrimPrefix(iddte, "IDDTE-")].(map[string]interface{})
+		if !ok {
+			log.Printf("No se encontró el documento %s del Lote_%s para el ZIP de PDF\n", iddte, correlativo)
+			continue
+		}
+		nombre, pdf, err := generarPdf(rdb, empid, correlativo, iddte, tipos[iddte], documento, plantilla)
+		if err != nil {
+			log.Printf("Error al generar el PDF de %s del Lote_%s: %v\n", iddte, correlativo, err)
+			continue
+		}
+		escritor, err := archivo.Create(nombre)
+		if err != nil {
+			log.Printf("Error al agregar el PDF de %s al ZIP: %v\n", iddte, err)
+			return
+		}
+		if _, err := escritor.Write(pdf); err != nil {
+			log.Printf("Error al agregar el PDF de %s al ZIP: %v\n", iddte, err)
+			return
+		}
+	}
+	if err := archivo.Close(); err != nil {
+		log.Printf("Error al cerrar el ZIP de PDF del Lote_%s: %v\n", correlativo, err)
+	}
+}
+
+// generarPdf devuelve el nombre de archivo y el PDF de un IDDTE
+func generarPdf(rdb *redis.Client, empid string, correlativo string, iddte string, tipoDte string, documento map[string]interface{}, plantilla representacion.Plantilla) (string, []byte, error) {
+	vista, err := documentos.CargarVista(rdb, empid, correlativo, iddte, tipoDte, documento)
+	if err != nil {
+		return "", nil, err
+	}
+	pdf, err := representacion.Generar(vista, plantilla)
+	if err != nil {
+		return "", nil, err
+	}
+
+	nombre := vista.CodigoGeneracion
+	if nombre == "" {
+		nombre = iddte
+	}
+	return nombre + ".pdf", pdf, nil
+}
+
+// HandleObtenerPlantillaPdf devuelve el diseño del PDF de una empresa
+func HandleObtenerPlantillaPdf(c *gin.Context, rdb *redis.Client) {
+	if !validarAdmin(c) {
+		return
+	}
+
+	plantilla, err := representacion.ObtenerPlantilla(rdb, c.Param("empid"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"plantilla": plantilla})
+}
+
+// HandleGuardarPlantillaPdf guarda el diseño del PDF de una empresa: logo, datos del emisor, color,
+// tamaño de página y pie
+func HandleGuardarPlantillaPdf(c *gin.Context, rdb *redis.Client) {
+	if !validarAdmin(c) {
+		return
+	}
+
+	var plantilla representacion.Plantilla
+	if err := c.ShouldBindJSON(&plantilla); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cuerpo de la solicitud inválido"})
+		return
+	}
+
+	if err := representacion.GuardarPlantilla(rdb, c.Param("empid"), plantilla); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Plantilla PDF guardada"})
+}
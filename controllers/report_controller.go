@@ -2,15 +2,15 @@ package controllers
 
 import (
 	"GoProcesadorExcel/authentication"
-	"bytes"
+	"GoProcesadorExcel/reportes"
+	"GoProcesadorExcel/utils"
 	"context"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"os"
-	"path/filepath"
-	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -18,28 +18,10 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
-	"github.com/tealeg/xlsx"
 )
 
-// KeyValue representa un par clave-valor
-type KeyValue struct {
-	Key   string
-	Value string
-}
-
-// Mensaje estructura del mensaje en el valor del par clave-valor
-type Mensaje struct {
-	CodigoGeneracion string `json:"CodigoGeneracion"`
-	SelloRecibido    string `json:"SelloRecibido"`
-	Estado           string `json:"Estado"`
-	DescripcionMsg   string `json:"DescripcionMsg"`
-}
-
-// Estructura del valor en el par clave-valor
-type Valor struct {
-	Codigo  int     `json:"Código"`
-	Mensaje Mensaje `json:"Mensaje"`
-}
+// tamanoLecturaEstados es el número de estados del lote que se leen de Redis por vez al generar el informe
+const tamanoLecturaEstados = 500
 
 func GetReporte(c *gin.Context, rdb *redis.Client) {
 	// Obtener el token del encabezado
@@ -56,281 +38,216 @@ func GetReporte(c *gin.Context, rdb *redis.Client) {
 	// Obtener el correlativo de la solicitud
 	correlativo := c.Param("correlativo")
 
-	// Obtener los datos desde Redis
-	data, err := getDatosRedis(rdb, empid, correlativo)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	formato := formatoReporte(c)
+	if formato != formatoBase64 && reportes.TipoContenido(formato) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Formato de informe no válido: %s", formato)})
 		return
 	}
 
-	fileName := fmt.Sprintf("%s_Lote_%s.xlsx", empid, correlativo)
-	// Generar el informe en Excel
-	fileBytes, err := generarInformeExcel(data, fileName)
+	// Obtener los IDDTE del lote; sus estados se leen por bloques a medida que se escribe el informe
+	claves, err := clavesLote(rdb, empid, correlativo)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error al generar el informe en Excel: %v", err)})
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Codificar los datos en base64
-	encodedFile := base64.StdEncoding.EncodeToString(fileBytes)
-
-	// Enviar los datos codificados en base64 como respuesta
-	c.JSON(http.StatusOK, gin.H{"ReporteExcel": encodedFile})
-}
+	// Agrupar las filas del informe por tipo de DTE
+	tipos := utils.ObtenerTiposLote(rdb, empid, correlativo)
+	claves = ordenarClaves(claves, tipos)
+	filas := filasLote(rdb, empid, correlativo, claves, tipos)
 
-// obtenerDatosDesdeRedis obtiene los datos desde Redis y los devuelve como una lista de KeyValue
-func getDatosRedis(rdb *redis.Client, empid string, correlativo string) ([]KeyValue, error) {
-	// Construir el nombre del lote usando el correlativo
-	nombreLote := fmt.Sprintf("%s_Lote_%s", empid, correlativo)
-
-	// Obtener todos los pares clave-valor del hash en Redis
-	data, err := rdb.HGetAll(context.Background(), nombreLote).Result()
-	if err != nil {
-		return nil, err
+	// El archivo original solo se copia en los informes en Excel
+	var originalFile *reportes.LibroOriginal
+	if formato == formatoBase64 || formato == reportes.FormatoXLSX {
+		originalFile, err = reportes.AbrirExcelOriginal(fmt.Sprintf("%s_Lote_%s.xlsx", empid, correlativo))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error al generar el informe en Excel: %v", err)})
+			return
+		}
+		if originalFile != nil {
+			defer originalFile.Close()
+		}
 	}
 
-	// Verificar si no se encontraron estados para el correlativo dado
-	if len(data) == 0 {
-		return nil, fmt.Errorf("no existe un lote con el correlativo %s", correlativo)
+	if formato == formatoBase64 {
+		// Mantener la respuesta JSON con el archivo en base64 para los clientes existentes. El Excel se genera
+		// primero en un archivo temporal para poder responder con un error si falla.
+		archivo, err := informeTemporal(filas, originalFile)
+		if err != nil {
+			log.Printf("Error al generar el informe %s del Lote_%s: %v\n", formato, correlativo, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error al generar el informe en Excel: %v", err)})
+			return
+		}
+		defer os.Remove(archivo.Name())
+		defer archivo.Close()
+
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := escribirInformeBase64(c.Writer, archivo); err != nil {
+			log.Printf("Error al enviar el informe %s del Lote_%s: %v\n", formato, correlativo, err)
+			abortarRespuesta(c)
+		}
+		return
 	}
 
-	// Crear una lista de KeyValue ordenada
-	var result []KeyValue
-	for key, value := range data {
-		result = append(result, KeyValue{Key: key, Value: value})
+	// Los demás formatos se escriben en la respuesta a medida que se generan; si fallan se corta la conexión
+	// para que el cliente no reciba un archivo incompleto como si estuviera completo
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("Lote_%s.%s", correlativo, formato)))
+	c.Header("Content-Type", reportes.TipoContenido(formato))
+	c.Status(http.StatusOK)
+	if err := reportes.Escribir(c.Writer, formato, filas, originalFile); err != nil {
+		log.Printf("Error al generar el informe %s del Lote_%s: %v\n", formato, correlativo, err)
+		abortarRespuesta(c)
 	}
-
-	// Ordenar las claves basadas en sus valores numéricos
-	sort.Slice(result, func(i, j int) bool {
-		return getNumero(result[i].Key) < getNumero(result[j].Key)
-	})
-
-	return result, nil
 }
 
-// Función para obtener el valor numérico de una clave
-func getNumero(clave string) int {
-	numeroStr := strings.TrimLeftFunc(clave, func(r rune) bool {
-		return !unicode.IsDigit(r) // Eliminar los caracteres no numéricos al principio
-	})
-	numero, _ := strconv.Atoi(numeroStr)
-	return numero
+// abortarRespuesta cierra la conexión sin terminar la respuesta, así el cliente detecta el error aunque ya
+// haya recibido el código 200 y parte del archivo
+func abortarRespuesta(c *gin.Context) {
+	if conexion, _, err := c.Writer.Hijack(); err == nil {
+		conexion.Close()
+		return
+	}
+	panic(http.ErrAbortHandler)
 }
 
-// Función para generar un informe en Excel
-func generarInformeExcel(data []KeyValue, lote string) ([]byte, error) {
-	// Construir el nombre del archivo de Excel del lote
-	originalFilePath := filepath.Join("data", "archivos_excel", lote)
+// formatoBase64 es el formato heredado del informe: JSON con el Excel en base64
+const formatoBase64 = "base64"
 
-	// Intentar abrir el archivo de Excel existente
-	var originalFile *xlsx.File
-	_, err := os.Stat(originalFilePath)
-	if !os.IsNotExist(err) {
-		originalFile, err = xlsx.OpenFile(originalFilePath)
-		if err != nil {
-			return nil, fmt.Errorf("error al abrir el archivo de Excel: %v", err)
-		}
+// formatoReporte elige el formato del informe. El parámetro ?format= (o ?formato=) tiene prioridad sobre el
+// encabezado Accept; sin ninguno se mantiene el JSON con el Excel en base64.
+func formatoReporte(c *gin.Context) string {
+	formato := c.Query("format")
+	if formato == "" {
+		formato = c.Query("formato")
 	}
-
-	// Crear un nuevo archivo de Excel
-	newFile := xlsx.NewFile()
-
-	// Crear una nueva hoja de informe en el nuevo archivo
-	informeSheet, err := newFile.AddSheet("Informe")
-	if err != nil {
-		return nil, fmt.Errorf("error al añadir la hoja 'Informe' al nuevo archivo de Excel: %v", err)
+	if formato != "" {
+		return strings.ToLower(formato)
 	}
-
-	// Escribir los encabezados de las columnas en la hoja 'Informe'
-	headerRow := informeSheet.AddRow()
-	headerRow.AddCell().SetValue("IDDTE")
-	headerRow.AddCell().SetValue("CodigoGeneracion")
-	headerRow.AddCell().SetValue("SelloRecibido")
-	headerRow.AddCell().SetValue("Estado")
-	headerRow.AddCell().SetValue("Mensaje")
-	headerRow.AddCell().SetValue("HojaError")
-
-	// Escribir los datos en la hoja 'Informe'
-	for _, kv := range data {
-		// Encontrar el índice de "Código"
-		startIndex := strings.Index(kv.Value, `Código: `)
-		if startIndex == -1 {
-			fmt.Printf("Formato inválido para clave %s\n", kv.Key)
-			continue
-		}
-
-		// Encontrar el índice de "Mensaje"
-		mensajeIndex := strings.Index(kv.Value, `Mensaje: {`)
-		if mensajeIndex == -1 {
-			fmt.Printf("Formato inválido para clave %s\n", kv.Key)
-			continue
-		}
-
-		// Extraer y deserializar el Código
-		codigoStr := kv.Value[startIndex+8 : mensajeIndex-2]
-		var v Valor
-		fmt.Sscanf(codigoStr, "%d", &v.Codigo)
-
-		// Extraer y deserializar el Mensaje
-		jsonData := kv.Value[mensajeIndex+9:]        // +9 para saltar "Mensaje: {"
-		endIndex := strings.LastIndex(jsonData, "}") // Encontrar el último cierre de objeto
-		if endIndex != -1 {
-			jsonData = jsonData[:endIndex+1] // Mantener hasta el cierre de "}"
-		}
-
-		// Añadir una nueva fila al archivo Excel en la hoja 'Informe'
-		row := informeSheet.AddRow()
-		row.AddCell().SetValue(kv.Key)
-
-		// Verificar si el mensaje contiene solo un campo "Message"
-		if v.Codigo == 400 || v.Codigo == 500 {
-			// Si el código es 400, evaluar el contenido de Mensaje
-			row.AddCell().SetValue("N/A")
-			row.AddCell().SetValue("N/A")
-			row.AddCell().SetValue("N/A")
-			row.AddCell().SetValue(fmt.Sprintf("%v", jsonData))
-
-			errorsSheet := verificacionErrorMessage(jsonData)
-			values := strings.Join(errorsSheet, ", ")
-			row.AddCell().SetValue(values)
-
-			boldStyle := xlsx.NewStyle()
-			boldStyle.Font.Bold = true
-			// Aplicar estilo de negrita si es la columna "HojaError"
-			if len(row.Cells) > 0 && row.Cells[len(row.Cells)-1].Value == values {
-				row.Cells[len(row.Cells)-1].SetStyle(boldStyle)
-			}
-
-		} else {
-			// Deserializar el mensaje completo
-			if err := json.Unmarshal([]byte(jsonData), &v.Mensaje); err != nil {
-				fmt.Printf("Error al parsear JSON para clave %s: %v\n", kv.Key, err)
-				continue
-			}
-
-			// Escribir los valores en las celdas correspondientes
-			if v.Mensaje.CodigoGeneracion == "" {
-				row.AddCell().SetValue("N/A")
-			} else {
-				row.AddCell().SetValue(v.Mensaje.CodigoGeneracion)
-			}
-			if v.Mensaje.SelloRecibido == "" {
-				row.AddCell().SetValue("N/A")
-			} else {
-				row.AddCell().SetValue(v.Mensaje.SelloRecibido)
-			}
-			if v.Mensaje.Estado == "" {
-				row.AddCell().SetValue("N/A")
-			} else {
-				row.AddCell().SetValue(v.Mensaje.Estado)
-			}
-			if v.Mensaje.DescripcionMsg == "" {
-				row.AddCell().SetValue("N/A")
-			} else {
-				row.AddCell().SetValue(v.Mensaje.DescripcionMsg)
-			}
-
-			errorValue := verificacionError(v)
-			row.AddCell().SetValue(errorValue)
-
-			boldStyle := xlsx.NewStyle()
-			boldStyle.Font.Bold = true
-			// Aplicar estilo de negrita si es la columna "HojaError"
-			if len(row.Cells) > 0 && row.Cells[len(row.Cells)-1].Value == errorValue {
-				row.Cells[len(row.Cells)-1].SetStyle(boldStyle)
-			}
-		}
-
-		// Determinar el color de la fila según si el valor indica un acierto o un error
-		var color string
-		if esAcierto(v) {
-			color = "C6EFCE" // verde
-		} else {
-			color = "FFC7CE" // rojo
-		}
-
-		// Aplicar el color a la fila
-		for i, cell := range row.Cells {
-			style := cell.GetStyle()
-			if i == 0 { // Solo aplicar color a la primera celda de cada fila de datos
-				style.Fill = *xlsx.NewFill("solid", color, color)
-				cell.SetStyle(style)
-			}
-			style.Font.Name = "Calibri"
-			style.Font.Size = 11
-		}
+	if aceptado := reportes.FormatoAceptado(c.GetHeader("Accept")); aceptado != "" {
+		return aceptado
 	}
+	return formatoBase64
+}
 
-	// Si el archivo original existe, copiar sus hojas al nuevo archivo
-	if originalFile != nil {
-		for _, sheet := range originalFile.Sheets {
-			newSheet, err := newFile.AddSheet(sheet.Name)
+// filasLote recorre las filas del informe en el orden de las claves, leyendo sus estados de Redis con HMGET
+// por bloques para que la memoria no dependa del número de IDDTE del lote
+func filasLote(rdb *redis.Client, empid string, correlativo string, claves []string, tipos map[string]string) reportes.Filas {
+	nombreLote := fmt.Sprintf("%s_Lote_%s", empid, correlativo)
+	return func(escribir func(reportes.Fila) error) error {
+		for inicio := 0; inicio < len(claves); inicio += tamanoLecturaEstados {
+			bloque := claves[inicio:min(inicio+tamanoLecturaEstados, len(claves))]
+			valores, err := rdb.HMGet(context.Background(), nombreLote, bloque...).Result()
 			if err != nil {
-				return nil, fmt.Errorf("error al añadir la hoja '%s' al nuevo archivo de Excel: %v", sheet.Name, err)
+				return fmt.Errorf("error al obtener los estados del lote: %v", err)
 			}
-			for _, row := range sheet.Rows {
-				newRow := newSheet.AddRow()
-				for _, cell := range row.Cells {
-					newCell := newRow.AddCell()
-					newCell.Value = cell.Value
-					style := cell.GetStyle()
-					newCell.SetStyle(style)
+			for i, valor := range valores {
+				// Un IDDTE borrado después de listar las claves no tiene estado
+				estado, ok := valor.(string)
+				if !ok {
+					continue
+				}
+				if fila, ok := reportes.NuevaFila(bloque[i], tipos[bloque[i]], estado); ok {
+					if err := escribir(fila); err != nil {
+						return err
+					}
 				}
 			}
 		}
+		return nil
 	}
-	// Guardar el nuevo archivo de Excel en un buffer
-	var buffer bytes.Buffer
-	err = newFile.Write(&buffer)
-	if err != nil {
-		return nil, fmt.Errorf("error al guardar el archivo de Excel: %v", err)
-	}
-
-	return buffer.Bytes(), nil
 }
 
-// esAcierto determina si el valor indica un acierto o un error
-func esAcierto(v Valor) bool {
-	return v.Codigo == 200 && v.Mensaje.CodigoGeneracion != "" && v.Mensaje.SelloRecibido != "" && v.Mensaje.Estado == "PROCESADO"
-}
-
-func verificacionError(rowData Valor) string {
-	// Verificar todas las condiciones necesarias para determinar el contenido de "HojaError"
-	if rowData.Mensaje.Estado == "RECHAZADO" && strings.Contains(rowData.Mensaje.DescripcionMsg, "cuerpoDocumento.item") {
-		return "Detalles"
+// informeTemporal genera el informe en Excel en un archivo temporal y lo devuelve listo para leerse
+func informeTemporal(filas reportes.Filas, originalFile *reportes.LibroOriginal) (*os.File, error) {
+	archivo, err := os.CreateTemp("", "informe_*.xlsx")
+	if err != nil {
+		return nil, err
 	}
-	if rowData.Mensaje.Estado == "RECHAZADO" && strings.Contains(rowData.Mensaje.DescripcionMsg, "Receptor.") {
-		return "Receptor"
+	if err := reportes.EscribirExcel(archivo, filas, originalFile); err != nil {
+		archivo.Close()
+		os.Remove(archivo.Name())
+		return nil, err
 	}
-	if rowData.Mensaje.Estado == "RECHAZADO" && strings.Contains(rowData.Mensaje.DescripcionMsg, "documentoRelacionado") {
-		return "DocumentosRelacionados"
+	if _, err := archivo.Seek(0, io.SeekStart); err != nil {
+		archivo.Close()
+		os.Remove(archivo.Name())
+		return nil, err
 	}
-
-	return "N/A"
+	return archivo, nil
 }
 
-func verificacionErrorMessage(message string) []string {
-	var errorsSheets []string
-	re := regexp.MustCompile(`Detalles\[\d+\].`)
-
-	// Ejemplo de lógica:
-	if strings.Contains(message, "Receptor.") {
-		errorsSheets = append(errorsSheets, "Receptor")
+// escribirInformeBase64 escribe {"ReporteExcel": "<archivo en base64>"} sin cargar el archivo completo en memoria
+func escribirInformeBase64(w io.Writer, excel io.Reader) error {
+	if _, err := io.WriteString(w, `{"ReporteExcel":"`); err != nil {
+		return err
 	}
-	if strings.Contains(message, "DocumentosRelacionados") {
-		errorsSheets = append(errorsSheets, "DocumentosRelacionados")
+	codificador := base64.NewEncoder(base64.StdEncoding, w)
+	if _, err := io.Copy(codificador, excel); err != nil {
+		return err
 	}
-	if strings.Contains(message, "No existe establecimiento con codigo") {
-		errorsSheets = append(errorsSheets, "Identificacion")
+	if err := codificador.Close(); err != nil {
+		return err
 	}
-	if re.MatchString(message) {
-		errorsSheets = append(errorsSheets, "Detalles")
+	_, err := io.WriteString(w, `"}`)
+	return err
+}
+
+// clavesLote obtiene los IDDTE del lote recorriendo el hash con HSCAN; los estados no se conservan
+func clavesLote(rdb *redis.Client, empid string, correlativo string) ([]string, error) {
+	// Construir el nombre del lote usando el correlativo
+	nombreLote := fmt.Sprintf("%s_Lote_%s", empid, correlativo)
+
+	var claves []string
+	var cursor uint64
+	for {
+		// HSCAN devuelve la clave y el valor alternados
+		pares, siguiente, err := rdb.HScan(context.Background(), nombreLote, cursor, "", tamanoLecturaEstados).Result()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(pares); i += 2 {
+			claves = append(claves, pares[i])
+		}
+		if siguiente == 0 {
+			break
+		}
+		cursor = siguiente
 	}
 
-	if len(errorsSheets) == 0 {
-		errorsSheets = append(errorsSheets, "N/A")
+	// Verificar si no se encontraron estados para el correlativo dado
+	if len(claves) == 0 {
+		return nil, fmt.Errorf("no existe un lote con el correlativo %s", correlativo)
 	}
+	return claves, nil
+}
 
-	// Por defecto
-	return errorsSheets
+// Función para obtener el valor numérico de una clave
+func getNumero(clave string) int {
+	numeroStr := strings.TrimLeftFunc(clave, func(r rune) bool {
+		return !unicode.IsDigit(r) // Eliminar los caracteres no numéricos al principio
+	})
+	numero, _ := strconv.Atoi(numeroStr)
+	return numero
+}
+
+// ordenarClaves agrupa los IDDTE por tipo de DTE y los ordena por su número dentro de cada tipo. HSCAN puede
+// devolver una clave más de una vez, así que se quitan las repetidas.
+func ordenarClaves(claves []string, tipos map[string]string) []string {
+	sort.Slice(claves, func(i, j int) bool {
+		if tipos[claves[i]] != tipos[claves[j]] {
+			return tipos[claves[i]] < tipos[claves[j]]
+		}
+		if getNumero(claves[i]) != getNumero(claves[j]) {
+			return getNumero(claves[i]) < getNumero(claves[j])
+		}
+		return claves[i] < claves[j]
+	})
+	unicas := claves[:0]
+	for i, clave := range claves {
+		if i == 0 || clave != claves[i-1] {
+			unicas = append(unicas, clave)
+		}
+	}
+	return unicas
 }
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/reportes"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tealeg/xlsx"
+)
+
+func TestEscribirInformeExcel(t *testing.T) {
+	var filas []reportes.Fila
+	for i := 1; i <= 3; i++ {
+		tipo := ""
+		if i == 1 {
+			tipo = "01"
+		}
+		fila, _ := reportes.NuevaFila(fmt.Sprintf("IDDTE-%d", i), tipo, fmt.Sprintf(`Código: 200, Mensaje: {"CodigoGeneracion": "COD-%d", "SelloRecibido": "SELLO", "Estado": "PROCESADO", "DescripcionMsg": "RECIBIDO"}`, i))
+		filas = append(filas, fila)
+	}
+	fila, _ := reportes.NuevaFila("IDDTE-4", "", `Código: 400, Mensaje: {"Message": "Receptor.Nrc no válido"}`)
+	filas = append(filas, fila)
+
+	original := xlsx.NewFile()
+	hoja, _ := original.AddSheet("Identificacion")
+	encabezados := hoja.AddRow()
+	encabezados.AddCell().SetValue("IDDTE")
+	encabezados.AddCell().SetValue("TipoDte")
+	hoja.AddRow().AddCell().SetValue("1")
+	ruta := filepath.Join(t.TempDir(), "original.xlsx")
+	if err := original.Save(ruta); err != nil {
+		t.Fatal(err)
+	}
+	libroOriginal, err := reportes.AbrirLibro(ruta)
+	if err != nil {
+		t.Fatalf("No se pudo leer el archivo original: %v", err)
+	}
+	defer libroOriginal.Close()
+
+	archivo, err := informeTemporal(reportes.Lista(filas), libroOriginal)
+	if err != nil {
+		t.Fatalf("Error al generar el informe: %v", err)
+	}
+	defer os.Remove(archivo.Name())
+	defer archivo.Close()
+
+	var salida bytes.Buffer
+	if err := escribirInformeBase64(&salida, archivo); err != nil {
+		t.Fatalf("Error al escribir el informe: %v", err)
+	}
+	var respuesta struct {
+		ReporteExcel string
+	}
+	if err := json.Unmarshal(salida.Bytes(), &respuesta); err != nil {
+		t.Fatalf("La respuesta no es JSON: %v", err)
+	}
+	contenido, err := base64.StdEncoding.DecodeString(respuesta.ReporteExcel)
+	if err != nil {
+		t.Fatalf("El informe no está en base64: %v", err)
+	}
+
+	informe, err := xlsx.OpenBinary(contenido)
+	if err != nil {
+		t.Fatalf("El informe no es un Excel válido: %v", err)
+	}
+	if len(informe.Sheets) != 2 || informe.Sheets[1].Name != "Identificacion" {
+		t.Fatalf("Hojas inesperadas: %d", len(informe.Sheets))
+	}
+	escritas := informe.Sheets[0].Rows
+	if len(escritas) != 5 {
+		t.Fatalf("Se esperaban 5 filas en 'Informe', hay %d", len(escritas))
+	}
+	if escritas[1].Cells[1].Value != "01" || escritas[3].Cells[2].Value != "COD-3" {
+		t.Errorf("Fila inesperada: %v, %v", escritas[1].Cells[1].Value, escritas[3].Cells[2].Value)
+	}
+	if escritas[4].Cells[6].Value != "Receptor" {
+		t.Errorf("HojaError %q, se esperaba Receptor", escritas[4].Cells[6].Value)
+	}
+	if len(informe.Sheets[1].Rows) != 2 {
+		t.Errorf("Se esperaban 2 filas en la hoja copiada, hay %d", len(informe.Sheets[1].Rows))
+	}
+}
+
+func TestOrdenarClaves(t *testing.T) {
+	tipos := map[string]string{"IDDTE-2": "03", "IDDTE-10": "01", "IDDTE-1": "01"}
+	claves := ordenarClaves([]string{"IDDTE-2", "IDDTE-10", "IDDTE-1", "IDDTE-10"}, tipos)
+	esperadas := []string{"IDDTE-1", "IDDTE-10", "IDDTE-2"}
+	if fmt.Sprint(claves) != fmt.Sprint(esperadas) {
+		t.Errorf("ordenarClaves = %v, se esperaba %v", claves, esperadas)
+	}
+}
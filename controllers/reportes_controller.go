@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/authentication"
+	"GoProcesadorExcel/documentos"
+	"GoProcesadorExcel/registro"
+	"GoProcesadorExcel/reportes"
+	"GoProcesadorExcel/utils"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// maxLotesConsolidado es el número máximo de lotes que recorre el informe consolidado, porque sus filas se
+// ordenan y resumen en memoria antes de escribirse
+const maxLotesConsolidado = 100
+
+// errInformeAmplio indica que el periodo del informe consolidado abarca demasiados lotes
+var errInformeAmplio = fmt.Errorf("El periodo abarca más de %d lotes; acótelo con from y to", maxLotesConsolidado)
+
+// HandleReporteConsolidado genera el informe de todos los IDDTE de la empresa en un periodo, con los filtros
+// ?from=&to= (AAAA-MM-DD), ?tipoDte= y ?estado= (listas separadas por comas). El formato es xlsx, con las hojas
+// 'Documentos' y 'Resumen', o csv; con ?format=csv&hoja=resumen se obtiene el resumen en CSV.
+func HandleReporteConsolidado(c *gin.Context, rdb *redis.Client) {
+	token := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(token)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	filtro := reportes.FiltroConsolidado{
+		TiposDte: listaParametro(c.Query("tipoDte")),
+		Estados:  listaParametro(c.Query("estado")),
+	}
+	if filtro.Desde, err = fechaParametro(c.Query("from")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Fecha inicial no válida, use el formato AAAA-MM-DD"})
+		return
+	}
+	if filtro.Hasta, err = fechaParametro(c.Query("to")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Fecha final no válida, use el formato AAAA-MM-DD"})
+		return
+	}
+	if !filtro.Desde.IsZero() && !filtro.Hasta.IsZero() && filtro.Hasta.Before(filtro.Desde) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La fecha final es anterior a la fecha inicial"})
+		return
+	}
+
+	formato := strings.ToLower(c.Query("format"))
+	if formato == "" {
+		formato = reportes.FormatoAceptado(c.GetHeader("Accept"))
+	}
+	if formato == "" {
+		formato = reportes.FormatoXLSX
+	}
+	if formato != reportes.FormatoXLSX && formato != reportes.FormatoCSV {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Formato de informe no válido: %s", formato)})
+		return
+	}
+
+	filas, err := filasConsolidadas(rdb, empid, filtro)
+	if err == errInformeAmplio {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	reportes.OrdenarConsolidado(filas)
+	resumen := reportes.Resumir(filas)
+
+	nombre := "Reporte"
+	if !filtro.Desde.IsZero() {
+		nombre += "_" + filtro.Desde.Format("2006-01-02")
+	}
+	if !filtro.Hasta.IsZero() {
+		nombre += "_" + filtro.Hasta.Format("2006-01-02")
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", nombre+"."+formato))
+	c.Header("Content-Type", reportes.TipoContenido(formato))
+	c.Status(http.StatusOK)
+
+	// Si la generación falla se corta la conexión para que el cliente no reciba un archivo incompleto como
+	// si estuviera completo
+	switch {
+	case formato == reportes.FormatoXLSX:
+		err = reportes.EscribirConsolidadoExcel(c.Writer, filas, resumen)
+	case c.Query("hoja") == "resumen":
+		err = reportes.EscribirResumenCSV(c.Writer, resumen)
+	default:
+		err = reportes.EscribirConsolidadoCSV(c.Writer, filas)
+	}
+	if err != nil {
+		log.Printf("Error al generar el informe consolidado de %s: %v\n", empid, err)
+		abortarRespuesta(c)
+	}
+}
+
+// filasConsolidadas recorre los lotes de la empresa creados en el periodo y devuelve los IDDTE que cumplen el
+// filtro; devuelve errInformeAmplio si el periodo abarca más de maxLotesConsolidado lotes
+func filasConsolidadas(rdb *redis.Client, empid string, filtro reportes.FiltroConsolidado) ([]reportes.Consolidada, error) {
+	ctx := context.Background()
+
+	// Un documento no se emite antes de que se cree su lote, y se envía el mismo día en que se crea; el día
+	// de margen cubre los envíos que terminan después de medianoche
+	consulta := registro.Consulta{}
+	if !filtro.Desde.IsZero() {
+		consulta.FechaDesde = filtro.Desde.AddDate(0, 0, -1)
+	}
+	if !filtro.Hasta.IsZero() {
+		consulta.FechaHasta = filtro.Hasta.AddDate(0, 0, 1)
+	}
+	correlativos, err := registro.Lotes(rdb, empid, consulta)
+	if err != nil {
+		return nil, err
+	}
+	if len(correlativos) > maxLotesConsolidado {
+		return nil, errInformeAmplio
+	}
+	fechas, err := registro.Fechas(rdb, empid, correlativos)
+	if err != nil {
+		return nil, err
+	}
+
+	var filas []reportes.Consolidada
+	for _, correlativo := range correlativos {
+		clave := fmt.Sprintf("%s_Lote_%s", empid, correlativo)
+		fechaLote := fechas[correlativo]
+
+		estados, err := rdb.HGetAll(ctx, clave).Result()
+		if err != nil {
+			log.Printf("Error al obtener los estados del Lote_%s: %v\n", correlativo, err)
+			continue
+		}
+		tipos := utils.ObtenerTiposLote(rdb, empid, correlativo)
+		documentosLote, err := documentos.Leer(empid, correlativo)
+		if err != nil {
+			log.Printf("No se pudieron leer los documentos del Lote_%s para el informe consolidado: %v\n", correlativo, err)
+		}
+
+		for iddte, valor := range estados {
+			fila, ok := reportes.NuevaFila(iddte, tipos[iddte], valor)
+			if !ok {
+				continue
+			}
+			documento, _ := documentosLote[strings.TrimPrefix(iddte, "IDDTE-")].(map[string]interface{})
+			_, respuesta, _ := documentos.ParsearEstado(valor)
+			vista := documentos.NuevaVista(documento, tipos[iddte], respuesta)
+
+			consolidada := reportes.NuevaConsolidada("Lote_"+correlativo, fila, vista, fechaLote)
+			if filtro.Acepta(consolidada) {
+				filas = append(filas, consolidada)
+			}
+		}
+	}
+	return filas, nil
+}
+
+// fechaParametro interpreta una fecha AAAA-MM-DD; un valor vacío devuelve la fecha cero
+func fechaParametro(valor string) (time.Time, error) {
+	if valor == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation("2006-01-02", valor, time.Local)
+}
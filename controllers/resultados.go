@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/documentos"
+)
+
+// estadoIddte es el estado guardado en Redis para un IDDTE: el código de la respuesta y su mensaje
+type estadoIddte struct {
+	Codigo  int
+	Mensaje map[string]interface{}
+	Texto   string
+}
+
+// parsearEstado interpreta un valor con el formato "Código: 200, Mensaje: {...}"; si el mensaje no es
+// JSON solo se conserva su texto
+func parsearEstado(valor string) estadoIddte {
+	codigo, mensaje, texto := documentos.ParsearEstado(valor)
+	return estadoIddte{Codigo: codigo, Mensaje: mensaje, Texto: texto}
+}
+
+// campo devuelve un campo del mensaje como texto
+func (e estadoIddte) campo(nombre string) string {
+	return documentos.Texto(e.Mensaje, nombre)
+}
+
+// procesado indica si la API aceptó el documento
+func (e estadoIddte) procesado() bool {
+	return e.Codigo == 200 && e.campo("CodigoGeneracion") != "" && e.campo("SelloRecibido") != "" && e.campo("Estado") == "PROCESADO"
+}
@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/authentication"
+	"GoProcesadorExcel/eventos"
+	"GoProcesadorExcel/utils"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// directorioErroresCSV es la carpeta con los archivos de errores de la conversión
+var directorioErroresCSV = filepath.Join("data", "csvErrors")
+
+// advertenciaConversion es una fila del archivo de errores que el conversor genera para cada lote
+type advertenciaConversion struct {
+	IDDTE   string `json:"iddte,omitempty"`
+	Mensaje string `json:"mensaje"`
+	Nivel   string `json:"nivel"`
+}
+
+// HandleResumenLote devuelve las estadísticas de un lote: los IDDTE por código HTTP, estado, categoría de error
+// y hoja, la duración de cada fase, los documentos por segundo y las advertencias de la conversión. Los contadores
+// se actualizan al guardar cada resultado; los lotes anteriores se resumen una vez a partir de sus estados.
+func HandleResumenLote(c *gin.Context, rdb *redis.Client) {
+	token := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(token)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	correlativo := c.Param("correlativo")
+	resumen, ok, err := eventos.ObtenerResumenLote(rdb, empid, correlativo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok || resumen.Total == 0 {
+		// El lote es anterior al resumen o no tiene resultados todavía
+		estados, err := rdb.HGetAll(context.Background(), fmt.Sprintf("%s_Lote_%s", empid, correlativo)).Result()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los estados del lote"})
+			return
+		}
+		if len(estados) == 0 && !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No existe un lote con el correlativo %s", correlativo)})
+			return
+		}
+		tipos := utils.ObtenerTiposLote(rdb, empid, correlativo)
+		for iddte, valor := range estados {
+			eventos.RegistrarResultado(rdb, empid, correlativo, iddte, tipos[iddte], valor)
+		}
+		if len(estados) > 0 {
+			if resumen, _, err = eventos.ObtenerResumenLote(rdb, empid, correlativo); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+	}
+
+	advertencias, err := advertenciasConversion(empid, correlativo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"resumen": resumen, "advertencias": advertencias})
+}
+
+// advertenciasConversion lee el archivo de errores más reciente de la conversión del lote. El conversor lo
+// nombra con el lote y la fecha (AAAAMMDDhhmmss) y marca con SUCCESS los IDDTE convertidos sin problemas.
+func advertenciasConversion(empid string, correlativo string) ([]advertenciaConversion, error) {
+	advertencias := []advertenciaConversion{}
+	prefijo := fmt.Sprintf("%s_Lote_%s", empid, correlativo)
+	patron := regexp.MustCompile(`^` + regexp.QuoteMeta(prefijo) + `\d{14}\.csv$`)
+
+	entradas, err := os.ReadDir(directorioErroresCSV)
+	if os.IsNotExist(err) {
+		return advertencias, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al leer los archivos de errores de la conversión: %v", err)
+	}
+	var archivos []string
+	for _, entrada := range entradas {
+		if patron.MatchString(entrada.Name()) {
+			archivos = append(archivos, entrada.Name())
+		}
+	}
+	if len(archivos) == 0 {
+		return advertencias, nil
+	}
+	sort.Strings(archivos)
+
+	archivo, err := os.Open(filepath.Join(directorioErroresCSV, archivos[len(archivos)-1]))
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir el archivo de errores de la conversión: %v", err)
+	}
+	defer archivo.Close()
+
+	lector := csv.NewReader(archivo)
+	lector.FieldsPerRecord = -1
+	registros, err := lector.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error al leer el archivo de errores de la conversión: %v", err)
+	}
+	for _, registro := range registros {
+		if len(registro) < 2 {
+			continue
+		}
+		nivel := "Error"
+		if len(registro) >= 4 && registro[3] != "" {
+			nivel = registro[3]
+		}
+		if strings.EqualFold(nivel, "SUCCESS") {
+			continue
+		}
+		advertencia := advertenciaConversion{Mensaje: registro[1], Nivel: nivel}
+		if registro[0] != "" {
+			advertencia.IDDTE = "IDDTE-" + strings.TrimPrefix(registro[0], "IDDTE-")
+		}
+		advertencias = append(advertencias, advertencia)
+	}
+	return advertencias, nil
+}
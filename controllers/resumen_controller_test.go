@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAdvertenciasConversion(t *testing.T) {
+	anterior := directorioErroresCSV
+	directorioErroresCSV = t.TempDir()
+	defer func() { directorioErroresCSV = anterior }()
+
+	archivos := map[string]string{
+		"emp_Lote_00720240101090000.csv":  "1,Error viejo,,Error\n",
+		"emp_Lote_00720240102090000.csv":  "1,,,SUCCESS\n2,\"Columna 'Nrc' vacía, se omite\",20240102,Error\n,La hoja 'Extension' está vacia.,,Error\n",
+		"emp_Lote_007120240103090000.csv": "9,Otro lote,,Error\n",
+	}
+	for nombre, contenido := range archivos {
+		if err := os.WriteFile(filepath.Join(directorioErroresCSV, nombre), []byte(contenido), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	advertencias, err := advertenciasConversion("emp", "007")
+	if err != nil {
+		t.Fatalf("Error al leer las advertencias: %v", err)
+	}
+	if len(advertencias) != 2 || advertencias[0].IDDTE != "IDDTE-2" || advertencias[1].IDDTE != "" {
+		t.Errorf("Advertencias inesperadas: %+v", advertencias)
+	}
+}
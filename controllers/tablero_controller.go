@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/authentication"
+	"GoProcesadorExcel/eventos"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+)
+
+// Tiempos de la conexión del tablero
+const (
+	esperaEscritura = 10 * time.Second
+	esperaPong      = 60 * time.Second
+	intervaloPing   = 45 * time.Second
+)
+
+// El CORS de la API ya permite cualquier origen
+var actualizador = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// HandleTablero abre un WebSocket con la actividad de la empresa: lotes recibidos, cambios de fase,
+// resultados de los IDDTE, resúmenes y los contadores del día. Los parámetros tipoDte y estado (listas
+// separadas por comas) filtran los eventos; el cliente puede cambiar el filtro enviando
+// {"tipoDte": [...], "estado": [...]}.
+func HandleTablero(c *gin.Context, rdb *redis.Client) {
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(tokenSolicitud(c))
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	filtro := eventos.Filtro{
+		TiposDte: listaParametro(c.Query("tipoDte")),
+		Estados:  listaParametro(c.Query("estado")),
+	}
+
+	conexion, err := actualizador.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("Error al abrir el WebSocket del tablero de la empresa %s: %v\n", empid, err)
+		return
+	}
+	defer conexion.Close()
+
+	ctx := c.Request.Context()
+	suscripcion := rdb.Subscribe(ctx, eventos.Canal(empid))
+	defer suscripcion.Close()
+
+	// Leer los cambios de filtro del cliente; la lectura también detecta el cierre de la conexión
+	filtros := make(chan eventos.Filtro)
+	cerrada := make(chan struct{})
+	terminado := make(chan struct{})
+	defer close(terminado)
+	go func() {
+		defer close(cerrada)
+		conexion.SetReadDeadline(time.Now().Add(esperaPong))
+		conexion.SetPongHandler(func(string) error {
+			return conexion.SetReadDeadline(time.Now().Add(esperaPong))
+		})
+		for {
+			var nuevo eventos.Filtro
+			if err := conexion.ReadJSON(&nuevo); err != nil {
+				return
+			}
+			select {
+			case filtros <- nuevo:
+			case <-terminado:
+				return
+			}
+		}
+	}()
+
+	if !enviarContadores(conexion, rdb, empid) {
+		return
+	}
+
+	mensajes := suscripcion.Channel()
+	ping := time.NewTicker(intervaloPing)
+	defer ping.Stop()
+	for {
+		select {
+		case <-cerrada:
+			return
+		case <-ctx.Done():
+			return
+		case nuevo := <-filtros:
+			filtro = nuevo
+		case <-ping.C:
+			conexion.SetWriteDeadline(time.Now().Add(esperaEscritura))
+			if err := conexion.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case mensaje, ok := <-mensajes:
+			if !ok {
+				return
+			}
+			evento, err := eventos.Decodificar(mensaje.Payload)
+			if err != nil {
+				continue
+			}
+			if filtro.Acepta(evento) {
+				conexion.SetWriteDeadline(time.Now().Add(esperaEscritura))
+				if err := conexion.WriteJSON(evento); err != nil {
+					return
+				}
+			}
+			// Los contadores cambian con los lotes recibidos y los resultados de los IDDTE
+			if evento.Tipo == eventos.TipoIddte || evento.Datos["fase"] == eventos.FaseRecibido {
+				if !enviarContadores(conexion, rdb, empid) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// enviarContadores envía los contadores del día; devuelve false si la conexión se cerró
+func enviarContadores(conexion *websocket.Conn, rdb *redis.Client, empid string) bool {
+	contadores, err := eventos.Contadores(rdb, empid)
+	if err != nil {
+		log.Printf("Error al obtener los contadores del tablero de la empresa %s: %v\n", empid, err)
+		return true
+	}
+
+	datos := make(map[string]interface{}, len(contadores))
+	for campo, valor := range contadores {
+		datos[campo] = valor
+	}
+	conexion.SetWriteDeadline(time.Now().Add(esperaEscritura))
+	err = conexion.WriteJSON(eventos.Evento{Tipo: eventos.TipoContadores, Fecha: time.Now(), Datos: datos})
+	return err == nil
+}
+
+// listaParametro separa un parámetro con valores separados por comas
+func listaParametro(valor string) []string {
+	var lista []string
+	for _, elemento := range strings.Split(valor, ",") {
+		if elemento = strings.TrimSpace(elemento); elemento != "" {
+			lista = append(lista, elemento)
+		}
+	}
+	return lista
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/authentication"
+	"GoProcesadorExcel/mapeo"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// HandlePlantilla genera la plantilla de Excel que espera el conversor para un tipo de DTE y la empresa del token
+func HandlePlantilla(c *gin.Context, rdb *redis.Client) {
+
+	token := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(token)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	tipoDte := c.Param("tipoDte")
+
+	tipos, err := mapeo.CargarTipos()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	configuracion, err := mapeo.ObtenerConfiguracion(rdb, empid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	hojas, err := mapeo.Definicion(tipoDte, tipos, configuracion)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "tiposDte": mapeo.TiposDteDefinidos()})
+		return
+	}
+
+	plantilla, err := mapeo.GenerarPlantilla(hojas)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error al generar la plantilla: %v", err)})
+		return
+	}
+
+	nombreArchivo := fmt.Sprintf("Plantilla_%s.xlsx", tipoDte)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", nombreArchivo))
+	c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", plantilla)
+}
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"GoProcesadorExcel/authentication"
+	"GoProcesadorExcel/webhooks"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// solicitudWebhook es el cuerpo de POST /webhooks
+type solicitudWebhook struct {
+	URL     string   `json:"url"`
+	Secreto string   `json:"secreto"`
+	Eventos []string `json:"eventos"`
+}
+
+// HandleListarWebhooks devuelve las suscripciones de la empresa sin sus secretos
+func HandleListarWebhooks(c *gin.Context, rdb *redis.Client) {
+
+	token := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(token)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	suscripciones, err := webhooks.Listar(rdb, empid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range suscripciones {
+		suscripciones[i].Secreto = ""
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": suscripciones, "eventos": webhooks.Eventos})
+}
+
+// HandleCrearWebhook registra una suscripción. El secreto solo se devuelve en esta respuesta.
+func HandleCrearWebhook(c *gin.Context, rdb *redis.Client) {
+
+	token := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(token)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var solicitud solicitudWebhook
+	if err := c.ShouldBindJSON(&solicitud); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cuerpo de la solicitud inválido"})
+		return
+	}
+
+	suscripcion, err := webhooks.Crear(rdb, empid, strings.TrimSpace(solicitud.URL), solicitud.Secreto, solicitud.Eventos)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook registrado", "webhook": suscripcion})
+}
+
+// HandleEliminarWebhook elimina una suscripción de la empresa
+func HandleEliminarWebhook(c *gin.Context, rdb *redis.Client) {
+
+	token := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(token)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = webhooks.Eliminar(rdb, empid, c.Param("id"))
+	if err == webhooks.ErrSuscripcionNoExiste {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook eliminado"})
+}
+
+// HandleProbarWebhook envía un evento de prueba a la suscripción y devuelve el resultado de la entrega
+func HandleProbarWebhook(c *gin.Context, rdb *redis.Client) {
+
+	token := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(token)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	suscripcion, err := webhooks.Obtener(rdb, empid, c.Param("id"))
+	if err == webhooks.ErrSuscripcionNoExiste {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	entrega := webhooks.Entregar(rdb, empid, *suscripcion, webhooks.EventoPrueba, gin.H{"message": "Entrega de prueba"})
+	if entrega.Estado != webhooks.EntregaExitosa {
+		c.JSON(http.StatusBadGateway, gin.H{"error": entrega.Error, "entrega": entrega})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Entrega de prueba exitosa", "entrega": entrega})
+}
+
+// HandleEntregasWebhooks devuelve el registro de entregas de los webhooks de la empresa
+func HandleEntregasWebhooks(c *gin.Context, rdb *redis.Client) {
+
+	token := c.GetHeader("Authorization")
+
+	// Validar el token
+	empid, err := authentication.ValidateToken(token)
+	if err != nil {
+		// Manejar el error, por ejemplo, enviar una respuesta de error al cliente
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	entregas, err := webhooks.ListarEntregas(rdb, empid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entregas": entregas})
+}
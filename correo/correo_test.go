@@ -0,0 +1,110 @@
+package correo
+
+import (
+	"GoProcesadorExcel/documentos"
+	"GoProcesadorExcel/representacion"
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+// servidorPrueba es un SMTP mínimo que acepta un mensaje y lo devuelve por el canal
+func servidorPrueba(t *testing.T) (string, string, <-chan string) {
+	escucha, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error al iniciar el servidor SMTP de prueba: %v", err)
+	}
+	recibidos := make(chan string, 1)
+
+	go func() {
+		defer escucha.Close()
+		conexion, err := escucha.Accept()
+		if err != nil {
+			return
+		}
+		defer conexion.Close()
+
+		lector := bufio.NewReader(conexion)
+		responder := func(linea string) { conexion.Write([]byte(linea + "\r\n")) }
+		responder("220 prueba")
+		var datos strings.Builder
+		for {
+			linea, err := lector.ReadString('\n')
+			if err != nil {
+				return
+			}
+			comando := strings.ToUpper(strings.TrimSpace(linea))
+			switch {
+			case strings.HasPrefix(comando, "EHLO"), strings.HasPrefix(comando, "HELO"):
+				responder("250 prueba")
+			case comando == "DATA":
+				responder("354 continuar")
+				for {
+					linea, err := lector.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if linea == ".\r\n" {
+						break
+					}
+					datos.WriteString(linea)
+				}
+				recibidos <- datos.String()
+				responder("250 recibido")
+			case comando == "QUIT":
+				responder("221 adios")
+				return
+			default:
+				responder("250 ok")
+			}
+		}
+	}()
+
+	host, puerto, _ := net.SplitHostPort(escucha.Addr().String())
+	return host, puerto, recibidos
+}
+
+func TestEnviarDocumento(t *testing.T) {
+	host, puerto, recibidos := servidorPrueba(t)
+	servidor := Servidor{Host: host, Puerto: puerto, Remitente: "dte@empresa.com"}
+
+	documento := map[string]interface{}{
+		"Receptor": map[string]interface{}{"Nombres": "Cliente de prueba", "Correo": "cliente@correo.com"},
+		"Detalles": []interface{}{map[string]interface{}{"Cantidad": 2.0, "Descripcion": "Servicio", "PrecioUnitario": 5.0}},
+	}
+	respuesta := map[string]interface{}{"CodigoGeneracion": "ABC-123", "SelloRecibido": "SELLO", "Estado": "PROCESADO"}
+	vista := documentos.NuevaVista(documento, "01", respuesta)
+	if vista.Total != 10 {
+		t.Errorf("Total %v, se esperaba 10", vista.Total)
+	}
+
+	asunto, cuerpo, err := PlantillaPredeterminada.Generar(vista)
+	if err != nil {
+		t.Fatalf("Error al generar la plantilla: %v", err)
+	}
+	adjuntos, err := adjuntosDocumento(documento, vista, representacion.PlantillaPredeterminada)
+	if err != nil {
+		t.Fatalf("Error al generar los adjuntos: %v", err)
+	}
+	mensaje, err := construirMensaje(servidor.Remitente, documentos.CorreoReceptor(documento), asunto, cuerpo, adjuntos)
+	if err != nil {
+		t.Fatalf("Error al generar el mensaje: %v", err)
+	}
+	if err := servidor.Enviar(documentos.CorreoReceptor(documento), mensaje); err != nil {
+		t.Fatalf("Error al enviar el correo: %v", err)
+	}
+
+	recibido := <-recibidos
+	for _, esperado := range []string{"To: cliente@correo.com", `filename="ABC-123.json"`, `filename="ABC-123.pdf"`, "multipart/mixed"} {
+		if !strings.Contains(recibido, esperado) {
+			t.Errorf("El mensaje no contiene %q", esperado)
+		}
+	}
+}
+
+func TestPlantillaInvalida(t *testing.T) {
+	if _, _, err := (Plantilla{Asunto: "{{.NoExiste", Cuerpo: "x"}).Generar(documentos.Vista{}); err == nil {
+		t.Error("Se esperaba un error con una plantilla mal formada")
+	}
+}
@@ -0,0 +1,277 @@
+package correo
+
+import (
+	"GoProcesadorExcel/documentos"
+	"GoProcesadorExcel/representacion"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Estados del envío por correo de un IDDTE
+const (
+	EstadoPendiente = "PENDIENTE"
+	EstadoEnviado   = "ENVIADO"
+	EstadoFallido   = "FALLIDO"
+)
+
+// claveCola es el conjunto ordenado de envíos pendientes de todas las empresas, con la fecha del
+// siguiente intento como puntaje
+const claveCola = "correos_pendientes"
+
+// Envio es el estado del envío por correo de un IDDTE
+type Envio struct {
+	Destinatario string     `json:"destinatario"`
+	TipoDte      string     `json:"tipoDte"`
+	Estado       string     `json:"estado"`
+	Intentos     int        `json:"intentos"`
+	Error        string     `json:"error,omitempty"`
+	Fecha        time.Time  `json:"fecha"`
+	Enviado      *time.Time `json:"enviado,omitempty"`
+}
+
+// claveEnvios devuelve el hash con los envíos por correo de un lote. No comparte el prefijo {empid}_Lote_
+// para que las consultas de estados no lo confundan con un lote.
+func claveEnvios(empid string, correlativo string) string {
+	return fmt.Sprintf("%s_Correos_Lote_%s", empid, correlativo)
+}
+
+// Habilitado indica si hay un servidor SMTP configurado
+func Habilitado() bool {
+	_, err := ServidorSMTP()
+	return err == nil
+}
+
+// Encolar programa el envío del DTE procesado al correo del receptor. Un IDDTE ya enviado no se vuelve a enviar.
+func Encolar(rdb *redis.Client, empid string, correlativo string, iddte string, tipoDte string, destinatario string) {
+	destinatario = strings.TrimSpace(destinatario)
+	if destinatario == "" || !Habilitado() {
+		return
+	}
+
+	if anterior, err := obtenerEnvio(rdb, empid, correlativo, iddte); err == nil && anterior != nil && anterior.Estado == EstadoEnviado {
+		return
+	}
+
+	envio := Envio{
+		Destinatario: destinatario,
+		TipoDte:      tipoDte,
+		Estado:       EstadoPendiente,
+		Fecha:        time.Now(),
+	}
+	if err := guardarEnvio(rdb, empid, correlativo, iddte, envio); err != nil {
+		log.Printf("Error al registrar el correo de %s del Lote_%s: %v\n", iddte, correlativo, err)
+		return
+	}
+	programar(rdb, empid, correlativo, iddte, time.Now())
+}
+
+// ObtenerEnvios devuelve los envíos por correo de los IDDTE de un lote
+func ObtenerEnvios(rdb *redis.Client, empid string, correlativo string) map[string]Envio {
+	envios := make(map[string]Envio)
+	valores, err := rdb.HGetAll(context.Background(), claveEnvios(empid, correlativo)).Result()
+	if err != nil {
+		log.Printf("Error al obtener los correos del Lote_%s: %v\n", correlativo, err)
+		return envios
+	}
+	for iddte, valor := range valores {
+		var envio Envio
+		if err := json.Unmarshal([]byte(valor), &envio); err == nil {
+			envios[iddte] = envio
+		}
+	}
+	return envios
+}
+
+// IniciarEnvioCorreos envía periódicamente los correos pendientes cuya fecha de intento ya pasó
+func IniciarEnvioCorreos(rdb *redis.Client) {
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			ProcesarPendientes(rdb)
+		}
+	}()
+}
+
+// ProcesarPendientes envía los correos pendientes. Cada réplica toma un envío quitándolo de la cola, así
+// que un correo no se envía dos veces.
+func ProcesarPendientes(rdb *redis.Client) {
+	ctx := context.Background()
+	miembros, err := rdb.ZRangeByScore(ctx, claveCola, &redis.ZRangeBy{Min: "-inf", Max: strconv.FormatInt(time.Now().Unix(), 10)}).Result()
+	if err != nil {
+		log.Printf("Error al obtener los correos pendientes: %v\n", err)
+		return
+	}
+
+	// Los documentos se leen una vez por lote
+	lotes := make(map[string]map[string]interface{})
+	for _, miembro := range miembros {
+		tomado, err := rdb.ZRem(ctx, claveCola, miembro).Result()
+		if err != nil || tomado == 0 {
+			continue
+		}
+		partes := strings.SplitN(miembro, "|", 3)
+		if len(partes) != 3 {
+			continue
+		}
+		empid, correlativo, iddte := partes[0], partes[1], partes[2]
+
+		clave := empid + "_" + correlativo
+		documentosLote, ok := lotes[clave]
+		if !ok {
+			if documentosLote, err = documentos.Leer(empid, correlativo); err != nil {
+				log.Printf("No se pudieron leer los documentos del Lote_%s para enviar correos: %v\n", correlativo, err)
+			}
+			lotes[clave] = documentosLote
+		}
+		enviarPendiente(rdb, empid, correlativo, iddte, documentosLote)
+	}
+}
+
+// enviarPendiente envía un correo y registra el resultado; si falla se reprograma con espera creciente
+// hasta CORREO_INTENTOS intentos (5 por defecto)
+func enviarPendiente(rdb *redis.Client, empid string, correlativo string, iddte string, documentosLote map[string]interface{}) {
+	envio, err := obtenerEnvio(rdb, empid, correlativo, iddte)
+	if err != nil || envio == nil || envio.Estado != EstadoPendiente {
+		return
+	}
+
+	envio.Intentos++
+	err = enviarDocumento(rdb, empid, correlativo, iddte, *envio, documentosLote)
+	if err == nil {
+		ahora := time.Now()
+		envio.Estado = EstadoEnviado
+		envio.Error = ""
+		envio.Enviado = &ahora
+		log.Printf("Correo de %s del Lote_%s enviado a %s\n", iddte, correlativo, envio.Destinatario)
+	} else {
+		envio.Error = err.Error()
+		maxIntentos, errIntentos := strconv.Atoi(os.Getenv("CORREO_INTENTOS"))
+		if errIntentos != nil || maxIntentos <= 0 {
+			maxIntentos = 5
+		}
+		if envio.Intentos >= maxIntentos {
+			envio.Estado = EstadoFallido
+			log.Printf("No se pudo enviar el correo de %s del Lote_%s: %v\n", iddte, correlativo, err)
+		} else {
+			espera := time.Duration(envio.Intentos*envio.Intentos) * time.Minute
+			programar(rdb, empid, correlativo, iddte, time.Now().Add(espera))
+		}
+	}
+
+	if err := guardarEnvio(rdb, empid, correlativo, iddte, *envio); err != nil {
+		log.Printf("Error al registrar el correo de %s del Lote_%s: %v\n", iddte, correlativo, err)
+	}
+}
+
+// enviarDocumento genera el correo del DTE con el JSON y el PDF adjuntos y lo envía
+func enviarDocumento(rdb *redis.Client, empid string, correlativo string, iddte string, envio Envio, documentosLote map[string]interface{}) error {
+	servidor, err := ServidorSMTP()
+	if err != nil {
+		return err
+	}
+
+	documento, ok := documentosLote[strings.TrimPrefix(iddte, "IDDTE-")].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("el documento %s no existe en el lote", iddte)
+	}
+	vista, err := documentos.CargarVista(rdb, empid, correlativo, iddte, envio.TipoDte, documento)
+	if err != nil {
+		return err
+	}
+
+	plantilla, err := ObtenerPlantilla(rdb, empid)
+	if err != nil {
+		return err
+	}
+	asunto, cuerpo, err := plantilla.Generar(vista)
+	if err != nil {
+		return err
+	}
+
+	plantillaPDF, err := representacion.ObtenerPlantilla(rdb, empid)
+	if err != nil {
+		return err
+	}
+	adjuntos, err := adjuntosDocumento(documento, vista, plantillaPDF)
+	if err != nil {
+		return err
+	}
+	mensaje, err := construirMensaje(servidor.Remitente, envio.Destinatario, asunto, cuerpo, adjuntos)
+	if err != nil {
+		return fmt.Errorf("error al generar el correo: %v", err)
+	}
+	return servidor.Enviar(envio.Destinatario, mensaje)
+}
+
+// adjuntosDocumento devuelve el DTE en JSON, con los identificadores y el sello de la respuesta, y su
+// representación gráfica en PDF
+func adjuntosDocumento(documento map[string]interface{}, vista documentos.Vista, plantillaPDF representacion.Plantilla) ([]Adjunto, error) {
+	dte := map[string]interface{}{
+		"CodigoGeneracion": vista.CodigoGeneracion,
+		"NumeroControl":    vista.NumeroControl,
+		"SelloRecibido":    vista.SelloRecibido,
+		"Documento":        documento,
+	}
+	contenidoJSON, err := json.MarshalIndent(dte, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error al generar el JSON del documento: %v", err)
+	}
+
+	pdf, err := representacion.Generar(vista, plantillaPDF)
+	if err != nil {
+		return nil, fmt.Errorf("error al generar el PDF: %v", err)
+	}
+
+	nombre := vista.CodigoGeneracion
+	if nombre == "" {
+		nombre = "documento"
+	}
+	return []Adjunto{
+		{Nombre: nombre + ".json", TipoContenido: "application/json", Contenido: contenidoJSON},
+		{Nombre: nombre + ".pdf", TipoContenido: "application/pdf", Contenido: pdf},
+	}, nil
+}
+
+func programar(rdb *redis.Client, empid string, correlativo string, iddte string, cuando time.Time) {
+	miembro := strings.Join([]string{empid, correlativo, iddte}, "|")
+	if err := rdb.ZAdd(context.Background(), claveCola, &redis.Z{Score: float64(cuando.Unix()), Member: miembro}).Err(); err != nil {
+		log.Printf("Error al programar el correo de %s del Lote_%s: %v\n", iddte, correlativo, err)
+	}
+}
+
+func obtenerEnvio(rdb *redis.Client, empid string, correlativo string, iddte string) (*Envio, error) {
+	contenido, err := rdb.HGet(context.Background(), claveEnvios(empid, correlativo), iddte).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var envio Envio
+	if err := json.Unmarshal([]byte(contenido), &envio); err != nil {
+		return nil, err
+	}
+	return &envio, nil
+}
+
+func guardarEnvio(rdb *redis.Client, empid string, correlativo string, iddte string, envio Envio) error {
+	contenido, err := json.Marshal(envio)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	clave := claveEnvios(empid, correlativo)
+	if err := rdb.HSet(ctx, clave, iddte, contenido).Err(); err != nil {
+		return err
+	}
+	return rdb.Expire(ctx, clave, 3*30*24*time.Hour).Err()
+}
@@ -0,0 +1,101 @@
+package correo
+
+import (
+	"GoProcesadorExcel/documentos"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Plantilla es el asunto y el cuerpo HTML del correo de una empresa. Ambos son plantillas de Go que
+// reciben la vista del DTE (documentos.Vista).
+type Plantilla struct {
+	Asunto string `json:"asunto"`
+	Cuerpo string `json:"cuerpo"`
+}
+
+// PlantillaPredeterminada es la plantilla en español que se usa si la empresa no tiene una propia
+var PlantillaPredeterminada = Plantilla{
+	Asunto: "{{.TipoDocumento}} {{.NumeroControl}}",
+	Cuerpo: `<p>Estimado(a) {{if .Receptor.Nombre}}{{.Receptor.Nombre}}{{else}}cliente{{end}}:</p>
+<p>Le enviamos su documento tributario electrónico procesado por el Ministerio de Hacienda.</p>
+<table>
+<tr><td>Tipo de documento</td><td>{{.TipoDocumento}}</td></tr>
+<tr><td>Código de generación</td><td>{{.CodigoGeneracion}}</td></tr>
+<tr><td>Número de control</td><td>{{.NumeroControl}}</td></tr>
+<tr><td>Sello de recepción</td><td>{{.SelloRecibido}}</td></tr>
+<tr><td>Fecha de emisión</td><td>{{.FechaEmision}}</td></tr>
+<tr><td>Total</td><td>{{printf "%.2f" .Total}} {{.Moneda}}</td></tr>
+</table>
+<p>Adjuntamos el documento en formato JSON y su representación gráfica en PDF.</p>`,
+}
+
+func clavePlantilla(empid string) string { return empid + "_plantilla_correo" }
+
+// ObtenerPlantilla devuelve la plantilla de la empresa o la predeterminada
+func ObtenerPlantilla(rdb *redis.Client, empid string) (Plantilla, error) {
+	contenido, err := rdb.Get(context.Background(), clavePlantilla(empid)).Result()
+	if err == redis.Nil {
+		return PlantillaPredeterminada, nil
+	}
+	if err != nil {
+		return Plantilla{}, fmt.Errorf("error al obtener la plantilla de correo: %v", err)
+	}
+
+	var plantilla Plantilla
+	if err := json.Unmarshal([]byte(contenido), &plantilla); err != nil {
+		return Plantilla{}, fmt.Errorf("error al analizar la plantilla de correo: %v", err)
+	}
+	return plantilla, nil
+}
+
+// GuardarPlantilla valida y guarda la plantilla de la empresa; los campos vacíos usan los predeterminados
+func GuardarPlantilla(rdb *redis.Client, empid string, plantilla Plantilla) error {
+	if strings.TrimSpace(plantilla.Asunto) == "" {
+		plantilla.Asunto = PlantillaPredeterminada.Asunto
+	}
+	if strings.TrimSpace(plantilla.Cuerpo) == "" {
+		plantilla.Cuerpo = PlantillaPredeterminada.Cuerpo
+	}
+	// Validar la plantilla con un documento vacío antes de guardarla
+	if _, _, err := plantilla.Generar(documentos.Vista{}); err != nil {
+		return err
+	}
+
+	contenido, err := json.Marshal(plantilla)
+	if err != nil {
+		return fmt.Errorf("error al serializar la plantilla de correo: %v", err)
+	}
+	if err := rdb.Set(context.Background(), clavePlantilla(empid), contenido, 0).Err(); err != nil {
+		return fmt.Errorf("error al guardar la plantilla de correo: %v", err)
+	}
+	return nil
+}
+
+// Generar devuelve el asunto y el cuerpo del correo para el DTE
+func (p Plantilla) Generar(vista documentos.Vista) (string, string, error) {
+	asunto, err := texttemplate.New("asunto").Parse(p.Asunto)
+	if err != nil {
+		return "", "", fmt.Errorf("asunto no válido: %v", err)
+	}
+	cuerpo, err := htmltemplate.New("cuerpo").Parse(p.Cuerpo)
+	if err != nil {
+		return "", "", fmt.Errorf("cuerpo no válido: %v", err)
+	}
+
+	var textoAsunto, textoCuerpo bytes.Buffer
+	if err := asunto.Execute(&textoAsunto, vista); err != nil {
+		return "", "", fmt.Errorf("error al generar el asunto: %v", err)
+	}
+	if err := cuerpo.Execute(&textoCuerpo, vista); err != nil {
+		return "", "", fmt.Errorf("error al generar el cuerpo: %v", err)
+	}
+	// El asunto es una sola línea
+	return strings.Join(strings.Fields(textoAsunto.String()), " "), textoCuerpo.String(), nil
+}
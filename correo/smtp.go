@@ -0,0 +1,133 @@
+package correo
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrSinConfiguracion = errors.New("no hay un servidor SMTP configurado")
+
+// Servidor es la configuración SMTP del envío de correos
+type Servidor struct {
+	Host      string
+	Puerto    string
+	Usuario   string
+	Clave     string
+	Remitente string
+}
+
+// Adjunto es un archivo adjunto del correo
+type Adjunto struct {
+	Nombre        string
+	TipoContenido string
+	Contenido     []byte
+}
+
+// ServidorSMTP lee la configuración SMTP de SMTP_HOST, SMTP_PORT (587 por defecto), SMTP_USUARIO,
+// SMTP_CLAVE y SMTP_REMITENTE (el usuario por defecto)
+func ServidorSMTP() (Servidor, error) {
+	servidor := Servidor{
+		Host:      os.Getenv("SMTP_HOST"),
+		Puerto:    os.Getenv("SMTP_PORT"),
+		Usuario:   os.Getenv("SMTP_USUARIO"),
+		Clave:     os.Getenv("SMTP_CLAVE"),
+		Remitente: os.Getenv("SMTP_REMITENTE"),
+	}
+	if servidor.Puerto == "" {
+		servidor.Puerto = "587"
+	}
+	if servidor.Remitente == "" {
+		servidor.Remitente = servidor.Usuario
+	}
+	if servidor.Host == "" || servidor.Remitente == "" {
+		return servidor, ErrSinConfiguracion
+	}
+	return servidor, nil
+}
+
+// Enviar envía el mensaje al destinatario. La autenticación solo se usa si hay usuario configurado.
+func (s Servidor) Enviar(destinatario string, mensaje []byte) error {
+	var autenticacion smtp.Auth
+	if s.Usuario != "" {
+		autenticacion = smtp.PlainAuth("", s.Usuario, s.Clave, s.Host)
+	}
+	if err := smtp.SendMail(net.JoinHostPort(s.Host, s.Puerto), autenticacion, s.Remitente, []string{destinatario}, mensaje); err != nil {
+		return fmt.Errorf("error al enviar el correo a %s: %v", destinatario, err)
+	}
+	return nil
+}
+
+// construirMensaje arma un mensaje MIME con el cuerpo en HTML y los adjuntos en base64
+func construirMensaje(remitente string, destinatario string, asunto string, cuerpo string, adjuntos []Adjunto) ([]byte, error) {
+	var mensaje bytes.Buffer
+	partes := multipart.NewWriter(&mensaje)
+
+	encabezados := []string{
+		"From: " + remitente,
+		"To: " + destinatario,
+		"Subject: " + mime.QEncoding.Encode("utf-8", asunto),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: " + idMensaje(remitente),
+		"MIME-Version: 1.0",
+		fmt.Sprintf("Content-Type: multipart/mixed; boundary=%q", partes.Boundary()),
+	}
+	mensaje.WriteString(strings.Join(encabezados, "\r\n") + "\r\n\r\n")
+
+	parte, err := partes.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	escribirBase64(parte, []byte(cuerpo))
+
+	for _, adjunto := range adjuntos {
+		parte, err := partes.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {fmt.Sprintf("%s; name=%q", adjunto.TipoContenido, adjunto.Nombre)},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", adjunto.Nombre)},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		escribirBase64(parte, adjunto.Contenido)
+	}
+
+	if err := partes.Close(); err != nil {
+		return nil, err
+	}
+	return mensaje.Bytes(), nil
+}
+
+// escribirBase64 codifica el contenido en líneas de 76 caracteres, como exige MIME
+func escribirBase64(destino io.Writer, contenido []byte) {
+	codificado := base64.StdEncoding.EncodeToString(contenido)
+	for len(codificado) > 76 {
+		destino.Write([]byte(codificado[:76] + "\r\n"))
+		codificado = codificado[76:]
+	}
+	destino.Write([]byte(codificado + "\r\n"))
+}
+
+func idMensaje(remitente string) string {
+	dominio := "localhost"
+	if posicion := strings.LastIndex(remitente, "@"); posicion >= 0 {
+		dominio = strings.Trim(remitente[posicion+1:], "<> ")
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return fmt.Sprintf("<%x.%d@%s>", b, time.Now().UnixNano(), dominio)
+}
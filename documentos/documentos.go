@@ -0,0 +1,129 @@
+package documentos
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Ruta devuelve la ruta del JSON con los documentos enviados en un lote
+func Ruta(empid string, correlativo string) string {
+	return filepath.Join("data", "responseJSON", fmt.Sprintf("%s_Lote_%s.json", empid, correlativo))
+}
+
+// Leer lee los documentos enviados en un lote, indexados por IDDTE
+func Leer(empid string, correlativo string) (map[string]interface{}, error) {
+	contenido, err := os.ReadFile(Ruta(empid, correlativo))
+	if err != nil {
+		return nil, err
+	}
+
+	var documentos map[string]interface{}
+	if err := json.Unmarshal(contenido, &documentos); err != nil {
+		return nil, err
+	}
+	return documentos, nil
+}
+
+// Documento lee un documento de un lote por su IDDTE, con o sin el prefijo "IDDTE-"
+func Documento(empid string, correlativo string, iddte string) (map[string]interface{}, error) {
+	documentos, err := Leer(empid, correlativo)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudieron leer los documentos del lote: %v", err)
+	}
+	documento, ok := documentos[strings.TrimPrefix(iddte, "IDDTE-")].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("el documento %s no existe en el lote", iddte)
+	}
+	return documento, nil
+}
+
+// Fila devuelve la primera fila de una hoja del documento, que puede ser un objeto o una lista
+func Fila(documento map[string]interface{}, hoja string) map[string]interface{} {
+	switch valor := documento[hoja].(type) {
+	case map[string]interface{}:
+		return valor
+	case []interface{}:
+		if len(valor) > 0 {
+			if fila, ok := valor[0].(map[string]interface{}); ok {
+				return fila
+			}
+		}
+	}
+	return nil
+}
+
+// Filas devuelve todas las filas de una hoja del documento
+func Filas(documento map[string]interface{}, hoja string) []map[string]interface{} {
+	switch valor := documento[hoja].(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{valor}
+	case []interface{}:
+		filas := make([]map[string]interface{}, 0, len(valor))
+		for _, elemento := range valor {
+			if fila, ok := elemento.(map[string]interface{}); ok {
+				filas = append(filas, fila)
+			}
+		}
+		return filas
+	}
+	return nil
+}
+
+// Texto devuelve un campo como texto, o vacío si no existe
+func Texto(fila map[string]interface{}, campo string) string {
+	valor, ok := fila[campo]
+	if !ok || valor == nil {
+		return ""
+	}
+	if numero, ok := valor.(float64); ok {
+		return strconv.FormatFloat(numero, 'f', -1, 64)
+	}
+	return strings.TrimSpace(fmt.Sprint(valor))
+}
+
+var patronEstado = regexp.MustCompile(`(?s)^Código:\s*(\d+)\s*,\s*Mensaje:\s*(.*)$`)
+
+// ParsearEstado interpreta el estado guardado de un IDDTE con el formato "Código: 200, Mensaje: {...}".
+// Devuelve el código, el mensaje si es JSON y el texto del mensaje; un valor sin ese formato tiene código 0.
+func ParsearEstado(valor string) (int, map[string]interface{}, string) {
+	coincidencia := patronEstado.FindStringSubmatch(valor)
+	if coincidencia == nil {
+		return 0, nil, valor
+	}
+
+	codigo, _ := strconv.Atoi(coincidencia[1])
+	var mensaje map[string]interface{}
+	if err := json.Unmarshal([]byte(coincidencia[2]), &mensaje); err != nil {
+		mensaje = nil
+	}
+	return codigo, mensaje, coincidencia[2]
+}
+
+// nombresTipo son los nombres de los tipos de DTE
+var nombresTipo = map[string]string{
+	"01":     "Factura",
+	"03":     "Comprobante de crédito fiscal",
+	"04":     "Nota de remisión",
+	"05":     "Nota de crédito",
+	"06":     "Nota de débito",
+	"07":     "Comprobante de retención",
+	"08":     "Comprobante de liquidación",
+	"09":     "Documento contable de liquidación",
+	"11":     "Factura de exportación",
+	"14":     "Factura de sujeto excluido",
+	"15":     "Comprobante de donación",
+	"cancel": "Invalidación",
+}
+
+// NombreTipo devuelve el nombre del tipo de DTE, o el código si no se conoce
+func NombreTipo(tipoDte string) string {
+	if nombre, ok := nombresTipo[tipoDte]; ok {
+		return nombre
+	}
+	return tipoDte
+}
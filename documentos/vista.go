@@ -0,0 +1,133 @@
+package documentos
+
+import (
+	"GoProcesadorExcel/identificadores"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Vista reúne los datos de un DTE procesado que se muestran al receptor: en el correo y en la
+// representación gráfica en PDF
+type Vista struct {
+	TipoDte            string
+	TipoDocumento      string
+	CodigoGeneracion   string
+	NumeroControl      string
+	SelloRecibido      string
+	FechaEmision       string
+	FechaProcesamiento string
+	Moneda             string
+	Receptor           Receptor
+	Items              []Item
+	Total              float64
+	Observaciones      string
+}
+
+// Receptor son los datos del receptor del DTE
+type Receptor struct {
+	Nombre    string
+	Documento string
+	Nrc       string
+	Correo    string
+	Telefono  string
+	Direccion string
+}
+
+// Item es una línea del detalle del DTE
+type Item struct {
+	Cantidad       float64
+	Codigo         string
+	Unidad         string
+	Descripcion    string
+	PrecioUnitario float64
+	Descuento      float64
+	Subtotal       float64
+}
+
+// NuevaVista arma la vista de un DTE con el documento enviado y la respuesta de la API. Los identificadores
+// de la respuesta tienen prioridad sobre los del documento.
+func NuevaVista(documento map[string]interface{}, tipoDte string, respuesta map[string]interface{}) Vista {
+	identificacion := Fila(documento, "Identificacion")
+	receptor := Fila(documento, "Receptor")
+	resumen := Fila(documento, "Resumen")
+
+	vista := Vista{
+		TipoDte:            tipoDte,
+		TipoDocumento:      NombreTipo(tipoDte),
+		CodigoGeneracion:   primero(Texto(respuesta, "CodigoGeneracion"), Texto(identificacion, "CodigoGeneracion"), Texto(documento, "CodigoGeneracion")),
+		NumeroControl:      primero(Texto(respuesta, "NumeroControl"), Texto(identificacion, "NumeroControl")),
+		SelloRecibido:      Texto(respuesta, "SelloRecibido"),
+		FechaEmision:       primero(Texto(respuesta, "FechaEmision"), Texto(identificacion, "FechaEmision")),
+		FechaProcesamiento: Texto(respuesta, "FhProcesamiento"),
+		Moneda:             primero(Texto(identificacion, "Moneda"), "USD"),
+		Receptor: Receptor{
+			Nombre:    Texto(receptor, "Nombres"),
+			Documento: primero(Texto(receptor, "NumeroDocumentoIdentificacion"), Texto(receptor, "Nit")),
+			Nrc:       Texto(receptor, "Nrc"),
+			Correo:    Texto(receptor, "Correo"),
+			Telefono:  Texto(receptor, "Telefono"),
+			Direccion: Texto(receptor, "Direccion"),
+		},
+		Observaciones: Texto(resumen, "Observaciones"),
+	}
+
+	for _, fila := range Filas(documento, "Detalles") {
+		item := Item{
+			Cantidad:       numero(fila, "Cantidad"),
+			Codigo:         Texto(fila, "Codigo"),
+			Unidad:         Texto(fila, "CodigoUnidadMedida"),
+			Descripcion:    Texto(fila, "Descripcion"),
+			PrecioUnitario: numero(fila, "PrecioUnitario"),
+			Descuento:      numero(fila, "Descuento"),
+			Subtotal:       numero(fila, "Subtotal"),
+		}
+		// Sin subtotal en el documento se calcula con la cantidad, el precio y el descuento
+		if _, ok := fila["Subtotal"]; !ok {
+			item.Subtotal = item.Cantidad*item.PrecioUnitario - item.Descuento
+		}
+		vista.Items = append(vista.Items, item)
+		vista.Total += item.Subtotal
+	}
+	return vista
+}
+
+// CorreoReceptor devuelve el correo del receptor del documento
+func CorreoReceptor(documento map[string]interface{}) string {
+	return Texto(Fila(documento, "Receptor"), "Correo")
+}
+
+func primero(valores ...string) string {
+	for _, valor := range valores {
+		if valor != "" {
+			return valor
+		}
+	}
+	return ""
+}
+
+func numero(fila map[string]interface{}, campo string) float64 {
+	valor, _ := strconv.ParseFloat(strings.ReplaceAll(Texto(fila, campo), ",", ""), 64)
+	return valor
+}
+
+// CargarVista arma la vista de un IDDTE con el documento enviado y su resultado guardado en Redis. Si la
+// respuesta no trae los identificadores se usan los que el servicio asignó al documento.
+func CargarVista(rdb *redis.Client, empid string, correlativo string, iddte string, tipoDte string, documento map[string]interface{}) (Vista, error) {
+	nombreLote := fmt.Sprintf("%s_Lote_%s", empid, correlativo)
+	estado, err := rdb.HGet(context.Background(), nombreLote, iddte).Result()
+	if err != nil && err != redis.Nil {
+		return Vista{}, fmt.Errorf("error al obtener el resultado del documento: %v", err)
+	}
+	_, respuesta, _ := ParsearEstado(estado)
+
+	vista := NuevaVista(documento, tipoDte, respuesta)
+	if asignacion, err := identificadores.ObtenerAsignacion(rdb, empid, nombreLote, iddte); err == nil && asignacion != nil {
+		vista.CodigoGeneracion = primero(vista.CodigoGeneracion, asignacion.CodigoGeneracion)
+		vista.NumeroControl = primero(vista.NumeroControl, asignacion.NumeroControl)
+	}
+	return vista, nil
+}
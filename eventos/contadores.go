@@ -0,0 +1,104 @@
+package eventos
+
+import (
+	"GoProcesadorExcel/registro"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// TipoContadores es el mensaje del tablero con los contadores del día de la empresa
+const TipoContadores = "contadores"
+
+func claveContadores(empid string, dia time.Time) string {
+	return fmt.Sprintf("%s_contadores:%s", empid, dia.Format("2006-01-02"))
+}
+
+// contar actualiza los contadores del día con el evento: los lotes recibidos y los resultados de los IDDTE,
+// en total y por tipo de DTE. Las fases se registran además en el resumen y en el índice de lotes.
+func contar(ctx context.Context, rdb *redis.Client, empid string, evento Evento) {
+	registrarFase(ctx, rdb, empid, evento)
+	indexar(rdb, empid, evento)
+
+	clave := claveContadores(empid, evento.Fecha)
+	pipe := rdb.TxPipeline()
+	switch {
+	case evento.Tipo == TipoFase && evento.Datos["fase"] == FaseRecibido:
+		pipe.HIncrBy(ctx, clave, "lotes", 1)
+	case evento.Tipo == TipoIddte:
+		resultado := fmt.Sprint(evento.Datos["resultado"])
+		pipe.HIncrBy(ctx, clave, resultado, 1)
+		if tipoDte, ok := evento.Datos["tipoDte"].(string); ok && tipoDte != "" {
+			pipe.HIncrBy(ctx, clave, tipoDte+":"+resultado, 1)
+		}
+	default:
+		return
+	}
+	pipe.Expire(ctx, clave, 7*24*time.Hour)
+	pipe.Exec(ctx)
+}
+
+// indexar registra el lote en el índice de la empresa al recibirlo y mueve el lote al índice de su estado en
+// cada cambio de fase; el resumen marca el lote como completado
+func indexar(rdb *redis.Client, empid string, evento Evento) {
+	switch evento.Tipo {
+	case TipoFase:
+		fase := fmt.Sprint(evento.Datos["fase"])
+		if fase == FaseRecibido {
+			registro.RegistrarLote(rdb, empid, evento.Correlativo, evento.Fecha)
+			if tipoDte, ok := evento.Datos["tipoDte"].(string); ok {
+				registro.RegistrarTipo(rdb, empid, evento.Correlativo, tipoDte)
+			}
+		}
+		registro.RegistrarEstado(rdb, empid, evento.Correlativo, fase)
+	case TipoResumen:
+		registro.RegistrarEstado(rdb, empid, evento.Correlativo, registro.EstadoCompletado)
+	}
+}
+
+// Contadores devuelve los contadores del día de la empresa
+func Contadores(rdb *redis.Client, empid string) (map[string]int64, error) {
+	valores, err := rdb.HGetAll(context.Background(), claveContadores(empid, time.Now())).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener los contadores: %v", err)
+	}
+
+	contadores := make(map[string]int64, len(valores))
+	for campo, valor := range valores {
+		contadores[campo], _ = strconv.ParseInt(valor, 10, 64)
+	}
+	return contadores, nil
+}
+
+// Filtro limita los eventos del tablero por tipo de DTE y por resultado de los IDDTE. Las listas vacías
+// no filtran; los eventos sin tipo de DTE o sin resultado, como las fases y los resúmenes, siempre pasan.
+type Filtro struct {
+	TiposDte []string `json:"tipoDte"`
+	Estados  []string `json:"estado"`
+}
+
+// Acepta indica si el evento pasa el filtro
+func (f Filtro) Acepta(evento Evento) bool {
+	if tipoDte, ok := evento.Datos["tipoDte"].(string); ok && tipoDte != "" && !contiene(f.TiposDte, tipoDte) {
+		return false
+	}
+	if evento.Tipo == TipoIddte && !contiene(f.Estados, fmt.Sprint(evento.Datos["resultado"])) {
+		return false
+	}
+	return true
+}
+
+func contiene(lista []string, valor string) bool {
+	if len(lista) == 0 {
+		return true
+	}
+	for _, elemento := range lista {
+		if elemento == valor {
+			return true
+		}
+	}
+	return false
+}
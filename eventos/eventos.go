@@ -0,0 +1,160 @@
+package eventos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Tipos de evento del progreso de un lote
+const (
+	TipoFase    = "fase"    // Cambio de fase de la conversión o el envío
+	TipoIddte   = "iddte"   // Resultado de un IDDTE
+	TipoResumen = "resumen" // Resultado final del lote; es el último evento del envío
+)
+
+// Fases de un lote
+const (
+	FaseRecibido          = "recibido"
+	FaseConvirtiendo      = "convirtiendo"
+	FaseConvertido        = "convertido"
+	FaseConversionFallida = "conversion_fallida"
+	FaseEnviando          = "enviando"
+)
+
+// maxEventosLote es el número de eventos que se conservan por lote para reanudar la transmisión
+const maxEventosLote = 5000
+
+// Evento es un cambio en el progreso de un lote. El ID es el de la entrada en el stream de Redis del
+// lote y sirve como Last-Event-ID para reanudar.
+type Evento struct {
+	ID          string                 `json:"id"`
+	Tipo        string                 `json:"tipo"`
+	Lote        string                 `json:"lote"`
+	Correlativo string                 `json:"correlativo"`
+	Fecha       time.Time              `json:"fecha"`
+	Datos       map[string]interface{} `json:"datos"`
+}
+
+// Canal devuelve el canal de pub/sub con los eventos de todos los lotes de la empresa
+func Canal(empid string) string { return empid + "_eventos" }
+
+func claveHistorial(empid string, correlativo string) string {
+	return fmt.Sprintf("%s_eventos_lote:%s", empid, correlativo)
+}
+
+// Publicar guarda el evento en el historial del lote y lo publica en el canal de la empresa
+func Publicar(rdb *redis.Client, empid string, correlativo string, tipo string, datos map[string]interface{}) {
+	ctx := context.Background()
+	evento := Evento{
+		Tipo:        tipo,
+		Lote:        "Lote_" + correlativo,
+		Correlativo: correlativo,
+		Fecha:       time.Now(),
+		Datos:       datos,
+	}
+	contenido, err := json.Marshal(evento)
+	if err != nil {
+		log.Printf("Error al serializar el evento del lote %s: %v\n", correlativo, err)
+		return
+	}
+
+	clave := claveHistorial(empid, correlativo)
+	id, err := rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: clave,
+		MaxLen: maxEventosLote,
+		Approx: true,
+		Values: map[string]interface{}{"evento": contenido},
+	}).Result()
+	if err != nil {
+		log.Printf("Error al guardar el evento del lote %s: %v\n", correlativo, err)
+		return
+	}
+	rdb.Expire(ctx, clave, 3*30*24*time.Hour)
+	contar(ctx, rdb, empid, evento)
+
+	evento.ID = id
+	contenido, _ = json.Marshal(evento)
+	if err := rdb.Publish(ctx, Canal(empid), contenido).Err(); err != nil {
+		log.Printf("Error al publicar el evento del lote %s: %v\n", correlativo, err)
+	}
+}
+
+// Fase publica un cambio de fase del lote
+func Fase(rdb *redis.Client, empid string, correlativo string, fase string, datos map[string]interface{}) {
+	if datos == nil {
+		datos = map[string]interface{}{}
+	}
+	datos["fase"] = fase
+	Publicar(rdb, empid, correlativo, TipoFase, datos)
+}
+
+// Historial devuelve los eventos del lote posteriores al ID indicado, o todos si está vacío
+func Historial(rdb *redis.Client, empid string, correlativo string, despuesDe string) ([]Evento, error) {
+	inicio := "-"
+	if despuesDe != "" {
+		inicio = "(" + despuesDe
+	}
+
+	mensajes, err := rdb.XRange(context.Background(), claveHistorial(empid, correlativo), inicio, "+").Result()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener los eventos del lote: %v", err)
+	}
+
+	historial := make([]Evento, 0, len(mensajes))
+	for _, mensaje := range mensajes {
+		contenido, _ := mensaje.Values["evento"].(string)
+		var evento Evento
+		if err := json.Unmarshal([]byte(contenido), &evento); err != nil {
+			continue
+		}
+		evento.ID = mensaje.ID
+		historial = append(historial, evento)
+	}
+	return historial, nil
+}
+
+// Decodificar interpreta un mensaje del canal de la empresa
+func Decodificar(mensaje string) (Evento, error) {
+	var evento Evento
+	err := json.Unmarshal([]byte(mensaje), &evento)
+	return evento, err
+}
+
+// NombreLote separa la empresa y el correlativo de un nombre de lote "{empid}_Lote_{correlativo}"
+func NombreLote(nombreLote string) (string, string, bool) {
+	posicion := strings.LastIndex(nombreLote, "_Lote_")
+	if posicion < 0 {
+		return "", "", false
+	}
+	return nombreLote[:posicion], nombreLote[posicion+len("_Lote_"):], true
+}
+
+// Posterior indica si el ID de stream a es posterior a b
+func Posterior(a string, b string) bool {
+	if b == "" {
+		return true
+	}
+	msA, secA := partesID(a)
+	msB, secB := partesID(b)
+	if msA != msB {
+		return msA > msB
+	}
+	return secA > secB
+}
+
+func partesID(id string) (int64, int64) {
+	partes := strings.SplitN(id, "-", 2)
+	ms, _ := strconv.ParseInt(partes[0], 10, 64)
+	var sec int64
+	if len(partes) == 2 {
+		sec, _ = strconv.ParseInt(partes[1], 10, 64)
+	}
+	return ms, sec
+}
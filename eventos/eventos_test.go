@@ -0,0 +1,110 @@
+package eventos
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPosterior(t *testing.T) {
+	casos := []struct {
+		a, b     string
+		esperado bool
+	}{
+		{"1700000000001-0", "1700000000000-5", true},
+		{"1700000000000-5", "1700000000000-10", false},
+		{"1700000000000-10", "1700000000000-9", true},
+		{"1700000000000-0", "1700000000000-0", false},
+		{"1700000000000-0", "", true},
+	}
+
+	for _, caso := range casos {
+		if resultado := Posterior(caso.a, caso.b); resultado != caso.esperado {
+			t.Errorf("Posterior(%q, %q) = %v, se esperaba %v", caso.a, caso.b, resultado, caso.esperado)
+		}
+	}
+}
+
+func TestNombreLote(t *testing.T) {
+	empid, correlativo, ok := NombreLote("empresa_1_Lote_007")
+	if !ok || empid != "empresa_1" || correlativo != "007" {
+		t.Errorf("NombreLote = %q, %q, %v", empid, correlativo, ok)
+	}
+	if _, _, ok := NombreLote("empresa_contador_lotes"); ok {
+		t.Error("Un nombre sin _Lote_ no es un lote")
+	}
+}
+
+func TestFiltro(t *testing.T) {
+	filtro := Filtro{TiposDte: []string{"03"}, Estados: []string{"rechazado"}}
+	casos := []struct {
+		evento   Evento
+		esperado bool
+	}{
+		{Evento{Tipo: TipoIddte, Datos: map[string]interface{}{"tipoDte": "03", "resultado": "rechazado"}}, true},
+		{Evento{Tipo: TipoIddte, Datos: map[string]interface{}{"tipoDte": "03", "resultado": "procesado"}}, false},
+		{Evento{Tipo: TipoIddte, Datos: map[string]interface{}{"tipoDte": "01", "resultado": "rechazado"}}, false},
+		{Evento{Tipo: TipoFase, Datos: map[string]interface{}{"fase": FaseRecibido, "tipoDte": "01"}}, false},
+		{Evento{Tipo: TipoFase, Datos: map[string]interface{}{"fase": FaseConvirtiendo}}, true},
+		{Evento{Tipo: TipoResumen, Datos: map[string]interface{}{"total": 3}}, true},
+	}
+
+	for _, caso := range casos {
+		if resultado := filtro.Acepta(caso.evento); resultado != caso.esperado {
+			t.Errorf("Acepta(%v) = %v, se esperaba %v", caso.evento.Datos, resultado, caso.esperado)
+		}
+	}
+	if !(Filtro{}).Acepta(casos[1].evento) {
+		t.Error("Un filtro vacío debería aceptar todos los eventos")
+	}
+}
+
+func TestResumenLote(t *testing.T) {
+	campos := camposResultado(`Código: 200, Mensaje: {"Estado": "RECHAZADO", "DescripcionMsg": "[receptor.nrc] NRC NO EXISTE"}`)
+	if strings.Join(campos, "|") != "codigo:200|estado:RECHAZADO|categoria:datos|hoja:Receptor" {
+		t.Errorf("Campos inesperados: %v", campos)
+	}
+	if campos := camposResultado(`Código: 200, Mensaje: {"Estado": "PROCESADO"}`); len(campos) != 2 {
+		t.Errorf("Un IDDTE procesado no tiene categoría: %v", campos)
+	}
+	campo := campoConteo("01", `Código: 200, Mensaje: {"Estado": "PROCESADO", "CodigoGeneracion": "C", "SelloRecibido": "S"}`)
+	if conteo, ok := nuevoConteo(campo, 2); !ok || conteo != (ConteoResultado{TipoDte: "01", Codigo: 200, Estado: "PROCESADO", Cantidad: 2}) {
+		t.Errorf("Conteo inesperado de %s: %+v", campo, conteo)
+	}
+
+	inicio := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	valores := map[string]string{
+		"total":              "4",
+		"codigo:200":         "3",
+		"codigo:500":         "1",
+		"codigo:400":         "0",
+		"estado:PROCESADO":   "3",
+		"categoria:servicio": "1",
+		"fase:recibido":      strconv.FormatInt(inicio.UnixMilli(), 10),
+		"fase:convirtiendo":  strconv.FormatInt(inicio.Add(time.Second).UnixMilli(), 10),
+		"fase:convertido":    strconv.FormatInt(inicio.Add(3*time.Second).UnixMilli(), 10),
+		"fase:enviando":      strconv.FormatInt(inicio.Add(4*time.Second).UnixMilli(), 10),
+		"fin:envio":          strconv.FormatInt(inicio.Add(6*time.Second).UnixMilli(), 10),
+		"enviados":           "4",
+	}
+	resumen := NuevoResumenLote("Lote_001", valores, inicio.Add(time.Minute))
+	if resumen.Total != 4 || resumen.PorCodigo["200"] != 3 || resumen.PorCategoria["servicio"] != 1 {
+		t.Errorf("Contadores inesperados: %+v", resumen)
+	}
+	if _, ok := resumen.PorCodigo["400"]; ok {
+		t.Error("Los contadores en cero no deberían aparecer")
+	}
+	if resumen.EnCurso || resumen.Duraciones["conversion"] != 2000 || resumen.Duraciones["envio"] != 2000 || resumen.Duraciones["total"] != 6000 {
+		t.Errorf("Duraciones inesperadas: %+v", resumen.Duraciones)
+	}
+	if resumen.DocumentosPorSeg != 2 {
+		t.Errorf("Documentos por segundo = %v, se esperaba 2", resumen.DocumentosPorSeg)
+	}
+
+	// Sin fin del envío, el lote sigue en curso y se mide hasta ahora
+	delete(valores, "fin:envio")
+	if resumen := NuevoResumenLote("Lote_001", valores, inicio.Add(8*time.Second)); !resumen.EnCurso || resumen.Duraciones["envio"] != 4000 {
+		t.Errorf("Resumen en curso inesperado: %+v", resumen)
+	}
+}
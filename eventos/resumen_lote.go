@@ -0,0 +1,277 @@
+package eventos
+
+import (
+	"GoProcesadorExcel/clasificacion"
+	"GoProcesadorExcel/documentos"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// El resumen de un lote se mantiene a medida que se guardan los resultados: un hash con los contadores y las
+// marcas de tiempo de las fases, y otro con los contadores que suma cada IDDTE para descontarlos si se reescribe.
+func claveResumenLote(empid string, correlativo string) string {
+	return fmt.Sprintf("%s_resumen_lote:%s", empid, correlativo)
+}
+
+func claveResumenIddte(empid string, correlativo string) string {
+	return claveResumenLote(empid, correlativo) + ":iddte"
+}
+
+// Prefijos de los contadores del resumen
+const (
+	prefijoCodigo    = "codigo:"
+	prefijoEstado    = "estado:"
+	prefijoCategoria = "categoria:"
+	prefijoHoja      = "hoja:"
+	prefijoFase      = "fase:"
+	prefijoConteo    = "conteo:"
+	campoFinEnvio    = "fin:envio"
+	campoEnviados    = "enviados"
+	campoTotal       = "total"
+)
+
+// ResumenLote son las estadísticas de un lote
+type ResumenLote struct {
+	Lote             string           `json:"lote"`
+	Total            int64            `json:"total"`
+	PorCodigo        map[string]int64 `json:"porCodigo"`
+	PorEstado        map[string]int64 `json:"porEstado"`
+	PorCategoria     map[string]int64 `json:"porCategoria"`
+	PorHojaError     map[string]int64 `json:"porHojaError"`
+	Fases            map[string]int64 `json:"fases"`
+	Duraciones       map[string]int64 `json:"duracionesMs"`
+	EnCurso          bool             `json:"enCurso"`
+	DocumentosPorSeg float64          `json:"documentosPorSegundo"`
+	// Conteos son los IDDTE por combinación de tipo de DTE, código, estado y categoría
+	Conteos []ConteoResultado `json:"-"`
+}
+
+// ConteoResultado es el número de IDDTE del lote con el mismo tipo de DTE, código, estado y categoría
+type ConteoResultado struct {
+	TipoDte   string
+	Codigo    int
+	Estado    string
+	Categoria string
+	Cantidad  int64
+}
+
+// camposResultado devuelve los contadores a los que suma el estado de un IDDTE
+func camposResultado(valor string) []string {
+	codigo, mensaje, _ := documentos.ParsearEstado(valor)
+	estado := documentos.Texto(mensaje, "Estado")
+	if estado == "" {
+		estado = "N/A"
+	}
+	campos := []string{prefijoCodigo + strconv.Itoa(codigo), prefijoEstado + estado}
+
+	procesado := codigo == 200 && estado == "PROCESADO"
+	if procesado || codigo == 202 {
+		return campos
+	}
+	resultado := clasificacion.Predeterminado().ClasificarEstado(valor)
+	campos = append(campos, prefijoCategoria+resultado.Categoria)
+	for _, hoja := range resultado.Hojas {
+		campos = append(campos, prefijoHoja+hoja)
+	}
+	return campos
+}
+
+// campoConteo devuelve el contador de la combinación de tipo de DTE, código, estado y categoría del IDDTE, con
+// el que se cuentan los IDDTE de cualquier combinación de filtros. La categoría sigue el criterio de la consulta
+// de IDDTE: no la tienen los procesados con sello ni los recibidos en contingencia. Los campos se separan con
+// "|" al guardarse, así que no pueden contenerlo.
+func campoConteo(tipoDte string, valor string) string {
+	codigo, mensaje, _ := documentos.ParsearEstado(valor)
+	estado := documentos.Texto(mensaje, "Estado")
+	if estado == "" {
+		estado = "N/A"
+	}
+	categoria := ""
+	sellado := codigo == 200 && estado == "PROCESADO" && documentos.Texto(mensaje, "CodigoGeneracion") != "" &&
+		documentos.Texto(mensaje, "SelloRecibido") != ""
+	if !sellado && codigo != 202 {
+		categoria = clasificacion.Predeterminado().ClasificarEstado(valor).Categoria
+	}
+	contenido, _ := json.Marshal([]string{tipoDte, strconv.Itoa(codigo), estado, categoria})
+	return prefijoConteo + strings.ReplaceAll(string(contenido), "|", " ")
+}
+
+// registrarResultado descuenta los contadores anteriores del IDDTE, suma los nuevos y los guarda en un solo
+// paso, para que dos resultados del mismo IDDTE guardados a la vez no descuenten ni cuenten dos veces
+var registrarResultado = redis.NewScript(`
+local anterior = redis.call("HGET", KEYS[2], ARGV[1])
+if anterior then
+	for campo in string.gmatch(anterior, "[^|]+") do
+		redis.call("HINCRBY", KEYS[1], campo, -1)
+	end
+else
+	redis.call("HINCRBY", KEYS[1], ARGV[3], 1)
+end
+for campo in string.gmatch(ARGV[2], "[^|]+") do
+	redis.call("HINCRBY", KEYS[1], campo, 1)
+end
+redis.call("HSET", KEYS[2], ARGV[1], ARGV[2])
+redis.call("EXPIRE", KEYS[1], ARGV[4])
+redis.call("EXPIRE", KEYS[2], ARGV[4])
+return 1
+`)
+
+// RegistrarResultado actualiza el resumen del lote con el estado guardado de un IDDTE y su tipo de DTE. Si el
+// IDDTE ya tenía un resultado, se descuentan sus contadores anteriores.
+func RegistrarResultado(rdb *redis.Client, empid string, correlativo string, iddte string, tipoDte string, valor string) {
+	claves := []string{claveResumenLote(empid, correlativo), claveResumenIddte(empid, correlativo)}
+	campos := strings.Join(append(camposResultado(valor), campoConteo(tipoDte, valor)), "|")
+	expiracion := int64((3 * 30 * 24 * time.Hour).Seconds())
+
+	if err := registrarResultado.Run(context.Background(), rdb, claves, iddte, campos, campoTotal, expiracion).Err(); err != nil {
+		log.Printf("Error al actualizar el resumen del lote %s: %v\n", correlativo, err)
+	}
+}
+
+// registrarFase guarda en el resumen del lote el inicio de cada fase y el fin del envío. Un reintento vuelve
+// a marcar el inicio del envío, así que las duraciones son las de la última ejecución.
+func registrarFase(ctx context.Context, rdb *redis.Client, empid string, evento Evento) {
+	clave := claveResumenLote(empid, evento.Correlativo)
+	pipe := rdb.TxPipeline()
+	switch evento.Tipo {
+	case TipoFase:
+		fase := fmt.Sprint(evento.Datos["fase"])
+		pipe.HSet(ctx, clave, prefijoFase+fase, evento.Fecha.UnixMilli())
+		if fase == FaseEnviando {
+			pipe.HDel(ctx, clave, campoFinEnvio)
+		}
+	case TipoResumen:
+		pipe.HSet(ctx, clave, campoFinEnvio, evento.Fecha.UnixMilli())
+		if enviados, ok := evento.Datos["enviados"]; ok {
+			pipe.HSet(ctx, clave, campoEnviados, fmt.Sprint(enviados))
+		}
+	default:
+		return
+	}
+	pipe.Expire(ctx, clave, 3*30*24*time.Hour)
+	pipe.Exec(ctx)
+}
+
+// ObtenerResumenLote devuelve el resumen del lote, o false si el lote no tiene resumen
+func ObtenerResumenLote(rdb *redis.Client, empid string, correlativo string) (ResumenLote, bool, error) {
+	valores, err := rdb.HGetAll(context.Background(), claveResumenLote(empid, correlativo)).Result()
+	if err != nil {
+		return ResumenLote{}, false, fmt.Errorf("error al obtener el resumen del lote: %v", err)
+	}
+	if len(valores) == 0 {
+		return ResumenLote{}, false, nil
+	}
+	return NuevoResumenLote("Lote_"+correlativo, valores, time.Now()), true, nil
+}
+
+// nuevoConteo interpreta un contador de combinación del resumen; los que quedaron en cero no se devuelven
+func nuevoConteo(campo string, cantidad int64) (ConteoResultado, bool) {
+	if !strings.HasPrefix(campo, prefijoConteo) || cantidad == 0 {
+		return ConteoResultado{}, false
+	}
+	var valores []string
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(campo, prefijoConteo)), &valores); err != nil || len(valores) != 4 {
+		return ConteoResultado{}, false
+	}
+	codigo, _ := strconv.Atoi(valores[1])
+	return ConteoResultado{TipoDte: valores[0], Codigo: codigo, Estado: valores[2], Categoria: valores[3], Cantidad: cantidad}, true
+}
+
+// ResumenesLotes devuelve los resúmenes de los lotes indicados por correlativo; los lotes sin resumen no
+// aparecen
+func ResumenesLotes(rdb *redis.Client, empid string, correlativos []string) (map[string]ResumenLote, error) {
+	resumenes := make(map[string]ResumenLote, len(correlativos))
+	if len(correlativos) == 0 {
+		return resumenes, nil
+	}
+	ctx := context.Background()
+	pipe := rdb.Pipeline()
+	resultados := make([]*redis.StringStringMapCmd, len(correlativos))
+	for i, correlativo := range correlativos {
+		resultados[i] = pipe.HGetAll(ctx, claveResumenLote(empid, correlativo))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("error al obtener los resúmenes de los lotes: %v", err)
+	}
+	ahora := time.Now()
+	for i, resultado := range resultados {
+		if valores := resultado.Val(); len(valores) > 0 {
+			resumenes[correlativos[i]] = NuevoResumenLote("Lote_"+correlativos[i], valores, ahora)
+		}
+	}
+	return resumenes, nil
+}
+
+// NuevoResumenLote arma el resumen con los valores del hash del lote. Las duraciones son la conversión, el
+// envío y el total desde la recepción; si el envío no ha terminado se miden hasta ahora.
+func NuevoResumenLote(lote string, valores map[string]string, ahora time.Time) ResumenLote {
+	resumen := ResumenLote{
+		Lote:         lote,
+		PorCodigo:    map[string]int64{},
+		PorEstado:    map[string]int64{},
+		PorCategoria: map[string]int64{},
+		PorHojaError: map[string]int64{},
+		Fases:        map[string]int64{},
+		Duraciones:   map[string]int64{},
+	}
+	destino := map[string]map[string]int64{
+		prefijoCodigo:    resumen.PorCodigo,
+		prefijoEstado:    resumen.PorEstado,
+		prefijoCategoria: resumen.PorCategoria,
+		prefijoHoja:      resumen.PorHojaError,
+		prefijoFase:      resumen.Fases,
+	}
+	for campo, texto := range valores {
+		valor, _ := strconv.ParseInt(texto, 10, 64)
+		for prefijo, contadores := range destino {
+			// Los contadores en cero quedan de los IDDTE que cambiaron de resultado
+			if strings.HasPrefix(campo, prefijo) && (valor != 0 || prefijo == prefijoFase) {
+				contadores[strings.TrimPrefix(campo, prefijo)] = valor
+			}
+		}
+		if campo == campoTotal {
+			resumen.Total = valor
+		}
+		if conteo, ok := nuevoConteo(campo, valor); ok {
+			resumen.Conteos = append(resumen.Conteos, conteo)
+		}
+	}
+
+	fin, terminado := valores[campoFinEnvio]
+	finEnvio, _ := strconv.ParseInt(fin, 10, 64)
+	if inicio, ok := resumen.Fases[FaseEnviando]; ok {
+		resumen.EnCurso = !terminado
+		if !terminado {
+			finEnvio = ahora.UnixMilli()
+		}
+		resumen.Duraciones["envio"] = finEnvio - inicio
+
+		enviados, err := strconv.ParseInt(valores[campoEnviados], 10, 64)
+		if err != nil || resumen.EnCurso {
+			enviados = resumen.Total
+		}
+		if segundos := float64(finEnvio-inicio) / 1000; segundos > 0 {
+			resumen.DocumentosPorSeg = float64(enviados) / segundos
+		}
+	}
+
+	if inicio, ok := resumen.Fases[FaseConvirtiendo]; ok {
+		if fin, ok := resumen.Fases[FaseConvertido]; ok {
+			resumen.Duraciones["conversion"] = fin - inicio
+		} else if fin, ok := resumen.Fases[FaseConversionFallida]; ok {
+			resumen.Duraciones["conversion"] = fin - inicio
+		}
+	}
+
+	if inicio, ok := resumen.Fases[FaseRecibido]; ok && finEnvio > 0 {
+		resumen.Duraciones["total"] = finEnvio - inicio
+	}
+	return resumen
+}
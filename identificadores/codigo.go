@@ -0,0 +1,18 @@
+package identificadores
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// NuevoCodigoGeneracion genera un UUID versión 4 en mayúsculas, el formato que Hacienda exige
+// para el código de generación de los documentos y eventos
+func NuevoCodigoGeneracion() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("error al generar el código de generación: %v", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // versión 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variante RFC 4122
+	return fmt.Sprintf("%X-%X-%X-%X-%X", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
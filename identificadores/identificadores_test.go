@@ -0,0 +1,30 @@
+package identificadores
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNuevoCodigoGeneracion(t *testing.T) {
+	patron := regexp.MustCompile(`^[0-9A-F]{8}-[0-9A-F]{4}-4[0-9A-F]{3}-[89AB][0-9A-F]{3}-[0-9A-F]{12}$`)
+	codigo, err := NuevoCodigoGeneracion()
+	if err != nil {
+		t.Fatalf("Error al generar el código: %v", err)
+	}
+	if !patron.MatchString(codigo) {
+		t.Errorf("El código %q no es un UUID v4 en mayúsculas", codigo)
+	}
+}
+
+func TestNumeroControl(t *testing.T) {
+	serie := SerieDocumento(map[string]interface{}{"CodigoEstablecimientoMH": "2", "CodigoPuntoVenta": "p01"})
+	if serie != "00020P01" {
+		t.Errorf("Serie inesperada: %q", serie)
+	}
+	if serie := SerieDocumento(map[string]interface{}{}); serie != "M001P001" {
+		t.Errorf("Serie predeterminada inesperada: %q", serie)
+	}
+	if numero := NumeroControl("01", "M001P001", 42); numero != "DTE-01-M001P001-000000000000042" {
+		t.Errorf("Número de control inesperado: %q", numero)
+	}
+}
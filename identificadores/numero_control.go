@@ -0,0 +1,214 @@
+package identificadores
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Códigos usados cuando el documento no indica el establecimiento o el punto de venta
+const (
+	EstablecimientoPredeterminado = "M001"
+	PuntoVentaPredeterminado      = "P001"
+)
+
+// maxSecuencia es el mayor correlativo que cabe en los 15 dígitos del número de control
+const maxSecuencia = 999999999999999
+
+// Asignacion son los identificadores asignados a un IDDTE de un lote
+type Asignacion struct {
+	CodigoGeneracion string    `json:"codigoGeneracion"`
+	NumeroControl    string    `json:"numeroControl"`
+	TipoDte          string    `json:"tipoDte"`
+	Serie            string    `json:"serie"`
+	Secuencia        int64     `json:"secuencia"`
+	Fecha            time.Time `json:"fecha"`
+}
+
+// Serie resume el uso de una secuencia de números de control
+type Serie struct {
+	TipoDte   string  `json:"tipoDte"`
+	Serie     string  `json:"serie"`
+	Ultimo    int64   `json:"ultimo"`
+	Asignados int64   `json:"asignados"`
+	Faltantes []int64 `json:"faltantes"`
+}
+
+func claveAsignaciones(empid string) string { return empid + "_identificadores" }
+func claveSeries(empid string) string       { return empid + "_numero_control_series" }
+func claveSecuencia(empid string, tipoDte string, serie string) string {
+	return fmt.Sprintf("%s_numero_control:%s:%s", empid, tipoDte, serie)
+}
+func claveUsados(empid string, tipoDte string, serie string) string {
+	return fmt.Sprintf("%s_numero_control_asignados:%s:%s", empid, tipoDte, serie)
+}
+
+// NumeroControl arma el número de control DTE-{tipo}-{establecimiento}{punto de venta}-{15 dígitos}
+func NumeroControl(tipoDte string, serie string, secuencia int64) string {
+	return fmt.Sprintf("DTE-%s-%s-%015d", tipoDte, serie, secuencia)
+}
+
+// SerieDocumento obtiene el establecimiento y el punto de venta de la identificación del documento,
+// completados a cuatro caracteres
+func SerieDocumento(identificacion map[string]interface{}) string {
+	establecimiento := campoTexto(identificacion, "CodigoEstablecimiento", "CodigoEstablecimientoMH")
+	if establecimiento == "" {
+		establecimiento = EstablecimientoPredeterminado
+	}
+	puntoVenta := campoTexto(identificacion, "CodigoPuntoVenta", "CodigoPuntoVentaMH")
+	if puntoVenta == "" {
+		puntoVenta = PuntoVentaPredeterminado
+	}
+	return completar(establecimiento) + completar(puntoVenta)
+}
+
+// Asignar devuelve los identificadores del IDDTE de un lote. Si ya se asignaron en un envío anterior se
+// reutilizan; si no, se genera el código de generación y se toma el siguiente número de la serie.
+func Asignar(rdb *redis.Client, empid string, lote string, id string, tipoDte string, identificacion map[string]interface{}) (*Asignacion, error) {
+	ctx := context.Background()
+	campo := lote + ":" + id
+
+	if existente, err := obtenerAsignacion(rdb, empid, campo); err != nil || existente != nil {
+		return existente, err
+	}
+
+	codigo, err := NuevoCodigoGeneracion()
+	if err != nil {
+		return nil, err
+	}
+
+	serie := SerieDocumento(identificacion)
+	secuencia, err := rdb.Incr(ctx, claveSecuencia(empid, tipoDte, serie)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener el número de control: %v", err)
+	}
+	if secuencia > maxSecuencia {
+		return nil, fmt.Errorf("la serie %s del tipo %s llegó al máximo de números de control", serie, tipoDte)
+	}
+
+	asignacion := &Asignacion{
+		CodigoGeneracion: codigo,
+		NumeroControl:    NumeroControl(tipoDte, serie, secuencia),
+		TipoDte:          tipoDte,
+		Serie:            serie,
+		Secuencia:        secuencia,
+		Fecha:            time.Now(),
+	}
+	contenido, err := json.Marshal(asignacion)
+	if err != nil {
+		return nil, fmt.Errorf("error al serializar los identificadores: %v", err)
+	}
+
+	// Si otro envío del mismo IDDTE ganó la asignación se usa la suya; el número tomado queda como faltante
+	guardado, err := rdb.HSetNX(ctx, claveAsignaciones(empid), campo, contenido).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error al guardar los identificadores: %v", err)
+	}
+	if !guardado {
+		return obtenerAsignacion(rdb, empid, campo)
+	}
+
+	pipe := rdb.TxPipeline()
+	pipe.ZAdd(ctx, claveUsados(empid, tipoDte, serie), &redis.Z{Score: float64(secuencia), Member: campo})
+	pipe.SAdd(ctx, claveSeries(empid), tipoDte+":"+serie)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("error al registrar el número de control: %v", err)
+	}
+	return asignacion, nil
+}
+
+// ObtenerAsignacion devuelve los identificadores asignados a un IDDTE de un lote, o nil si no tiene
+func ObtenerAsignacion(rdb *redis.Client, empid string, lote string, id string) (*Asignacion, error) {
+	return obtenerAsignacion(rdb, empid, lote+":"+id)
+}
+
+func obtenerAsignacion(rdb *redis.Client, empid string, campo string) (*Asignacion, error) {
+	contenido, err := rdb.HGet(context.Background(), claveAsignaciones(empid), campo).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener los identificadores asignados: %v", err)
+	}
+
+	var asignacion Asignacion
+	if err := json.Unmarshal([]byte(contenido), &asignacion); err != nil {
+		return nil, fmt.Errorf("error al analizar los identificadores asignados: %v", err)
+	}
+	return &asignacion, nil
+}
+
+// Auditar revisa cada serie de números de control de la empresa y devuelve los números que se tomaron
+// de la secuencia pero no quedaron asignados a ningún documento
+func Auditar(rdb *redis.Client, empid string) ([]Serie, error) {
+	ctx := context.Background()
+	series, err := rdb.SMembers(ctx, claveSeries(empid)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener las series de números de control: %v", err)
+	}
+	sort.Strings(series)
+
+	resultado := make([]Serie, 0, len(series))
+	for _, nombre := range series {
+		partes := strings.SplitN(nombre, ":", 2)
+		if len(partes) != 2 {
+			continue
+		}
+		serie := Serie{TipoDte: partes[0], Serie: partes[1], Faltantes: []int64{}}
+
+		ultimo, err := rdb.Get(ctx, claveSecuencia(empid, serie.TipoDte, serie.Serie)).Result()
+		if err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("error al obtener la secuencia %s: %v", nombre, err)
+		}
+		serie.Ultimo, _ = strconv.ParseInt(ultimo, 10, 64)
+
+		usados, err := rdb.ZRangeWithScores(ctx, claveUsados(empid, serie.TipoDte, serie.Serie), 0, -1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("error al obtener los números asignados de %s: %v", nombre, err)
+		}
+		serie.Asignados = int64(len(usados))
+
+		// Los números están ordenados; cualquier salto entre ellos es un faltante
+		esperado := int64(1)
+		for _, usado := range usados {
+			numero := int64(usado.Score)
+			for ; esperado < numero; esperado++ {
+				serie.Faltantes = append(serie.Faltantes, esperado)
+			}
+			esperado = numero + 1
+		}
+		for ; esperado <= serie.Ultimo; esperado++ {
+			serie.Faltantes = append(serie.Faltantes, esperado)
+		}
+
+		resultado = append(resultado, serie)
+	}
+	return resultado, nil
+}
+
+// campoTexto devuelve el primer campo con valor de la identificación
+func campoTexto(fila map[string]interface{}, campos ...string) string {
+	for _, campo := range campos {
+		if valor, ok := fila[campo]; ok && valor != nil {
+			if texto := strings.TrimSpace(fmt.Sprint(valor)); texto != "" {
+				return texto
+			}
+		}
+	}
+	return ""
+}
+
+// completar ajusta un código a cuatro caracteres, con ceros a la izquierda si es más corto
+func completar(codigo string) string {
+	codigo = strings.ToUpper(codigo)
+	if len(codigo) >= 4 {
+		return codigo[:4]
+	}
+	return strings.Repeat("0", 4-len(codigo)) + codigo
+}
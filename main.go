@@ -1,8 +1,12 @@
 package main
 
 import (
+	"GoProcesadorExcel/correo"
+	"GoProcesadorExcel/registro"
 	"GoProcesadorExcel/routes"
+	"GoProcesadorExcel/utils"
 	"context"
+	"flag"
 	"log"
 	"os"
 
@@ -14,6 +18,10 @@ var rdb *redis.Client
 
 func main() {
 
+	// Con -reindexar solo se construye el índice de lotes a partir de las claves existentes y se termina
+	reindexar := flag.Bool("reindexar", false, "construir el índice de lotes de todas las empresas y salir")
+	flag.Parse()
+
 	if err := godotenv.Load(); err != nil {
 		log.Fatal("Error al cargar archivo .env")
 	}
@@ -37,6 +45,20 @@ func main() {
 	}
 	log.Printf("Conexión a Redis establecida: %s", pong)
 
+	if *reindexar {
+		lotes, err := registro.Reconstruir(rdb)
+		if err != nil {
+			log.Fatalf("Error al construir el índice de lotes: %v", err)
+		}
+		log.Printf("Índice de lotes construido: %d lotes registrados", lotes)
+		return
+	}
+
+	// Revisar periódicamente las contingencias, los envíos por conciliar y los correos pendientes
+	utils.IniciarMonitorContingencia(rdb)
+	utils.IniciarConciliacion(rdb)
+	correo.IniciarEnvioCorreos(rdb)
+
 	r := routes.SetupRouter(rdb)
 	r.Run(":8082")
 }
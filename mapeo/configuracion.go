@@ -0,0 +1,284 @@
+package mapeo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Configuracion es el documento versionado con el mapeo de una empresa
+type Configuracion struct {
+	Version  int                          `json:"version"`
+	Fecha    string                       `json:"fecha,omitempty"`
+	Valores  MapaCliente                  `json:"valores"`
+	Tipos    TiposColumna                 `json:"tipos,omitempty"`
+	Columnas map[string]map[string]string `json:"columnas,omitempty"`
+}
+
+var ErrVersionNoExiste = errors.New("la versión del mapeo no existe")
+
+var tiposValidos = map[string]bool{"str": true, "int": true, "float": true, "bool": true}
+
+func claveMapeo(empid string) string        { return empid + "_mapeo" }
+func claveVersionMapeo(empid string) string { return empid + "_mapeo_version" }
+func claveMapeoActivo(empid string) string  { return empid + "_mapeo_activo" }
+
+// ObtenerConfiguracion devuelve el mapeo activo de la empresa. Si no hay ninguno guardado en Redis
+// se usa el archivo de la carpeta de mapas como versión 0.
+func ObtenerConfiguracion(rdb *redis.Client, empid string) (*Configuracion, error) {
+	activa, err := rdb.Get(context.Background(), claveMapeoActivo(empid)).Result()
+	if err == redis.Nil {
+		mapa, err := CargarMapaCliente(empid)
+		if err != nil {
+			return nil, err
+		}
+		return &Configuracion{Version: 0, Valores: mapa}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener el mapeo activo: %v", err)
+	}
+
+	version, err := strconv.Atoi(activa)
+	if err != nil {
+		return nil, fmt.Errorf("versión de mapeo activa inválida %q", activa)
+	}
+	return ObtenerVersion(rdb, empid, version)
+}
+
+// ObtenerVersion devuelve una versión específica del mapeo de la empresa
+func ObtenerVersion(rdb *redis.Client, empid string, version int) (*Configuracion, error) {
+	contenido, err := rdb.HGet(context.Background(), claveMapeo(empid), strconv.Itoa(version)).Result()
+	if err == redis.Nil {
+		return nil, ErrVersionNoExiste
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener la versión %d del mapeo: %v", version, err)
+	}
+
+	var configuracion Configuracion
+	if err := json.Unmarshal([]byte(contenido), &configuracion); err != nil {
+		return nil, fmt.Errorf("error al analizar la versión %d del mapeo: %v", version, err)
+	}
+	return &configuracion, nil
+}
+
+// ListarVersiones devuelve los números de versión guardados y la versión activa
+func ListarVersiones(rdb *redis.Client, empid string) ([]int, int, error) {
+	campos, err := rdb.HKeys(context.Background(), claveMapeo(empid)).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("error al listar las versiones del mapeo: %v", err)
+	}
+
+	versiones := make([]int, 0, len(campos))
+	for _, campo := range campos {
+		if version, err := strconv.Atoi(campo); err == nil {
+			versiones = append(versiones, version)
+		}
+	}
+	sort.Ints(versiones)
+
+	activa, err := rdb.Get(context.Background(), claveMapeoActivo(empid)).Int()
+	if err != nil && err != redis.Nil {
+		return nil, 0, fmt.Errorf("error al obtener el mapeo activo: %v", err)
+	}
+	return versiones, activa, nil
+}
+
+// GuardarConfiguracion valida el mapeo, lo guarda como una nueva versión y la activa
+func GuardarConfiguracion(rdb *redis.Client, empid string, configuracion *Configuracion) (int, error) {
+	base, err := CargarTipos()
+	if err != nil {
+		return 0, err
+	}
+	if err := configuracion.Validar(base); err != nil {
+		return 0, err
+	}
+
+	version, err := rdb.Incr(context.Background(), claveVersionMapeo(empid)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("error al generar la versión del mapeo: %v", err)
+	}
+	configuracion.Version = int(version)
+	configuracion.Fecha = time.Now().Format(time.RFC3339)
+
+	contenido, err := json.Marshal(configuracion)
+	if err != nil {
+		return 0, fmt.Errorf("error al serializar el mapeo: %v", err)
+	}
+
+	pipe := rdb.TxPipeline()
+	pipe.HSet(context.Background(), claveMapeo(empid), strconv.Itoa(configuracion.Version), contenido)
+	pipe.Set(context.Background(), claveMapeoActivo(empid), configuracion.Version, 0)
+	if _, err := pipe.Exec(context.Background()); err != nil {
+		return 0, fmt.Errorf("error al guardar el mapeo: %v", err)
+	}
+	return configuracion.Version, nil
+}
+
+// ActivarVersion vuelve a activar una versión guardada del mapeo
+func ActivarVersion(rdb *redis.Client, empid string, version int) error {
+	existe, err := rdb.HExists(context.Background(), claveMapeo(empid), strconv.Itoa(version)).Result()
+	if err != nil {
+		return fmt.Errorf("error al verificar la versión %d del mapeo: %v", version, err)
+	}
+	if !existe {
+		return ErrVersionNoExiste
+	}
+	return rdb.Set(context.Background(), claveMapeoActivo(empid), version, 0).Err()
+}
+
+// EscribirArchivo guarda el mapeo en un archivo JSON para que lo lea excelProcessor.py
+func (c *Configuracion) EscribirArchivo(ruta string) error {
+	if err := os.MkdirAll(filepath.Dir(ruta), 0755); err != nil {
+		return fmt.Errorf("error al crear la carpeta del mapeo: %v", err)
+	}
+	contenido, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("error al serializar el mapeo: %v", err)
+	}
+	return os.WriteFile(ruta, contenido, 0644)
+}
+
+// TiposCombinados aplica los tipos propios de la empresa sobre el mapa de tipos base
+func (c *Configuracion) TiposCombinados(base TiposColumna) TiposColumna {
+	tipos := TiposColumna{}
+	for hoja, columnas := range base {
+		tipos[hoja] = map[string]string{}
+		for columna, tipo := range columnas {
+			tipos[hoja][columna] = tipo
+		}
+	}
+	for hoja, columnas := range c.Tipos {
+		if tipos[hoja] == nil {
+			tipos[hoja] = map[string]string{}
+		}
+		for columna, tipo := range columnas {
+			tipos[hoja][columna] = tipo
+		}
+	}
+	return tipos
+}
+
+// ColumnaExcel devuelve el nombre que la empresa usa en su libro para una columna del DTE.
+// Si la columna tiene varios alias se usa el primero en orden alfabético.
+func (c *Configuracion) ColumnaExcel(hoja string, columna string) string {
+	var alias []string
+	for origen, destino := range c.Columnas[hoja] {
+		if destino == columna {
+			alias = append(alias, origen)
+		}
+	}
+	if len(alias) == 0 {
+		return columna
+	}
+	sort.Strings(alias)
+	return alias[0]
+}
+
+// Validar revisa que el mapeo pueda ser aplicado por el conversor
+func (c *Configuracion) Validar(base TiposColumna) error {
+	for hoja, columnas := range c.Tipos {
+		for columna, tipo := range columnas {
+			if !tiposValidos[tipo] {
+				return fmt.Errorf("tipos: el tipo %q de la columna %s.%s no es válido (str, int, float o bool)", tipo, hoja, columna)
+			}
+		}
+	}
+
+	tipos := c.TiposCombinados(base)
+	for tipoDte, hojas := range c.Valores {
+		if _, ok := hojasTipo(tipoDte); !ok {
+			return fmt.Errorf("valores: el tipo de DTE %q no está definido", tipoDte)
+		}
+		for hoja, valores := range hojas {
+			if err := validarValoresHoja(tipos, tipoDte, hoja, valores); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Varios alias pueden apuntar a la misma columna, pero dos alias que se normalizan
+	// igual no pueden apuntar a columnas distintas
+	for hoja, columnas := range c.Columnas {
+		plegados := map[string]string{}
+		for origen, destino := range columnas {
+			if strings.TrimSpace(origen) == "" || strings.TrimSpace(destino) == "" {
+				return fmt.Errorf("columnas: la hoja %s tiene un alias vacío", hoja)
+			}
+			if destino == "IDDTE" || origen == "IDDTE" {
+				return fmt.Errorf("columnas: la columna IDDTE de la hoja %s no puede renombrarse", hoja)
+			}
+			clave := Plegar(origen)
+			if anterior, ok := plegados[clave]; ok && anterior != destino {
+				return fmt.Errorf("columnas: el alias %q de la hoja %s es ambiguo entre %q y %q", origen, hoja, anterior, destino)
+			}
+			plegados[clave] = destino
+		}
+	}
+	return nil
+}
+
+func validarValoresHoja(tipos TiposColumna, tipoDte string, hoja string, valores interface{}) error {
+	switch v := valores.(type) {
+	case map[string]interface{}:
+		return validarFila(tipos, tipoDte, hoja, v)
+	case []interface{}:
+		if hoja == HojaRaiz {
+			return fmt.Errorf("valores: la hoja %s del tipo %s debe ser un objeto", hoja, tipoDte)
+		}
+		for _, item := range v {
+			fila, ok := item.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("valores: la hoja %s del tipo %s debe contener objetos", hoja, tipoDte)
+			}
+			if err := validarFila(tipos, tipoDte, hoja, fila); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("valores: la hoja %s del tipo %s debe ser un objeto o una lista de objetos", hoja, tipoDte)
+}
+
+func validarFila(tipos TiposColumna, tipoDte string, hoja string, fila map[string]interface{}) error {
+	for columna, valor := range fila {
+		if valor == nil {
+			continue
+		}
+		tipo := tipos[hoja][columna]
+		if tipo == "" {
+			continue
+		}
+		if !valorCompatible(tipo, valor) {
+			return fmt.Errorf("valores: el valor %v de %s.%s del tipo %s no es de tipo %s", valor, hoja, columna, tipoDte, tipo)
+		}
+	}
+	return nil
+}
+
+func valorCompatible(tipo string, valor interface{}) bool {
+	switch tipo {
+	case "str":
+		_, ok := valor.(string)
+		return ok
+	case "int":
+		numero, ok := valor.(float64)
+		return ok && numero == float64(int64(numero))
+	case "float":
+		_, ok := valor.(float64)
+		return ok
+	case "bool":
+		_, ok := valor.(bool)
+		return ok
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package mapeo
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func init() {
+	DirectorioMapas = filepath.Join("..", "utils", "maps")
+}
+
+func TestValidarMapeoCliente(t *testing.T) {
+	tipos, err := CargarTipos()
+	if err != nil {
+		t.Fatalf("Error al cargar los tipos: %v", err)
+	}
+	mapa, err := CargarMapaCliente("1022")
+	if err != nil {
+		t.Fatalf("Error al cargar el mapa del cliente: %v", err)
+	}
+
+	configuracion := Configuracion{Valores: mapa}
+	if err := configuracion.Validar(tipos); err != nil {
+		t.Errorf("El mapa del cliente 1022 debería ser válido: %v", err)
+	}
+}
+
+func TestValidarMapeoInvalido(t *testing.T) {
+	casos := map[string]string{
+		"tipo de DTE inexistente": `{"valores": {"99": {"dte": {}}}}`,
+		"tipo de columna":         `{"tipos": {"Receptor": {"Nit": "texto"}}}`,
+		"valor con otro tipo":     `{"valores": {"01": {"Identificacion": {"TipoDte": 1}}}}`,
+		"raíz como lista":         `{"valores": {"01": {"dte": [{"NumeroIntentos": 0}]}}}`,
+		"alias ambiguo":           `{"columnas": {"Receptor": {"NIT": "Nit", "nit": "Nrc"}}}`,
+	}
+
+	for nombre, documento := range casos {
+		var configuracion Configuracion
+		if err := json.Unmarshal([]byte(documento), &configuracion); err != nil {
+			t.Fatalf("%s: error al analizar el documento: %v", nombre, err)
+		}
+		if err := configuracion.Validar(TiposColumna{"Identificacion": {"TipoDte": "str"}}); err == nil {
+			t.Errorf("%s: se esperaba un error de validación", nombre)
+		}
+	}
+}
+
+func TestDefinicionConMapeo(t *testing.T) {
+	configuracion := &Configuracion{
+		Valores:  MapaCliente{"01": {"Identificacion": map[string]interface{}{"TipoDte": "01"}}},
+		Columnas: map[string]map[string]string{"Receptor": {"Documento": "NumeroDocumentoIdentificacion"}},
+	}
+
+	hojas, err := Definicion("01", TiposColumna{}, configuracion)
+	if err != nil {
+		t.Fatalf("Error al construir la definición: %v", err)
+	}
+
+	columnas := map[string]bool{}
+	for _, hoja := range hojas {
+		for _, columna := range hoja.Columnas {
+			columnas[hoja.Nombre+"."+columna.Nombre] = true
+		}
+	}
+
+	if columnas["Identificacion.TipoDte"] {
+		t.Error("La columna con valor fijo no debería estar en la plantilla")
+	}
+	if !columnas["Receptor.Documento"] || columnas["Receptor.NumeroDocumentoIdentificacion"] {
+		t.Error("La columna renombrada debería mostrarse con el nombre de la empresa")
+	}
+}
+
+func TestHojasConTiposDelConversor(t *testing.T) {
+	disposicion, err := CargarHojas()
+	if err != nil {
+		t.Fatalf("Error al cargar las hojas: %v", err)
+	}
+	tipos, err := CargarTipos()
+	if err != nil {
+		t.Fatalf("Error al cargar los tipos: %v", err)
+	}
+	if len(disposicion) == 0 {
+		t.Fatal("hojas.json no define ningún tipo de DTE")
+	}
+
+	for tipoDte, hojas := range disposicion {
+		for _, hoja := range hojas {
+			for _, nombre := range hoja.Columnas {
+				nombre = strings.TrimSuffix(nombre, "*")
+				if _, ok := tipos[hoja.Hoja][nombre]; !ok {
+					t.Errorf("%s: la columna %s.%s no tiene tipo en tipos.json", tipoDte, hoja.Hoja, nombre)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package mapeo
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tealeg/xlsx"
+)
+
+// ArchivoCSV es una hoja recibida como CSV; el nombre de la hoja es el del archivo sin extensión
+type ArchivoCSV struct {
+	Hoja      string
+	Contenido []byte
+}
+
+var patronNumero = regexp.MustCompile(`^-?(0|[1-9]\d*)(\.\d+)?$`)
+
+// LibroDesdeCSV arma un libro de Excel con una hoja por CSV. La hoja raíz (dte) queda primero, seguida
+// de las hojas en el orden de la definición del tipo de DTE. Los valores se escriben con el tipo de su
+// columna para que el conversor los lea igual que si vinieran de Excel.
+func LibroDesdeCSV(archivos []ArchivoCSV, tipoDte string, tipos TiposColumna, configuracion *Configuracion) ([]byte, error) {
+	tipos = configuracion.TiposCombinados(tipos)
+	ordenarHojas(archivos, tipoDte)
+
+	if len(archivos) == 0 || Plegar(archivos[0].Hoja) != Plegar(HojaRaiz) {
+		return nil, fmt.Errorf("falta el archivo %s.csv con la hoja raíz del documento", HojaRaiz)
+	}
+
+	libro := xlsx.NewFile()
+	for _, archivo := range archivos {
+		registros, err := leerCSV(archivo.Contenido)
+		if err != nil {
+			return nil, fmt.Errorf("error al leer el archivo %s.csv: %v", archivo.Hoja, err)
+		}
+		if len(registros) == 0 {
+			continue
+		}
+
+		hoja, err := libro.AddSheet(archivo.Hoja)
+		if err != nil {
+			return nil, fmt.Errorf("error al agregar la hoja %s: %v", archivo.Hoja, err)
+		}
+
+		encabezados := registros[0]
+		tiposHoja := tiposPlegados(tipos, archivo.Hoja, configuracion)
+
+		fila := hoja.AddRow()
+		for _, encabezado := range encabezados {
+			fila.AddCell().SetString(strings.TrimSpace(encabezado))
+		}
+
+		for _, registro := range registros[1:] {
+			fila := hoja.AddRow()
+			for i, valor := range registro {
+				tipo := ""
+				if i < len(encabezados) {
+					tipo = tiposHoja[Plegar(encabezados[i])]
+				}
+				escribirCelda(fila.AddCell(), strings.TrimSpace(valor), tipo)
+			}
+		}
+	}
+
+	var buffer bytes.Buffer
+	if err := libro.Write(&buffer); err != nil {
+		return nil, fmt.Errorf("error al generar el libro de Excel: %v", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// leerCSV detecta el separador (coma o punto y coma) y devuelve los registros del archivo
+func leerCSV(contenido []byte) ([][]string, error) {
+	contenido = bytes.TrimPrefix(contenido, []byte("\xef\xbb\xbf"))
+
+	primeraLinea := contenido
+	if fin := bytes.IndexByte(contenido, '\n'); fin >= 0 {
+		primeraLinea = contenido[:fin]
+	}
+
+	lector := csv.NewReader(bytes.NewReader(contenido))
+	if bytes.Count(primeraLinea, []byte(";")) > bytes.Count(primeraLinea, []byte(",")) {
+		lector.Comma = ';'
+	}
+	lector.FieldsPerRecord = -1
+	return lector.ReadAll()
+}
+
+// escribirCelda guarda el valor con el tipo de la columna; sin tipo declarado los números se
+// escriben como números y el resto como texto, respetando los ceros a la izquierda
+func escribirCelda(celda *xlsx.Cell, valor string, tipo string) {
+	if valor == "" {
+		return
+	}
+
+	switch tipo {
+	case "str":
+		celda.SetString(valor)
+		return
+	case "bool":
+		switch strings.ToLower(valor) {
+		case "true", "verdadero", "1", "si", "sí":
+			celda.SetBool(true)
+		case "false", "falso", "0", "no":
+			celda.SetBool(false)
+		default:
+			celda.SetString(valor)
+		}
+		return
+	case "int", "float":
+		// Los ERP con configuración regional en español exportan la coma como separador decimal
+		if !strings.Contains(valor, ".") {
+			valor = strings.Replace(valor, ",", ".", 1)
+		}
+	}
+
+	if patronNumero.MatchString(valor) {
+		if entero, err := strconv.ParseInt(valor, 10, 64); err == nil {
+			celda.SetInt64(entero)
+			return
+		}
+		if decimal, err := strconv.ParseFloat(valor, 64); err == nil {
+			celda.SetFloat(decimal)
+			return
+		}
+	}
+	celda.SetString(valor)
+}
+
+// tiposPlegados devuelve los tipos de las columnas de una hoja indexados por el encabezado normalizado
+func tiposPlegados(tipos TiposColumna, hoja string, configuracion *Configuracion) map[string]string {
+	plegados := map[string]string{}
+	for nombreHoja, columnas := range tipos {
+		if Plegar(nombreHoja) != Plegar(hoja) {
+			continue
+		}
+		for columna, tipo := range columnas {
+			plegados[Plegar(columna)] = tipo
+		}
+		for origen, destino := range configuracion.Columnas[nombreHoja] {
+			if tipo, ok := columnas[destino]; ok {
+				plegados[Plegar(origen)] = tipo
+			}
+		}
+	}
+	return plegados
+}
+
+// ordenarHojas coloca la hoja raíz primero y luego las hojas en el orden de la definición del tipo de DTE
+func ordenarHojas(archivos []ArchivoCSV, tipoDte string) {
+	posiciones := map[string]int{Plegar(HojaRaiz): 0}
+	hojas, _ := hojasTipo(tipoDte)
+	for i, definicion := range hojas {
+		if _, ok := posiciones[Plegar(definicion.Hoja)]; !ok {
+			posiciones[Plegar(definicion.Hoja)] = i + 1
+		}
+	}
+
+	posicion := func(hoja string) int {
+		if p, ok := posiciones[Plegar(hoja)]; ok {
+			return p
+		}
+		return len(posiciones) + 1
+	}
+
+	sort.SliceStable(archivos, func(i, j int) bool {
+		pi, pj := posicion(archivos[i].Hoja), posicion(archivos[j].Hoja)
+		if pi != pj {
+			return pi < pj
+		}
+		return archivos[i].Hoja < archivos[j].Hoja
+	})
+}
@@ -0,0 +1,43 @@
+package mapeo
+
+import (
+	"testing"
+
+	"github.com/tealeg/xlsx"
+)
+
+func TestLibroDesdeCSV(t *testing.T) {
+	archivos := []ArchivoCSV{
+		{Hoja: "Receptor", Contenido: []byte("IDDTE;Nit;Nombre\n1;06140101011011;Cliente\n")},
+		{Hoja: "dte", Contenido: []byte("\xef\xbb\xbfIDDTE,NumeroIntentos\n1,0\n")},
+	}
+	tipos := TiposColumna{"Receptor": {"Nit": "str"}}
+
+	contenido, err := LibroDesdeCSV(archivos, "01", tipos, &Configuracion{})
+	if err != nil {
+		t.Fatalf("Error al armar el libro: %v", err)
+	}
+
+	libro, err := xlsx.OpenBinary(contenido)
+	if err != nil {
+		t.Fatalf("Error al abrir el libro generado: %v", err)
+	}
+	if len(libro.Sheets) != 2 || libro.Sheets[0].Name != "dte" || libro.Sheets[1].Name != "Receptor" {
+		t.Fatalf("Hojas inesperadas: %v", libro.Sheets)
+	}
+	if libro.Sheets[0].Rows[0].Cells[0].Value != "IDDTE" {
+		t.Errorf("El BOM no se eliminó del encabezado: %q", libro.Sheets[0].Rows[0].Cells[0].Value)
+	}
+
+	nit := libro.Sheets[1].Rows[1].Cells[1]
+	if nit.Type() != xlsx.CellTypeString || nit.Value != "06140101011011" {
+		t.Errorf("El NIT debería conservarse como texto: %q", nit.Value)
+	}
+}
+
+func TestLibroDesdeCSVSinRaiz(t *testing.T) {
+	archivos := []ArchivoCSV{{Hoja: "Receptor", Contenido: []byte("IDDTE,Nit\n1,0614\n")}}
+	if _, err := LibroDesdeCSV(archivos, "01", TiposColumna{}, &Configuracion{}); err == nil {
+		t.Error("Se esperaba un error por la falta de la hoja raíz")
+	}
+}
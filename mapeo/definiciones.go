@@ -0,0 +1,214 @@
+package mapeo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// HojaRaiz es la primera hoja del libro; sus columnas se agregan en la raíz del documento
+const HojaRaiz = "dte"
+
+// Columna describe una columna que el conversor espera en una hoja. Campo es el nombre del DTE y
+// Nombre el encabezado que usa la empresa en su libro.
+type Columna struct {
+	Campo       string
+	Nombre      string
+	Tipo        string
+	Requerida   bool
+	Catalogo    []string
+	Descripcion string
+	Ejemplo     interface{}
+}
+
+// Hoja describe una hoja del libro con sus columnas en orden
+type Hoja struct {
+	Nombre   string
+	Columnas []Columna
+}
+
+// infoColumna documenta una columna de una hoja
+type infoColumna struct {
+	descripcion string
+	ejemplo     interface{}
+	catalogo    []string
+}
+
+var (
+	catalogoTipoDocumento  = []string{"36", "13", "37", "03", "02"}
+	catalogoTipoDte        = []string{"01", "03", "04", "05", "06", "07", "08", "09", "11", "14", "15"}
+	catalogoDepartamento   = []string{"01", "02", "03", "04", "05", "06", "07", "08", "09", "10", "11", "12", "13", "14"}
+	catalogoCondicion      = []string{"1", "2", "3"}
+	catalogoTipoItem       = []string{"1", "2", "3", "4"}
+	catalogoRetencionIva   = []string{"22", "C4", "C9"}
+	catalogoTipoPersona    = []string{"1", "2"}
+	catalogoTipoGeneracion = []string{"1", "2"}
+	catalogoInvalidacion   = []string{"1", "2", "3"}
+)
+
+// columnas contiene la documentación de cada columna, con la clave Hoja.Columna
+var columnas = map[string]infoColumna{
+	"IDDTE": {descripcion: "Identificador del documento dentro del libro; relaciona las filas de todas las hojas", ejemplo: 1},
+
+	"dte.CodigoCondicionOperacion": {descripcion: "Condición de la operación: 1 contado, 2 crédito, 3 otro", ejemplo: "1", catalogo: catalogoCondicion},
+	"dte.CodigoEstablecimientoMH":  {descripcion: "Código del establecimiento asignado por Hacienda", ejemplo: "0002"},
+	"dte.TipoInvalidacion":         {descripcion: "Tipo de invalidación: 1 error en la información, 2 rescindir la operación, 3 otro", ejemplo: "2", catalogo: catalogoInvalidacion},
+	"dte.MotivoInvalidacion":       {descripcion: "Motivo de la invalidación", ejemplo: "Operación anulada por el cliente"},
+	"dte.TipoDte":                  {descripcion: "Tipo de DTE del documento; si se omite se usa el tipo indicado al enviar el lote", ejemplo: "01", catalogo: catalogoTipoDte},
+
+	"Identificacion.CodigoEstablecimientoMH": {descripcion: "Código del establecimiento asignado por Hacienda", ejemplo: "0002"},
+	"Identificacion.Moneda":                  {descripcion: "Moneda de la operación", ejemplo: "USD", catalogo: []string{"USD"}},
+	"Identificacion.TipoDte":                 {descripcion: "Tipo de DTE", ejemplo: "01", catalogo: catalogoTipoDte},
+
+	"Receptor.TipoDocumentoIdentificacion":   {descripcion: "Tipo de documento: 36 NIT, 13 DUI, 37 otro, 03 pasaporte, 02 carnet de residente", ejemplo: "13", catalogo: catalogoTipoDocumento},
+	"Receptor.NumeroDocumentoIdentificacion": {descripcion: "Número del documento, con o sin guiones", ejemplo: "00016297-5"},
+	"Receptor.Nit":                           {descripcion: "NIT de 14 dígitos o DUI homologado de 9 dígitos", ejemplo: "0614-010190-101-2"},
+	"Receptor.Nrc":                           {descripcion: "Número de registro de contribuyente", ejemplo: "123456-7"},
+	"Receptor.Nombres":                       {descripcion: "Nombre o razón social del receptor", ejemplo: "Victor Perez"},
+	"Receptor.CodigoActividadEconomica":      {descripcion: "Código de la actividad económica del receptor", ejemplo: "10005"},
+	"Receptor.DescripcionActividadEconomica": {descripcion: "Descripción de la actividad económica del receptor", ejemplo: "Otros"},
+	"Receptor.CodigoDepartamento":            {descripcion: "Código del departamento de la dirección", ejemplo: "06", catalogo: catalogoDepartamento},
+	"Receptor.CodigoMunicipio":               {descripcion: "Código del municipio de la dirección", ejemplo: "14"},
+	"Receptor.Direccion":                     {descripcion: "Complemento de la dirección", ejemplo: "Colonia Escalón, San Salvador"},
+	"Receptor.DireccionComplemento":          {descripcion: "Dirección del receptor en el extranjero", ejemplo: "5th Avenue 100, New York"},
+	"Receptor.CodigoPais":                    {descripcion: "Código del país del receptor", ejemplo: "9450"},
+	"Receptor.NombrePais":                    {descripcion: "Nombre del país del receptor", ejemplo: "Estados Unidos"},
+	"Receptor.CodigoTipoPersona":             {descripcion: "Tipo de persona: 1 natural, 2 jurídica", ejemplo: 1, catalogo: catalogoTipoPersona},
+	"Receptor.Correo":                        {descripcion: "Correo electrónico del receptor", ejemplo: "receptor@mail.com"},
+	"Receptor.Telefono":                      {descripcion: "Teléfono del receptor", ejemplo: "22222222"},
+
+	"Detalles.CodigoTipoItem":       {descripcion: "Tipo de ítem: 1 bien, 2 servicio, 3 ambos, 4 otro", ejemplo: 2, catalogo: catalogoTipoItem},
+	"Detalles.TipoMonto":            {descripcion: "Tipo de monto de la venta del ítem", ejemplo: 1},
+	"Detalles.Cantidad":             {descripcion: "Cantidad del ítem", ejemplo: 1},
+	"Detalles.Codigo":               {descripcion: "Código interno del producto o servicio", ejemplo: "P001"},
+	"Detalles.CodigoUnidadMedida":   {descripcion: "Código de la unidad de medida (59 unidad)", ejemplo: "59"},
+	"Detalles.Descripcion":          {descripcion: "Descripción del producto o servicio", ejemplo: "Producto 1"},
+	"Detalles.PrecioUnitario":       {descripcion: "Precio unitario del ítem", ejemplo: 10.0},
+	"Detalles.Descuento":            {descripcion: "Monto de descuento del ítem", ejemplo: 0.0},
+	"Detalles.Subtotal":             {descripcion: "Subtotal del ítem", ejemplo: 10.0},
+	"Detalles.IvaItem":              {descripcion: "IVA incluido en el ítem", ejemplo: 1.15},
+	"Detalles.Tributos":             {descripcion: "Códigos de tributos separados por comas", ejemplo: "20"},
+	"Detalles.CodigoTributo":        {descripcion: "Código del tributo cuando el ítem es un tributo", ejemplo: ""},
+	"Detalles.CodGenDocRelacionado": {descripcion: "Código de generación del documento relacionado al ítem", ejemplo: ""},
+
+	"Resumen.CodigoRetencionIva":      {descripcion: "Código de retención de IVA", ejemplo: "22", catalogo: catalogoRetencionIva},
+	"Resumen.PercepcionIva":           {descripcion: "Indica si aplica percepción de IVA (VERDADERO/FALSO)", ejemplo: false},
+	"Resumen.RetencionRenta":          {descripcion: "Indica si aplica retención de renta (VERDADERO/FALSO)", ejemplo: false},
+	"Resumen.DescuentoNoSujeto":       {descripcion: "Descuento a ventas no sujetas", ejemplo: 0.0},
+	"Resumen.DescuentoGravado":        {descripcion: "Descuento a ventas gravadas", ejemplo: 0.0},
+	"Resumen.DescuentoExento":         {descripcion: "Descuento a ventas exentas", ejemplo: 0.0},
+	"Resumen.Seguro":                  {descripcion: "Monto del seguro", ejemplo: 0.0},
+	"Resumen.Flete":                   {descripcion: "Monto del flete", ejemplo: 0.0},
+	"Resumen.CodigoIncoterm":          {descripcion: "Código INCOTERMS", ejemplo: "10"},
+	"Resumen.DescripcionIncoterm":     {descripcion: "Descripción INCOTERMS", ejemplo: "FOB-Libre a bordo"},
+	"Resumen.Observaciones":           {descripcion: "Observaciones del documento", ejemplo: ""},
+	"Resumen.TipoDocIdentResponsable": {descripcion: "Tipo de documento del responsable de la invalidación", ejemplo: "13", catalogo: catalogoTipoDocumento},
+	"Resumen.NumDocIdentResponsable":  {descripcion: "Número de documento del responsable de la invalidación", ejemplo: "00016297-5"},
+	"Resumen.NombresResponsable":      {descripcion: "Nombre del responsable de la invalidación", ejemplo: "Victor Perez"},
+	"Resumen.TipoDocIdentSolicita":    {descripcion: "Tipo de documento de quien solicita la invalidación", ejemplo: "13", catalogo: catalogoTipoDocumento},
+	"Resumen.NumDocIdentSolicita":     {descripcion: "Número de documento de quien solicita la invalidación", ejemplo: "00016297-5"},
+	"Resumen.NombresSolicita":         {descripcion: "Nombre de quien solicita la invalidación", ejemplo: "Victor Perez"},
+
+	"Extension.NombreEntrega":    {descripcion: "Nombre de quien entrega", ejemplo: "Cante Feliz"},
+	"Extension.DocumentoEntrega": {descripcion: "Documento de quien entrega (DUI, NIT u otro)", ejemplo: "00016297-5"},
+	"Extension.NombreRecibe":     {descripcion: "Nombre de quien recibe", ejemplo: "Victor Perez"},
+	"Extension.DocumentoRecibe":  {descripcion: "Documento de quien recibe (DUI, NIT u otro)", ejemplo: "00016297-5"},
+	"Extension.Observaciones":    {descripcion: "Observaciones de la entrega", ejemplo: ""},
+	"Extension.PlacaVehiculo":    {descripcion: "Placa del vehículo", ejemplo: ""},
+
+	"DocumentosRelacionados.TipoDte":              {descripcion: "Tipo de DTE del documento relacionado", ejemplo: "03", catalogo: catalogoTipoDte},
+	"DocumentosRelacionados.CodigoGeneracion":     {descripcion: "Código de generación o número del documento relacionado", ejemplo: "1B2C3D4E-0000-4000-8000-000000000000"},
+	"DocumentosRelacionados.CodigoTipoGeneracion": {descripcion: "Tipo de generación: 1 físico, 2 electrónico", ejemplo: 2, catalogo: catalogoTipoGeneracion},
+	"DocumentosRelacionados.FechaEmision":         {descripcion: "Fecha de emisión del documento relacionado (AAAA-MM-DD)", ejemplo: "2024-01-31"},
+
+	"Detalle.TipoDte":                            {descripcion: "Tipo de DTE del documento a invalidar", ejemplo: "01", catalogo: catalogoTipoDte},
+	"Detalle.CodigoGeneracion":                   {descripcion: "Código de generación del documento a invalidar", ejemplo: "1B2C3D4E-0000-4000-8000-000000000000"},
+	"Detalle.CodigoGeneracionDocumentoReemplazo": {descripcion: "Código de generación del documento que lo reemplaza", ejemplo: ""},
+	"Detalle.TipoDteReemplazo":                   {descripcion: "Tipo de DTE del documento que lo reemplaza", ejemplo: "", catalogo: catalogoTipoDte},
+	"Detalle.NombreCliente":                      {descripcion: "Nombre del cliente", ejemplo: "Victor Perez"},
+	"Detalle.CorreoCliente":                      {descripcion: "Correo del cliente", ejemplo: "receptor@mail.com"},
+	"Detalle.TelefonoCliente":                    {descripcion: "Teléfono del cliente", ejemplo: "22222222"},
+}
+
+// TiposDteDefinidos devuelve los tipos de DTE que tienen una definición de hojas
+func TiposDteDefinidos() []string {
+	disposicion, _ := CargarHojas()
+	tipos := make([]string, 0, len(disposicion))
+	for tipo := range disposicion {
+		tipos = append(tipos, tipo)
+	}
+	sort.Strings(tipos)
+	return tipos
+}
+
+// Definicion construye las hojas y columnas que el conversor espera para un tipo de DTE y el mapeo de una empresa,
+// con las hojas de hojas.json y los tipos de tipos.json, los mismos mapas que usa el conversor.
+// Las columnas a las que el mapeo asigna un valor fijo se omiten, porque el conversor sobrescribe lo que
+// venga en el libro, y las columnas renombradas se muestran con el nombre que usa la empresa.
+func Definicion(tipoDte string, tipos TiposColumna, configuracion *Configuracion) ([]Hoja, error) {
+	disposicion, err := CargarHojas()
+	if err != nil {
+		return nil, err
+	}
+	hojasDte, ok := disposicion[tipoDte]
+	if !ok {
+		return nil, fmt.Errorf("no existe una definición de hojas para el tipo de DTE %s", tipoDte)
+	}
+	tipos = configuracion.TiposCombinados(tipos)
+
+	hojas := make([]Hoja, 0, len(hojasDte))
+	for _, definicion := range hojasDte {
+		nombreHoja := definicion.Hoja
+		fijos := configuracion.Valores.ValoresFijos(tipoDte, nombreHoja)
+
+		hoja := Hoja{Nombre: nombreHoja, Columnas: []Columna{nuevaColumna("", "IDDTE", true, tipos)}}
+		for _, nombre := range definicion.Columnas {
+			requerida := strings.HasSuffix(nombre, "*")
+			nombre = strings.TrimSuffix(nombre, "*")
+			if _, fijo := fijos[nombre]; fijo {
+				continue
+			}
+			columna := nuevaColumna(nombreHoja, nombre, requerida, tipos)
+			columna.Nombre = configuracion.ColumnaExcel(nombreHoja, nombre)
+			hoja.Columnas = append(hoja.Columnas, columna)
+		}
+		hojas = append(hojas, hoja)
+	}
+	return hojas, nil
+}
+
+func nuevaColumna(hoja string, nombre string, requerida bool, tipos TiposColumna) Columna {
+	clave := nombre
+	if hoja != "" {
+		clave = hoja + "." + nombre
+	}
+	info := columnas[clave]
+
+	tipo := tipos[hoja][nombre]
+	if tipo == "" {
+		tipo = tipoDeValor(info.ejemplo)
+	}
+
+	return Columna{
+		Campo:       nombre,
+		Nombre:      nombre,
+		Tipo:        tipo,
+		Requerida:   requerida,
+		Catalogo:    info.catalogo,
+		Descripcion: info.descripcion,
+		Ejemplo:     info.ejemplo,
+	}
+}
+
+// tipoDeValor deduce el tipo de una columna sin tipo declarado a partir de su ejemplo
+func tipoDeValor(valor interface{}) string {
+	switch valor.(type) {
+	case int:
+		return "int"
+	case float64:
+		return "float"
+	case bool:
+		return "bool"
+	}
+	return "str"
+}
@@ -0,0 +1,98 @@
+package mapeo
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// DirectorioMapas es la carpeta con los mapas JSON compartidos con excelProcessor.py
+var DirectorioMapas = filepath.Join("utils", "maps")
+
+// TiposColumna asocia cada columna de cada hoja con su tipo (str, int, float o bool)
+type TiposColumna map[string]map[string]string
+
+// DisposicionHoja son las columnas de una hoja para un tipo de DTE en orden; las que terminan en * son obligatorias
+type DisposicionHoja struct {
+	Hoja     string   `json:"hoja"`
+	Columnas []string `json:"columnas"`
+}
+
+// Disposicion contiene, por tipo de DTE, las hojas del libro en orden
+type Disposicion map[string][]DisposicionHoja
+
+// MapaCliente contiene, por tipo de DTE, los valores fijos que se agregan a cada hoja
+type MapaCliente map[string]map[string]interface{}
+
+// CargarTipos lee el mapa de tipos de datos de las columnas
+func CargarTipos() (TiposColumna, error) {
+	var tipos TiposColumna
+	if err := leerMapa("tipos.json", &tipos); err != nil {
+		return nil, err
+	}
+	if tipos == nil {
+		tipos = TiposColumna{}
+	}
+	return tipos, nil
+}
+
+// CargarHojas lee las hojas y columnas de cada tipo de DTE. Todas sus columnas deben tener un tipo en
+// tipos.json, que es el mapa con el que el conversor interpreta cada columna.
+func CargarHojas() (Disposicion, error) {
+	var disposicion Disposicion
+	if err := leerMapa("hojas.json", &disposicion); err != nil {
+		return nil, err
+	}
+	if disposicion == nil {
+		disposicion = Disposicion{}
+	}
+	return disposicion, nil
+}
+
+// hojasTipo devuelve las hojas de un tipo de DTE; si el mapa no se puede leer el tipo se considera sin definición
+func hojasTipo(tipoDte string) ([]DisposicionHoja, bool) {
+	disposicion, err := CargarHojas()
+	if err != nil {
+		log.Printf("Error al cargar las hojas de los tipos de DTE: %v\n", err)
+		return nil, false
+	}
+	hojas, ok := disposicion[tipoDte]
+	return hojas, ok
+}
+
+// CargarMapaCliente lee los valores fijos de la empresa; si no tiene un mapa propio devuelve uno vacío
+func CargarMapaCliente(empid string) (MapaCliente, error) {
+	var mapa MapaCliente
+	if err := leerMapa(empid+".json", &mapa); err != nil {
+		return nil, err
+	}
+	if mapa == nil {
+		mapa = MapaCliente{}
+	}
+	return mapa, nil
+}
+
+// ValoresFijos devuelve las columnas de una hoja a las que el mapa del cliente asigna un valor fijo
+func (m MapaCliente) ValoresFijos(tipoDte string, hoja string) map[string]interface{} {
+	valores, ok := m[tipoDte][hoja].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return valores
+}
+
+func leerMapa(nombre string, destino interface{}) error {
+	contenido, err := os.ReadFile(filepath.Join(DirectorioMapas, nombre))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error al leer el mapa %s: %v", nombre, err)
+	}
+	if err := json.Unmarshal(contenido, destino); err != nil {
+		return fmt.Errorf("error al analizar el mapa %s: %v", nombre, err)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package mapeo
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/tealeg/xlsx"
+)
+
+// ResultadoHoja resume la normalización de los encabezados de una hoja del libro
+type ResultadoHoja struct {
+	Hoja         string            `json:"hoja"`
+	HojaOriginal string            `json:"hojaOriginal,omitempty"`
+	Renombradas  map[string]string `json:"renombradas,omitempty"`
+	Desconocidas []string          `json:"desconocidas,omitempty"`
+	Faltantes    []string          `json:"faltantes,omitempty"`
+	NoReconocida bool              `json:"noReconocida,omitempty"`
+}
+
+var sinAcentos = strings.NewReplacer(
+	"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n",
+	"Á", "a", "É", "e", "Í", "i", "Ó", "o", "Ú", "u", "Ü", "u", "Ñ", "n",
+)
+
+// Plegar normaliza un encabezado quitando acentos, mayúsculas, espacios y separadores,
+// de modo que "Código Generación", "codigo_generacion" y "CodigoGeneracion" coincidan
+func Plegar(texto string) string {
+	texto = sinAcentos.Replace(texto)
+	var plegado strings.Builder
+	for _, r := range texto {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			plegado.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return plegado.String()
+}
+
+// hojaEsperada reúne los nombres de columna válidos de una hoja y sus obligatorias
+type hojaEsperada struct {
+	nombre     string
+	conocidas  map[string]string
+	alias      map[string]string
+	requeridas []string
+}
+
+// NormalizarLibro renombra las hojas y los encabezados del libro a los nombres del DTE, aplicando los
+// alias de la empresa, y reporta por hoja las columnas desconocidas y las obligatorias que faltan.
+// El libro solo se vuelve a guardar si se renombró algo.
+func NormalizarLibro(ruta string, tipoDte string, tipos TiposColumna, configuracion *Configuracion) ([]ResultadoHoja, error) {
+	libro, err := xlsx.OpenFile(ruta)
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir el archivo de Excel: %v", err)
+	}
+
+	esperadas := hojasEsperadas(tipoDte, configuracion.TiposCombinados(tipos), configuracion)
+
+	modificado := false
+	resultados := make([]ResultadoHoja, 0, len(libro.Sheets))
+	for i, hoja := range libro.Sheets {
+		resultado := ResultadoHoja{Hoja: hoja.Name}
+
+		// La primera hoja siempre es la raíz del documento
+		var esperada *hojaEsperada
+		if i == 0 {
+			esperada = esperadas[Plegar(HojaRaiz)]
+		} else {
+			esperada = esperadas[Plegar(hoja.Name)]
+		}
+
+		if esperada != nil && i > 0 && hoja.Name != esperada.nombre {
+			if _, existe := libro.Sheet[esperada.nombre]; !existe {
+				resultado.HojaOriginal = hoja.Name
+				resultado.Hoja = esperada.nombre
+				delete(libro.Sheet, hoja.Name)
+				hoja.Name = esperada.nombre
+				libro.Sheet[hoja.Name] = hoja
+				modificado = true
+			}
+		}
+
+		if esperada == nil || len(hoja.Rows) == 0 {
+			resultado.NoReconocida = esperada == nil
+			resultados = append(resultados, resultado)
+			continue
+		}
+
+		presentes := map[string]bool{}
+		for _, celda := range hoja.Rows[0].Cells {
+			encabezado := strings.TrimSpace(celda.Value)
+			if encabezado == "" {
+				continue
+			}
+
+			campo, ok := esperada.campo(encabezado)
+			if !ok {
+				resultado.Desconocidas = append(resultado.Desconocidas, encabezado)
+				continue
+			}
+			if campo != celda.Value {
+				if resultado.Renombradas == nil {
+					resultado.Renombradas = map[string]string{}
+				}
+				resultado.Renombradas[celda.Value] = campo
+				celda.SetString(campo)
+				modificado = true
+			}
+			presentes[campo] = true
+		}
+
+		for _, requerida := range esperada.requeridas {
+			if !presentes[requerida] {
+				resultado.Faltantes = append(resultado.Faltantes, requerida)
+			}
+		}
+		resultados = append(resultados, resultado)
+	}
+
+	if modificado {
+		if err := libro.Save(ruta); err != nil {
+			return nil, fmt.Errorf("error al guardar el archivo de Excel normalizado: %v", err)
+		}
+	}
+	return resultados, nil
+}
+
+// ResumenNormalizacion describe en texto las hojas con columnas desconocidas o faltantes
+func ResumenNormalizacion(resultados []ResultadoHoja) string {
+	var lineas []string
+	for _, resultado := range resultados {
+		if resultado.NoReconocida {
+			lineas = append(lineas, fmt.Sprintf("Hoja %s: no es una hoja reconocida para este tipo de DTE", resultado.Hoja))
+		}
+		if len(resultado.Desconocidas) > 0 {
+			lineas = append(lineas, fmt.Sprintf("Hoja %s: columnas desconocidas: %s", resultado.Hoja, strings.Join(resultado.Desconocidas, ", ")))
+		}
+		if len(resultado.Faltantes) > 0 {
+			lineas = append(lineas, fmt.Sprintf("Hoja %s: columnas obligatorias faltantes: %s", resultado.Hoja, strings.Join(resultado.Faltantes, ", ")))
+		}
+	}
+	return strings.Join(lineas, "\n")
+}
+
+// campo busca la columna del DTE que corresponde a un encabezado del libro
+func (h *hojaEsperada) campo(encabezado string) (string, bool) {
+	clave := Plegar(encabezado)
+	if campo, ok := h.alias[clave]; ok {
+		return campo, true
+	}
+	campo, ok := h.conocidas[clave]
+	return campo, ok
+}
+
+// hojasEsperadas arma, por nombre de hoja normalizado, las columnas que el conversor reconoce
+func hojasEsperadas(tipoDte string, tipos TiposColumna, configuracion *Configuracion) map[string]*hojaEsperada {
+	esperadas := map[string]*hojaEsperada{}
+	obtener := func(nombre string) *hojaEsperada {
+		clave := Plegar(nombre)
+		if esperadas[clave] == nil {
+			esperadas[clave] = &hojaEsperada{
+				nombre:    nombre,
+				conocidas: map[string]string{Plegar("IDDTE"): "IDDTE"},
+				alias:     map[string]string{},
+			}
+		}
+		return esperadas[clave]
+	}
+
+	for hoja, columnas := range tipos {
+		esperada := obtener(hoja)
+		for columna := range columnas {
+			esperada.conocidas[Plegar(columna)] = columna
+		}
+	}
+
+	for hoja, valores := range configuracion.Valores[tipoDte] {
+		esperada := obtener(hoja)
+		if fila, ok := valores.(map[string]interface{}); ok {
+			for columna := range fila {
+				esperada.conocidas[Plegar(columna)] = columna
+			}
+		}
+	}
+
+	if hojas, ok := hojasTipo(tipoDte); ok {
+		for _, definicion := range hojas {
+			esperada := obtener(definicion.Hoja)
+			esperada.requeridas = []string{"IDDTE"}
+			fijos := configuracion.Valores.ValoresFijos(tipoDte, definicion.Hoja)
+			for _, nombre := range definicion.Columnas {
+				columna := strings.TrimSuffix(nombre, "*")
+				esperada.conocidas[Plegar(columna)] = columna
+				if _, fijo := fijos[columna]; strings.HasSuffix(nombre, "*") && !fijo {
+					esperada.requeridas = append(esperada.requeridas, columna)
+				}
+			}
+		}
+	}
+
+	for hoja, alias := range configuracion.Columnas {
+		esperada := obtener(hoja)
+		for origen, destino := range alias {
+			esperada.alias[Plegar(origen)] = destino
+		}
+	}
+
+	return esperadas
+}
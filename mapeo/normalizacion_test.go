@@ -0,0 +1,65 @@
+package mapeo
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/tealeg/xlsx"
+)
+
+func TestPlegar(t *testing.T) {
+	for _, encabezado := range []string{"Código Generación", "codigo_generacion", " CodigoGeneracion ", "CÓDIGO-GENERACIÓN"} {
+		if plegado := Plegar(encabezado); plegado != "codigogeneracion" {
+			t.Errorf("Plegar(%q) = %q", encabezado, plegado)
+		}
+	}
+}
+
+func TestNormalizarLibro(t *testing.T) {
+	libro := xlsx.NewFile()
+	agregarHoja := func(nombre string, encabezados ...string) {
+		hoja, err := libro.AddSheet(nombre)
+		if err != nil {
+			t.Fatalf("Error al agregar la hoja %s: %v", nombre, err)
+		}
+		fila := hoja.AddRow()
+		for _, encabezado := range encabezados {
+			fila.AddCell().SetString(encabezado)
+		}
+	}
+	agregarHoja("DTE", "IDDTE", "Código Condición Operación")
+	agregarHoja("receptor", "iddte", "Documento", "nombres", "Columna Extra")
+
+	ruta := filepath.Join(t.TempDir(), "lote.xlsx")
+	if err := libro.Save(ruta); err != nil {
+		t.Fatalf("Error al guardar el libro: %v", err)
+	}
+
+	configuracion := &Configuracion{Columnas: map[string]map[string]string{"Receptor": {"Documento": "NumeroDocumentoIdentificacion"}}}
+	resultados, err := NormalizarLibro(ruta, "01", TiposColumna{}, configuracion)
+	if err != nil {
+		t.Fatalf("Error al normalizar el libro: %v", err)
+	}
+
+	receptor := resultados[1]
+	if receptor.Hoja != "Receptor" || receptor.HojaOriginal != "receptor" {
+		t.Errorf("La hoja debería renombrarse a Receptor: %+v", receptor)
+	}
+	if receptor.Renombradas["Documento"] != "NumeroDocumentoIdentificacion" || receptor.Renombradas["nombres"] != "Nombres" {
+		t.Errorf("Renombres inesperados: %v", receptor.Renombradas)
+	}
+	if len(receptor.Desconocidas) != 1 || receptor.Desconocidas[0] != "Columna Extra" {
+		t.Errorf("Columnas desconocidas inesperadas: %v", receptor.Desconocidas)
+	}
+
+	normalizado, err := xlsx.OpenFile(ruta)
+	if err != nil {
+		t.Fatalf("Error al abrir el libro normalizado: %v", err)
+	}
+	if normalizado.Sheets[0].Rows[0].Cells[1].Value != "CodigoCondicionOperacion" {
+		t.Errorf("El encabezado de la raíz no se normalizó: %q", normalizado.Sheets[0].Rows[0].Cells[1].Value)
+	}
+	if _, ok := normalizado.Sheet["Receptor"]; !ok {
+		t.Error("El libro guardado debería tener la hoja Receptor")
+	}
+}
@@ -0,0 +1,104 @@
+package mapeo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+// filasConValidacion es el número de filas de datos a las que se aplican las listas desplegables
+const filasConValidacion = 1000
+
+var nombresTipo = map[string]string{
+	"str":   "texto",
+	"int":   "número entero",
+	"float": "número decimal",
+	"bool":  "VERDADERO/FALSO",
+}
+
+// GenerarPlantilla crea un libro de Excel con las hojas y columnas que espera el conversor,
+// una fila de ejemplo, comentarios con el tipo de cada columna y listas desplegables de catálogos
+func GenerarPlantilla(hojas []Hoja) ([]byte, error) {
+	libro := excelize.NewFile()
+
+	estiloEncabezado, err := libro.NewStyle(`{"font":{"bold":true},"fill":{"type":"pattern","color":["#D9E1F2"],"pattern":1}}`)
+	if err != nil {
+		return nil, fmt.Errorf("error al crear el estilo del encabezado: %v", err)
+	}
+	estiloRequerido, err := libro.NewStyle(`{"font":{"bold":true,"color":"#9C0006"},"fill":{"type":"pattern","color":["#FFC7CE"],"pattern":1}}`)
+	if err != nil {
+		return nil, fmt.Errorf("error al crear el estilo de columnas obligatorias: %v", err)
+	}
+
+	for i, hoja := range hojas {
+		if i == 0 {
+			libro.SetSheetName("Sheet1", hoja.Nombre)
+		} else {
+			libro.NewSheet(hoja.Nombre)
+		}
+
+		for j, columna := range hoja.Columnas {
+			letra := excelize.ToAlphaString(j)
+			encabezado := fmt.Sprintf("%s1", letra)
+
+			libro.SetCellStr(hoja.Nombre, encabezado, columna.Nombre)
+			if columna.Requerida {
+				libro.SetCellStyle(hoja.Nombre, encabezado, encabezado, estiloRequerido)
+			} else {
+				libro.SetCellStyle(hoja.Nombre, encabezado, encabezado, estiloEncabezado)
+			}
+			libro.SetColWidth(hoja.Nombre, letra, letra, float64(len(columna.Nombre)+4))
+
+			if err := libro.AddComment(hoja.Nombre, encabezado, comentarioColumna(columna)); err != nil {
+				return nil, fmt.Errorf("error al agregar el comentario de la columna %s.%s: %v", hoja.Nombre, columna.Nombre, err)
+			}
+
+			if columna.Ejemplo != nil && columna.Ejemplo != "" {
+				libro.SetCellValue(hoja.Nombre, fmt.Sprintf("%s2", letra), columna.Ejemplo)
+			}
+
+			if len(columna.Catalogo) > 0 {
+				validacion := excelize.NewDataValidation(true)
+				validacion.SetSqref(fmt.Sprintf("%s2:%s%d", letra, letra, filasConValidacion+1))
+				if err := validacion.SetDropList(columna.Catalogo); err != nil {
+					return nil, fmt.Errorf("error al crear la lista de la columna %s.%s: %v", hoja.Nombre, columna.Nombre, err)
+				}
+				validacion.SetError(excelize.DataValidationErrorStyleStop, columna.Nombre, "El valor no existe en el catálogo")
+				libro.AddDataValidation(hoja.Nombre, validacion)
+			}
+		}
+		libro.SetPanes(hoja.Nombre, `{"freeze":true,"split":false,"x_split":0,"y_split":1,"top_left_cell":"A2","active_pane":"bottomLeft"}`)
+	}
+	libro.SetActiveSheet(1)
+
+	var buffer bytes.Buffer
+	if err := libro.Write(&buffer); err != nil {
+		return nil, fmt.Errorf("error al guardar la plantilla: %v", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// comentarioColumna arma el comentario de excelize con el tipo, la obligatoriedad y la descripción
+func comentarioColumna(columna Columna) string {
+	lineas := []string{fmt.Sprintf("Tipo: %s", nombresTipo[columna.Tipo])}
+	if columna.Requerida {
+		lineas = append(lineas, "Obligatoria")
+	} else {
+		lineas = append(lineas, "Opcional")
+	}
+	if columna.Descripcion != "" {
+		lineas = append(lineas, columna.Descripcion)
+	}
+	if len(columna.Catalogo) > 0 {
+		lineas = append(lineas, "Valores: "+strings.Join(columna.Catalogo, ", "))
+	}
+
+	formato, _ := json.Marshal(map[string]string{
+		"author": "GoProcesadorExcel: ",
+		"text":   strings.Join(lineas, "\n"),
+	})
+	return string(formato)
+}
@@ -0,0 +1,505 @@
+package registro
+
+import (
+	"GoProcesadorExcel/documentos"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Estados de un lote en el índice. Salvo completado, coinciden con las fases de los eventos del lote.
+const (
+	EstadoRecibido          = "recibido"
+	EstadoConversionFallida = "conversion_fallida"
+	EstadoCompletado        = "completado"
+)
+
+// vigencia es el tiempo que se conservan los lotes en Redis; los lotes más antiguos se quitan del índice
+const vigencia = 3 * 30 * 24 * time.Hour
+
+// El índice de lotes de una empresa son conjuntos ordenados por el número del correlativo, salvo el de las
+// fechas de creación. Los miembros son los correlativos tal como aparecen en las claves ("007").
+func claveLotes(empid string) string { return empid + "_lotes" }
+
+func claveFechas(empid string) string { return empid + "_lotes:fecha" }
+
+func claveTipo(empid string, tipo string) string { return empid + "_lotes:tipo:" + tipo }
+
+// claveTipos es el conjunto de los tipos de DTE con índice, para poder quitar un lote de todos ellos
+func claveTipos(empid string) string { return empid + "_lotes:tipos" }
+
+func claveEstado(empid string, estado string) string { return empid + "_lotes:estado:" + estado }
+
+// claveEstadoActual guarda el estado de cada lote para moverlo entre los índices de estado
+func claveEstadoActual(empid string) string { return empid + "_lotes:estado" }
+
+// claveArchivos son las claves con el estado de la conversión o la recepción de los lotes, sin el prefijo de
+// la empresa ("Lote_007.xlsx:01")
+func claveArchivos(empid string) string { return empid + "_lotes:archivos" }
+
+// patronClave reconoce los hashes de los lotes ({empid}_Lote_{correlativo}) y las claves de estado de sus
+// archivos ({empid}_Lote_{correlativo}.xlsx:{tipo} o .json:{tipo})
+var patronClave = regexp.MustCompile(`^(.+)_Lote_(\d+)(?:\.(xlsx|json)(?::(\w+))?)?$`)
+
+// ajenas son las claves de otros datos del lote que comparten el patrón {empid}_X_Lote_{correlativo}
+var ajenas = []string{"_TiposDte", "_Invalidaciones", "_Correos"}
+
+// Clave es una clave de Redis de un lote
+type Clave struct {
+	Empid       string
+	Correlativo string
+	Extension   string // Vacía en el hash de estados del lote
+	TipoDte     string
+}
+
+// ParsearClave interpreta una clave de un lote; devuelve false si la clave no es un lote ni el estado de
+// uno de sus archivos
+func ParsearClave(clave string) (Clave, bool) {
+	coincidencia := patronClave.FindStringSubmatch(clave)
+	if coincidencia == nil {
+		return Clave{}, false
+	}
+	for _, sufijo := range ajenas {
+		if strings.HasSuffix(coincidencia[1], sufijo) {
+			return Clave{}, false
+		}
+	}
+	return Clave{Empid: coincidencia[1], Correlativo: coincidencia[2], Extension: coincidencia[3], TipoDte: coincidencia[4]}, true
+}
+
+func numero(correlativo string) float64 {
+	valor, _ := strconv.Atoi(correlativo)
+	return float64(valor)
+}
+
+// RegistrarLote agrega el lote al índice con su fecha de creación; si ya estaba registrado conserva la fecha.
+// Los lotes vencidos se quitan del índice al registrar uno nuevo.
+func RegistrarLote(rdb *redis.Client, empid string, correlativo string, fecha time.Time) {
+	ctx := context.Background()
+	pipe := rdb.TxPipeline()
+	pipe.ZAdd(ctx, claveLotes(empid), &redis.Z{Score: numero(correlativo), Member: correlativo})
+	nuevo := pipe.ZAddNX(ctx, claveFechas(empid), &redis.Z{Score: float64(fecha.UnixMilli()), Member: correlativo})
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error al registrar el Lote_%s en el índice de %s: %v\n", correlativo, empid, err)
+		return
+	}
+	if nuevo.Val() > 0 {
+		depurar(ctx, rdb, empid, fecha.Add(-vigencia))
+	}
+}
+
+// RegistrarTipo agrega el lote al índice del tipo de DTE
+func RegistrarTipo(rdb *redis.Client, empid string, correlativo string, tipo string) {
+	if tipo == "" {
+		return
+	}
+	ctx := context.Background()
+	pipe := rdb.TxPipeline()
+	pipe.ZAdd(ctx, claveTipo(empid, tipo), &redis.Z{Score: numero(correlativo), Member: correlativo})
+	pipe.SAdd(ctx, claveTipos(empid), tipo)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error al registrar el tipo de DTE %s del Lote_%s: %v\n", tipo, correlativo, err)
+	}
+}
+
+// RegistrarEstado mueve el lote al índice de su estado actual
+func RegistrarEstado(rdb *redis.Client, empid string, correlativo string, estado string) {
+	ctx := context.Background()
+	anterior, err := rdb.HGet(ctx, claveEstadoActual(empid), correlativo).Result()
+	if err != nil && err != redis.Nil {
+		log.Printf("Error al obtener el estado del Lote_%s en el índice: %v\n", correlativo, err)
+		return
+	}
+	if anterior == estado {
+		return
+	}
+
+	pipe := rdb.TxPipeline()
+	if anterior != "" {
+		pipe.ZRem(ctx, claveEstado(empid, anterior), correlativo)
+	}
+	pipe.ZAdd(ctx, claveEstado(empid, estado), &redis.Z{Score: numero(correlativo), Member: correlativo})
+	pipe.HSet(ctx, claveEstadoActual(empid), correlativo, estado)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error al registrar el estado %s del Lote_%s: %v\n", estado, correlativo, err)
+	}
+}
+
+// RegistrarArchivo agrega al índice la clave con el estado de la conversión o la recepción de un lote, y el
+// tipo de DTE que indica su sufijo
+func RegistrarArchivo(rdb *redis.Client, clave string) {
+	lote, ok := ParsearClave(clave)
+	if !ok || lote.Extension == "" {
+		log.Printf("La clave %s no es el estado del archivo de un lote\n", clave)
+		return
+	}
+	nombre := strings.TrimPrefix(clave, lote.Empid+"_")
+	if err := rdb.ZAdd(context.Background(), claveArchivos(lote.Empid), &redis.Z{Score: numero(lote.Correlativo), Member: nombre}).Err(); err != nil {
+		log.Printf("Error al registrar el archivo %s en el índice: %v\n", clave, err)
+		return
+	}
+	RegistrarTipo(rdb, lote.Empid, lote.Correlativo, lote.TipoDte)
+}
+
+// depurar quita del índice los lotes creados antes de la fecha indicada
+func depurar(ctx context.Context, rdb *redis.Client, empid string, antesDe time.Time) {
+	vencidos, err := rdb.ZRangeByScore(ctx, claveFechas(empid), &redis.ZRangeBy{Min: "-inf", Max: "(" + strconv.FormatInt(antesDe.UnixMilli(), 10)}).Result()
+	if err != nil || len(vencidos) == 0 {
+		return
+	}
+	tipos, _ := rdb.SMembers(ctx, claveTipos(empid)).Result()
+	estados, _ := rdb.HMGet(ctx, claveEstadoActual(empid), vencidos...).Result()
+
+	pipe := rdb.TxPipeline()
+	for i, correlativo := range vencidos {
+		miembros := []interface{}{correlativo}
+		pipe.ZRem(ctx, claveLotes(empid), miembros...)
+		pipe.ZRem(ctx, claveFechas(empid), miembros...)
+		for _, tipo := range tipos {
+			pipe.ZRem(ctx, claveTipo(empid, tipo), miembros...)
+		}
+		if estado, ok := estados[i].(string); ok {
+			pipe.ZRem(ctx, claveEstado(empid, estado), miembros...)
+		}
+		pipe.HDel(ctx, claveEstadoActual(empid), correlativo)
+		limite := strconv.FormatFloat(numero(correlativo), 'f', -1, 64)
+		pipe.ZRemRangeByScore(ctx, claveArchivos(empid), limite, limite)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error al quitar los lotes vencidos del índice de %s: %v\n", empid, err)
+	}
+}
+
+// Consulta filtra los lotes del índice. Los límites en cero y las listas vacías no filtran; los tipos de DTE
+// y los estados se combinan con "o" dentro de cada lista.
+type Consulta struct {
+	Desde      int
+	Hasta      int
+	FechaDesde time.Time
+	FechaHasta time.Time
+	TiposDte   []string
+	Estados    []string
+}
+
+func rango(desde int, hasta int) *redis.ZRangeBy {
+	limites := &redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+	if desde > 0 {
+		limites.Min = strconv.Itoa(desde)
+	}
+	if hasta > 0 {
+		limites.Max = strconv.Itoa(hasta)
+	}
+	return limites
+}
+
+// Lotes devuelve los correlativos de los lotes que cumplen la consulta, en orden ascendente
+func Lotes(rdb *redis.Client, empid string, consulta Consulta) ([]string, error) {
+	ctx := context.Background()
+	limites := rango(consulta.Desde, consulta.Hasta)
+	correlativos, err := rdb.ZRangeByScore(ctx, claveLotes(empid), limites).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener los lotes: %v", err)
+	}
+
+	var filtros [][]string
+	if !consulta.FechaDesde.IsZero() || !consulta.FechaHasta.IsZero() {
+		fechas := &redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+		if !consulta.FechaDesde.IsZero() {
+			fechas.Min = strconv.FormatInt(consulta.FechaDesde.UnixMilli(), 10)
+		}
+		if !consulta.FechaHasta.IsZero() {
+			fechas.Max = strconv.FormatInt(consulta.FechaHasta.UnixMilli(), 10)
+		}
+		enRango, err := rdb.ZRangeByScore(ctx, claveFechas(empid), fechas).Result()
+		if err != nil {
+			return nil, fmt.Errorf("error al obtener los lotes por fecha: %v", err)
+		}
+		filtros = append(filtros, enRango)
+	}
+	for _, indice := range []struct {
+		claves []string
+		clave  func(string, string) string
+	}{
+		{consulta.TiposDte, claveTipo},
+		{consulta.Estados, claveEstado},
+	} {
+		if len(indice.claves) == 0 {
+			continue
+		}
+		var union []string
+		for _, valor := range indice.claves {
+			miembros, err := rdb.ZRangeByScore(ctx, indice.clave(empid, valor), limites).Result()
+			if err != nil {
+				return nil, fmt.Errorf("error al obtener los lotes de %s: %v", valor, err)
+			}
+			union = append(union, miembros...)
+		}
+		filtros = append(filtros, union)
+	}
+
+	for _, filtro := range filtros {
+		correlativos = interseccion(correlativos, filtro)
+	}
+	return correlativos, nil
+}
+
+// PaginaLotes recorre el índice de lotes en orden de correlativo a partir del lote desde, incluido; con 0
+// empieza por el primero o, en orden descendente, por el último. Lee hasta cantidad lotes del rango con
+// ZRANGEBYSCORE y LIMIT, devuelve los que cumplen el resto de la consulta y el lote desde el que sigue la
+// siguiente lectura, o 0 si ya no quedan lotes.
+func PaginaLotes(rdb *redis.Client, empid string, consulta Consulta, desde int, descendente bool, cantidad int) ([]string, int, error) {
+	ctx := context.Background()
+	limites := rango(consulta.Desde, consulta.Hasta)
+	limites.Count = int64(cantidad)
+	var correlativos []string
+	var err error
+	if descendente {
+		if desde > 0 && (consulta.Hasta == 0 || desde < consulta.Hasta) {
+			limites.Max = strconv.Itoa(desde)
+		}
+		correlativos, err = rdb.ZRevRangeByScore(ctx, claveLotes(empid), limites).Result()
+	} else {
+		if desde > consulta.Desde {
+			limites.Min = strconv.Itoa(desde)
+		}
+		correlativos, err = rdb.ZRangeByScore(ctx, claveLotes(empid), limites).Result()
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("error al obtener los lotes: %v", err)
+	}
+
+	// Los correlativos empiezan en 1, así que el lote 0 marca el fin en los dos sentidos
+	siguiente := 0
+	if len(correlativos) == cantidad {
+		siguiente = int(numero(correlativos[len(correlativos)-1])) + 1
+		if descendente {
+			siguiente -= 2
+		}
+	}
+	correlativos, err = filtrar(ctx, rdb, empid, consulta, correlativos)
+	return correlativos, siguiente, err
+}
+
+// filtrar conserva los lotes que cumplen las fechas, los tipos de DTE y los estados de la consulta, consultando
+// solo los miembros indicados en cada índice
+func filtrar(ctx context.Context, rdb *redis.Client, empid string, consulta Consulta, correlativos []string) ([]string, error) {
+	if len(correlativos) == 0 {
+		return correlativos, nil
+	}
+
+	var claves [][]string
+	if !consulta.FechaDesde.IsZero() || !consulta.FechaHasta.IsZero() {
+		claves = append(claves, []string{claveFechas(empid)})
+	}
+	for _, indice := range []struct {
+		valores []string
+		clave   func(string, string) string
+	}{
+		{consulta.TiposDte, claveTipo},
+		{consulta.Estados, claveEstado},
+	} {
+		if len(indice.valores) == 0 {
+			continue
+		}
+		var union []string
+		for _, valor := range indice.valores {
+			union = append(union, indice.clave(empid, valor))
+		}
+		claves = append(claves, union)
+	}
+	if len(claves) == 0 {
+		return correlativos, nil
+	}
+
+	pipe := rdb.Pipeline()
+	resultados := make([][][]*redis.FloatCmd, len(claves))
+	for i, union := range claves {
+		resultados[i] = make([][]*redis.FloatCmd, len(union))
+		for j, clave := range union {
+			resultados[i][j] = make([]*redis.FloatCmd, len(correlativos))
+			for k, correlativo := range correlativos {
+				resultados[i][j][k] = pipe.ZScore(ctx, clave, correlativo)
+			}
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("error al filtrar los lotes: %v", err)
+	}
+
+	filtrados := make([]string, 0, len(correlativos))
+	for k, correlativo := range correlativos {
+		cumple := true
+		for i := range claves {
+			enAlguno := false
+			for j := range claves[i] {
+				valor, err := resultados[i][j][k].Result()
+				if err != nil {
+					continue
+				}
+				// El índice de fechas guarda la fecha de creación como puntaje
+				if claves[i][j] == claveFechas(empid) {
+					fecha := time.UnixMilli(int64(valor))
+					if (!consulta.FechaDesde.IsZero() && fecha.Before(consulta.FechaDesde)) || (!consulta.FechaHasta.IsZero() && fecha.After(consulta.FechaHasta)) {
+						continue
+					}
+				}
+				enAlguno = true
+			}
+			if !enAlguno {
+				cumple = false
+				break
+			}
+		}
+		if cumple {
+			filtrados = append(filtrados, correlativo)
+		}
+	}
+	return filtrados, nil
+}
+
+// interseccion conserva los elementos de a que están en b, en el orden de a
+func interseccion(a []string, b []string) []string {
+	presentes := make(map[string]bool, len(b))
+	for _, elemento := range b {
+		presentes[elemento] = true
+	}
+	resultado := make([]string, 0, len(a))
+	for _, elemento := range a {
+		if presentes[elemento] {
+			resultado = append(resultado, elemento)
+		}
+	}
+	return resultado
+}
+
+// Fechas devuelve la fecha de creación de los lotes indicados; los que no la tienen no aparecen
+func Fechas(rdb *redis.Client, empid string, correlativos []string) (map[string]time.Time, error) {
+	fechas := make(map[string]time.Time, len(correlativos))
+	if len(correlativos) == 0 {
+		return fechas, nil
+	}
+	ctx := context.Background()
+	pipe := rdb.Pipeline()
+	resultados := make([]*redis.FloatCmd, len(correlativos))
+	for i, correlativo := range correlativos {
+		resultados[i] = pipe.ZScore(ctx, claveFechas(empid), correlativo)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("error al obtener las fechas de los lotes: %v", err)
+	}
+	for i, resultado := range resultados {
+		if valor, err := resultado.Result(); err == nil {
+			fechas[correlativos[i]] = time.UnixMilli(int64(valor))
+		}
+	}
+	return fechas, nil
+}
+
+// Archivos devuelve las claves de estado de los archivos de los lotes indicados, sin el prefijo de la
+// empresa; con nil devuelve las de todos los lotes
+func Archivos(rdb *redis.Client, empid string, correlativos []string) ([]string, error) {
+	archivos, err := rdb.ZRange(context.Background(), claveArchivos(empid), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener los archivos de los lotes: %v", err)
+	}
+	if correlativos == nil {
+		return archivos, nil
+	}
+	incluidos := make(map[string]bool, len(correlativos))
+	for _, correlativo := range correlativos {
+		incluidos[correlativo] = true
+	}
+	var resultado []string
+	for _, archivo := range archivos {
+		if lote, ok := ParsearClave(empid + "_" + archivo); ok && incluidos[lote.Correlativo] {
+			resultado = append(resultado, archivo)
+		}
+	}
+	return resultado, nil
+}
+
+// QuitarArchivos quita del índice las claves de estado que ya vencieron
+func QuitarArchivos(rdb *redis.Client, empid string, archivos []string) {
+	if len(archivos) == 0 {
+		return
+	}
+	miembros := make([]interface{}, len(archivos))
+	for i, archivo := range archivos {
+		miembros[i] = archivo
+	}
+	rdb.ZRem(context.Background(), claveArchivos(empid), miembros...)
+}
+
+// Reconstruir arma el índice de todas las empresas a partir de las claves {empid}_Lote_* existentes,
+// recorriéndolas con SCAN. La fecha de creación de los lotes anteriores al índice es la del JSON con sus
+// documentos o, si no existe, la de la reconstrucción. Devuelve el número de lotes registrados.
+func Reconstruir(rdb *redis.Client) (int, error) {
+	ctx := context.Background()
+	lotes := make(map[[2]string]bool)
+	errores := make(map[[2]string]bool)
+	conEstados := make(map[[2]string]bool)
+
+	iterador := rdb.Scan(ctx, 0, "*_Lote_*", 1000).Iterator()
+	for iterador.Next(ctx) {
+		clave, ok := ParsearClave(iterador.Val())
+		if !ok {
+			continue
+		}
+		lote := [2]string{clave.Empid, clave.Correlativo}
+		lotes[lote] = true
+		switch {
+		case clave.Extension == "":
+			conEstados[lote] = true
+		case clave.Extension == "xlsx" && clave.TipoDte == "":
+			// La conversión falló; la clave no tiene tipo de DTE
+			errores[lote] = true
+			RegistrarArchivo(rdb, iterador.Val())
+		default:
+			RegistrarArchivo(rdb, iterador.Val())
+		}
+	}
+	if err := iterador.Err(); err != nil {
+		return 0, fmt.Errorf("error al recorrer las claves de los lotes: %v", err)
+	}
+
+	for lote := range lotes {
+		empid, correlativo := lote[0], lote[1]
+		fecha := time.Now()
+		if info, err := os.Stat(documentos.Ruta(empid, correlativo)); err == nil {
+			fecha = info.ModTime()
+		}
+		RegistrarLote(rdb, empid, correlativo, fecha)
+
+		tipos, err := rdb.HVals(ctx, fmt.Sprintf("%s_TiposDte_Lote_%s", empid, correlativo)).Result()
+		if err != nil {
+			log.Printf("Error al obtener los tipos de DTE del Lote_%s de %s: %v\n", correlativo, empid, err)
+		}
+		vistos := make(map[string]bool)
+		for _, tipo := range tipos {
+			if !vistos[tipo] {
+				vistos[tipo] = true
+				RegistrarTipo(rdb, empid, correlativo, tipo)
+			}
+		}
+
+		// Los lotes con resultados ya se enviaron; el estado no se reemplaza si el lote ya estaba en el índice
+		estado := EstadoRecibido
+		switch {
+		case conEstados[lote]:
+			estado = EstadoCompletado
+		case errores[lote]:
+			estado = EstadoConversionFallida
+		}
+		if existe, _ := rdb.HExists(ctx, claveEstadoActual(empid), correlativo).Result(); !existe {
+			RegistrarEstado(rdb, empid, correlativo, estado)
+		}
+	}
+	return len(lotes), nil
+}
@@ -0,0 +1,36 @@
+package registro
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsearClave(t *testing.T) {
+	casos := []struct {
+		clave    string
+		esperado Clave
+		ok       bool
+	}{
+		{"empresa_1_Lote_007", Clave{Empid: "empresa_1", Correlativo: "007"}, true},
+		{"1022_Lote_012.xlsx", Clave{Empid: "1022", Correlativo: "012", Extension: "xlsx"}, true},
+		{"1022_Lote_012.xlsx:03", Clave{Empid: "1022", Correlativo: "012", Extension: "xlsx", TipoDte: "03"}, true},
+		{"1022_Lote_013.json:cancel", Clave{Empid: "1022", Correlativo: "013", Extension: "json", TipoDte: "cancel"}, true},
+		{"1022_TiposDte_Lote_012", Clave{}, false},
+		{"1022_Invalidaciones_Lote_012", Clave{}, false},
+		{"1022_Correos_Lote_012", Clave{}, false},
+		{"1022_Lote_012.csv", Clave{}, false},
+		{"1022_lotes:tipo:01", Clave{}, false},
+	}
+	for _, caso := range casos {
+		clave, ok := ParsearClave(caso.clave)
+		if ok != caso.ok || clave != caso.esperado {
+			t.Errorf("ParsearClave(%q) = %+v, %v", caso.clave, clave, ok)
+		}
+	}
+}
+
+func TestInterseccion(t *testing.T) {
+	if resultado := interseccion([]string{"001", "002", "010"}, []string{"010", "001", "005"}); !reflect.DeepEqual(resultado, []string{"001", "010"}) {
+		t.Errorf("interseccion = %v", resultado)
+	}
+}
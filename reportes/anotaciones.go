@@ -0,0 +1,207 @@
+package reportes
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Anotacion es un error ubicado en las hojas originales del lote: la hoja, la fila del IDDTE dentro de esa
+// hoja y la columna. Un índice -1 marca todas las filas del IDDTE y un campo vacío marca la fila completa.
+type Anotacion struct {
+	Hoja    string `json:"Hoja"`
+	Indice  int    `json:"Indice"`
+	Campo   string `json:"Campo,omitempty"`
+	Mensaje string `json:"Mensaje"`
+}
+
+// patronRutaCampo reconoce rutas de campos en los mensajes de rechazo, como Detalles[3].PrecioUnitario o Receptor.Nrc
+var patronRutaCampo = regexp.MustCompile(`\b([A-Za-z]+)(?:\[(\d+)\])?\.([A-Za-z][A-Za-z0-9]*)`)
+
+// aliasHojas relaciona los nombres de Hacienda con las hojas del libro
+var aliasHojas = map[string]string{
+	"cuerpodocumento":      "Detalles",
+	"documentorelacionado": "DocumentosRelacionados",
+	"identificacion":       "Identificacion",
+	"receptor":             "Receptor",
+	"resumen":              "Resumen",
+	"extension":            "Extension",
+}
+
+// anotar ubica los errores de la fila: los errores de validación por campo, las rutas de campos del mensaje
+// de rechazo y, si no hay rutas, las hojas de la columna HojaError
+func (f Fila) anotar(texto string) []Anotacion {
+	if f.Acierto {
+		return nil
+	}
+
+	// Los errores de validación ya traen su ubicación; su mensaje repite las mismas rutas
+	if len(f.Errores) > 0 {
+		anotaciones := make([]Anotacion, 0, len(f.Errores))
+		for _, e := range f.Errores {
+			anotaciones = append(anotaciones, Anotacion{Hoja: e.Hoja, Indice: e.Fila - 1, Campo: e.Campo, Mensaje: e.Mensaje})
+		}
+		return anotaciones
+	}
+
+	var anotaciones []Anotacion
+
+	// Cada segmento del mensaje se asocia a las rutas que contiene
+	hojas := make(map[string]bool)
+	for _, segmento := range segmentosMensaje(append([]string{texto}, f.Observaciones...)) {
+		for _, ruta := range patronRutaCampo.FindAllStringSubmatch(segmento, -1) {
+			hoja := ruta[1]
+			if alias, ok := aliasHojas[strings.ToLower(hoja)]; ok {
+				hoja = alias
+			}
+			indice := -1
+			if ruta[2] != "" {
+				indice, _ = strconv.Atoi(ruta[2])
+			}
+			anotaciones = append(anotaciones, Anotacion{Hoja: hoja, Indice: indice, Campo: ruta[3], Mensaje: segmento})
+			hojas[strings.ToLower(hoja)] = true
+		}
+	}
+
+	for _, hoja := range strings.Split(f.HojaError, ", ") {
+		if hoja != "" && hoja != "N/A" && !hojas[strings.ToLower(hoja)] {
+			anotaciones = append(anotaciones, Anotacion{Hoja: hoja, Indice: -1, Mensaje: texto})
+		}
+	}
+	return anotaciones
+}
+
+// segmentosMensaje separa los mensajes en frases para que cada celda reciba solo el error que le corresponde
+func segmentosMensaje(mensajes []string) []string {
+	var segmentos []string
+	for _, mensaje := range mensajes {
+		for _, segmento := range strings.FieldsFunc(mensaje, func(r rune) bool { return r == ';' || r == '\n' }) {
+			if segmento = strings.TrimSpace(segmento); segmento != "" {
+				segmentos = append(segmentos, segmento)
+			}
+		}
+	}
+	return segmentos
+}
+
+// comentario es el mensaje de error de una celda de las hojas originales, con fila y columna desde 0
+type comentario struct {
+	Fila    int
+	Columna int
+	Texto   string
+}
+
+// anotacionesPorHoja agrupa las anotaciones de las filas por hoja e IDDTE. Se arma mientras se escribe la hoja
+// 'Informe' y solo conserva las anotaciones de los IDDTE con errores.
+type anotacionesPorHoja map[string]map[string][]Anotacion
+
+func (a anotacionesPorHoja) agregar(fila Fila) {
+	for _, anotacion := range fila.Anotaciones {
+		hoja := strings.ToLower(anotacion.Hoja)
+		if a[hoja] == nil {
+			a[hoja] = make(map[string][]Anotacion)
+		}
+		iddte := normalizarIddte(fila.IDDTE)
+		a[hoja][iddte] = append(a[hoja][iddte], anotacion)
+	}
+}
+
+// marcador ubica las anotaciones en las filas de una hoja original a medida que se leen. La hoja se relaciona
+// con las anotaciones por su nombre, las filas por la columna IDDTE y el orden de aparición del IDDTE, y las
+// celdas por el encabezado de la columna.
+type marcador struct {
+	porIddte     map[string][]Anotacion
+	columnaIddte int
+	columnas     map[string]int
+	ocurrencias  map[string]int
+	textos       map[[2]int][]string
+}
+
+func (a anotacionesPorHoja) marcador(hoja string) *marcador {
+	return &marcador{
+		porIddte:     a[strings.ToLower(hoja)],
+		columnaIddte: -1,
+		columnas:     make(map[string]int),
+		ocurrencias:  make(map[string]int),
+		textos:       make(map[[2]int][]string),
+	}
+}
+
+// marcar devuelve si la fila r se resalta y las columnas de sus celdas rechazadas. La fila 0 son los encabezados.
+func (m *marcador) marcar(r int, valores []string) (bool, map[int]bool) {
+	if len(m.porIddte) == 0 {
+		return false, nil
+	}
+	if r == 0 {
+		for j, valor := range valores {
+			encabezado := strings.ToLower(strings.TrimSpace(valor))
+			if encabezado == "iddte" {
+				m.columnaIddte = j
+			}
+			if _, ok := m.columnas[encabezado]; !ok {
+				m.columnas[encabezado] = j
+			}
+		}
+		return false, nil
+	}
+	if m.columnaIddte == -1 || m.columnaIddte >= len(valores) {
+		return false, nil
+	}
+
+	// Solo se cuentan las apariciones de los IDDTE con anotaciones
+	iddte := normalizarIddte(valores[m.columnaIddte])
+	anotaciones := m.porIddte[iddte]
+	if len(anotaciones) == 0 {
+		return false, nil
+	}
+	ocurrencia := m.ocurrencias[iddte]
+	m.ocurrencias[iddte]++
+
+	resaltada := false
+	var celdas map[int]bool
+	for _, anotacion := range anotaciones {
+		if anotacion.Indice != -1 && anotacion.Indice != ocurrencia {
+			continue
+		}
+		resaltada = true
+
+		// Sin columna conocida, el comentario va en la celda del IDDTE
+		celda := [2]int{r, m.columnaIddte}
+		if columna, ok := m.columnas[strings.ToLower(anotacion.Campo)]; ok && anotacion.Campo != "" {
+			celda[1] = columna
+			if celdas == nil {
+				celdas = make(map[int]bool)
+			}
+			celdas[columna] = true
+		}
+		if !contiene(m.textos[celda], anotacion.Mensaje) {
+			m.textos[celda] = append(m.textos[celda], anotacion.Mensaje)
+		}
+	}
+	return resaltada, celdas
+}
+
+// comentarios devuelve los comentarios de las celdas marcadas ordenados por fila y columna
+func (m *marcador) comentarios() []comentario {
+	comentarios := make([]comentario, 0, len(m.textos))
+	for celda, mensajes := range m.textos {
+		comentarios = append(comentarios, comentario{Fila: celda[0], Columna: celda[1], Texto: strings.Join(mensajes, "\n")})
+	}
+	sort.Slice(comentarios, func(a, b int) bool {
+		if comentarios[a].Fila != comentarios[b].Fila {
+			return comentarios[a].Fila < comentarios[b].Fila
+		}
+		return comentarios[a].Columna < comentarios[b].Columna
+	})
+	return comentarios
+}
+
+// normalizarIddte unifica los IDDTE de Redis (IDDTE-3) y de las hojas (3 o 3.0)
+func normalizarIddte(valor string) string {
+	valor = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(valor), "IDDTE-"))
+	if numero, err := strconv.ParseFloat(valor, 64); err == nil && numero == float64(int64(numero)) {
+		return strconv.FormatInt(int64(numero), 10)
+	}
+	return valor
+}
@@ -0,0 +1,228 @@
+package reportes
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/tealeg/xlsx"
+)
+
+// La librería de Excel no escribe comentarios, así que se agregan al archivo ya generado: por cada hoja
+// comentada se añaden sus partes de comentarios y de dibujo VML, y la hoja las referencia con legacyDrawing.
+const (
+	tipoComentarios = "application/vnd.openxmlformats-officedocument.spreadsheetml.comments+xml"
+	tipoVML         = "application/vnd.openxmlformats-officedocument.vmlDrawing"
+	relComentarios  = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/comments"
+	relVML          = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/vmlDrawing"
+	nsRelaciones    = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	autorComentario = "GoProcesadorExcel"
+)
+
+// agregarComentarios copia el archivo de Excel de origen en w añadiendo los comentarios de cada hoja. Las
+// claves de comentarios son los números de hoja del libro, empezando en 1.
+func agregarComentarios(w io.Writer, origen io.ReaderAt, tamano int64, comentarios map[int][]comentario) error {
+	lector, err := zip.NewReader(origen, tamano)
+	if err != nil {
+		return fmt.Errorf("error al leer el archivo de Excel generado: %v", err)
+	}
+
+	hojas := make([]int, 0, len(comentarios))
+	for hoja := range comentarios {
+		hojas = append(hojas, hoja)
+	}
+	sort.Ints(hojas)
+
+	escritor := zip.NewWriter(w)
+	for _, parte := range lector.File {
+		var contenido []byte
+		switch {
+		case parte.Name == "[Content_Types].xml":
+			if contenido, err = leerParte(parte); err != nil {
+				return err
+			}
+			contenido = tiposComentarios(contenido, hojas)
+		case strings.HasPrefix(parte.Name, "xl/worksheets/sheet"):
+			var hoja int
+			if _, err := fmt.Sscanf(parte.Name, "xl/worksheets/sheet%d.xml", &hoja); err != nil || comentarios[hoja] == nil {
+				break
+			}
+			if err := copiarConDibujo(escritor, parte); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Las partes sin cambios se copian sin descomprimir
+		if contenido == nil {
+			if err := escritor.Copy(parte); err != nil {
+				return fmt.Errorf("error al copiar %s: %v", parte.Name, err)
+			}
+			continue
+		}
+		if err := escribirParte(escritor, parte.Name, contenido); err != nil {
+			return err
+		}
+	}
+
+	for _, hoja := range hojas {
+		partes := []struct {
+			nombre    string
+			contenido []byte
+		}{
+			{fmt.Sprintf("xl/comments%d.xml", hoja), xmlComentarios(comentarios[hoja])},
+			{fmt.Sprintf("xl/drawings/vmlDrawing%d.vml", hoja), vmlComentarios(hoja, comentarios[hoja])},
+			{fmt.Sprintf("xl/worksheets/_rels/sheet%d.xml.rels", hoja), relacionesComentarios(hoja)},
+		}
+		for _, parte := range partes {
+			if err := escribirParte(escritor, parte.nombre, parte.contenido); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := escritor.Close(); err != nil {
+		return fmt.Errorf("error al guardar el archivo de Excel: %v", err)
+	}
+	return nil
+}
+
+func leerParte(parte *zip.File) ([]byte, error) {
+	lector, err := parte.Open()
+	if err != nil {
+		return nil, fmt.Errorf("error al leer %s: %v", parte.Name, err)
+	}
+	defer lector.Close()
+	contenido, err := io.ReadAll(lector)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer %s: %v", parte.Name, err)
+	}
+	return contenido, nil
+}
+
+func escribirParte(escritor *zip.Writer, nombre string, contenido []byte) error {
+	destino, err := escritor.Create(nombre)
+	if err != nil {
+		return fmt.Errorf("error al escribir %s: %v", nombre, err)
+	}
+	if _, err := destino.Write(contenido); err != nil {
+		return fmt.Errorf("error al escribir %s: %v", nombre, err)
+	}
+	return nil
+}
+
+// tiposComentarios registra los tipos de contenido de los comentarios y de los dibujos VML
+func tiposComentarios(contenido []byte, hojas []int) []byte {
+	var tipos strings.Builder
+	fmt.Fprintf(&tipos, `<Default Extension="vml" ContentType="%s"/>`, tipoVML)
+	for _, hoja := range hojas {
+		fmt.Fprintf(&tipos, `<Override PartName="/xl/comments%d.xml" ContentType="%s"/>`, hoja, tipoComentarios)
+	}
+	return bytes.Replace(contenido, []byte("</Types>"), []byte(tipos.String()+"</Types>"), 1)
+}
+
+// copiarConDibujo copia la hoja añadiendo el elemento legacyDrawing, que va después de headerFooter y es el
+// último elemento que escribe la librería. La hoja se copia por bloques para no cargarla completa en memoria.
+func copiarConDibujo(escritor *zip.Writer, parte *zip.File) error {
+	lector, err := parte.Open()
+	if err != nil {
+		return fmt.Errorf("error al leer %s: %v", parte.Name, err)
+	}
+	defer lector.Close()
+	destino, err := escritor.Create(parte.Name)
+	if err != nil {
+		return fmt.Errorf("error al escribir %s: %v", parte.Name, err)
+	}
+
+	// La etiqueta de apertura de la hoja necesita el espacio de nombres de las relaciones
+	entrada := bufio.NewReader(lector)
+	for {
+		etiqueta, err := entrada.ReadBytes('>')
+		if err != nil {
+			return fmt.Errorf("error al leer %s: %v", parte.Name, err)
+		}
+		if bytes.Contains(etiqueta, []byte("<worksheet ")) && !bytes.Contains(etiqueta, []byte("xmlns:r=")) {
+			etiqueta = bytes.Replace(etiqueta, []byte("<worksheet "), []byte(`<worksheet xmlns:r="`+nsRelaciones+`" `), 1)
+		}
+		if _, err := destino.Write(etiqueta); err != nil {
+			return fmt.Errorf("error al escribir %s: %v", parte.Name, err)
+		}
+		if bytes.Contains(etiqueta, []byte("<worksheet")) {
+			break
+		}
+	}
+
+	// El cierre de la hoja está al final; se retiene el último bloque para reemplazarlo
+	bloque := make([]byte, 32*1024)
+	var cola []byte
+	for {
+		n, err := entrada.Read(bloque)
+		cola = append(cola, bloque[:n]...)
+		if len(cola) > 2*len(bloque) {
+			corte := len(cola) - len(bloque)
+			if _, err := destino.Write(cola[:corte]); err != nil {
+				return fmt.Errorf("error al escribir %s: %v", parte.Name, err)
+			}
+			cola = append(cola[:0], cola[corte:]...)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error al leer %s: %v", parte.Name, err)
+		}
+	}
+	cola = bytes.Replace(cola, []byte("</worksheet>"), []byte(`<legacyDrawing r:id="rId2"/></worksheet>`), 1)
+	if _, err := destino.Write(cola); err != nil {
+		return fmt.Errorf("error al escribir %s: %v", parte.Name, err)
+	}
+	return nil
+}
+
+func relacionesComentarios(hoja int) []byte {
+	return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`+
+		`<Relationship Id="rId1" Type="%s" Target="../comments%d.xml"/>`+
+		`<Relationship Id="rId2" Type="%s" Target="../drawings/vmlDrawing%d.vml"/>`+
+		`</Relationships>`, relComentarios, hoja, relVML, hoja))
+}
+
+func xmlComentarios(comentarios []comentario) []byte {
+	var contenido bytes.Buffer
+	contenido.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`)
+	contenido.WriteString(`<comments xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	contenido.WriteString(`<authors><author>` + autorComentario + `</author></authors><commentList>`)
+	for _, c := range comentarios {
+		fmt.Fprintf(&contenido, `<comment ref="%s" authorId="0"><text><r><t xml:space="preserve">`, xlsx.GetCellIDStringFromCoords(c.Columna, c.Fila))
+		xml.EscapeText(&contenido, []byte(c.Texto))
+		contenido.WriteString(`</t></r></text></comment>`)
+	}
+	contenido.WriteString(`</commentList></comments>`)
+	return contenido.Bytes()
+}
+
+// vmlComentarios dibuja el recuadro de cada comentario, oculto hasta que se pasa el cursor por la celda
+func vmlComentarios(hoja int, comentarios []comentario) []byte {
+	var contenido bytes.Buffer
+	contenido.WriteString(`<xml xmlns:v="urn:schemas-microsoft-com:vml" xmlns:o="urn:schemas-microsoft-com:office:office" xmlns:x="urn:schemas-microsoft-com:office:excel">`)
+	fmt.Fprintf(&contenido, `<o:shapelayout v:ext="edit"><o:idmap v:ext="edit" data="%d"/></o:shapelayout>`, hoja)
+	contenido.WriteString(`<v:shapetype id="_x0000_t202" coordsize="21600,21600" o:spt="202" path="m,l,21600r21600,l21600,xe">` +
+		`<v:stroke joinstyle="miter"/><v:path gradientshapeok="t" o:connecttype="rect"/></v:shapetype>`)
+	for i, c := range comentarios {
+		fmt.Fprintf(&contenido, `<v:shape id="_x0000_s%d" type="#_x0000_t202" `+
+			`style="position:absolute;margin-left:59.25pt;margin-top:1.5pt;width:180pt;height:60pt;z-index:%d;visibility:hidden" `+
+			`fillcolor="#ffffe1" o:insetmode="auto"><v:fill color2="#ffffe1"/><v:shadow on="t" color="black" obscured="t"/>`+
+			`<v:path o:connecttype="none"/><v:textbox style="mso-direction-alt:auto"><div style="text-align:left"></div></v:textbox>`+
+			`<x:ClientData ObjectType="Note"><x:MoveWithCells/><x:SizeWithCells/>`+
+			`<x:Anchor>%d, 15, %d, 10, %d, 15, %d, 4</x:Anchor><x:AutoFill>False</x:AutoFill>`+
+			`<x:Row>%d</x:Row><x:Column>%d</x:Column></x:ClientData></v:shape>`,
+			hoja*1024+i+1, i+1, c.Columna+1, c.Fila, c.Columna+4, c.Fila+4, c.Fila, c.Columna)
+	}
+	contenido.WriteString(`</xml>`)
+	return contenido.Bytes()
+}
@@ -0,0 +1,297 @@
+package reportes
+
+import (
+	"GoProcesadorExcel/documentos"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tealeg/xlsx"
+)
+
+// Estados finales de un IDDTE en el informe consolidado
+const (
+	EstadoProcesado = "PROCESADO"
+	EstadoRechazado = "RECHAZADO"
+	EstadoError     = "ERROR"
+)
+
+// formatosFecha son los formatos de fecha que pueden traer el documento y la respuesta de Hacienda
+var formatosFecha = []string{"2006-01-02", "2006-01-02T15:04:05", "2006-01-02 15:04:05", "02/01/2006 15:04:05", "02/01/2006"}
+
+// Consolidada es un IDDTE del informe consolidado de un periodo, con los datos del documento enviado
+type Consolidada struct {
+	Lote          string    `json:"Lote"`
+	Fecha         time.Time `json:"Fecha"`
+	NumeroControl string    `json:"NumeroControl"`
+	Receptor      string    `json:"Receptor"`
+	Moneda        string    `json:"Moneda"`
+	Total         float64   `json:"Total"`
+	EstadoFinal   string    `json:"EstadoFinal"`
+	Fila
+}
+
+// NuevaConsolidada combina la fila del informe de un IDDTE con la vista de su documento. La fecha es la de
+// emisión o procesamiento de Hacienda y, si no está disponible, la del lote.
+func NuevaConsolidada(lote string, fila Fila, vista documentos.Vista, fechaLote time.Time) Consolidada {
+	fecha, ok := FechaDocumento(vista)
+	if !ok {
+		fecha = fechaLote
+	}
+	return Consolidada{
+		Lote:          lote,
+		Fecha:         fecha,
+		NumeroControl: vista.NumeroControl,
+		Receptor:      vista.Receptor.Nombre,
+		Moneda:        vista.Moneda,
+		Total:         vista.Total,
+		EstadoFinal:   fila.EstadoFinal(),
+		Fila:          fila,
+	}
+}
+
+// EstadoFinal resume el resultado del IDDTE: PROCESADO, el estado de Hacienda o ERROR si no llegó a procesarse
+func (f Fila) EstadoFinal() string {
+	if f.Acierto {
+		return EstadoProcesado
+	}
+	if f.Estado != "" && f.Estado != "N/A" {
+		return strings.ToUpper(f.Estado)
+	}
+	return EstadoError
+}
+
+// FechaDocumento devuelve la fecha de emisión del documento o, si no la tiene, la de procesamiento
+func FechaDocumento(vista documentos.Vista) (time.Time, bool) {
+	for _, valor := range []string{vista.FechaEmision, vista.FechaProcesamiento} {
+		valor = strings.TrimSpace(valor)
+		if valor == "" {
+			continue
+		}
+		for _, formato := range formatosFecha {
+			if len(valor) >= len(formato) {
+				if fecha, err := time.ParseInLocation(formato, valor[:len(formato)], time.Local); err == nil {
+					return fecha, true
+				}
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// FiltroConsolidado selecciona los IDDTE del informe consolidado. Las fechas incluyen los días extremos y una
+// lista vacía no filtra.
+type FiltroConsolidado struct {
+	Desde    time.Time
+	Hasta    time.Time
+	TiposDte []string
+	Estados  []string
+}
+
+// Acepta indica si el IDDTE cumple el filtro
+func (f FiltroConsolidado) Acepta(fila Consolidada) bool {
+	dia := time.Date(fila.Fecha.Year(), fila.Fecha.Month(), fila.Fecha.Day(), 0, 0, 0, 0, time.Local)
+	if !f.Desde.IsZero() && dia.Before(f.Desde) {
+		return false
+	}
+	if !f.Hasta.IsZero() && dia.After(f.Hasta) {
+		return false
+	}
+	if len(f.TiposDte) > 0 && !contiene(f.TiposDte, fila.TipoDte) {
+		return false
+	}
+	if len(f.Estados) > 0 && !contiene(f.Estados, fila.EstadoFinal) {
+		return false
+	}
+	return true
+}
+
+func contiene(lista []string, valor string) bool {
+	for _, elemento := range lista {
+		if strings.EqualFold(elemento, valor) {
+			return true
+		}
+	}
+	return false
+}
+
+// OrdenarConsolidado ordena las filas por fecha, lote e IDDTE
+func OrdenarConsolidado(filas []Consolidada) {
+	sort.SliceStable(filas, func(i, j int) bool {
+		if !filas[i].Fecha.Equal(filas[j].Fecha) {
+			return filas[i].Fecha.Before(filas[j].Fecha)
+		}
+		if filas[i].Lote != filas[j].Lote {
+			return numeroFinal(filas[i].Lote) < numeroFinal(filas[j].Lote)
+		}
+		return numeroFinal(filas[i].IDDTE) < numeroFinal(filas[j].IDDTE)
+	})
+}
+
+// numeroFinal devuelve el número al final de un identificador como Lote_12 o IDDTE-3
+func numeroFinal(texto string) int {
+	inicio := strings.LastIndexAny(texto, "_-")
+	numero, _ := strconv.Atoi(texto[inicio+1:])
+	return numero
+}
+
+// Resumen es la cantidad de documentos y el monto total de un tipo de DTE, estado y moneda. Los montos de
+// monedas distintas no se suman entre sí.
+type Resumen struct {
+	TipoDte     string  `json:"TipoDte"`
+	EstadoFinal string  `json:"EstadoFinal"`
+	Moneda      string  `json:"Moneda"`
+	Cantidad    int     `json:"Cantidad"`
+	Monto       float64 `json:"Monto"`
+}
+
+// Resumir agrupa las filas por tipo de DTE, estado y moneda
+func Resumir(filas []Consolidada) []Resumen {
+	indices := make(map[[3]string]int)
+	var resumen []Resumen
+	for _, fila := range filas {
+		moneda := strings.ToUpper(strings.TrimSpace(fila.Moneda))
+		clave := [3]string{fila.TipoDte, fila.EstadoFinal, moneda}
+		i, ok := indices[clave]
+		if !ok {
+			i = len(resumen)
+			indices[clave] = i
+			resumen = append(resumen, Resumen{TipoDte: fila.TipoDte, EstadoFinal: fila.EstadoFinal, Moneda: moneda})
+		}
+		resumen[i].Cantidad++
+		resumen[i].Monto += fila.Total
+	}
+	sort.Slice(resumen, func(i, j int) bool {
+		if resumen[i].TipoDte != resumen[j].TipoDte {
+			return resumen[i].TipoDte < resumen[j].TipoDte
+		}
+		if resumen[i].EstadoFinal != resumen[j].EstadoFinal {
+			return resumen[i].EstadoFinal < resumen[j].EstadoFinal
+		}
+		return resumen[i].Moneda < resumen[j].Moneda
+	})
+	return resumen
+}
+
+// encabezadosConsolidado son las columnas de la hoja 'Documentos' y del CSV consolidado
+var encabezadosConsolidado = []string{"Lote", "IDDTE", "TipoDte", "Fecha", "CodigoGeneracion", "NumeroControl", "SelloRecibido", "Receptor", "Moneda", "Total", "EstadoFinal", "Mensaje", "HojaError"}
+
+var encabezadosResumen = []string{"TipoDte", "EstadoFinal", "Moneda", "Cantidad", "Monto"}
+
+func (c Consolidada) columnas() []string {
+	return []string{c.Lote, c.IDDTE, c.TipoDte, c.Fecha.Format("2006-01-02"), c.CodigoGeneracion, c.NumeroControl, c.SelloRecibido, c.Receptor, c.Moneda, formatoMonto(c.Total), c.EstadoFinal, c.Mensaje, c.HojaError}
+}
+
+func (r Resumen) columnas() []string {
+	return []string{r.TipoDte, r.EstadoFinal, r.Moneda, strconv.Itoa(r.Cantidad), formatoMonto(r.Monto)}
+}
+
+func formatoMonto(monto float64) string {
+	return strconv.FormatFloat(monto, 'f', 2, 64)
+}
+
+// EscribirConsolidadoCSV escribe un IDDTE por línea
+func EscribirConsolidadoCSV(w io.Writer, filas []Consolidada) error {
+	escritor := csv.NewWriter(w)
+	if err := escritor.Write(encabezadosConsolidado); err != nil {
+		return err
+	}
+	for _, fila := range filas {
+		if err := escritor.Write(fila.columnas()); err != nil {
+			return err
+		}
+	}
+	escritor.Flush()
+	return escritor.Error()
+}
+
+// EscribirResumenCSV escribe la cantidad y el monto por tipo de DTE, estado y moneda
+func EscribirResumenCSV(w io.Writer, resumen []Resumen) error {
+	escritor := csv.NewWriter(w)
+	if err := escritor.Write(encabezadosResumen); err != nil {
+		return err
+	}
+	for _, fila := range resumen {
+		if err := escritor.Write(fila.columnas()); err != nil {
+			return err
+		}
+	}
+	escritor.Flush()
+	return escritor.Error()
+}
+
+// EscribirConsolidadoExcel escribe las hojas 'Documentos', con un IDDTE por fila, y 'Resumen', con la
+// cantidad y el monto por tipo de DTE, estado y moneda
+func EscribirConsolidadoExcel(w io.Writer, filas []Consolidada, resumen []Resumen) error {
+	fuente := xlsx.NewFont(11, "Calibri")
+	fuenteNegrita := xlsx.NewFont(11, "Calibri")
+	fuenteNegrita.Bold = true
+	normal := xlsx.MakeStringStyle(fuente, xlsx.DefaultFill(), xlsx.DefaultAlignment(), xlsx.DefaultBorder())
+	negrita := xlsx.MakeStringStyle(fuenteNegrita, xlsx.DefaultFill(), xlsx.DefaultAlignment(), xlsx.DefaultBorder())
+	decimal := xlsx.MakeDecimalStyle(fuente, xlsx.DefaultFill(), xlsx.DefaultAlignment(), xlsx.DefaultBorder())
+	entero := xlsx.MakeIntegerStyle(fuente, xlsx.DefaultFill(), xlsx.DefaultAlignment(), xlsx.DefaultBorder())
+
+	builder := xlsx.NewStreamFileBuilder(w)
+	if err := builder.AddStreamStyleList([]xlsx.StreamStyle{normal, negrita, decimal, entero}); err != nil {
+		return fmt.Errorf("error al registrar los estilos del informe: %v", err)
+	}
+	if err := builder.AddSheetS("Documentos", estilosColumnas(normal, len(encabezadosConsolidado))); err != nil {
+		return fmt.Errorf("error al añadir la hoja 'Documentos': %v", err)
+	}
+	if err := builder.AddSheetS("Resumen", estilosColumnas(normal, len(encabezadosResumen))); err != nil {
+		return fmt.Errorf("error al añadir la hoja 'Resumen': %v", err)
+	}
+	archivo, err := builder.Build()
+	if err != nil {
+		return fmt.Errorf("error al generar el archivo de Excel: %v", err)
+	}
+
+	if err := archivo.WriteS(celdasEncabezado(encabezadosConsolidado, negrita)); err != nil {
+		return fmt.Errorf("error al escribir la hoja 'Documentos': %v", err)
+	}
+	columnaTotal := indice(encabezadosConsolidado, "Total")
+	for _, fila := range filas {
+		celdas := celdasInforme(fila.columnas(), normal, normal, normal)
+		celdas[columnaTotal] = xlsx.NewStreamCell(formatoMonto(fila.Total), decimal, xlsx.CellTypeNumeric)
+		if err := archivo.WriteS(celdas); err != nil {
+			return fmt.Errorf("error al escribir la hoja 'Documentos': %v", err)
+		}
+	}
+
+	if err := archivo.NextSheet(); err != nil {
+		return fmt.Errorf("error al añadir la hoja 'Resumen': %v", err)
+	}
+	if err := archivo.WriteS(celdasEncabezado(encabezadosResumen, negrita)); err != nil {
+		return fmt.Errorf("error al escribir la hoja 'Resumen': %v", err)
+	}
+	for _, fila := range resumen {
+		celdas := celdasInforme(fila.columnas(), normal, normal, normal)
+		celdas[indice(encabezadosResumen, "Cantidad")] = xlsx.NewStreamCell(strconv.Itoa(fila.Cantidad), entero, xlsx.CellTypeNumeric)
+		celdas[indice(encabezadosResumen, "Monto")] = xlsx.NewStreamCell(formatoMonto(fila.Monto), decimal, xlsx.CellTypeNumeric)
+		if err := archivo.WriteS(celdas); err != nil {
+			return fmt.Errorf("error al escribir la hoja 'Resumen': %v", err)
+		}
+	}
+
+	if err := archivo.Close(); err != nil {
+		return fmt.Errorf("error al guardar el archivo de Excel: %v", err)
+	}
+	return nil
+}
+
+func celdasEncabezado(encabezados []string, estilo xlsx.StreamStyle) []xlsx.StreamCell {
+	return celdasInforme(encabezados, estilo, estilo, estilo)
+}
+
+func indice(lista []string, valor string) int {
+	for i, elemento := range lista {
+		if elemento == valor {
+			return i
+		}
+	}
+	return -1
+}
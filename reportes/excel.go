@@ -0,0 +1,206 @@
+package reportes
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tealeg/xlsx"
+)
+
+// encabezadosInforme son las columnas de la hoja 'Informe'
+var encabezadosInforme = []string{"IDDTE", "TipoDte", "CodigoGeneracion", "SelloRecibido", "Estado", "Mensaje", "HojaError"}
+
+// columnasInforme devuelve los valores de la fila en el orden de encabezadosInforme
+func (f Fila) columnasInforme() []string {
+	return []string{f.IDDTE, f.TipoDte, f.CodigoGeneracion, f.SelloRecibido, f.Estado, f.Mensaje, f.HojaError}
+}
+
+// EscribirExcel escribe el informe en Excel en w: la hoja 'Informe' con el estado de cada IDDTE seguida de las
+// hojas del archivo original del lote. Las filas del informe y las de las hojas originales se escriben a medida
+// que se leen; solo se conservan las anotaciones de los IDDTE con errores para marcarlas en las hojas originales.
+//
+// En las hojas originales se resaltan las filas de los IDDTE con errores y las celdas de los campos rechazados
+// llevan un comentario con el mensaje, para que el archivo se pueda corregir y volver a cargar. Con el archivo
+// original, el informe se genera primero en un temporal y se copia en w agregando los comentarios.
+func EscribirExcel(w io.Writer, filas Filas, originalFile *LibroOriginal) error {
+	if originalFile == nil {
+		_, err := escribirLibro(w, filas, nil)
+		return err
+	}
+
+	temporal, err := os.CreateTemp("", "informe-*.xlsx")
+	if err != nil {
+		return fmt.Errorf("error al crear el archivo temporal del informe: %v", err)
+	}
+	defer os.Remove(temporal.Name())
+	defer temporal.Close()
+
+	comentarios, err := escribirLibro(temporal, filas, originalFile)
+	if err != nil {
+		return err
+	}
+	if len(comentarios) == 0 {
+		if _, err := temporal.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("error al leer el archivo temporal del informe: %v", err)
+		}
+		_, err := io.Copy(w, temporal)
+		return err
+	}
+	info, err := temporal.Stat()
+	if err != nil {
+		return fmt.Errorf("error al leer el archivo temporal del informe: %v", err)
+	}
+	return agregarComentarios(w, temporal, info.Size(), comentarios)
+}
+
+// columnasHojas devuelve el número de columnas de cada hoja del archivo original, que es el de su fila más larga
+func columnasHojas(originalFile *LibroOriginal) ([]int, error) {
+	columnas := make([]int, len(originalFile.hojas))
+	for i := range originalFile.hojas {
+		err := originalFile.recorrerHoja(i, func(_ int, valores []string) error {
+			if len(valores) > columnas[i] {
+				columnas[i] = len(valores)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return columnas, nil
+}
+
+// escribirLibro genera las hojas del informe resaltando los errores en las hojas originales. Devuelve los
+// comentarios de cada hoja por su número en el libro, empezando en 1.
+func escribirLibro(w io.Writer, filas Filas, originalFile *LibroOriginal) (map[int][]comentario, error) {
+	// Estilos de las celdas: verde para los aciertos, rojo para los errores y negrita para la columna "HojaError".
+	// Las celdas rechazadas de las hojas originales llevan un rojo más intenso en negrita.
+	fuente := xlsx.NewFont(11, "Calibri")
+	fuenteNegrita := xlsx.NewFont(11, "Calibri")
+	fuenteNegrita.Bold = true
+	fuenteError := xlsx.NewFont(11, "Calibri")
+	fuenteError.Bold = true
+	fuenteError.Color = "FF9C0006"
+	normal := xlsx.MakeStringStyle(fuente, xlsx.DefaultFill(), xlsx.DefaultAlignment(), xlsx.DefaultBorder())
+	negrita := xlsx.MakeStringStyle(fuenteNegrita, xlsx.DefaultFill(), xlsx.DefaultAlignment(), xlsx.DefaultBorder())
+	verde := xlsx.MakeStringStyle(fuente, xlsx.NewFill("solid", "C6EFCE", "C6EFCE"), xlsx.DefaultAlignment(), xlsx.DefaultBorder())
+	rojo := xlsx.MakeStringStyle(fuente, xlsx.NewFill("solid", "FFC7CE", "FFC7CE"), xlsx.DefaultAlignment(), xlsx.DefaultBorder())
+	celdaError := xlsx.MakeStringStyle(fuenteError, xlsx.NewFill("solid", "FF9999", "FF9999"), xlsx.DefaultAlignment(), xlsx.DefaultBorder())
+
+	builder := xlsx.NewStreamFileBuilder(w)
+	if err := builder.AddStreamStyleList([]xlsx.StreamStyle{normal, negrita, verde, rojo, celdaError}); err != nil {
+		return nil, fmt.Errorf("error al registrar los estilos del informe: %v", err)
+	}
+	if err := builder.AddSheetS("Informe", estilosColumnas(normal, len(encabezadosInforme))); err != nil {
+		return nil, fmt.Errorf("error al añadir la hoja 'Informe' al nuevo archivo de Excel: %v", err)
+	}
+
+	// Las hojas del archivo original se declaran con tantas columnas como su fila más larga
+	var columnasOriginales []int
+	if originalFile != nil {
+		var err error
+		if columnasOriginales, err = columnasHojas(originalFile); err != nil {
+			return nil, err
+		}
+		for i, hoja := range originalFile.hojas {
+			if err := builder.AddSheetS(hoja.nombre, estilosColumnas(normal, columnasOriginales[i])); err != nil {
+				return nil, fmt.Errorf("error al añadir la hoja '%s' al nuevo archivo de Excel: %v", hoja.nombre, err)
+			}
+		}
+	}
+
+	archivo, err := builder.Build()
+	if err != nil {
+		return nil, fmt.Errorf("error al generar el archivo de Excel: %v", err)
+	}
+
+	// Escribir los encabezados de las columnas en la hoja 'Informe'
+	if err := archivo.WriteS(celdasInforme(encabezadosInforme, normal, normal, normal)); err != nil {
+		return nil, fmt.Errorf("error al escribir la hoja 'Informe': %v", err)
+	}
+
+	// Escribir los datos en la hoja 'Informe' guardando las anotaciones de los errores
+	anotaciones := make(anotacionesPorHoja)
+	err = filas(func(fila Fila) error {
+		// Determinar el color de la fila según si el valor indica un acierto o un error
+		color := rojo
+		if fila.Acierto {
+			color = verde
+		}
+		if err := archivo.WriteS(celdasInforme(fila.columnasInforme(), color, normal, negrita)); err != nil {
+			return fmt.Errorf("error al escribir la hoja 'Informe': %v", err)
+		}
+		if originalFile != nil {
+			anotaciones.agregar(fila)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Si el archivo original existe, copiar sus hojas al nuevo archivo
+	comentarios := make(map[int][]comentario)
+	if originalFile != nil {
+		for i, hoja := range originalFile.hojas {
+			if err := archivo.NextSheet(); err != nil {
+				return nil, fmt.Errorf("error al añadir la hoja '%s' al nuevo archivo de Excel: %v", hoja.nombre, err)
+			}
+			marcas := anotaciones.marcador(hoja.nombre)
+			err := originalFile.recorrerHoja(i, func(r int, leidos []string) error {
+				valores := make([]string, columnasOriginales[i])
+				copy(valores, leidos)
+				celdas := celdasInforme(valores, normal, normal, normal)
+				if resaltada, rechazadas := marcas.marcar(r, valores); resaltada {
+					celdas = celdasInforme(valores, rojo, rojo, rojo)
+					for j := range rechazadas {
+						celdas[j] = xlsx.NewStyledStringStreamCell(valores[j], celdaError)
+					}
+				}
+				if err := archivo.WriteS(celdas); err != nil {
+					return fmt.Errorf("error al escribir la hoja '%s': %v", hoja.nombre, err)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			// La hoja 'Informe' es la primera del libro
+			if lista := marcas.comentarios(); len(lista) > 0 {
+				comentarios[i+2] = lista
+			}
+		}
+	}
+
+	if err := archivo.Close(); err != nil {
+		return nil, fmt.Errorf("error al guardar el archivo de Excel: %v", err)
+	}
+	return comentarios, nil
+}
+
+// estilosColumnas devuelve el mismo estilo para n columnas
+func estilosColumnas(estilo xlsx.StreamStyle, n int) []xlsx.StreamStyle {
+	estilos := make([]xlsx.StreamStyle, n)
+	for i := range estilos {
+		estilos[i] = estilo
+	}
+	return estilos
+}
+
+// celdasInforme arma las celdas de una fila: la primera con el estilo primera, la última con el estilo
+// ultima y el resto con el estilo normal
+func celdasInforme(valores []string, primera xlsx.StreamStyle, normal xlsx.StreamStyle, ultima xlsx.StreamStyle) []xlsx.StreamCell {
+	celdas := make([]xlsx.StreamCell, len(valores))
+	for i, valor := range valores {
+		estilo := normal
+		switch {
+		case i == 0:
+			estilo = primera
+		case i == len(valores)-1:
+			estilo = ultima
+		}
+		celdas[i] = xlsx.NewStyledStringStreamCell(valor, estilo)
+	}
+	return celdas
+}
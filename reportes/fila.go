@@ -0,0 +1,156 @@
+package reportes
+
+import (
+	"GoProcesadorExcel/clasificacion"
+	"GoProcesadorExcel/documentos"
+	"GoProcesadorExcel/validacion"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Mensaje estructura del mensaje en el valor del par clave-valor
+type Mensaje struct {
+	CodigoGeneracion string `json:"CodigoGeneracion"`
+	SelloRecibido    string `json:"SelloRecibido"`
+	Estado           string `json:"Estado"`
+	DescripcionMsg   string `json:"DescripcionMsg"`
+}
+
+// Estructura del valor en el par clave-valor
+type Valor struct {
+	Codigo  int     `json:"Código"`
+	Mensaje Mensaje `json:"Mensaje"`
+}
+
+// Fila es el resultado de un IDDTE en el informe de un lote. Todos los formatos del informe se generan a
+// partir de ella para que tengan las mismas columnas y valores.
+type Fila struct {
+	IDDTE            string `json:"IDDTE"`
+	TipoDte          string `json:"TipoDte"`
+	Codigo           int    `json:"Codigo"`
+	CodigoGeneracion string `json:"CodigoGeneracion"`
+	SelloRecibido    string `json:"SelloRecibido"`
+	Estado           string `json:"Estado"`
+	Mensaje          string `json:"Mensaje"`
+	HojaError        string `json:"HojaError"`
+	// Errores son los errores de validación por campo detectados antes del envío
+	Errores []validacion.ErrorCampo `json:"Errores,omitempty"`
+	// Observaciones son las observaciones de Hacienda sobre el documento
+	Observaciones []string `json:"Observaciones,omitempty"`
+	// Clasificacion es la categoría del error, con la sugerencia para corregirlo; vacía en los aciertos
+	Clasificacion *clasificacion.Clasificacion `json:"Clasificacion,omitempty"`
+	// Anotaciones ubican los errores en las hojas originales del lote
+	Anotaciones []Anotacion `json:"Anotaciones,omitempty"`
+	// Acierto indica si Hacienda procesó el documento
+	Acierto bool `json:"Acierto"`
+}
+
+// NuevaFila convierte el estado guardado de un IDDTE en su fila del informe. Devuelve false si el valor no
+// tiene el formato esperado.
+func NuevaFila(iddte string, tipoDte string, estado string) (Fila, bool) {
+	codigo, mensaje, texto := documentos.ParsearEstado(estado)
+	if codigo == 0 {
+		log.Printf("Formato inválido para clave %s\n", iddte)
+		return Fila{}, false
+	}
+
+	if tipoDte == "" {
+		tipoDte = "N/A"
+	}
+	fila := Fila{IDDTE: iddte, TipoDte: tipoDte, Codigo: codigo}
+	var textoError string
+	fila.Errores, fila.Observaciones, textoError = detallesError(mensaje)
+
+	// Los errores del envío y de validación solo traen el texto del error
+	if codigo == 400 || codigo == 500 {
+		fila.CodigoGeneracion = "N/A"
+		fila.SelloRecibido = "N/A"
+		fila.Estado = "N/A"
+		fila.Mensaje = texto
+		fila.clasificar(estado)
+		if textoError == "" {
+			textoError = texto
+		}
+		fila.Anotaciones = fila.anotar(textoError)
+		return fila, true
+	}
+
+	if mensaje == nil {
+		log.Printf("El mensaje de la clave %s no es JSON\n", iddte)
+		return Fila{}, false
+	}
+
+	v := Valor{
+		Codigo: codigo,
+		Mensaje: Mensaje{
+			CodigoGeneracion: documentos.Texto(mensaje, "CodigoGeneracion"),
+			SelloRecibido:    documentos.Texto(mensaje, "SelloRecibido"),
+			Estado:           documentos.Texto(mensaje, "Estado"),
+			DescripcionMsg:   documentos.Texto(mensaje, "DescripcionMsg"),
+		},
+	}
+	fila.CodigoGeneracion = valorOTexto(v.Mensaje.CodigoGeneracion)
+	fila.SelloRecibido = valorOTexto(v.Mensaje.SelloRecibido)
+	fila.Estado = valorOTexto(v.Mensaje.Estado)
+	fila.Mensaje = valorOTexto(v.Mensaje.DescripcionMsg)
+	fila.Acierto = esAcierto(v)
+	fila.HojaError = "N/A"
+	if !fila.Acierto {
+		fila.clasificar(estado)
+	}
+	fila.Anotaciones = fila.anotar(v.Mensaje.DescripcionMsg)
+	return fila, true
+}
+
+// clasificar asigna la clasificación del error y las hojas que señala a la columna "HojaError"
+func (f *Fila) clasificar(estado string) {
+	resultado := clasificacion.Predeterminado().ClasificarEstado(estado)
+	f.Clasificacion = &resultado
+	f.HojaError = "N/A"
+	if len(resultado.Hojas) > 0 {
+		f.HojaError = strings.Join(resultado.Hojas, ", ")
+	}
+}
+
+// detallesError extrae del mensaje los errores de validación por campo, las observaciones de Hacienda y el
+// texto del campo Message
+func detallesError(mensaje map[string]interface{}) ([]validacion.ErrorCampo, []string, string) {
+	if mensaje == nil {
+		return nil, nil, ""
+	}
+
+	var errores []validacion.ErrorCampo
+	if lista, ok := mensaje["Errores"]; ok {
+		if contenido, err := json.Marshal(lista); err == nil {
+			if err := json.Unmarshal(contenido, &errores); err != nil {
+				errores = nil
+			}
+		}
+	}
+
+	var observaciones []string
+	if lista, ok := mensaje["Observaciones"].([]interface{}); ok {
+		for _, observacion := range lista {
+			if texto := strings.TrimSpace(fmt.Sprint(observacion)); texto != "" {
+				observaciones = append(observaciones, texto)
+			}
+		}
+	}
+	texto, _ := mensaje["Message"].(string)
+	return errores, observaciones, texto
+}
+
+// valorOTexto devuelve N/A para los campos vacíos del informe
+func valorOTexto(valor string) string {
+	if valor == "" {
+		return "N/A"
+	}
+	return valor
+}
+
+// esAcierto determina si el valor indica un acierto o un error
+func esAcierto(v Valor) bool {
+	return v.Codigo == 200 && v.Mensaje.CodigoGeneracion != "" && v.Mensaje.SelloRecibido != "" && v.Mensaje.Estado == "PROCESADO"
+}
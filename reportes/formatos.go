@@ -0,0 +1,145 @@
+package reportes
+
+import (
+	"GoProcesadorExcel/validacion"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Formatos del informe de un lote
+const (
+	FormatoXLSX   = "xlsx"
+	FormatoCSV    = "csv"
+	FormatoJSON   = "json"
+	FormatoNDJSON = "ndjson"
+)
+
+// tiposContenido es el Content-Type de cada formato
+var tiposContenido = map[string]string{
+	FormatoXLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	FormatoCSV:    "text/csv; charset=utf-8",
+	FormatoJSON:   "application/json; charset=utf-8",
+	FormatoNDJSON: "application/x-ndjson",
+}
+
+// TipoContenido devuelve el Content-Type del formato, o "" si el formato no existe
+func TipoContenido(formato string) string {
+	return tiposContenido[formato]
+}
+
+// FormatoAceptado devuelve el formato del informe que corresponde al encabezado Accept, o "" si no pide
+// ninguno en particular. application/json no se considera porque es el formato heredado con el Excel en base64.
+func FormatoAceptado(accept string) string {
+	for _, formato := range []string{FormatoXLSX, FormatoCSV, FormatoNDJSON} {
+		tipo := strings.SplitN(tiposContenido[formato], ";", 2)[0]
+		if strings.Contains(accept, tipo) {
+			return formato
+		}
+	}
+	return ""
+}
+
+// Filas recorre las filas del informe en orden y llama a escribir con cada una, deteniéndose en el primer
+// error. Las filas se pueden generar a medida que se recorren para no tener el lote completo en memoria.
+type Filas func(escribir func(Fila) error) error
+
+// Lista recorre las filas de una lista ya armada
+func Lista(filas []Fila) Filas {
+	return func(escribir func(Fila) error) error {
+		for _, fila := range filas {
+			if err := escribir(fila); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Escribir escribe las filas del informe en w con el formato indicado. El archivo original solo se usa en
+// el formato xlsx.
+func Escribir(w io.Writer, formato string, filas Filas, originalFile *LibroOriginal) error {
+	switch formato {
+	case FormatoXLSX:
+		return EscribirExcel(w, filas, originalFile)
+	case FormatoCSV:
+		return EscribirCSV(w, filas)
+	case FormatoJSON:
+		return EscribirJSON(w, filas)
+	case FormatoNDJSON:
+		return EscribirNDJSON(w, filas)
+	}
+	return fmt.Errorf("formato de informe no válido: %s", formato)
+}
+
+// encabezadosCSV son las columnas de la hoja 'Informe' seguidas del código HTTP, los detalles del error y su
+// clasificación
+var encabezadosCSV = append(append([]string{}, encabezadosInforme...), "Codigo", "Errores", "Observaciones", "Categoria", "Sugerencia", "Reintentable")
+
+// EscribirCSV escribe una línea por IDDTE. Los errores por campo y las observaciones se separan con "; ".
+func EscribirCSV(w io.Writer, filas Filas) error {
+	escritor := csv.NewWriter(w)
+	if err := escritor.Write(encabezadosCSV); err != nil {
+		return err
+	}
+	err := filas(func(fila Fila) error {
+		var categoria, sugerencia, reintentable string
+		if fila.Clasificacion != nil {
+			categoria = fila.Clasificacion.Categoria
+			sugerencia = fila.Clasificacion.Sugerencia
+			reintentable = strconv.FormatBool(fila.Clasificacion.Reintentable)
+		}
+		registro := append(fila.columnasInforme(),
+			strconv.Itoa(fila.Codigo),
+			validacion.ResumenErrores(fila.Errores),
+			strings.Join(fila.Observaciones, "; "),
+			categoria,
+			sugerencia,
+			reintentable,
+		)
+		return escritor.Write(registro)
+	})
+	if err != nil {
+		return err
+	}
+	escritor.Flush()
+	return escritor.Error()
+}
+
+// EscribirJSON escribe un arreglo JSON con una fila por IDDTE, codificando cada fila a medida que se escribe
+func EscribirJSON(w io.Writer, filas Filas) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	primera := true
+	err := filas(func(fila Fila) error {
+		if !primera {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		primera = false
+		contenido, err := json.Marshal(fila)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(contenido)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "]")
+	return err
+}
+
+// EscribirNDJSON escribe un objeto JSON por línea para cada IDDTE
+func EscribirNDJSON(w io.Writer, filas Filas) error {
+	codificador := json.NewEncoder(w)
+	return filas(func(fila Fila) error {
+		return codificador.Encode(fila)
+	})
+}
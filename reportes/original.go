@@ -0,0 +1,256 @@
+package reportes
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LibroOriginal es el archivo de Excel con el que se generó el lote. Sus hojas se leen fila por fila
+// directamente del zip, así que solo los textos compartidos del libro quedan en memoria.
+type LibroOriginal struct {
+	archivo *zip.ReadCloser
+	partes  map[string]*zip.File
+	hojas   []hojaOriginal
+	textos  []string
+}
+
+// hojaOriginal es el nombre de una hoja y la parte del zip con sus filas
+type hojaOriginal struct {
+	nombre string
+	parte  string
+}
+
+// AbrirExcelOriginal abre el archivo de Excel con el que se generó el lote; devuelve nil si ya no existe
+func AbrirExcelOriginal(lote string) (*LibroOriginal, error) {
+	// Construir el nombre del archivo de Excel del lote
+	originalFilePath := filepath.Join("data", "archivos_excel", lote)
+
+	// Intentar abrir el archivo de Excel existente
+	if _, err := os.Stat(originalFilePath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return AbrirLibro(originalFilePath)
+}
+
+// AbrirLibro abre un archivo de Excel para leer sus hojas fila por fila
+func AbrirLibro(ruta string) (*LibroOriginal, error) {
+	archivo, err := zip.OpenReader(ruta)
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir el archivo de Excel: %v", err)
+	}
+	libro := &LibroOriginal{archivo: archivo, partes: make(map[string]*zip.File)}
+	for _, parte := range archivo.File {
+		libro.partes[parte.Name] = parte
+	}
+	if err := libro.leerHojas(); err != nil {
+		archivo.Close()
+		return nil, fmt.Errorf("error al abrir el archivo de Excel: %v", err)
+	}
+	if err := libro.leerTextos(); err != nil {
+		archivo.Close()
+		return nil, fmt.Errorf("error al abrir el archivo de Excel: %v", err)
+	}
+	return libro, nil
+}
+
+// Close cierra el archivo
+func (l *LibroOriginal) Close() error {
+	return l.archivo.Close()
+}
+
+// decodificarParte lee una parte XML pequeña del libro en destino
+func (l *LibroOriginal) decodificarParte(nombre string, destino interface{}) error {
+	parte, ok := l.partes[nombre]
+	if !ok {
+		return fmt.Errorf("falta %s", nombre)
+	}
+	lector, err := parte.Open()
+	if err != nil {
+		return err
+	}
+	defer lector.Close()
+	return xml.NewDecoder(lector).Decode(destino)
+}
+
+// leerHojas obtiene las hojas en el orden del libro con la parte de cada una
+func (l *LibroOriginal) leerHojas() error {
+	var libro struct {
+		Hojas []struct {
+			Nombre string `xml:"name,attr"`
+			ID     string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := l.decodificarParte("xl/workbook.xml", &libro); err != nil {
+		return err
+	}
+	var relaciones struct {
+		Relaciones []struct {
+			ID      string `xml:"Id,attr"`
+			Destino string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := l.decodificarParte("xl/_rels/workbook.xml.rels", &relaciones); err != nil {
+		return err
+	}
+	destinos := make(map[string]string, len(relaciones.Relaciones))
+	for _, relacion := range relaciones.Relaciones {
+		// Los destinos son relativos a xl/, salvo los que empiezan con "/"
+		destino := strings.TrimPrefix(relacion.Destino, "/")
+		if !strings.HasPrefix(relacion.Destino, "/") {
+			destino = path.Join("xl", relacion.Destino)
+		}
+		destinos[relacion.ID] = destino
+	}
+	for _, hoja := range libro.Hojas {
+		l.hojas = append(l.hojas, hojaOriginal{nombre: hoja.Nombre, parte: destinos[hoja.ID]})
+	}
+	return nil
+}
+
+// leerTextos carga los textos compartidos del libro, si los tiene
+func (l *LibroOriginal) leerTextos() error {
+	if _, ok := l.partes["xl/sharedStrings.xml"]; !ok {
+		return nil
+	}
+	var textos struct {
+		Elementos []textoCelda `xml:"si"`
+	}
+	if err := l.decodificarParte("xl/sharedStrings.xml", &textos); err != nil {
+		return err
+	}
+	l.textos = make([]string, len(textos.Elementos))
+	for i, texto := range textos.Elementos {
+		l.textos[i] = texto.valor()
+	}
+	return nil
+}
+
+// textoCelda es un texto simple o con formato (varios fragmentos)
+type textoCelda struct {
+	Texto      string `xml:"t"`
+	Fragmentos []struct {
+		Texto string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t textoCelda) valor() string {
+	if len(t.Fragmentos) == 0 {
+		return t.Texto
+	}
+	var texto strings.Builder
+	for _, fragmento := range t.Fragmentos {
+		texto.WriteString(fragmento.Texto)
+	}
+	return texto.String()
+}
+
+// celdaOriginal es una celda de la hoja tal como está en el XML
+type celdaOriginal struct {
+	Referencia string     `xml:"r,attr"`
+	Tipo       string     `xml:"t,attr"`
+	Valor      string     `xml:"v"`
+	EnLinea    textoCelda `xml:"is"`
+}
+
+// filaOriginal es una fila de la hoja tal como está en el XML
+type filaOriginal struct {
+	Numero int             `xml:"r,attr"`
+	Celdas []celdaOriginal `xml:"c"`
+}
+
+// recorrerHoja llama a fn con los valores de cada fila de la hoja i, empezando en la fila 0. Las filas
+// vacías que el XML omite se entregan sin valores para que los índices coincidan con los de la hoja.
+func (l *LibroOriginal) recorrerHoja(i int, fn func(fila int, valores []string) error) error {
+	parte, ok := l.partes[l.hojas[i].parte]
+	if !ok {
+		return fmt.Errorf("falta la hoja '%s'", l.hojas[i].nombre)
+	}
+	lector, err := parte.Open()
+	if err != nil {
+		return fmt.Errorf("error al leer la hoja '%s': %v", l.hojas[i].nombre, err)
+	}
+	defer lector.Close()
+
+	decodificador := xml.NewDecoder(lector)
+	siguiente := 0
+	for {
+		token, err := decodificador.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error al leer la hoja '%s': %v", l.hojas[i].nombre, err)
+		}
+		inicio, ok := token.(xml.StartElement)
+		if !ok || inicio.Name.Local != "row" {
+			continue
+		}
+		var fila filaOriginal
+		if err := decodificador.DecodeElement(&fila, &inicio); err != nil {
+			return fmt.Errorf("error al leer la hoja '%s': %v", l.hojas[i].nombre, err)
+		}
+
+		numero := siguiente
+		if fila.Numero > 0 {
+			numero = fila.Numero - 1
+		}
+		for ; siguiente < numero; siguiente++ {
+			if err := fn(siguiente, nil); err != nil {
+				return err
+			}
+		}
+		if err := fn(numero, l.valoresFila(fila)); err != nil {
+			return err
+		}
+		siguiente = numero + 1
+	}
+}
+
+// valoresFila ubica cada celda en su columna según su referencia
+func (l *LibroOriginal) valoresFila(fila filaOriginal) []string {
+	var valores []string
+	for j, celda := range fila.Celdas {
+		columna := j
+		if referencia := columnaReferencia(celda.Referencia); referencia >= 0 {
+			columna = referencia
+		}
+		for len(valores) <= columna {
+			valores = append(valores, "")
+		}
+		valores[columna] = l.valorCelda(celda)
+	}
+	return valores
+}
+
+func (l *LibroOriginal) valorCelda(celda celdaOriginal) string {
+	switch celda.Tipo {
+	case "s":
+		indice, err := strconv.Atoi(celda.Valor)
+		if err != nil || indice < 0 || indice >= len(l.textos) {
+			return ""
+		}
+		return l.textos[indice]
+	case "inlineStr":
+		return celda.EnLinea.valor()
+	}
+	return celda.Valor
+}
+
+// columnaReferencia convierte la columna de una referencia ("AB12") en su índice desde 0
+func columnaReferencia(referencia string) int {
+	columna := 0
+	for _, r := range referencia {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		columna = columna*26 + int(r-'A'+1)
+	}
+	return columna - 1
+}
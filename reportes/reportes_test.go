@@ -0,0 +1,294 @@
+package reportes
+
+import (
+	"GoProcesadorExcel/documentos"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tealeg/xlsx"
+)
+
+func filasPrueba(t *testing.T) []Fila {
+	estados := [][3]string{
+		{"IDDTE-1", "01", `Código: 200, Mensaje: {"CodigoGeneracion": "COD-1", "SelloRecibido": "SELLO", "Estado": "PROCESADO", "DescripcionMsg": "RECIBIDO"}`},
+		{"IDDTE-2", "03", `Código: 200, Mensaje: {"CodigoGeneracion": "COD-2", "Estado": "RECHAZADO", "DescripcionMsg": "Receptor.nrc no válido", "Observaciones": ["Revisar NRC"]}`},
+		{"IDDTE-3", "01", `Código: 400 , Mensaje: {"Message": "Receptor.NumeroDocumento (fila 1): DUI inválido", "Errores": [{"Hoja": "Receptor", "Fila": 1, "Campo": "NumeroDocumento", "Mensaje": "DUI inválido"}]}`},
+	}
+	var filas []Fila
+	for _, estado := range estados {
+		fila, ok := NuevaFila(estado[0], estado[1], estado[2])
+		if !ok {
+			t.Fatalf("No se pudo interpretar el estado de %s", estado[0])
+		}
+		filas = append(filas, fila)
+	}
+	return filas
+}
+
+func TestNuevaFila(t *testing.T) {
+	filas := filasPrueba(t)
+	if !filas[0].Acierto || filas[1].Acierto || filas[2].Acierto {
+		t.Errorf("Aciertos inesperados: %v %v %v", filas[0].Acierto, filas[1].Acierto, filas[2].Acierto)
+	}
+	if filas[1].HojaError != "Receptor" || len(filas[1].Observaciones) != 1 {
+		t.Errorf("Fila rechazada inesperada: %+v", filas[1])
+	}
+	if filas[2].HojaError != "Receptor" || len(filas[2].Errores) != 1 || filas[2].Errores[0].Campo != "NumeroDocumento" {
+		t.Errorf("Fila con errores de validación inesperada: %+v", filas[2])
+	}
+	if _, ok := NuevaFila("IDDTE-4", "01", "sin formato"); ok {
+		t.Error("Un estado sin formato no debería generar una fila")
+	}
+	if fila, ok := NuevaFila("IDDTE-5", "01", "Código: 500 , Mensaje: Error al Generar DTE"); !ok || fila.Mensaje != "Error al Generar DTE" {
+		t.Errorf("Un error del envío sin JSON debería generar una fila con su texto: %+v", fila)
+	}
+}
+
+func TestFormatosConsistentes(t *testing.T) {
+	filas := filasPrueba(t)
+
+	var salidaCSV bytes.Buffer
+	if err := Escribir(&salidaCSV, FormatoCSV, Lista(filas), nil); err != nil {
+		t.Fatalf("Error al generar el CSV: %v", err)
+	}
+	registros, err := csv.NewReader(&salidaCSV).ReadAll()
+	if err != nil {
+		t.Fatalf("CSV no válido: %v", err)
+	}
+	if len(registros) != len(filas)+1 || registros[0][0] != "IDDTE" {
+		t.Fatalf("CSV inesperado: %v", registros)
+	}
+
+	var salidaJSON bytes.Buffer
+	if err := Escribir(&salidaJSON, FormatoJSON, Lista(filas), nil); err != nil {
+		t.Fatalf("Error al generar el JSON: %v", err)
+	}
+	var desdeJSON []Fila
+	if err := json.Unmarshal(salidaJSON.Bytes(), &desdeJSON); err != nil {
+		t.Fatalf("JSON no válido: %v", err)
+	}
+
+	var salidaNDJSON bytes.Buffer
+	if err := Escribir(&salidaNDJSON, FormatoNDJSON, Lista(filas), nil); err != nil {
+		t.Fatalf("Error al generar el NDJSON: %v", err)
+	}
+	var desdeNDJSON []Fila
+	lector := bufio.NewScanner(&salidaNDJSON)
+	for lector.Scan() {
+		var fila Fila
+		if err := json.Unmarshal(lector.Bytes(), &fila); err != nil {
+			t.Fatalf("Línea NDJSON no válida: %v", err)
+		}
+		desdeNDJSON = append(desdeNDJSON, fila)
+	}
+
+	for i, fila := range filas {
+		columnas := fila.columnasInforme()
+		for j, valor := range columnas {
+			if registros[i+1][j] != valor {
+				t.Errorf("CSV fila %d columna %s: %q, se esperaba %q", i, encabezadosCSV[j], registros[i+1][j], valor)
+			}
+		}
+		if desdeJSON[i].Mensaje != fila.Mensaje || desdeNDJSON[i].HojaError != fila.HojaError || len(desdeNDJSON[i].Errores) != len(fila.Errores) {
+			t.Errorf("Fila %d distinta entre formatos", i)
+		}
+	}
+
+	if err := Escribir(&bytes.Buffer{}, "pdf", Lista(filas), nil); err == nil {
+		t.Error("Se esperaba un error con un formato no válido")
+	}
+}
+
+func TestConsolidado(t *testing.T) {
+	filas := filasPrueba(t)
+	fechaLote := time.Date(2024, 5, 20, 10, 0, 0, 0, time.Local)
+	vistas := []documentos.Vista{
+		{FechaEmision: "2024-05-02", Total: 10},
+		{FechaProcesamiento: "31/05/2024 23:10:00", Total: 5.5},
+		{Total: 2},
+	}
+
+	var consolidadas []Consolidada
+	for i, fila := range filas {
+		consolidadas = append(consolidadas, NuevaConsolidada("Lote_1", fila, vistas[i], fechaLote))
+	}
+	if consolidadas[1].Fecha.Day() != 31 || !consolidadas[2].Fecha.Equal(fechaLote) {
+		t.Errorf("Fechas inesperadas: %v, %v", consolidadas[1].Fecha, consolidadas[2].Fecha)
+	}
+	if consolidadas[0].EstadoFinal != EstadoProcesado || consolidadas[1].EstadoFinal != EstadoRechazado || consolidadas[2].EstadoFinal != EstadoError {
+		t.Errorf("Estados inesperados: %s, %s, %s", consolidadas[0].EstadoFinal, consolidadas[1].EstadoFinal, consolidadas[2].EstadoFinal)
+	}
+
+	filtro := FiltroConsolidado{
+		Desde:    time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local),
+		Hasta:    time.Date(2024, 5, 31, 0, 0, 0, 0, time.Local),
+		TiposDte: []string{"01"},
+	}
+	var aceptadas []Consolidada
+	for _, consolidada := range consolidadas {
+		if filtro.Acepta(consolidada) {
+			aceptadas = append(aceptadas, consolidada)
+		}
+	}
+	if len(aceptadas) != 2 {
+		t.Fatalf("Se esperaban 2 documentos de tipo 01 en mayo, hay %d", len(aceptadas))
+	}
+
+	resumen := Resumir(consolidadas)
+	if len(resumen) != 3 || resumen[0].TipoDte != "01" || resumen[0].Monto != 2 || resumen[2].Monto != 5.5 {
+		t.Errorf("Resumen inesperado: %+v", resumen)
+	}
+
+	// Los montos en otra moneda quedan en su propia fila del resumen
+	enEuros := consolidadas[0]
+	enEuros.Moneda = "EUR"
+	porMoneda := Resumir([]Consolidada{consolidadas[0], enEuros})
+	if len(porMoneda) != 2 || porMoneda[0].Moneda != "" || porMoneda[1].Moneda != "EUR" || porMoneda[1].Monto != 10 {
+		t.Errorf("Resumen por moneda inesperado: %+v", porMoneda)
+	}
+
+	var salida bytes.Buffer
+	if err := EscribirConsolidadoExcel(&salida, consolidadas, resumen); err != nil {
+		t.Fatalf("Error al generar el Excel consolidado: %v", err)
+	}
+	archivo, err := xlsx.OpenBinary(salida.Bytes())
+	if err != nil {
+		t.Fatalf("Excel consolidado no válido: %v", err)
+	}
+	if len(archivo.Sheets) != 2 || len(archivo.Sheets[0].Rows) != 4 || len(archivo.Sheets[1].Rows) != 4 {
+		t.Errorf("Hojas inesperadas en el Excel consolidado")
+	}
+}
+
+func TestExcelAnotado(t *testing.T) {
+	filas := filasPrueba(t)
+	fila, ok := NuevaFila("IDDTE-4", "01", `Código: 500, Mensaje: {"Message": "Detalles[1].PrecioUnitario: debe ser mayor que 0"}`)
+	if !ok {
+		t.Fatal("No se pudo interpretar el estado de IDDTE-4")
+	}
+	filas = append(filas, fila)
+
+	original := xlsx.NewFile()
+	receptor, _ := original.AddSheet("Receptor")
+	detalles, _ := original.AddSheet("Detalles")
+	for _, valores := range [][]string{{"IDDTE", "NumeroDocumento", "Nrc"}, {"1", "1", "1"}, {"2", "2", "2"}, {"3", "3", "3"}, {"4", "4", "4"}} {
+		receptor.AddRow().WriteSlice(&valores, -1)
+	}
+	for _, valores := range [][]string{{"IDDTE", "Cantidad", "PrecioUnitario"}, {"4", "1", "10"}, {"4", "2", "0"}, {"3", "1", "5"}} {
+		detalles.AddRow().WriteSlice(&valores, -1)
+	}
+
+	ruta := filepath.Join(t.TempDir(), "original.xlsx")
+	if err := original.Save(ruta); err != nil {
+		t.Fatal(err)
+	}
+	libroOriginal, err := AbrirLibro(ruta)
+	if err != nil {
+		t.Fatalf("No se pudo leer el archivo original: %v", err)
+	}
+	defer libroOriginal.Close()
+
+	var salida bytes.Buffer
+	if err := EscribirExcel(&salida, Lista(filas), libroOriginal); err != nil {
+		t.Fatalf("Error al generar el Excel: %v", err)
+	}
+
+	// Receptor: comentario en el NRC del IDDTE 2 y en el documento del IDDTE 3; Detalles: segundo ítem del IDDTE 4
+	lector, err := zip.NewReader(bytes.NewReader(salida.Bytes()), int64(salida.Len()))
+	if err != nil {
+		t.Fatalf("Excel no válido: %v", err)
+	}
+	esperados := map[string][]string{
+		"xl/comments2.xml": {`ref="C3"`, `ref="B4"`},
+		"xl/comments3.xml": {`ref="C3"`},
+	}
+	for _, parte := range lector.File {
+		contenido, ok := esperados[parte.Name]
+		if !ok {
+			continue
+		}
+		texto, err := leerParte(parte)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, referencia := range contenido {
+			if !bytes.Contains(texto, []byte(referencia)) {
+				t.Errorf("%s no contiene %s: %s", parte.Name, referencia, texto)
+			}
+		}
+		delete(esperados, parte.Name)
+	}
+	if len(esperados) > 0 {
+		t.Errorf("Faltan los comentarios %v", esperados)
+	}
+
+	libro, err := xlsx.OpenBinary(salida.Bytes())
+	if err != nil {
+		t.Fatalf("No se pudo abrir el Excel anotado: %v", err)
+	}
+	hoja := libro.Sheet["Detalles"]
+	if hoja == nil || len(hoja.Rows) != 4 {
+		t.Fatalf("Hoja 'Detalles' inesperada: %+v", hoja)
+	}
+	if hoja.Rows[1].Cells[0].GetStyle().Fill.FgColor != "" || hoja.Rows[2].Cells[0].GetStyle().Fill.FgColor == "" {
+		t.Error("Solo la fila del ítem rechazado debería estar resaltada")
+	}
+	if !hoja.Rows[2].Cells[2].GetStyle().Font.Bold {
+		t.Error("La celda rechazada debería estar en negrita")
+	}
+}
+
+func TestLibroOriginalPorFilas(t *testing.T) {
+	partes := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Receptor" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst><si><t>IDDTE</t></si><si><r><t>Num</t></r><r><t>ero</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>` +
+			`<row r="3"><c r="A3"><v>2</v></c><c r="C3" t="inlineStr"><is><t>nota</t></is></c></row>` +
+			`</sheetData></worksheet>`,
+	}
+	ruta := filepath.Join(t.TempDir(), "original.xlsx")
+	var contenido bytes.Buffer
+	escritor := zip.NewWriter(&contenido)
+	for nombre, texto := range partes {
+		parte, _ := escritor.Create(nombre)
+		parte.Write([]byte(texto))
+	}
+	escritor.Close()
+	if err := os.WriteFile(ruta, contenido.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	libro, err := AbrirLibro(ruta)
+	if err != nil {
+		t.Fatalf("No se pudo abrir el libro: %v", err)
+	}
+	defer libro.Close()
+
+	var filas [][]string
+	err = libro.recorrerHoja(0, func(r int, valores []string) error {
+		if r != len(filas) {
+			t.Errorf("Fila %d fuera de orden", r)
+		}
+		filas = append(filas, valores)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	esperadas := [][]string{{"IDDTE", "Numero"}, nil, {"2", "", "nota"}}
+	if !reflect.DeepEqual(filas, esperadas) {
+		t.Errorf("Filas %q, se esperaban %q", filas, esperadas)
+	}
+}
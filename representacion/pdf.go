@@ -0,0 +1,271 @@
+package representacion
+
+import (
+	"GoProcesadorExcel/documentos"
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// columnaDetalle es una columna de la tabla de ítems con su ancho en milímetros
+type columnaDetalle struct {
+	titulo string
+	ancho  float64
+	alinea string
+}
+
+var columnasDetalle = []columnaDetalle{
+	{"Cantidad", 18, "R"},
+	{"Código", 22, "L"},
+	{"Descripción", 0, "L"}, // ocupa el espacio restante
+	{"Precio unitario", 26, "R"},
+	{"Descuento", 22, "R"},
+	{"Subtotal", 24, "R"},
+}
+
+// URLConsulta devuelve el enlace de consulta pública de Hacienda que se codifica en el QR. La base se
+// configura con CONSULTA_PUBLICA_URL y el ambiente con HACIENDA_AMBIENTE (00 pruebas, 01 producción).
+func URLConsulta(vista documentos.Vista) string {
+	base := os.Getenv("CONSULTA_PUBLICA_URL")
+	if base == "" {
+		base = "https://admin.factura.gob.sv/consultaPublica"
+	}
+	ambiente := os.Getenv("HACIENDA_AMBIENTE")
+	if ambiente == "" {
+		ambiente = "00"
+	}
+
+	parametros := url.Values{}
+	parametros.Set("ambiente", ambiente)
+	parametros.Set("codGen", vista.CodigoGeneracion)
+	fecha := vista.FechaEmision
+	if len(fecha) > 10 {
+		fecha = fecha[:10]
+	}
+	parametros.Set("fechaEmi", fecha)
+	return base + "?" + parametros.Encode()
+}
+
+// Generar devuelve la representación gráfica del DTE en PDF con el diseño de la plantilla
+func Generar(vista documentos.Vista, plantilla Plantilla) ([]byte, error) {
+	if plantilla.Tamano == "" {
+		plantilla.Tamano = PlantillaPredeterminada.Tamano
+	}
+	if plantilla.Color == "" {
+		plantilla.Color = PlantillaPredeterminada.Color
+	}
+	if err := plantilla.validar(); err != nil {
+		return nil, err
+	}
+	r, g, b, _ := plantilla.rgb()
+
+	pdf := gofpdf.New("P", "mm", plantilla.Tamano, "")
+	// Las fuentes estándar usan cp1252; el traductor convierte los acentos y la ñ
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetMargins(12, 12, 12)
+	pdf.SetAutoPageBreak(true, 18)
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-14)
+		pdf.SetFont("Helvetica", "I", 7)
+		pdf.SetTextColor(110, 110, 110)
+		pdf.CellFormat(0, 4, tr(plantilla.Pie), "", 0, "L", false, 0, "")
+		izquierdo, _, _, _ := pdf.GetMargins()
+		pdf.SetX(izquierdo)
+		pdf.CellFormat(0, 4, tr(fmt.Sprintf("Página %d de {nb}", pdf.PageNo())), "", 0, "R", false, 0, "")
+	})
+	pdf.AddPage()
+
+	anchoPagina, _ := pdf.GetPageSize()
+	izquierdo, superior, derecho, _ := pdf.GetMargins()
+	anchoUtil := anchoPagina - izquierdo - derecho
+
+	// Encabezado: logo y datos del emisor a la izquierda, código QR a la derecha
+	xEmisor := izquierdo
+	if plantilla.Logo != "" {
+		contenido, tipo, err := plantilla.logo()
+		if err != nil {
+			return nil, err
+		}
+		opciones := gofpdf.ImageOptions{ImageType: tipo}
+		pdf.RegisterImageOptionsReader("logo", opciones, bytes.NewReader(contenido))
+		pdf.ImageOptions("logo", izquierdo, superior, 30, 0, false, opciones, 0, "")
+		xEmisor += 34
+	}
+
+	qr, err := qrcode.Encode(URLConsulta(vista), qrcode.Medium, 256)
+	if err != nil {
+		return nil, fmt.Errorf("error al generar el código QR: %v", err)
+	}
+	opcionesQR := gofpdf.ImageOptions{ImageType: "PNG"}
+	pdf.RegisterImageOptionsReader("qr", opcionesQR, bytes.NewReader(qr))
+	pdf.ImageOptions("qr", anchoPagina-derecho-30, superior, 30, 30, false, opcionesQR, 0, URLConsulta(vista))
+
+	anchoEmisor := anchoPagina - derecho - 34 - xEmisor
+	pdf.SetXY(xEmisor, superior)
+	pdf.SetTextColor(r, g, b)
+	pdf.SetFont("Helvetica", "B", 12)
+	pdf.MultiCell(anchoEmisor, 6, tr(plantilla.Emisor.Nombre), "", "L", false)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont("Helvetica", "", 8)
+	for _, linea := range []string{
+		etiqueta("NIT", plantilla.Emisor.Nit) + "   " + etiqueta("NRC", plantilla.Emisor.Nrc),
+		plantilla.Emisor.Actividad,
+		plantilla.Emisor.Direccion,
+		etiqueta("Teléfono", plantilla.Emisor.Telefono) + "   " + etiqueta("Correo", plantilla.Emisor.Correo),
+	} {
+		if linea = strings.TrimSpace(linea); linea != "" {
+			pdf.SetX(xEmisor)
+			pdf.MultiCell(anchoEmisor, 4, tr(linea), "", "L", false)
+		}
+	}
+	if pdf.GetY() < superior+32 {
+		pdf.SetY(superior + 32)
+	}
+
+	// Título e identificadores del documento
+	pdf.Ln(2)
+	pdf.SetFillColor(r, g, b)
+	pdf.SetTextColor(255, 255, 255)
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(anchoUtil, 7, tr(vista.TipoDocumento), "", 1, "C", true, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+	identificadores := [][2]string{
+		{"Código de generación", vista.CodigoGeneracion},
+		{"Número de control", vista.NumeroControl},
+		{"Sello de recepción", vista.SelloRecibido},
+		{"Fecha de emisión", vista.FechaEmision},
+		{"Fecha de procesamiento", vista.FechaProcesamiento},
+	}
+	for _, par := range identificadores {
+		pdf.SetFont("Helvetica", "B", 8)
+		pdf.CellFormat(42, 5, tr(par[0]), "LB", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.CellFormat(anchoUtil-42, 5, tr(par[1]), "RB", 1, "L", false, 0, "")
+	}
+
+	// Datos del receptor
+	pdf.Ln(3)
+	seccion(pdf, tr, "Receptor", anchoUtil, r, g, b)
+	pdf.SetFont("Helvetica", "", 8)
+	for _, par := range [][2]string{
+		{"Nombre", vista.Receptor.Nombre},
+		{"Documento", vista.Receptor.Documento},
+		{"NRC", vista.Receptor.Nrc},
+		{"Dirección", vista.Receptor.Direccion},
+		{"Teléfono", vista.Receptor.Telefono},
+		{"Correo", vista.Receptor.Correo},
+	} {
+		if par[1] == "" {
+			continue
+		}
+		pdf.SetFont("Helvetica", "B", 8)
+		pdf.CellFormat(30, 5, tr(par[0]), "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.MultiCell(anchoUtil-30, 5, tr(par[1]), "", "L", false)
+	}
+
+	// Detalle de ítems
+	pdf.Ln(3)
+	columnas := make([]columnaDetalle, len(columnasDetalle))
+	copy(columnas, columnasDetalle)
+	fijo := 0.0
+	for _, columna := range columnas {
+		fijo += columna.ancho
+	}
+	for i := range columnas {
+		if columnas[i].ancho == 0 {
+			columnas[i].ancho = anchoUtil - fijo
+		}
+	}
+	encabezadoDetalle := func() {
+		pdf.SetFillColor(r, g, b)
+		pdf.SetTextColor(255, 255, 255)
+		pdf.SetFont("Helvetica", "B", 8)
+		for _, columna := range columnas {
+			pdf.CellFormat(columna.ancho, 6, tr(columna.titulo), "1", 0, "C", true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetTextColor(0, 0, 0)
+		pdf.SetFont("Helvetica", "", 8)
+	}
+	encabezadoDetalle()
+
+	_, altoPagina := pdf.GetPageSize()
+	for _, item := range vista.Items {
+		valores := []string{
+			formatoCantidad(item.Cantidad),
+			item.Codigo,
+			item.Descripcion,
+			fmt.Sprintf("%.2f", item.PrecioUnitario),
+			fmt.Sprintf("%.2f", item.Descuento),
+			fmt.Sprintf("%.2f", item.Subtotal),
+		}
+		lineas := pdf.SplitLines([]byte(tr(item.Descripcion)), columnas[2].ancho-2)
+		alto := float64(max(len(lineas), 1)) * 4.5
+
+		// La fila completa pasa a la siguiente página con su encabezado
+		if pdf.GetY()+alto > altoPagina-18 {
+			pdf.AddPage()
+			encabezadoDetalle()
+		}
+		x, y := pdf.GetXY()
+		for i, columna := range columnas {
+			if i == 2 {
+				pdf.Rect(x, y, columna.ancho, alto, "D")
+				pdf.MultiCell(columna.ancho, 4.5, tr(valores[i]), "", columna.alinea, false)
+			} else {
+				pdf.CellFormat(columna.ancho, alto, tr(valores[i]), "1", 0, columna.alinea, false, 0, "")
+			}
+			x += columna.ancho
+			pdf.SetXY(x, y)
+		}
+		pdf.SetXY(izquierdo, y+alto)
+	}
+
+	pdf.SetFont("Helvetica", "B", 9)
+	ultimo := columnas[len(columnas)-1].ancho
+	pdf.CellFormat(anchoUtil-ultimo, 6, tr("Total "+vista.Moneda), "1", 0, "R", false, 0, "")
+	pdf.CellFormat(ultimo, 6, fmt.Sprintf("%.2f", vista.Total), "1", 1, "R", false, 0, "")
+
+	if vista.Observaciones != "" {
+		pdf.Ln(3)
+		seccion(pdf, tr, "Observaciones", anchoUtil, r, g, b)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.MultiCell(anchoUtil, 4.5, tr(vista.Observaciones), "", "L", false)
+	}
+
+	var salida bytes.Buffer
+	if err := pdf.Output(&salida); err != nil {
+		return nil, fmt.Errorf("error al generar el PDF: %v", err)
+	}
+	return salida.Bytes(), nil
+}
+
+// seccion escribe el título de una sección con el color de la plantilla
+func seccion(pdf *gofpdf.Fpdf, tr func(string) string, titulo string, ancho float64, r, g, b int) {
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.SetTextColor(r, g, b)
+	pdf.CellFormat(ancho, 6, tr(titulo), "B", 1, "L", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+	pdf.Ln(1)
+}
+
+func etiqueta(nombre string, valor string) string {
+	if valor == "" {
+		return ""
+	}
+	return nombre + ": " + valor
+}
+
+func formatoCantidad(cantidad float64) string {
+	if cantidad == float64(int64(cantidad)) {
+		return fmt.Sprintf("%d", int64(cantidad))
+	}
+	return fmt.Sprintf("%.2f", cantidad)
+}
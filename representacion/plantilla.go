@@ -0,0 +1,134 @@
+package representacion
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Emisor son los datos del emisor que se imprimen en el encabezado del documento
+type Emisor struct {
+	Nombre    string `json:"nombre"`
+	Nit       string `json:"nit"`
+	Nrc       string `json:"nrc"`
+	Actividad string `json:"actividad"`
+	Direccion string `json:"direccion"`
+	Telefono  string `json:"telefono"`
+	Correo    string `json:"correo"`
+}
+
+// Plantilla es el diseño de la representación gráfica de una empresa
+type Plantilla struct {
+	// Logo en PNG o JPG codificado en base64
+	Logo   string `json:"logo,omitempty"`
+	Emisor Emisor `json:"emisor"`
+	// Color de los encabezados en hexadecimal, por ejemplo #1F4E79
+	Color string `json:"color"`
+	// Tamano es el tamaño de página: Letter, Legal o A4
+	Tamano string `json:"tamano"`
+	// Pie es el texto que se imprime al final de cada página
+	Pie string `json:"pie,omitempty"`
+}
+
+// PlantillaPredeterminada es el diseño que se usa si la empresa no tiene uno propio
+var PlantillaPredeterminada = Plantilla{
+	Color:  "#1F4E79",
+	Tamano: "Letter",
+	Pie:    "Representación gráfica de documento tributario electrónico",
+}
+
+var tamanosPagina = map[string]bool{"Letter": true, "Legal": true, "A4": true}
+
+func clavePlantilla(empid string) string { return empid + "_plantilla_pdf" }
+
+// ObtenerPlantilla devuelve la plantilla de la empresa o la predeterminada
+func ObtenerPlantilla(rdb *redis.Client, empid string) (Plantilla, error) {
+	contenido, err := rdb.Get(context.Background(), clavePlantilla(empid)).Result()
+	if err == redis.Nil {
+		return PlantillaPredeterminada, nil
+	}
+	if err != nil {
+		return Plantilla{}, fmt.Errorf("error al obtener la plantilla PDF: %v", err)
+	}
+
+	var plantilla Plantilla
+	if err := json.Unmarshal([]byte(contenido), &plantilla); err != nil {
+		return Plantilla{}, fmt.Errorf("error al analizar la plantilla PDF: %v", err)
+	}
+	return plantilla, nil
+}
+
+// GuardarPlantilla valida y guarda la plantilla de la empresa; los campos vacíos usan los predeterminados
+func GuardarPlantilla(rdb *redis.Client, empid string, plantilla Plantilla) error {
+	if strings.TrimSpace(plantilla.Color) == "" {
+		plantilla.Color = PlantillaPredeterminada.Color
+	}
+	if strings.TrimSpace(plantilla.Tamano) == "" {
+		plantilla.Tamano = PlantillaPredeterminada.Tamano
+	}
+	if err := plantilla.validar(); err != nil {
+		return err
+	}
+
+	contenido, err := json.Marshal(plantilla)
+	if err != nil {
+		return fmt.Errorf("error al serializar la plantilla PDF: %v", err)
+	}
+	if err := rdb.Set(context.Background(), clavePlantilla(empid), contenido, 0).Err(); err != nil {
+		return fmt.Errorf("error al guardar la plantilla PDF: %v", err)
+	}
+	return nil
+}
+
+func (p Plantilla) validar() error {
+	if !tamanosPagina[p.Tamano] {
+		return fmt.Errorf("tamaño de página no válido: %s", p.Tamano)
+	}
+	if _, _, _, err := p.rgb(); err != nil {
+		return err
+	}
+	if p.Logo != "" {
+		if _, _, err := p.logo(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rgb devuelve los componentes del color de la plantilla
+func (p Plantilla) rgb() (int, int, int, error) {
+	color := strings.TrimPrefix(strings.TrimSpace(p.Color), "#")
+	if len(color) != 6 {
+		return 0, 0, 0, fmt.Errorf("color no válido: %s", p.Color)
+	}
+	valor, err := strconv.ParseUint(color, 16, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("color no válido: %s", p.Color)
+	}
+	return int(valor >> 16 & 0xFF), int(valor >> 8 & 0xFF), int(valor & 0xFF), nil
+}
+
+// logo decodifica el logo y devuelve su contenido y su tipo de imagen para gofpdf
+func (p Plantilla) logo() ([]byte, string, error) {
+	contenido, err := base64.StdEncoding.DecodeString(p.Logo)
+	if err != nil {
+		return nil, "", fmt.Errorf("el logo no está codificado en base64: %v", err)
+	}
+	_, formato, err := image.DecodeConfig(bytes.NewReader(contenido))
+	if err != nil {
+		return nil, "", fmt.Errorf("el logo debe ser una imagen PNG o JPG")
+	}
+	if formato == "jpeg" {
+		formato = "jpg"
+	}
+	return contenido, strings.ToUpper(formato), nil
+}
@@ -0,0 +1,61 @@
+package representacion
+
+import (
+	"GoProcesadorExcel/documentos"
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestGenerarPdf(t *testing.T) {
+	var logo bytes.Buffer
+	if err := png.Encode(&logo, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatalf("Error al generar el logo: %v", err)
+	}
+	plantilla := PlantillaPredeterminada
+	plantilla.Logo = base64.StdEncoding.EncodeToString(logo.Bytes())
+	plantilla.Emisor = Emisor{Nombre: "Compañía de prueba", Nit: "0614-010101-101-1"}
+
+	vista := documentos.Vista{
+		TipoDocumento:    "Factura",
+		CodigoGeneracion: "ABC-123",
+		NumeroControl:    "DTE-01-00000000-000000000000001",
+		SelloRecibido:    "SELLO",
+		FechaEmision:     "2024-05-01",
+		Moneda:           "USD",
+		Receptor:         documentos.Receptor{Nombre: "Cliente", Direccion: "San Salvador"},
+		Items:            []documentos.Item{{Cantidad: 2, Descripcion: strings.Repeat("Servicio de diseño ", 20), PrecioUnitario: 5, Subtotal: 10}},
+		Total:            10,
+	}
+	pdf, err := Generar(vista, plantilla)
+	if err != nil {
+		t.Fatalf("Error al generar el PDF: %v", err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Error("El contenido generado no es un PDF")
+	}
+}
+
+func TestURLConsulta(t *testing.T) {
+	t.Setenv("HACIENDA_AMBIENTE", "01")
+	url := URLConsulta(documentos.Vista{CodigoGeneracion: "ABC-123", FechaEmision: "2024-05-01T10:00:00"})
+	esperada := "https://admin.factura.gob.sv/consultaPublica?ambiente=01&codGen=ABC-123&fechaEmi=2024-05-01"
+	if url != esperada {
+		t.Errorf("URL %q, se esperaba %q", url, esperada)
+	}
+}
+
+func TestPlantillaInvalida(t *testing.T) {
+	for _, plantilla := range []Plantilla{
+		{Color: "azul", Tamano: "Letter"},
+		{Color: "#000000", Tamano: "A0"},
+		{Color: "#000000", Tamano: "A4", Logo: base64.StdEncoding.EncodeToString([]byte("no es imagen"))},
+	} {
+		if err := plantilla.validar(); err == nil {
+			t.Errorf("Se esperaba un error con la plantilla %+v", plantilla)
+		}
+	}
+}
@@ -15,17 +15,146 @@ func SetupRouter(rdb *redis.Client) *gin.Engine {
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
 	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Access-Control-Allow-Origin", "tipoDte"}
-	config.AllowMethods = []string{"GET", "POST", "OPTIONS"}
+	config.AllowMethods = []string{"GET", "POST", "DELETE", "OPTIONS"}
 	r.Use(cors.New(config))
 
 	r.POST("/convert", func(c *gin.Context) {
 		controllers.HandleExcelConversion(c, rdb)
 	})
 
+	r.POST("/lotes", func(c *gin.Context) {
+		controllers.HandleEnvioLote(c, rdb)
+	})
+
+	r.POST("/lotes/:correlativo/invalidate", func(c *gin.Context) {
+		controllers.HandleInvalidarLote(c, rdb)
+	})
+
+	r.POST("/lotes/:correlativo/retry", func(c *gin.Context) {
+		controllers.HandleReintentarLote(c, rdb)
+	})
+
+	r.GET("/lotes/:correlativo/summary", func(c *gin.Context) {
+		controllers.HandleResumenLote(c, rdb)
+	})
+
+	r.GET("/lotes/:correlativo/events", func(c *gin.Context) {
+		controllers.HandleEventosLote(c, rdb)
+	})
+
+	r.GET("/lotes/:correlativo/pdf", func(c *gin.Context) {
+		controllers.HandlePdfLote(c, rdb)
+	})
+
+	r.GET("/lotes/:correlativo/iddte/:id/pdf", func(c *gin.Context) {
+		controllers.HandlePdfIddte(c, rdb)
+	})
+
+	r.GET("/ws/actividad", func(c *gin.Context) {
+		controllers.HandleTablero(c, rdb)
+	})
+
 	r.GET("/report/:correlativo", func(c *gin.Context) {
 		controllers.GetReporte(c, rdb)
 	})
 
+	r.GET("/reports", func(c *gin.Context) {
+		controllers.HandleReporteConsolidado(c, rdb)
+	})
+
+	r.GET("/documents/search", func(c *gin.Context) {
+		controllers.HandleBuscarDocumentos(c, rdb)
+	})
+
+	r.GET("/templates/:tipoDte", func(c *gin.Context) {
+		controllers.HandlePlantilla(c, rdb)
+	})
+
+	admin := r.Group("/admin")
+	{
+		admin.GET("/mapeos/:empid", func(c *gin.Context) {
+			controllers.HandleObtenerMapeo(c, rdb)
+		})
+
+		admin.POST("/mapeos/:empid", func(c *gin.Context) {
+			controllers.HandleGuardarMapeo(c, rdb)
+		})
+
+		admin.GET("/mapeos/:empid/:version", func(c *gin.Context) {
+			controllers.HandleObtenerVersionMapeo(c, rdb)
+		})
+
+		admin.POST("/mapeos/:empid/:version/activar", func(c *gin.Context) {
+			controllers.HandleActivarMapeo(c, rdb)
+		})
+
+		admin.GET("/correo/:empid", func(c *gin.Context) {
+			controllers.HandleObtenerPlantillaCorreo(c, rdb)
+		})
+
+		admin.POST("/correo/:empid", func(c *gin.Context) {
+			controllers.HandleGuardarPlantillaCorreo(c, rdb)
+		})
+
+		admin.GET("/pdf/:empid", func(c *gin.Context) {
+			controllers.HandleObtenerPlantillaPdf(c, rdb)
+		})
+
+		admin.POST("/pdf/:empid", func(c *gin.Context) {
+			controllers.HandleGuardarPlantillaPdf(c, rdb)
+		})
+	}
+
+	r.GET("/identificadores/auditoria", func(c *gin.Context) {
+		controllers.HandleAuditoriaNumeroControl(c, rdb)
+	})
+
+	r.GET("/conciliacion", func(c *gin.Context) {
+		controllers.HandleConciliacion(c, rdb)
+	})
+
+	webhooks := r.Group("/webhooks")
+	{
+		webhooks.GET("", func(c *gin.Context) {
+			controllers.HandleListarWebhooks(c, rdb)
+		})
+
+		webhooks.POST("", func(c *gin.Context) {
+			controllers.HandleCrearWebhook(c, rdb)
+		})
+
+		webhooks.GET("/entregas", func(c *gin.Context) {
+			controllers.HandleEntregasWebhooks(c, rdb)
+		})
+
+		webhooks.DELETE("/:id", func(c *gin.Context) {
+			controllers.HandleEliminarWebhook(c, rdb)
+		})
+
+		webhooks.POST("/:id/test", func(c *gin.Context) {
+			controllers.HandleProbarWebhook(c, rdb)
+		})
+	}
+
+	contingencia := r.Group("/contingencia")
+	{
+		contingencia.GET("", func(c *gin.Context) {
+			controllers.HandleEstadoContingencia(c, rdb)
+		})
+
+		contingencia.POST("/activar", func(c *gin.Context) {
+			controllers.HandleActivarContingencia(c, rdb)
+		})
+
+		contingencia.POST("/desactivar", func(c *gin.Context) {
+			controllers.HandleDesactivarContingencia(c, rdb)
+		})
+
+		contingencia.POST("/:codigo/transmitir", func(c *gin.Context) {
+			controllers.HandleTransmitirContingencia(c, rdb)
+		})
+	}
+
 	status := r.Group("/status")
 	{
 		status.GET("/lotes", func(c *gin.Context) {
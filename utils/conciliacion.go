@@ -0,0 +1,324 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Resultados de la consulta de un documento con resultado ambiguo
+const (
+	ConciliacionProcesado  = "PROCESADO"
+	ConciliacionRechazado  = "RECHAZADO"
+	ConciliacionNoEncontro = "NO_ENCONTRADO"
+)
+
+// mensajeSinCodigo explica por qué un documento pendiente no se consulta en la conciliación
+const mensajeSinCodigo = "Sin código de generación; no se puede conciliar automáticamente, verifique el documento en Hacienda"
+
+// claveEmpresasConciliacion es el conjunto de empresas con documentos pendientes de conciliar
+const claveEmpresasConciliacion = "conciliacion_empresas"
+
+// maxCambiosConciliacion es el número de cambios que se conservan en el registro de cada empresa
+const maxCambiosConciliacion = 1000
+
+// DocumentoAmbiguo es un documento cuyo envío terminó en timeout, error de red o 5xx, por lo que pudo
+// haber llegado a Hacienda. No se reenvía hasta conocer su resultado. Sin código de generación no se puede
+// consultar, así que queda bloqueado hasta que se revise manualmente.
+type DocumentoAmbiguo struct {
+	Lote             string    `json:"lote"`
+	IDDTE            string    `json:"iddte"`
+	TipoDte          string    `json:"tipoDte"`
+	CodigoGeneracion string    `json:"codigoGeneracion"`
+	Fecha            time.Time `json:"fecha"`
+	Intentos         int       `json:"intentos"`
+	UltimaConsulta   time.Time `json:"ultimaConsulta,omitempty"`
+	Mensaje          string    `json:"mensaje,omitempty"`
+}
+
+// CambioConciliacion registra un estado actualizado por la conciliación
+type CambioConciliacion struct {
+	Fecha            time.Time `json:"fecha"`
+	Lote             string    `json:"lote"`
+	IDDTE            string    `json:"iddte"`
+	CodigoGeneracion string    `json:"codigoGeneracion"`
+	Resultado        string    `json:"resultado"`
+	EstadoAnterior   string    `json:"estadoAnterior"`
+	EstadoNuevo      string    `json:"estadoNuevo"`
+}
+
+func claveAmbiguos(empid string) string            { return empid + "_conciliacion_pendientes" }
+func claveCambiosConciliacion(empid string) string { return empid + "_conciliacion_cambios" }
+
+// registrarAmbiguo deja el documento pendiente de conciliación para que no se reenvíe. Los documentos sin
+// código de generación también se registran aunque no se puedan consultar, porque reenviarlos puede duplicarlos.
+func (e *envioLote) registrarAmbiguo(id string, tipoDocumento string, documento map[string]interface{}) {
+	codigo := codigoGeneracionDocumento(documento)
+
+	pendiente := DocumentoAmbiguo{
+		Lote:             e.nombreLote,
+		IDDTE:            "IDDTE-" + id,
+		TipoDte:          tipoDocumento,
+		CodigoGeneracion: codigo,
+		Fecha:            time.Now(),
+	}
+	if codigo == "" {
+		log.Printf("La estructura %s tuvo un resultado ambiguo y no tiene código de generación para conciliarla\n", id)
+		pendiente.Mensaje = mensajeSinCodigo
+	}
+	if err := guardarAmbiguo(e.rdb, e.empid, pendiente); err != nil {
+		log.Printf("Error al registrar la estructura %s para conciliación: %v\n", id, err)
+		return
+	}
+	if err := e.rdb.SAdd(context.Background(), claveEmpresasConciliacion, e.empid).Err(); err != nil {
+		log.Printf("Error al registrar la empresa %s para conciliación: %v\n", e.empid, err)
+	}
+}
+
+// PendienteConciliacion indica si el IDDTE de un lote espera la conciliación y no se debe reenviar
+func PendienteConciliacion(rdb *redis.Client, empid string, nombreLote string, iddte string) bool {
+	existe, err := rdb.HExists(context.Background(), claveAmbiguos(empid), nombreLote+":"+iddte).Result()
+	if err != nil {
+		log.Printf("Error al verificar la conciliación de %s: %v\n", iddte, err)
+		// Ante la duda se evita un posible documento duplicado
+		return true
+	}
+	return existe
+}
+
+// ListarPendientesConciliacion devuelve los documentos de la empresa que esperan la conciliación
+func ListarPendientesConciliacion(rdb *redis.Client, empid string) ([]DocumentoAmbiguo, error) {
+	valores, err := rdb.HGetAll(context.Background(), claveAmbiguos(empid)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener los documentos pendientes de conciliación: %v", err)
+	}
+
+	pendientes := make([]DocumentoAmbiguo, 0, len(valores))
+	for _, valor := range valores {
+		var pendiente DocumentoAmbiguo
+		if err := json.Unmarshal([]byte(valor), &pendiente); err == nil {
+			pendientes = append(pendientes, pendiente)
+		}
+	}
+	return pendientes, nil
+}
+
+// ListarCambiosConciliacion devuelve los últimos estados actualizados por la conciliación, del más reciente al más antiguo
+func ListarCambiosConciliacion(rdb *redis.Client, empid string) ([]CambioConciliacion, error) {
+	valores, err := rdb.LRange(context.Background(), claveCambiosConciliacion(empid), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener los cambios de la conciliación: %v", err)
+	}
+
+	cambios := make([]CambioConciliacion, 0, len(valores))
+	for _, valor := range valores {
+		var cambio CambioConciliacion
+		if err := json.Unmarshal([]byte(valor), &cambio); err == nil {
+			cambios = append(cambios, cambio)
+		}
+	}
+	return cambios, nil
+}
+
+// IniciarConciliacion consulta periódicamente el resultado de los documentos con resultado ambiguo
+// (CONCILIACION_INTERVALO_MINUTOS, 5 minutos por defecto)
+func IniciarConciliacion(rdb *redis.Client) {
+	intervalo, err := strconv.Atoi(os.Getenv("CONCILIACION_INTERVALO_MINUTOS"))
+	if err != nil || intervalo <= 0 {
+		intervalo = 5
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(intervalo) * time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			ConciliarPendientes(rdb)
+		}
+	}()
+}
+
+// ConciliarPendientes consulta cada documento pendiente y actualiza su resultado cuando la consulta es concluyente
+func ConciliarPendientes(rdb *redis.Client) {
+	empresas, err := rdb.SMembers(context.Background(), claveEmpresasConciliacion).Result()
+	if err != nil {
+		log.Printf("Error al obtener las empresas pendientes de conciliación: %v\n", err)
+		return
+	}
+
+	cliente := &http.Client{Timeout: 30 * time.Second}
+	for _, empid := range empresas {
+		valores, err := rdb.HGetAll(context.Background(), claveAmbiguos(empid)).Result()
+		if err != nil {
+			log.Printf("Error al obtener los pendientes de conciliación de la empresa %s: %v\n", empid, err)
+			continue
+		}
+		if len(valores) == 0 {
+			rdb.SRem(context.Background(), claveEmpresasConciliacion, empid)
+			continue
+		}
+
+		for _, valor := range valores {
+			var pendiente DocumentoAmbiguo
+			if err := json.Unmarshal([]byte(valor), &pendiente); err != nil || pendiente.CodigoGeneracion == "" {
+				continue
+			}
+			conciliarDocumento(rdb, cliente, empid, pendiente)
+		}
+	}
+}
+
+// conciliarDocumento consulta un documento y, si el resultado es concluyente, actualiza su estado en el lote
+func conciliarDocumento(rdb *redis.Client, cliente *http.Client, empid string, pendiente DocumentoAmbiguo) {
+	ctx := context.Background()
+	campo := pendiente.Lote + ":" + pendiente.IDDTE
+
+	statusCode, cuerpo, err := consultarDocumento(cliente, pendiente)
+	pendiente.Intentos++
+	pendiente.UltimaConsulta = time.Now()
+	if err != nil || statusCode >= 500 || (statusCode >= 400 && statusCode != http.StatusNotFound) {
+		// La consulta no es concluyente; se vuelve a intentar en la siguiente revisión
+		if err != nil {
+			pendiente.Mensaje = err.Error()
+		} else {
+			pendiente.Mensaje = fmt.Sprintf("Código %d: %s", statusCode, cuerpo)
+		}
+		if err := guardarAmbiguo(rdb, empid, pendiente); err != nil {
+			log.Printf("Error al actualizar el pendiente de conciliación %s: %v\n", campo, err)
+		}
+		return
+	}
+
+	// Solo un "no encontrado" explícito permite reintentar; una respuesta que no se entiende sigue pendiente
+	resultado := resultadoConsulta(statusCode, cuerpo)
+	if resultado == "" {
+		pendiente.Mensaje = fmt.Sprintf("Respuesta no concluyente (código %d): %s", statusCode, cuerpo)
+		if err := guardarAmbiguo(rdb, empid, pendiente); err != nil {
+			log.Printf("Error al actualizar el pendiente de conciliación %s: %v\n", campo, err)
+		}
+		return
+	}
+
+	// Mismo formato que las respuestas del envío
+	estadoNuevo := fmt.Sprintf("Código: %d, Mensaje: %s", statusCode, cuerpo)
+	if resultado == ConciliacionNoEncontro {
+		estadoNuevo = mensajeError(http.StatusNotFound, "El documento no llegó a Hacienda; puede reintentarse")
+	}
+
+	estadoAnterior, _ := rdb.HGet(ctx, pendiente.Lote, pendiente.IDDTE).Result()
+	guardarEstadoEnRedis(rdb, pendiente.Lote, pendiente.IDDTE, estadoNuevo)
+
+	cambio, _ := json.Marshal(CambioConciliacion{
+		Fecha:            time.Now(),
+		Lote:             strings.TrimPrefix(pendiente.Lote, empid+"_"),
+		IDDTE:            pendiente.IDDTE,
+		CodigoGeneracion: pendiente.CodigoGeneracion,
+		Resultado:        resultado,
+		EstadoAnterior:   estadoAnterior,
+		EstadoNuevo:      estadoNuevo,
+	})
+	pipe := rdb.TxPipeline()
+	pipe.LPush(ctx, claveCambiosConciliacion(empid), cambio)
+	pipe.LTrim(ctx, claveCambiosConciliacion(empid), 0, maxCambiosConciliacion-1)
+	pipe.HDel(ctx, claveAmbiguos(empid), campo)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error al registrar la conciliación de %s: %v\n", campo, err)
+		return
+	}
+	log.Printf("Conciliación de %s (%s): %s\n", campo, pendiente.CodigoGeneracion, resultado)
+
+	// El documento ya tiene un resultado definitivo; el no encontrado queda para reintentar
+	if resultado != ConciliacionNoEncontro {
+		tipoDte, _ := rdb.HGet(ctx, ClaveTiposLote(empid, strings.TrimPrefix(pendiente.Lote, empid+"_Lote_")), pendiente.IDDTE).Result()
+		notificarIddte(rdb, empid, pendiente.Lote, pendiente.IDDTE, tipoDte, estadoNuevo, nil)
+	}
+}
+
+// resultadoConsulta interpreta la respuesta de la consulta: un 404 o un Estado NO_ENCONTRADO indican que el
+// documento no llegó; PROCESADO y RECHAZADO son definitivos. Cualquier otra respuesta devuelve "".
+func resultadoConsulta(statusCode int, cuerpo string) string {
+	if statusCode == http.StatusNotFound {
+		return ConciliacionNoEncontro
+	}
+
+	var respuesta struct {
+		Estado string `json:"Estado"`
+	}
+	if err := json.Unmarshal([]byte(cuerpo), &respuesta); err != nil {
+		return ""
+	}
+	switch estado := strings.ToUpper(strings.TrimSpace(respuesta.Estado)); estado {
+	case ConciliacionProcesado, ConciliacionRechazado, ConciliacionNoEncontro:
+		return estado
+	}
+	return ""
+}
+
+// consultarDocumento consulta el documento en la API de consulta (CONSULTA_API, "/dte/consulta/{codigoGeneracion}"
+// por defecto) con la credencial de servicio. Las marcas {codigoGeneracion} y {tipoDte} se reemplazan por
+// los datos del documento.
+func consultarDocumento(cliente *http.Client, pendiente DocumentoAmbiguo) (int, string, error) {
+	token := TokenServicio()
+	if token == "" {
+		return 0, "", errors.New("no hay credencial para consultar el documento; configure SERVICIO_TOKEN")
+	}
+
+	ruta := os.Getenv("CONSULTA_API")
+	if ruta == "" {
+		ruta = "/dte/consulta/{codigoGeneracion}"
+	}
+	ruta = strings.ReplaceAll(ruta, "{codigoGeneracion}", url.PathEscape(pendiente.CodigoGeneracion))
+	ruta = strings.ReplaceAll(ruta, "{tipoDte}", url.PathEscape(pendiente.TipoDte))
+
+	req, err := http.NewRequest("GET", os.Getenv("FACTURED_API")+ruta, nil)
+	if err != nil {
+		return 0, "", fmt.Errorf("error al crear la consulta: %v", err)
+	}
+	req.Header.Set("Authorization", token)
+
+	respuesta, err := cliente.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("error al consultar el documento: %v", err)
+	}
+	defer respuesta.Body.Close()
+
+	cuerpo, err := ioutil.ReadAll(respuesta.Body)
+	if err != nil {
+		return 0, "", fmt.Errorf("error al leer la respuesta de la consulta: %v", err)
+	}
+	return respuesta.StatusCode, string(cuerpo), nil
+}
+
+func guardarAmbiguo(rdb *redis.Client, empid string, pendiente DocumentoAmbiguo) error {
+	contenido, err := json.Marshal(pendiente)
+	if err != nil {
+		return err
+	}
+	return rdb.HSet(context.Background(), claveAmbiguos(empid), pendiente.Lote+":"+pendiente.IDDTE, contenido).Err()
+}
+
+// codigoGeneracionDocumento obtiene el código de generación de la identificación o de la raíz del documento
+func codigoGeneracionDocumento(documento map[string]interface{}) string {
+	if documento == nil {
+		return ""
+	}
+	if identificacion, ok := documento["Identificacion"].(map[string]interface{}); ok {
+		if codigo, ok := identificacion["CodigoGeneracion"].(string); ok && codigo != "" {
+			return codigo
+		}
+	}
+	if codigo, ok := documento["CodigoGeneracion"].(string); ok {
+		return codigo
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConsultarDocumento(t *testing.T) {
+	var ruta, token string
+	servidor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ruta = r.URL.Path
+		token = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer servidor.Close()
+
+	t.Setenv("FACTURED_API", servidor.URL)
+	t.Setenv("CONSULTA_API", "/dte/{tipoDte}/consulta/{codigoGeneracion}")
+	t.Setenv("SERVICIO_TOKEN", "x")
+
+	pendiente := DocumentoAmbiguo{TipoDte: "03", CodigoGeneracion: "ABC-123"}
+	statusCode, _, err := consultarDocumento(servidor.Client(), pendiente)
+	if err != nil {
+		t.Fatalf("Error al consultar el documento: %v", err)
+	}
+	if statusCode != http.StatusNotFound {
+		t.Errorf("Código %d, se esperaba %d", statusCode, http.StatusNotFound)
+	}
+	if ruta != "/dte/03/consulta/ABC-123" {
+		t.Errorf("Ruta %q, se esperaba /dte/03/consulta/ABC-123", ruta)
+	}
+	if token != "Bearer x" {
+		t.Errorf("Autorización %q, se esperaba la credencial de servicio", token)
+	}
+}
+
+func TestCodigoGeneracionDocumento(t *testing.T) {
+	casos := []struct {
+		documento map[string]interface{}
+		esperado  string
+	}{
+		{map[string]interface{}{"Identificacion": map[string]interface{}{"CodigoGeneracion": "A"}, "CodigoGeneracion": "B"}, "A"},
+		{map[string]interface{}{"CodigoGeneracion": "B"}, "B"},
+		{map[string]interface{}{"Identificacion": []interface{}{}}, ""},
+		{nil, ""},
+	}
+
+	for _, caso := range casos {
+		if codigo := codigoGeneracionDocumento(caso.documento); codigo != caso.esperado {
+			t.Errorf("codigoGeneracionDocumento(%v) = %q, se esperaba %q", caso.documento, codigo, caso.esperado)
+		}
+	}
+}
+
+func TestResultadoConsulta(t *testing.T) {
+	casos := []struct {
+		statusCode int
+		cuerpo     string
+		esperado   string
+	}{
+		{http.StatusNotFound, "", ConciliacionNoEncontro},
+		{http.StatusOK, `{"Estado": "procesado"}`, ConciliacionProcesado},
+		{http.StatusOK, `{"Estado": "RECHAZADO"}`, ConciliacionRechazado},
+		{http.StatusOK, `{"Estado": "NO_ENCONTRADO"}`, ConciliacionNoEncontro},
+		{http.StatusOK, `{"Estado": "EN_PROCESO"}`, ""},
+		{http.StatusOK, `<html>mantenimiento</html>`, ""},
+	}
+
+	for _, caso := range casos {
+		if resultado := resultadoConsulta(caso.statusCode, caso.cuerpo); resultado != caso.esperado {
+			t.Errorf("resultadoConsulta(%d, %q) = %q, se esperaba %q", caso.statusCode, caso.cuerpo, resultado, caso.esperado)
+		}
+	}
+}
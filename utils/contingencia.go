@@ -0,0 +1,341 @@
+package utils
+
+import (
+	"GoProcesadorExcel/contingencia"
+	"GoProcesadorExcel/documentos"
+	"GoProcesadorExcel/identificadores"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// apiContingencia es la ruta de la API para reportar los eventos de contingencia
+const apiContingencia = "/dte/contingencia"
+
+var ErrTransmisionEnCurso = errors.New("ya se están transmitiendo los eventos de contingencia de la empresa")
+
+var ErrSinCredencial = errors.New("no hay un token para transmitir el evento de contingencia; configure SERVICIO_TOKEN o transmítalo desde la API")
+
+// encolarEnContingencia guarda el documento en la cola de la contingencia activa, o de una contingencia
+// automática si la API lleva caída más que el umbral. Devuelve false si el documento se debe enviar; un
+// documento que no se puede encolar por no tener código de generación queda con el error y no se envía.
+func (e *envioLote) encolarEnContingencia(id string, tipoDocumento string, documento map[string]interface{}) bool {
+	if e.transmisionContingencia || documento == nil {
+		return false
+	}
+
+	evento, err := contingencia.EventoParaEnvio(e.rdb, e.empid)
+	if err != nil {
+		log.Printf("Error al verificar la contingencia de la empresa %s: %v\n", e.empid, err)
+		return false
+	}
+	if evento == nil {
+		return false
+	}
+
+	// El evento de contingencia identifica cada documento por su código de generación; sin él, Hacienda
+	// rechazaría el evento cuando ya se cerró la ventana. Sin la asignación de identificadores del servicio
+	// solo se genera el código; el número de control lo sigue asignando la empresa.
+	if contingencia.CodigoDocumento(documento) == "" && tipoDocumento != "cancel" {
+		codigo, err := identificadores.NuevoCodigoGeneracion()
+		if err != nil {
+			log.Printf("Error al generar el código de generación de la estructura %s: %v\n", id, err)
+		} else {
+			filaIdentificacion(documento)["CodigoGeneracion"] = codigo
+		}
+	}
+	if contingencia.CodigoDocumento(documento) == "" {
+		guardarEstadoEnRedis(e.rdb, e.nombreLote, "IDDTE-"+id, mensajeError(http.StatusBadRequest, "El documento no tiene código de generación y no se puede emitir en contingencia"))
+		e.registrar(fmt.Sprintf("%s - %s - Sin código de generación, no se encola en contingencia\n", time.Now().Format(time.Stamp), "IDDTE-"+id))
+		return true
+	}
+
+	contingencia.MarcarDocumento(documento, evento)
+	err = contingencia.Encolar(e.rdb, e.empid, evento, contingencia.DocumentoEnCola{
+		Lote:      e.nombreLote,
+		ID:        id,
+		TipoDte:   tipoDocumento,
+		Documento: documento,
+		Fecha:     time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error al guardar la estructura %s en la cola de contingencia: %v\n", id, err)
+		return false
+	}
+
+	mensaje, _ := json.Marshal(map[string]string{
+		"Message":                      "Documento emitido en contingencia, pendiente de transmisión",
+		"Estado":                       "CONTINGENCIA",
+		"CodigoGeneracionContingencia": evento.CodigoGeneracion,
+	})
+	guardarEstadoEnRedis(e.rdb, e.nombreLote, "IDDTE-"+id, fmt.Sprintf("Código: %d , Mensaje: %s", http.StatusAccepted, string(mensaje)))
+	e.registrar(fmt.Sprintf("%s - %s - Documento en contingencia %s\n", time.Now().Format(time.Stamp), "IDDTE-"+id, evento.CodigoGeneracion))
+	return true
+}
+
+// TransmitirContingencia reporta un evento de contingencia cerrado y luego transmite los documentos de
+// su cola. Si authToken está vacío se usa la credencial de servicio. Solo salen de la cola los documentos
+// con una respuesta definitiva; el evento queda reportado hasta que la cola se vacíe o venza el plazo.
+func TransmitirContingencia(rdb *redis.Client, empid string, authToken string, codigo string) error {
+	if authToken == "" {
+		authToken = TokenServicio()
+	}
+	if authToken == "" {
+		return ErrSinCredencial
+	}
+
+	bloqueado, err := contingencia.Bloquear(rdb, empid)
+	if err != nil {
+		return fmt.Errorf("error al bloquear la transmisión de contingencia: %v", err)
+	}
+	if !bloqueado {
+		return ErrTransmisionEnCurso
+	}
+	defer contingencia.Desbloquear(rdb, empid)
+
+	evento, err := contingencia.ObtenerEvento(rdb, empid, codigo)
+	if err != nil {
+		return err
+	}
+	if evento.Estado == contingencia.EstadoActiva {
+		return errors.New("la contingencia sigue activa")
+	}
+	if evento.Estado == contingencia.EstadoTransmitida {
+		return nil
+	}
+
+	documentos, err := contingencia.DocumentosEnCola(rdb, empid, codigo)
+	if err != nil {
+		return err
+	}
+
+	// Sin documentos pendientes no hay nada que reportar ni transmitir
+	if len(documentos) == 0 {
+		evento.Estado = contingencia.EstadoTransmitida
+		return contingencia.GuardarEvento(rdb, empid, evento)
+	}
+
+	// Paso 1: Reportar el evento de contingencia
+	if evento.Estado == contingencia.EstadoCerrada {
+		sello, err := enviarEventoContingencia(contingencia.DocumentoEvento(evento, documentos), authToken)
+		if err != nil {
+			evento.Mensaje = err.Error()
+			contingencia.GuardarEvento(rdb, empid, evento)
+			return err
+		}
+		evento.Estado = contingencia.EstadoReportada
+		evento.SelloRecibido = sello
+		evento.Mensaje = ""
+		if err := contingencia.GuardarEvento(rdb, empid, evento); err != nil {
+			return err
+		}
+		log.Printf("Evento de contingencia %s de la empresa %s reportado\n", codigo, empid)
+	}
+
+	// Paso 2: Transmitir los documentos de la cola dentro del plazo
+	logFile, err := os.OpenFile("IDDTElog.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error al abrir el archivo de registro: %v", err)
+	}
+	defer logFile.Close()
+
+	cliente := &http.Client{}
+	plazo := evento.Plazo()
+	var pendientes []contingencia.DocumentoEnCola
+	for _, documento := range documentos {
+		iddte := "IDDTE-" + documento.ID
+		envio := &envioLote{
+			rdb:                     rdb,
+			cliente:                 cliente,
+			empid:                   empid,
+			apiURL:                  os.Getenv("FACTURED_API"),
+			authToken:               authToken,
+			tipoDte:                 documento.TipoDte,
+			nombreLote:              documento.Lote,
+			claveTipos:              ClaveTiposLote(empid, strings.TrimPrefix(documento.Lote, empid+"_Lote_")),
+			logFile:                 logFile,
+			transmisionContingencia: true,
+		}
+
+		// Un envío anterior con resultado ambiguo se resuelve con la conciliación antes de reenviarlo
+		if PendienteConciliacion(rdb, empid, documento.Lote, iddte) {
+			pendientes = append(pendientes, documento)
+			continue
+		}
+		if estado, _ := rdb.HGet(context.Background(), documento.Lote, iddte).Result(); respuestaDefinitiva(estado) {
+			// La conciliación ya obtuvo el resultado del documento
+			evento.Transmitidos++
+			continue
+		}
+
+		if time.Now().After(plazo) {
+			guardarEstadoEnRedis(rdb, documento.Lote, iddte, mensajeError(http.StatusBadRequest, "Venció el plazo para transmitir el documento emitido en contingencia"))
+			envio.registrar(fmt.Sprintf("%s - %s - Plazo de contingencia vencido\n", time.Now().Format(time.Stamp), iddte))
+			continue
+		}
+
+		envio.enviarEstructura(documento.ID, documento.Documento)
+		if estado, _ := rdb.HGet(context.Background(), documento.Lote, iddte).Result(); !respuestaDefinitiva(estado) {
+			pendientes = append(pendientes, documento)
+			continue
+		}
+		evento.Transmitidos++
+	}
+
+	if err := contingencia.ReemplazarCola(rdb, empid, codigo, pendientes); err != nil {
+		log.Printf("Error al actualizar la cola de contingencia %s: %v\n", codigo, err)
+		return err
+	}
+	log.Printf("Documentos del evento de contingencia %s transmitidos: %d de %d, pendientes: %d\n", codigo, evento.Transmitidos, evento.Documentos, len(pendientes))
+
+	// El evento sigue abierto mientras queden documentos sin respuesta definitiva dentro del plazo
+	if len(pendientes) > 0 {
+		evento.Mensaje = fmt.Sprintf("%d documentos pendientes de transmitir", len(pendientes))
+		if err := contingencia.GuardarEvento(rdb, empid, evento); err != nil {
+			return err
+		}
+		return fmt.Errorf("quedan %d documentos del evento de contingencia %s sin respuesta definitiva", len(pendientes), codigo)
+	}
+	evento.Estado = contingencia.EstadoTransmitida
+	evento.Mensaje = ""
+	return contingencia.GuardarEvento(rdb, empid, evento)
+}
+
+// respuestaDefinitiva indica si el estado guardado de un documento es una respuesta de la API que no
+// cambia al reenviarlo. Los timeouts, errores de red, 5xx y el estado de contingencia no lo son, ni el
+// 404 que guarda la conciliación cuando el documento no llegó a Hacienda.
+func respuestaDefinitiva(estado string) bool {
+	codigo, respuesta, _ := documentos.ParsearEstado(estado)
+	switch {
+	case codigo < http.StatusOK || codigo >= http.StatusInternalServerError:
+		return false
+	case codigo == http.StatusNotFound || codigo == http.StatusRequestTimeout || codigo == http.StatusTooManyRequests:
+		return false
+	}
+	return documentos.Texto(respuesta, "Estado") != "CONTINGENCIA"
+}
+
+// enviarEventoContingencia envía el documento del evento y devuelve el sello de recepción
+func enviarEventoContingencia(documento map[string]interface{}, authToken string) (string, error) {
+	contenido, err := json.Marshal(documento)
+	if err != nil {
+		return "", fmt.Errorf("error al convertir el evento de contingencia a JSON: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", os.Getenv("FACTURED_API")+apiContingencia, bytes.NewBuffer(contenido))
+	if err != nil {
+		return "", fmt.Errorf("error al crear la solicitud del evento de contingencia: %v", err)
+	}
+	req.Header.Set("Authorization", authToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	respuesta, statusCode, mensajeOriginal, err := SendWithRetries(req, &http.Client{})
+	if err != nil {
+		return "", fmt.Errorf("error al reportar el evento de contingencia (código %d): %s", statusCode, mensajeOriginal)
+	}
+	defer respuesta.Body.Close()
+
+	cuerpo, err := ioutil.ReadAll(respuesta.Body)
+	if err != nil {
+		return "", fmt.Errorf("error al leer la respuesta del evento de contingencia: %v", err)
+	}
+
+	var resultado struct {
+		SelloRecibido  string `json:"SelloRecibido"`
+		Estado         string `json:"Estado"`
+		DescripcionMsg string `json:"DescripcionMsg"`
+	}
+	json.Unmarshal(cuerpo, &resultado)
+	if resultado.Estado == "RECHAZADO" {
+		return "", fmt.Errorf("evento de contingencia rechazado: %s", resultado.DescripcionMsg)
+	}
+	return resultado.SelloRecibido, nil
+}
+
+// IniciarMonitorContingencia revisa periódicamente las empresas en contingencia: cierra las contingencias
+// automáticas cuando la API vuelve a responder y transmite los eventos cerrados con sus documentos
+func IniciarMonitorContingencia(rdb *redis.Client) {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			revisarContingencias(rdb)
+		}
+	}()
+}
+
+func revisarContingencias(rdb *redis.Client) {
+	empresas, err := contingencia.Empresas(rdb)
+	if err != nil {
+		log.Printf("Error al obtener las empresas en contingencia: %v\n", err)
+		return
+	}
+
+	for _, empid := range empresas {
+		activo, err := contingencia.ObtenerActivo(rdb, empid)
+		if err != nil {
+			log.Printf("Error al obtener la contingencia de la empresa %s: %v\n", empid, err)
+			continue
+		}
+		if activo != nil {
+			// Las contingencias del operador solo las cierra el operador
+			if activo.Origen != contingencia.OrigenAutomatico || !servicioDisponible() {
+				continue
+			}
+			if _, err := contingencia.Cerrar(rdb, empid); err != nil {
+				log.Printf("Error al cerrar la contingencia de la empresa %s: %v\n", empid, err)
+				continue
+			}
+			log.Printf("La API volvió a responder; contingencia %s de la empresa %s cerrada\n", activo.CodigoGeneracion, empid)
+		}
+
+		eventos, err := contingencia.ListarEventos(rdb, empid)
+		if err != nil {
+			log.Printf("Error al listar los eventos de contingencia de la empresa %s: %v\n", empid, err)
+			continue
+		}
+
+		pendientes := false
+		for _, evento := range eventos {
+			if evento.Estado != contingencia.EstadoCerrada && evento.Estado != contingencia.EstadoReportada {
+				continue
+			}
+			if err := TransmitirContingencia(rdb, empid, "", evento.CodigoGeneracion); err != nil {
+				log.Printf("Error al transmitir el evento de contingencia %s: %v\n", evento.CodigoGeneracion, err)
+				pendientes = true
+				// Sin credencial de servicio los eventos esperan a que se transmitan desde la API
+				if err == ErrSinCredencial {
+					break
+				}
+			}
+		}
+
+		if !pendientes {
+			if err := contingencia.QuitarEmpresa(rdb, empid); err != nil {
+				log.Printf("Error al quitar la empresa %s del seguimiento de contingencia: %v\n", empid, err)
+			}
+		}
+	}
+}
+
+// servicioDisponible consulta la API; cualquier respuesta HTTP indica que volvió a estar disponible
+func servicioDisponible() bool {
+	cliente := &http.Client{Timeout: 10 * time.Second}
+	respuesta, err := cliente.Get(os.Getenv("FACTURED_API"))
+	if err != nil {
+		return false
+	}
+	respuesta.Body.Close()
+	contingencia.RegistrarExito()
+	return true
+}
@@ -0,0 +1,21 @@
+package utils
+
+import "testing"
+
+func TestRespuestaDefinitiva(t *testing.T) {
+	casos := map[string]bool{
+		`Código: 200, Mensaje: {"Estado": "PROCESADO"}`:                                 true,
+		`Código: 400, Mensaje: {"Message": "Receptor.Nrc no válido"}`:                   true,
+		`Código: 202 , Mensaje: {"Estado": "CONTINGENCIA"}`:                             false,
+		`Código: 500 , Mensaje: Error al Generar DTE`:                                   false,
+		`Código: 404 , Mensaje: {"Message": "El documento no llegó a Hacienda"}`:        false,
+		`Post "http://api/dte/fc": context deadline exceeded (Client.Timeout exceeded)`: false,
+		``: false,
+	}
+
+	for estado, esperado := range casos {
+		if definitiva := respuestaDefinitiva(estado); definitiva != esperado {
+			t.Errorf("respuestaDefinitiva(%q) = %v, se esperaba %v", estado, definitiva, esperado)
+		}
+	}
+}
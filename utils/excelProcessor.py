@@ -11,10 +11,31 @@ import csv
 # Obtener el ID de usuario como argumento
 id_emp = sys.argv[3]
 
-client_maps = {}
-if id_emp == "1022":
-    from maps.maps_px import *
-    client_maps = locals()
+# Los mapas de datos fijos y de tipos se definen en archivos JSON compartidos con el servicio en Go
+maps_dir = os.path.join(os.path.dirname(os.path.abspath(__file__)), "maps")
+tipos_python = {"str": str, "int": int, "float": float, "bool": bool}
+
+
+def cargar_mapa(nombre):
+    ruta = os.path.join(maps_dir, nombre)
+    if not os.path.exists(ruta):
+        return {}
+    with open(ruta, encoding="utf-8") as archivo:
+        return json.load(archivo)
+
+
+type_map = {hoja: {col: tipos_python[tipo] for col, tipo in columnas.items()} for hoja, columnas in cargar_mapa("tipos.json").items()}
+client_maps = cargar_mapa(f"{id_emp}.json")
+map_columns = {}
+
+# El servicio en Go envía el mapeo activo de la empresa (valores fijos, tipos y renombres de columnas)
+if len(sys.argv) > 4:
+    with open(sys.argv[4], encoding="utf-8") as archivo_mapeo:
+        mapeo_empresa = json.load(archivo_mapeo)
+    client_maps = mapeo_empresa.get("valores") or {}
+    for hoja, columnas in (mapeo_empresa.get("tipos") or {}).items():
+        type_map.setdefault(hoja, {}).update({col: tipos_python[tipo] for col, tipo in columnas.items()})
+    map_columns = mapeo_empresa.get("columnas") or {}
 
 
 def convert_nan_to_none(value):
@@ -64,6 +85,21 @@ def procesar_documento_identificacion_extension(row):
         if isinstance(documento_recibe, str):
             row["DocumentoRecibe"] = documento_recibe.replace("-", "")
         
+# Tipo de DTE de un documento: columna TipoDte de la hoja raíz, TipoDte de Identificacion o el tipo del lote
+def tipo_de_documento(detalle, tipo_predeterminado):
+    tipo = detalle.get("TipoDte")
+    if tipo is None or (not isinstance(tipo, str) and pd.isna(tipo)):
+        identificacion = detalle.get("Identificacion")
+        if isinstance(identificacion, list) and identificacion:
+            tipo = identificacion[0].get("TipoDte")
+        elif isinstance(identificacion, dict):
+            tipo = identificacion.get("TipoDte")
+    if tipo is None or (not isinstance(tipo, str) and pd.isna(tipo)) or str(tipo).strip() == "":
+        return tipo_predeterminado
+    if isinstance(tipo, (int, float, np.integer, np.floating)):
+        return "{:02d}".format(int(tipo))
+    return str(tipo).strip()
+
 def main():
     message = [['IDDTE', 'ERROR', 'FECHA', 'STATUS']]
     
@@ -78,16 +114,10 @@ def main():
     hojas_a_procesar = list(hojas.keys())  # Obtener automáticamente los nombres de las hojas
 
     # Definir los mapas de datos fijos según el tipo de DTE y la empresa
-    map_dte = {
-        "01": client_maps.get('fc_map', {}),  # Obtener el mapa si está definido en el módulo del usuario, o un diccionario vacío {}
-        "03": client_maps.get('ccf_map', {}),
-        "11": client_maps.get('fex_map', {}),
-        "05": client_maps.get('nc_map', {}),
-        "14": client_maps.get('fse_map', {}),
-        "cancel": {}
-    }
-
-    map_selected = map_dte.get(tipo_dte)
+    map_dte = dict(client_maps)  # Obtener el mapa si está definido en el mapeo del cliente, o un diccionario vacío {}
+    map_dte["cancel"] = {}
+
+    map_selected = map_dte.get(tipo_dte, {})
     map_datatype_selected = type_map
 
     detalles_por_id = {}
@@ -101,7 +131,8 @@ def main():
                 columnas_texto = [col for col, dtype in datatype_map.items() if dtype == str]
             else:
                 columnas_texto = []
-            dtype_dict_per_sheet[hoja_nombre] = {col: str if col in columnas_texto else None for col in hoja.columns}        
+            renombres = map_columns.get(hoja_nombre, {})
+            dtype_dict_per_sheet[hoja_nombre] = {col: str if renombres.get(col, col) in columnas_texto else None for col in hoja.columns}
 
     # Procesamiento de todas las hojas
     for hoja_nombre in hojas_a_procesar:
@@ -127,6 +158,10 @@ def main():
 
             # Aplicar los tipos de datos al cargar la hoja
             hoja = pd.read_excel(archivo_excel, sheet_name=hoja_nombre, dtype=dtype_dict_per_sheet[hoja_nombre])
+
+            # Renombrar las columnas propias de la empresa a los nombres del DTE
+            if hoja_nombre in map_columns:
+                hoja = hoja.rename(columns=map_columns[hoja_nombre])
             
             for index, row in hoja.iterrows():  
                 try:
@@ -193,11 +228,18 @@ def main():
             print(f"Error al procesar la hoja '{hoja_nombre}' en la fila {index + 2}")
             continue
     
+    # Cada documento puede indicar su propio tipo de DTE; el del lote queda como predeterminado
+    tipos_por_id = {}
+    for idte, detalle in detalles_por_id.items():
+        tipos_por_id[idte] = tipo_de_documento(detalle, tipo_dte)
+        if "TipoDte" in detalle:
+            detalle["TipoDte"] = tipos_por_id[idte]
+
     if map_selected != "cancel":
-        # Integrar map_selected en detalles_por_id
+        # Integrar los datos fijos del tipo de cada documento en detalles_por_id
         for idte, detalle in detalles_por_id.items():
             try:
-                for hoja_nombre, datos_fijos in map_selected.items():
+                for hoja_nombre, datos_fijos in map_dte.get(tipos_por_id[idte], {}).items():
                     if hoja_nombre != "dte":
                         if idte not in detalles_por_id:
                             detalles_por_id[idte] = {}
@@ -243,6 +285,7 @@ def main():
         # Convertir las claves numpy.int64 a str
     try:      
         detalles_por_id_str_keys = {str(key): value for key, value in detalles_por_id.items()}
+        tipos_por_id_str_keys = {str(key): value for key, value in tipos_por_id.items()}
     except Exception as e:
         message.append(['', f"Error al convertir las claves a cadena de texto: {e}", '', "Error"])
         print(f"Error al convertir las claves a cadena de texto: {e}")
@@ -261,8 +304,9 @@ def main():
     # Agregar datos del objeto "dte" directamente en la raíz
     for idte, detalle in detalles_por_id_str_keys.items():
         try:
-            if "dte" in map_selected:
-                dte_data = map_selected["dte"]
+            map_documento = map_dte.get(tipos_por_id_str_keys.get(idte, tipo_dte), {})
+            if "dte" in map_documento:
+                dte_data = map_documento["dte"]
                 for key, value in dte_data.items():
                     if key not in detalle:
                         detalles_por_id_str_keys[idte][key] = value
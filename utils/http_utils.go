@@ -1,12 +1,14 @@
 package utils
 
 import (
+	"GoProcesadorExcel/contingencia"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 )
@@ -18,6 +20,17 @@ var errorPatterns = map[int]string{
 
 var ErrNoRetries = errors.New("no se realizaron reintentos")
 
+// TokenServicio devuelve la credencial de servicio (SERVICIO_TOKEN) para las tareas en segundo plano que
+// llaman a la API sin una solicitud de usuario, como el monitor de contingencia y la conciliación.
+// Los tokens de los usuarios no se guardan para usarlos después.
+func TokenServicio() string {
+	token := strings.TrimSpace(os.Getenv("SERVICIO_TOKEN"))
+	if token != "" && !strings.HasPrefix(token, "Bearer ") {
+		token = "Bearer " + token
+	}
+	return token
+}
+
 // Función para enviar datos a la API con reintentos y análisis de mensajes de error
 func SendWithRetries(req *http.Request, client *http.Client) (*http.Response, int, string, error) {
 	const maxRetries = 1
@@ -33,6 +46,8 @@ func SendWithRetries(req *http.Request, client *http.Client) (*http.Response, in
 		if err != nil {
 
 			originalErrorMessage = err.Error()
+			// Registrar el fallo de comunicación para detectar la caída de la API
+			contingencia.RegistrarFallo()
 			// Error de comunicación, como red o timeout
 			if isNetworkError(err) {
 				log.Printf("Intento %d: Error de red o timeout: %v\n", i+1, err)
@@ -43,6 +58,7 @@ func SendWithRetries(req *http.Request, client *http.Client) (*http.Response, in
 			}
 		} else {
 
+			contingencia.RegistrarExito()
 			StatusCode = resp.StatusCode
 			// Verificar si la respuesta indica un error
 			if StatusCode >= 400 {
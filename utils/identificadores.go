@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"GoProcesadorExcel/identificadores"
+	"os"
+	"strings"
+)
+
+// GenerarIdentificadores indica si el servicio asigna el código de generación y el número de control de
+// los documentos antes de enviarlos (GENERAR_IDENTIFICADORES=true)
+func GenerarIdentificadores() bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("GENERAR_IDENTIFICADORES"))) {
+	case "true", "1", "si", "sí":
+		return true
+	}
+	return false
+}
+
+// asignarIdentificadores coloca en la identificación del documento los identificadores asignados al IDDTE.
+// Un reenvío del mismo IDDTE reutiliza los identificadores; los que vienen en el documento se respetan.
+func (e *envioLote) asignarIdentificadores(id string, tipoDocumento string, documento map[string]interface{}) error {
+	identificacion := filaIdentificacion(documento)
+
+	existente, err := identificadores.ObtenerAsignacion(e.rdb, e.empid, e.nombreLote, "IDDTE-"+id)
+	if err != nil {
+		return err
+	}
+	if existente == nil && textoNoVacio(identificacion["CodigoGeneracion"]) && textoNoVacio(identificacion["NumeroControl"]) {
+		return nil
+	}
+
+	asignacion := existente
+	if asignacion == nil {
+		asignacion, err = identificadores.Asignar(e.rdb, e.empid, e.nombreLote, "IDDTE-"+id, tipoDocumento, identificacion)
+		if err != nil {
+			return err
+		}
+	}
+
+	identificacion["CodigoGeneracion"] = asignacion.CodigoGeneracion
+	identificacion["NumeroControl"] = asignacion.NumeroControl
+	return nil
+}
+
+// filaIdentificacion devuelve la identificación del documento, creándola si no existe
+func filaIdentificacion(documento map[string]interface{}) map[string]interface{} {
+	switch identificacion := documento["Identificacion"].(type) {
+	case map[string]interface{}:
+		return identificacion
+	case []interface{}:
+		if len(identificacion) > 0 {
+			if fila, ok := identificacion[0].(map[string]interface{}); ok {
+				return fila
+			}
+		}
+	}
+	identificacion := map[string]interface{}{}
+	documento["Identificacion"] = identificacion
+	return identificacion
+}
+
+func textoNoVacio(valor interface{}) bool {
+	texto, ok := valor.(string)
+	return ok && strings.TrimSpace(texto) != ""
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"GoProcesadorExcel/correo"
+	"GoProcesadorExcel/documentos"
+	"GoProcesadorExcel/eventos"
+	"GoProcesadorExcel/webhooks"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Resultado de un IDDTE para las notificaciones
+const (
+	resultadoProcesado = "procesado"
+	resultadoRechazado = "rechazado"
+	resultadoPendiente = "pendiente"
+)
+
+// clasificarEstado interpreta el estado guardado de un IDDTE: procesado si Hacienda lo aceptó, pendiente
+// si está en contingencia y rechazado en cualquier otro caso
+func clasificarEstado(valor string) (string, int, interface{}) {
+	codigo, mensaje, texto := documentos.ParsearEstado(valor)
+	switch {
+	case mensaje == nil:
+		return resultadoRechazado, codigo, texto
+	case codigo == http.StatusAccepted:
+		return resultadoPendiente, codigo, mensaje
+	case codigo == http.StatusOK && mensaje["Estado"] == "PROCESADO":
+		return resultadoProcesado, codigo, mensaje
+	}
+	return resultadoRechazado, codigo, mensaje
+}
+
+// notificarResultado dispara iddte.processed o iddte.rejected con el estado final del IDDTE y programa el
+// correo al receptor de los procesados. Los documentos en contingencia o pendientes de conciliación
+// todavía no tienen un resultado y no se notifican.
+func (e *envioLote) notificarResultado(id string, estructura interface{}) {
+	iddte := "IDDTE-" + id
+	if PendienteConciliacion(e.rdb, e.empid, e.nombreLote, iddte) {
+		return
+	}
+	valor, err := e.rdb.HGet(context.Background(), e.nombreLote, iddte).Result()
+	if err != nil {
+		return
+	}
+	tipoDte, _ := e.rdb.HGet(context.Background(), e.claveTipos, iddte).Result()
+	documento, _ := estructura.(map[string]interface{})
+	notificarIddte(e.rdb, e.empid, e.nombreLote, iddte, tipoDte, valor, documento)
+}
+
+// notificarIddte notifica el resultado de un IDDTE. Sin el documento en memoria se lee del lote si hace falta.
+func notificarIddte(rdb *redis.Client, empid string, nombreLote string, iddte string, tipoDte string, valor string, documento map[string]interface{}) {
+	resultado, codigo, respuesta := clasificarEstado(valor)
+	correlativo := strings.TrimPrefix(nombreLote, empid+"_Lote_")
+	evento := webhooks.EventoIddteRechazado
+	switch resultado {
+	case resultadoPendiente:
+		return
+	case resultadoProcesado:
+		evento = webhooks.EventoIddteProcesado
+		if tipoDte != "cancel" && correo.Habilitado() {
+			if documento == nil {
+				documento, _ = documentos.Documento(empid, correlativo, iddte)
+			}
+			correo.Encolar(rdb, empid, correlativo, iddte, tipoDte, documentos.CorreoReceptor(documento))
+		}
+	}
+
+	webhooks.Disparar(rdb, empid, evento, map[string]interface{}{
+		"lote":        strings.TrimPrefix(nombreLote, empid+"_"),
+		"correlativo": correlativo,
+		"iddte":       iddte,
+		"tipoDte":     tipoDte,
+		"codigo":      codigo,
+		"respuesta":   respuesta,
+	})
+}
+
+// notificarLoteCompletado dispara lote.completed y publica el evento de resumen con los resultados del lote
+func notificarLoteCompletado(rdb *redis.Client, empid string, nombreLote string, enviados int) {
+	estados, err := rdb.HGetAll(context.Background(), nombreLote).Result()
+	if err != nil {
+		log.Printf("Error al obtener los resultados del lote %s para notificar: %v\n", nombreLote, err)
+		return
+	}
+
+	procesados, rechazados, pendientes := 0, 0, 0
+	for iddte, valor := range estados {
+		resultado, _, _ := clasificarEstado(valor)
+		if PendienteConciliacion(rdb, empid, nombreLote, iddte) {
+			resultado = resultadoPendiente
+		}
+		switch resultado {
+		case resultadoProcesado:
+			procesados++
+		case resultadoPendiente:
+			pendientes++
+		default:
+			rechazados++
+		}
+	}
+
+	correlativo := strings.TrimPrefix(nombreLote, empid+"_Lote_")
+	resumen := map[string]interface{}{
+		"lote":        "Lote_" + correlativo,
+		"correlativo": correlativo,
+		"enviados":    enviados,
+		"total":       len(estados),
+		"procesados":  procesados,
+		"rechazados":  rechazados,
+		"pendientes":  pendientes,
+	}
+	eventos.Publicar(rdb, empid, correlativo, eventos.TipoResumen, resumen)
+	webhooks.Disparar(rdb, empid, webhooks.EventoLoteCompletado, resumen)
+}
+
+// publicarEstado publica el resultado de un IDDTE en el progreso de su lote
+func publicarEstado(rdb *redis.Client, nombreLote string, iddte string, valor string) {
+	empid, correlativo, ok := eventos.NombreLote(nombreLote)
+	if !ok {
+		return
+	}
+	resultado, codigo, respuesta := clasificarEstado(valor)
+	tipoDte, _ := rdb.HGet(context.Background(), ClaveTiposLote(empid, correlativo), iddte).Result()
+
+	eventos.Publicar(rdb, empid, correlativo, eventos.TipoIddte, map[string]interface{}{
+		"iddte":     iddte,
+		"tipoDte":   tipoDte,
+		"resultado": resultado,
+		"codigo":    codigo,
+		"respuesta": respuesta,
+	})
+}
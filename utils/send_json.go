@@ -2,6 +2,10 @@ package utils
 
 import (
 	"GoProcesadorExcel/authentication"
+	"GoProcesadorExcel/busqueda"
+	"GoProcesadorExcel/eventos"
+	"GoProcesadorExcel/registro"
+	"GoProcesadorExcel/validacion"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -31,24 +35,28 @@ var apiMap = map[string]string{
 	"cancel": "/dte/cancel",
 }
 
+// TipoDteSoportado indica si existe una API para enviar documentos del tipo de DTE indicado
+func TipoDteSoportado(tipoDte string) bool {
+	_, ok := apiMap[tipoDte]
+	return ok
+}
+
 // ProcesarArchivoJSON procesa un archivo JSON enviando sus estructuras a una API y registrando su estado en Redis
 func ProcesarArchivoJSON(rutaEntrada string, tipoDte string, authToken string, rdb *redis.Client, correlativo int) {
 
 	empid, _ := authentication.ValidateToken(authToken)
 
-	// Paso 1: Obtener la API correspondiente al tipo de DTE
-	dteApi, ok := apiMap[tipoDte]
-	if !ok {
-		log.Printf("Tipo de DTE no válido: %s\n", tipoDte)
-		return
+	// Paso 1: El tipo de DTE del lote es el predeterminado; cada documento puede indicar el suyo
+	if _, ok := apiMap[tipoDte]; !ok {
+		log.Printf("Tipo de DTE predeterminado no válido: %s\n", tipoDte)
 	}
 
-	// Paso 2: Construir la URL de la API
+	// Paso 2: Obtener la URL base de la API
 	apiURL := os.Getenv("FACTURED_API")
-	api := apiURL + dteApi
 
 	// Paso 3: Generar un nombre de lote único
 	nombreLote := fmt.Sprintf("%s_Lote_%03d", empid, correlativo)
+	claveTipos := ClaveTiposLote(empid, fmt.Sprintf("%03d", correlativo))
 
 	// Paso 4: Leer el archivo JSON
 	contenido, err := os.ReadFile(rutaEntrada)
@@ -76,6 +84,7 @@ func ProcesarArchivoJSON(rutaEntrada string, tipoDte string, authToken string, r
 	var wg sync.WaitGroup
 
 	log.Println("Iniciando el envío de las estructuras a la API...")
+	eventos.Fase(rdb, empid, fmt.Sprintf("%03d", correlativo), eventos.FaseEnviando, map[string]interface{}{"documentos": len(estructuras)})
 
 	//Crear el archivo de registro
 	logFileName := "IDDTElog.txt"
@@ -86,6 +95,18 @@ func ProcesarArchivoJSON(rutaEntrada string, tipoDte string, authToken string, r
 	}
 	defer logFile.Close()
 
+	envio := &envioLote{
+		rdb:        rdb,
+		cliente:    cliente,
+		empid:      empid,
+		apiURL:     apiURL,
+		authToken:  authToken,
+		tipoDte:    tipoDte,
+		nombreLote: nombreLote,
+		claveTipos: claveTipos,
+		logFile:    logFile,
+	}
+
 	// Paso 9: Enviar cada estructura a la API y registrar su estado en Redis
 	for id, estructura := range estructuras {
 		wg.Add(1) // Incrementar el contador del WaitGroup
@@ -102,89 +123,7 @@ func ProcesarArchivoJSON(rutaEntrada string, tipoDte string, authToken string, r
 				wg.Done()
 			}()
 
-			log.Printf("Iniciando envío de la estructura %s\n", id)
-
-			// Paso 10: Convertir la estructura a JSON
-			contenidoJSON, err := json.Marshal(estructura)
-			if err != nil {
-				log.Printf("Error al convertir la estructura a JSON: %v\n", err)
-				return
-			}
-
-			// Paso 11: Crear la solicitud HTTP
-			req, err := http.NewRequest("POST", api, bytes.NewBuffer(contenidoJSON))
-			if err != nil {
-				log.Printf("Error al crear la solicitud HTTP: %v\n", err)
-				// Guardar el error en Redis
-				guardarEstadoEnRedis(rdb, nombreLote, "IDDTE-"+id, err.Error())
-				return
-			}
-
-			// Paso 12: Agregar el encabezado de autorización
-			req.Header.Set("Authorization", authToken)
-			req.Header.Set("Content-Type", "application/json")
-
-			// Paso 13: Realizar la solicitud HTTP POST a la API de forma asíncrona
-			originalErrorMessage := "" // Variable para almacenar el mensaje original
-			respuesta, statusCode, originalErrorMessage, err := SendWithRetries(req, cliente)
-			if err != nil {
-
-				// Variable para rastrear si se realizó un reintento
-				var retried bool
-				statusRespuesta := fmt.Sprintf("Código: %d , Mensaje: %s", statusCode, string(originalErrorMessage))
-
-				// Verificar si se realizó un reintento
-				if err == ErrNoRetries {
-					retried = false
-				} else {
-					retried = true
-				}
-
-				// Imprimir el log de error solo si se realizó un reintento
-				if retried {
-					log.Printf("Error al enviar la estructura %s: %v\n", id, err)
-				}
-				// Guardar el error original en Redis si todos los reintentos fallan
-				if originalErrorMessage != "" {
-					guardarEstadoEnRedis(rdb, nombreLote, "IDDTE-"+id, statusRespuesta)
-				} else {
-					guardarEstadoEnRedis(rdb, nombreLote, "IDDTE-"+id, err.Error())
-				}
-				// Escribir el error en el archivo de registro
-				logEntry := fmt.Sprintf("%s - %s - Error al enviar la estructura: %v\n", time.Now().Format(time.Stamp), "IDDTE-"+id, statusRespuesta)
-				logEntry += ("\n<------------------------------------------------------------->\n")
-				if _, err := logFile.WriteString(logEntry); err != nil {
-					log.Printf("Error al escribir en el archivo de registro: %v\n", err)
-				}
-				return
-			}
-			defer respuesta.Body.Close()
-
-			// Paso 14: Leer el cuerpo de la respuesta
-			cuerpoRespuesta, err := ioutil.ReadAll(respuesta.Body)
-			if err != nil {
-				log.Printf("Error al leer la respuesta de la API: %v\n", err)
-				// Guardar el error en Redis
-				guardarEstadoEnRedis(rdb, nombreLote, "IDDTE-"+id, err.Error())
-				return
-			}
-
-			// Paso 15: Obtener el estado de la respuesta
-			estadoRespuesta := fmt.Sprintf("Código: %d, Mensaje: %s", respuesta.StatusCode, string(cuerpoRespuesta))
-
-			// Paso 16: Registrar el estado del IDDTE en Redis
-			guardarEstadoEnRedis(rdb, nombreLote, "IDDTE-"+id, estadoRespuesta)
-
-			dt := time.Now()
-
-			// Escribir en el archivo de registro
-			logEntry := fmt.Sprintf("%s - %s - Código de estado de la respuesta: %d %s\n", dt.Format(time.Stamp), "IDDTE-"+id, respuesta.StatusCode, respuesta.Status)
-			logEntry += fmt.Sprintf("%s - %s - Mensaje de la respuesta: %s\n", dt.Format(time.Stamp), "IDDTE-"+id, string(cuerpoRespuesta))
-			logEntry += ("\n<------------------------------------------------------------->\n")
-			if _, err := logFile.WriteString(logEntry); err != nil {
-				log.Printf("Error al escribir en el archivo de registro: %v\n", err)
-				return
-			}
+			envio.enviarEstructura(id, estructura)
 		}(id, estructura)
 	}
 
@@ -192,10 +131,189 @@ func ProcesarArchivoJSON(rutaEntrada string, tipoDte string, authToken string, r
 	wg.Wait()
 
 	log.Println("Envío de las estructuras completado.")
+	notificarLoteCompletado(rdb, empid, nombreLote, len(estructuras))
 
 	// fmt.Println("Documentos JSON enviados con éxito")
 }
 
+// envioLote reúne los datos compartidos por los envíos de las estructuras de un lote
+type envioLote struct {
+	rdb        *redis.Client
+	cliente    *http.Client
+	empid      string
+	apiURL     string
+	authToken  string
+	tipoDte    string
+	nombreLote string
+	claveTipos string
+	logFile    *os.File
+
+	// transmisionContingencia indica que las estructuras vienen de la cola de contingencia y se
+	// deben enviar aunque la contingencia siga activa
+	transmisionContingencia bool
+}
+
+// enviarEstructura envía un documento a la API de su tipo de DTE y registra su estado en Redis
+func (e *envioLote) enviarEstructura(id string, estructura interface{}) {
+	log.Printf("Iniciando envío de la estructura %s\n", id)
+	defer e.notificarResultado(id, estructura)
+	defer e.indexarDocumento(id, estructura)
+
+	// Enviar el documento a la API de su tipo de DTE; la columna TipoDte no forma parte del DTE
+	tipoDocumento := TipoDocumento(estructura, e.tipoDte)
+	documento, _ := estructura.(map[string]interface{})
+	if documento != nil {
+		delete(documento, "TipoDte")
+	}
+	guardarTipoEnRedis(e.rdb, e.claveTipos, "IDDTE-"+id, tipoDocumento)
+	if empid, correlativo, ok := eventos.NombreLote(e.nombreLote); ok {
+		registro.RegistrarTipo(e.rdb, empid, correlativo, tipoDocumento)
+	}
+
+	dteApi, ok := apiMap[tipoDocumento]
+	if !ok {
+		statusRespuesta := mensajeError(http.StatusBadRequest, "Tipo de DTE no válido: "+tipoDocumento)
+		guardarEstadoEnRedis(e.rdb, e.nombreLote, "IDDTE-"+id, statusRespuesta)
+		e.registrar(fmt.Sprintf("%s - %s - Tipo de DTE no válido: %s\n", time.Now().Format(time.Stamp), "IDDTE-"+id, tipoDocumento))
+		return
+	}
+	api := e.apiURL + dteApi
+
+	// Validar los documentos de identidad antes de enviar la estructura
+	if documento != nil {
+		if errores := validacion.ValidarEstructura(documento); len(errores) > 0 {
+			statusRespuesta := mensajeErrorValidacion(errores)
+			guardarEstadoEnRedis(e.rdb, e.nombreLote, "IDDTE-"+id, statusRespuesta)
+			e.registrar(fmt.Sprintf("%s - %s - Error de validación: %s\n", time.Now().Format(time.Stamp), "IDDTE-"+id, validacion.ResumenErrores(errores)))
+			return
+		}
+	}
+
+	// Un envío anterior con resultado ambiguo pudo llegar a Hacienda; no se reenvía hasta conciliarlo
+	if PendienteConciliacion(e.rdb, e.empid, e.nombreLote, "IDDTE-"+id) {
+		e.registrar(fmt.Sprintf("%s - %s - Pendiente de conciliación, no se reenvía\n", time.Now().Format(time.Stamp), "IDDTE-"+id))
+		return
+	}
+
+	// Asignar el código de generación y el número de control antes de enviar o encolar el documento
+	if documento != nil && tipoDocumento != "cancel" && GenerarIdentificadores() {
+		if err := e.asignarIdentificadores(id, tipoDocumento, documento); err != nil {
+			guardarEstadoEnRedis(e.rdb, e.nombreLote, "IDDTE-"+id, mensajeError(http.StatusInternalServerError, "No se pudieron asignar los identificadores: "+err.Error()))
+			e.registrar(fmt.Sprintf("%s - %s - Error al asignar los identificadores: %v\n", time.Now().Format(time.Stamp), "IDDTE-"+id, err))
+			return
+		}
+	}
+
+	// Durante una contingencia el documento se guarda en la cola en lugar de enviarse
+	if e.encolarEnContingencia(id, tipoDocumento, documento) {
+		return
+	}
+
+	// Paso 10: Convertir la estructura a JSON
+	contenidoJSON, err := json.Marshal(estructura)
+	if err != nil {
+		log.Printf("Error al convertir la estructura a JSON: %v\n", err)
+		return
+	}
+
+	// Paso 11: Crear la solicitud HTTP
+	req, err := http.NewRequest("POST", api, bytes.NewBuffer(contenidoJSON))
+	if err != nil {
+		log.Printf("Error al crear la solicitud HTTP: %v\n", err)
+		// Guardar el error en Redis
+		guardarEstadoEnRedis(e.rdb, e.nombreLote, "IDDTE-"+id, err.Error())
+		return
+	}
+
+	// Paso 12: Agregar el encabezado de autorización
+	req.Header.Set("Authorization", e.authToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	// Paso 13: Realizar la solicitud HTTP POST a la API de forma asíncrona
+	originalErrorMessage := "" // Variable para almacenar el mensaje original
+	respuesta, statusCode, originalErrorMessage, err := SendWithRetries(req, e.cliente)
+	if err != nil {
+
+		// Si la API no respondió y lleva caída más que el umbral, el documento pasa a contingencia
+		if statusCode == 0 && e.encolarEnContingencia(id, tipoDocumento, documento) {
+			return
+		}
+
+		// Variable para rastrear si se realizó un reintento
+		var retried bool
+		statusRespuesta := fmt.Sprintf("Código: %d , Mensaje: %s", statusCode, string(originalErrorMessage))
+
+		// Verificar si se realizó un reintento
+		if err == ErrNoRetries {
+			retried = false
+		} else {
+			retried = true
+		}
+
+		// Imprimir el log de error solo si se realizó un reintento
+		if retried {
+			log.Printf("Error al enviar la estructura %s: %v\n", id, err)
+		}
+		// Guardar el error original en Redis si todos los reintentos fallan
+		if originalErrorMessage != "" {
+			guardarEstadoEnRedis(e.rdb, e.nombreLote, "IDDTE-"+id, statusRespuesta)
+		} else {
+			guardarEstadoEnRedis(e.rdb, e.nombreLote, "IDDTE-"+id, err.Error())
+		}
+		// Un timeout, error de red o 5xx no confirma que el documento no haya llegado a Hacienda
+		if statusCode == 0 || statusCode >= http.StatusInternalServerError {
+			e.registrarAmbiguo(id, tipoDocumento, documento)
+		}
+		// Escribir el error en el archivo de registro
+		e.registrar(fmt.Sprintf("%s - %s - Error al enviar la estructura: %v\n", time.Now().Format(time.Stamp), "IDDTE-"+id, statusRespuesta))
+		return
+	}
+	defer respuesta.Body.Close()
+
+	// Paso 14: Leer el cuerpo de la respuesta
+	cuerpoRespuesta, err := ioutil.ReadAll(respuesta.Body)
+	if err != nil {
+		log.Printf("Error al leer la respuesta de la API: %v\n", err)
+		// Guardar el error en Redis
+		guardarEstadoEnRedis(e.rdb, e.nombreLote, "IDDTE-"+id, err.Error())
+		e.registrarAmbiguo(id, tipoDocumento, documento)
+		return
+	}
+
+	// Paso 15: Obtener el estado de la respuesta
+	estadoRespuesta := fmt.Sprintf("Código: %d, Mensaje: %s", respuesta.StatusCode, string(cuerpoRespuesta))
+
+	// Paso 16: Registrar el estado del IDDTE en Redis
+	guardarEstadoEnRedis(e.rdb, e.nombreLote, "IDDTE-"+id, estadoRespuesta)
+
+	dt := time.Now()
+
+	// Escribir en el archivo de registro
+	logEntry := fmt.Sprintf("%s - %s - Código de estado de la respuesta: %d %s\n", dt.Format(time.Stamp), "IDDTE-"+id, respuesta.StatusCode, respuesta.Status)
+	logEntry += fmt.Sprintf("%s - %s - Mensaje de la respuesta: %s\n", dt.Format(time.Stamp), "IDDTE-"+id, string(cuerpoRespuesta))
+	e.registrar(logEntry)
+}
+
+// indexarDocumento registra en el índice de búsqueda los identificadores del documento, incluidos los
+// asignados antes del envío, y el NIT del receptor
+func (e *envioLote) indexarDocumento(id string, estructura interface{}) {
+	documento, ok := estructura.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if empid, correlativo, ok := eventos.NombreLote(e.nombreLote); ok {
+		busqueda.Indexar(e.rdb, empid, correlativo, "IDDTE-"+id, busqueda.DelDocumento(documento))
+	}
+}
+
+// registrar escribe una entrada en el archivo de registro de los IDDTE
+func (e *envioLote) registrar(logEntry string) {
+	logEntry += ("\n<------------------------------------------------------------->\n")
+	if _, err := e.logFile.WriteString(logEntry); err != nil {
+		log.Printf("Error al escribir en el archivo de registro: %v\n", err)
+	}
+}
+
 func guardarEstadoEnRedis(rdb *redis.Client, nombreLote string, id string, estado string) {
 	// Guardar el estado en el hash del lote correspondiente
 	if err := rdb.HSet(context.Background(), nombreLote, id, estado).Err(); err != nil {
@@ -207,5 +325,32 @@ func guardarEstadoEnRedis(rdb *redis.Client, nombreLote string, id string, estad
 		if err != nil {
 			log.Printf("Error al establecer el tiempo de expiración en Redis para IDDTE %s del lote %s: %v\n", id, nombreLote, err)
 		}
+		if empid, correlativo, ok := eventos.NombreLote(nombreLote); ok {
+			tipoDte, _ := rdb.HGet(context.Background(), ClaveTiposLote(empid, correlativo), id).Result()
+			eventos.RegistrarResultado(rdb, empid, correlativo, id, tipoDte, estado)
+			busqueda.Indexar(rdb, empid, correlativo, id, busqueda.DelEstado(estado))
+		}
+		publicarEstado(rdb, nombreLote, id, estado)
+	}
+}
+
+// mensajeErrorValidacion construye el estado de un IDDTE rechazado localmente con el mismo formato que las respuestas de la API
+func mensajeErrorValidacion(errores []validacion.ErrorCampo) string {
+	mensaje, err := json.Marshal(map[string]interface{}{
+		"Message": validacion.ResumenErrores(errores),
+		"Errores": errores,
+	})
+	if err != nil {
+		return fmt.Sprintf("Código: %d , Mensaje: %s", http.StatusBadRequest, validacion.ResumenErrores(errores))
+	}
+	return fmt.Sprintf("Código: %d , Mensaje: %s", http.StatusBadRequest, string(mensaje))
+}
+
+// mensajeError construye el estado de un IDDTE rechazado localmente con un único mensaje
+func mensajeError(codigo int, mensaje string) string {
+	contenido, err := json.Marshal(map[string]string{"Message": mensaje})
+	if err != nil {
+		return fmt.Sprintf("Código: %d , Mensaje: %s", codigo, mensaje)
 	}
+	return fmt.Sprintf("Código: %d , Mensaje: %s", codigo, string(contenido))
 }
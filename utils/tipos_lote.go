@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ClaveTiposLote devuelve el hash de Redis con el tipo de DTE de cada IDDTE de un lote. No comparte el
+// prefijo {empid}_Lote_ para que las consultas de estados no lo confundan con un lote.
+func ClaveTiposLote(empid string, correlativo string) string {
+	return fmt.Sprintf("%s_TiposDte_Lote_%s", empid, correlativo)
+}
+
+// TipoDocumento obtiene el tipo de DTE de un documento: primero la columna TipoDte de la hoja raíz,
+// luego Identificacion.TipoDte y, si ninguno está presente, el tipo indicado para el lote
+func TipoDocumento(estructura interface{}, predeterminado string) string {
+	documento, ok := estructura.(map[string]interface{})
+	if !ok {
+		return predeterminado
+	}
+
+	if tipo := textoTipoDte(documento["TipoDte"]); tipo != "" {
+		return tipo
+	}
+
+	switch identificacion := documento["Identificacion"].(type) {
+	case map[string]interface{}:
+		if tipo := textoTipoDte(identificacion["TipoDte"]); tipo != "" {
+			return tipo
+		}
+	case []interface{}:
+		if len(identificacion) > 0 {
+			if fila, ok := identificacion[0].(map[string]interface{}); ok {
+				if tipo := textoTipoDte(fila["TipoDte"]); tipo != "" {
+					return tipo
+				}
+			}
+		}
+	}
+	return predeterminado
+}
+
+// textoTipoDte convierte el valor de la columna TipoDte al código de dos dígitos
+func textoTipoDte(valor interface{}) string {
+	switch v := valor.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return fmt.Sprintf("%02d", int(v))
+	case json.Number:
+		if entero, err := v.Int64(); err == nil {
+			return fmt.Sprintf("%02d", entero)
+		}
+		return v.String()
+	}
+	return ""
+}
+
+// ObtenerTiposLote devuelve el tipo de DTE de cada IDDTE de un lote, con las mismas claves que el hash de estados
+func ObtenerTiposLote(rdb *redis.Client, empid string, correlativo string) map[string]string {
+	tipos, err := rdb.HGetAll(context.Background(), ClaveTiposLote(empid, correlativo)).Result()
+	if err != nil {
+		log.Printf("Error al obtener los tipos de DTE del lote %s: %v\n", correlativo, err)
+		return map[string]string{}
+	}
+	return tipos
+}
+
+func guardarTipoEnRedis(rdb *redis.Client, claveTipos string, id string, tipo string) {
+	if err := rdb.HSet(context.Background(), claveTipos, id, tipo).Err(); err != nil {
+		log.Printf("Error al guardar el tipo de DTE en Redis para %s: %v\n", id, err)
+		return
+	}
+	expiration := 3 * 30 * 24 * time.Hour
+	if err := rdb.Expire(context.Background(), claveTipos, expiration).Err(); err != nil {
+		log.Printf("Error al establecer el tiempo de expiración en Redis para %s: %v\n", claveTipos, err)
+	}
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTipoDocumento(t *testing.T) {
+	casos := []struct {
+		documento string
+		esperado  string
+	}{
+		{`{"TipoDte": "03", "Identificacion": {"TipoDte": "01"}}`, "03"},
+		{`{"Identificacion": {"TipoDte": "05"}}`, "05"},
+		{`{"Identificacion": [{"TipoDte": "14"}]}`, "14"},
+		{`{"TipoDte": 3}`, "03"},
+		{`{"TipoDte": ""}`, "01"},
+		{`{"Receptor": {}}`, "01"},
+	}
+
+	for _, caso := range casos {
+		var documento map[string]interface{}
+		if err := json.Unmarshal([]byte(caso.documento), &documento); err != nil {
+			t.Fatalf("Error al analizar %s: %v", caso.documento, err)
+		}
+		if tipo := TipoDocumento(documento, "01"); tipo != caso.esperado {
+			t.Errorf("TipoDocumento(%s) = %q, se esperaba %q", caso.documento, tipo, caso.esperado)
+		}
+	}
+}
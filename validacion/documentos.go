@@ -0,0 +1,141 @@
+package validacion
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Códigos del catálogo de tipos de documento de identificación del receptor
+const (
+	TipoDocumentoNIT       = "36"
+	TipoDocumentoDUI       = "13"
+	TipoDocumentoOtro      = "37"
+	TipoDocumentoPasaporte = "03"
+	TipoDocumentoResidente = "02"
+)
+
+var tiposDocumentoValidos = map[string]bool{
+	TipoDocumentoNIT:       true,
+	TipoDocumentoDUI:       true,
+	TipoDocumentoOtro:      true,
+	TipoDocumentoPasaporte: true,
+	TipoDocumentoResidente: true,
+}
+
+var (
+	patronDUI       = regexp.MustCompile(`^\d{8}-?\d$`)
+	patronNIT       = regexp.MustCompile(`^\d{4}-?\d{6}-?\d{3}-?\d$`)
+	patronNRC       = regexp.MustCompile(`^\d{1,7}-?\d$`)
+	patronDocumento = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+	soloDigitos     = regexp.MustCompile(`^\d+$`)
+)
+
+var ErrDocumentoVacio = errors.New("el número de documento está vacío")
+
+// ValidarDUI verifica el formato y el dígito verificador de un DUI (########-#)
+func ValidarDUI(dui string) error {
+	dui = strings.TrimSpace(dui)
+	if dui == "" {
+		return ErrDocumentoVacio
+	}
+	if !patronDUI.MatchString(dui) {
+		return fmt.Errorf("el DUI %q debe tener 9 dígitos con formato ########-#", dui)
+	}
+
+	digitos := strings.ReplaceAll(dui, "-", "")
+
+	// Los primeros 8 dígitos se ponderan de 9 a 2
+	suma := 0
+	for i := 0; i < 8; i++ {
+		suma += int(digitos[i]-'0') * (9 - i)
+	}
+	verificador := (10 - suma%10) % 10
+
+	if int(digitos[8]-'0') != verificador {
+		return fmt.Errorf("el DUI %q tiene un dígito verificador inválido", dui)
+	}
+	return nil
+}
+
+// ValidarNIT verifica un NIT de 14 dígitos (####-######-###-#) o un DUI homologado de 9 dígitos
+func ValidarNIT(nit string) error {
+	nit = strings.TrimSpace(nit)
+	if nit == "" {
+		return ErrDocumentoVacio
+	}
+
+	digitos := strings.ReplaceAll(nit, "-", "")
+	if len(digitos) == 9 {
+		// A partir de la homologación el DUI es válido como NIT
+		if err := ValidarDUI(nit); err != nil {
+			return fmt.Errorf("el NIT %q no es un DUI homologado válido: %v", nit, err)
+		}
+		return nil
+	}
+
+	if !patronNIT.MatchString(nit) {
+		return fmt.Errorf("el NIT %q debe tener 14 dígitos con formato ####-######-###-# o 9 dígitos de DUI homologado", nit)
+	}
+	return nil
+}
+
+// ValidarNRC verifica el formato de un número de registro de contribuyente
+func ValidarNRC(nrc string) error {
+	nrc = strings.TrimSpace(nrc)
+	if nrc == "" {
+		return ErrDocumentoVacio
+	}
+	if !patronNRC.MatchString(nrc) {
+		return fmt.Errorf("el NRC %q debe tener entre 2 y 8 dígitos", nrc)
+	}
+	return nil
+}
+
+// ValidarDocumentoIdentificacion aplica las reglas propias de cada TipoDocumentoIdentificacion
+func ValidarDocumentoIdentificacion(tipo string, numero string) error {
+	tipo = strings.TrimSpace(tipo)
+	if !tiposDocumentoValidos[tipo] {
+		return fmt.Errorf("el tipo de documento de identificación %q no existe en el catálogo", tipo)
+	}
+
+	switch tipo {
+	case TipoDocumentoNIT:
+		return ValidarNIT(numero)
+	case TipoDocumentoDUI:
+		return ValidarDUI(numero)
+	default:
+		return validarOtroDocumento(numero, 3, 20)
+	}
+}
+
+// ValidarDocumentoPersona valida los documentos de entrega y recepción de la extensión,
+// que pueden ser DUI, NIT o cualquier otro documento
+func ValidarDocumentoPersona(numero string) error {
+	numero = strings.TrimSpace(numero)
+	digitos := strings.ReplaceAll(numero, "-", "")
+	if soloDigitos.MatchString(digitos) {
+		switch len(digitos) {
+		case 9:
+			return ValidarDUI(numero)
+		case 14:
+			return ValidarNIT(numero)
+		}
+	}
+	return validarOtroDocumento(numero, 1, 25)
+}
+
+func validarOtroDocumento(numero string, minimo int, maximo int) error {
+	numero = strings.TrimSpace(numero)
+	if numero == "" {
+		return ErrDocumentoVacio
+	}
+	if len(numero) < minimo || len(numero) > maximo {
+		return fmt.Errorf("el documento %q debe tener entre %d y %d caracteres", numero, minimo, maximo)
+	}
+	if !patronDocumento.MatchString(numero) {
+		return fmt.Errorf("el documento %q solo puede contener letras, números y guiones", numero)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package validacion
+
+import (
+	"testing"
+)
+
+func TestValidarDUI(t *testing.T) {
+	casos := map[string]bool{
+		"00016297-5": true,
+		"000162975":  true,
+		"00016297-4": false,
+		"0001629-75": false,
+		"1234567":    false,
+		"":           false,
+	}
+	for dui, valido := range casos {
+		if err := ValidarDUI(dui); (err == nil) != valido {
+			t.Errorf("ValidarDUI(%q) = %v, se esperaba válido=%v", dui, err, valido)
+		}
+	}
+}
+
+func TestValidarNIT(t *testing.T) {
+	casos := map[string]bool{
+		"0614-010190-101-2": true,
+		"06140101901012":    true,
+		"00016297-5":        true,
+		"000162974":         false,
+		"0614-010190-101":   false,
+		"0614010190101A":    false,
+	}
+	for nit, valido := range casos {
+		if err := ValidarNIT(nit); (err == nil) != valido {
+			t.Errorf("ValidarNIT(%q) = %v, se esperaba válido=%v", nit, err, valido)
+		}
+	}
+}
+
+func TestValidarNRC(t *testing.T) {
+	casos := map[string]bool{
+		"123456-7":  true,
+		"1234567":   true,
+		"12":        true,
+		"1":         false,
+		"123456789": false,
+		"12345A-7":  false,
+	}
+	for nrc, valido := range casos {
+		if err := ValidarNRC(nrc); (err == nil) != valido {
+			t.Errorf("ValidarNRC(%q) = %v, se esperaba válido=%v", nrc, err, valido)
+		}
+	}
+}
+
+func TestValidarDocumentoIdentificacion(t *testing.T) {
+	casos := []struct {
+		tipo   string
+		numero string
+		valido bool
+	}{
+		{"13", "00016297-5", true},
+		{"13", "06140101901012", false},
+		{"36", "06140101901012", true},
+		{"36", "000162975", true},
+		{"03", "A1234567", true},
+		{"03", "A1", false},
+		{"37", "ID 123", false},
+		{"99", "00016297-5", false},
+	}
+	for _, caso := range casos {
+		if err := ValidarDocumentoIdentificacion(caso.tipo, caso.numero); (err == nil) != caso.valido {
+			t.Errorf("ValidarDocumentoIdentificacion(%q, %q) = %v, se esperaba válido=%v", caso.tipo, caso.numero, err, caso.valido)
+		}
+	}
+}
+
+func TestValidarEstructura(t *testing.T) {
+	estructura := map[string]interface{}{
+		"Receptor": map[string]interface{}{
+			"TipoDocumentoIdentificacion":   "13",
+			"NumeroDocumentoIdentificacion": "000162974",
+			"Nrc":                           nil,
+		},
+		"Resumen": map[string]interface{}{
+			"TipoDocIdentResponsable": "36",
+			"NumDocIdentResponsable":  "06140101901012",
+		},
+		"Extension": map[string]interface{}{
+			"DocumentoEntrega": "00016297-5",
+			"DocumentoRecibe":  "12345678901",
+		},
+	}
+
+	errores := ValidarEstructura(estructura)
+	if len(errores) != 1 {
+		t.Fatalf("se esperaba 1 error, se obtuvieron %d: %v", len(errores), errores)
+	}
+	if errores[0].Hoja != "Receptor" || errores[0].Campo != "NumeroDocumentoIdentificacion" {
+		t.Errorf("error inesperado: %v", errores[0])
+	}
+}
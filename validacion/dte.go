@@ -0,0 +1,132 @@
+package validacion
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrorCampo describe un campo inválido dentro de una hoja del documento
+type ErrorCampo struct {
+	Hoja    string `json:"Hoja"`
+	Fila    int    `json:"Fila"`
+	Campo   string `json:"Campo"`
+	Mensaje string `json:"Mensaje"`
+}
+
+func (e ErrorCampo) Error() string {
+	return fmt.Sprintf("%s.%s (fila %d): %s", e.Hoja, e.Campo, e.Fila, e.Mensaje)
+}
+
+// parDocumento relaciona la columna del tipo de documento con la de su número
+type parDocumento struct {
+	tipo   string
+	numero string
+}
+
+var documentosResumen = []parDocumento{
+	{tipo: "TipoDocIdentResponsable", numero: "NumDocIdentResponsable"},
+	{tipo: "TipoDocIdentSolicita", numero: "NumDocIdentSolicita"},
+}
+
+// ValidarEstructura revisa los documentos de identidad de un IDDTE ya convertido y
+// devuelve un error por cada campo inválido
+func ValidarEstructura(estructura map[string]interface{}) []ErrorCampo {
+	var errores []ErrorCampo
+
+	for fila, receptor := range filasHoja(estructura, "Receptor") {
+		errores = append(errores, validarPar(receptor, "Receptor", fila, parDocumento{tipo: "TipoDocumentoIdentificacion", numero: "NumeroDocumentoIdentificacion"})...)
+
+		if nit, ok := valorCampo(receptor, "Nit"); ok {
+			if err := ValidarNIT(nit); err != nil {
+				errores = append(errores, ErrorCampo{Hoja: "Receptor", Fila: fila + 1, Campo: "Nit", Mensaje: err.Error()})
+			}
+		}
+		if nrc, ok := valorCampo(receptor, "Nrc"); ok {
+			if err := ValidarNRC(nrc); err != nil {
+				errores = append(errores, ErrorCampo{Hoja: "Receptor", Fila: fila + 1, Campo: "Nrc", Mensaje: err.Error()})
+			}
+		}
+	}
+
+	for fila, resumen := range filasHoja(estructura, "Resumen") {
+		for _, par := range documentosResumen {
+			errores = append(errores, validarPar(resumen, "Resumen", fila, par)...)
+		}
+	}
+
+	for fila, extension := range filasHoja(estructura, "Extension") {
+		for _, campo := range []string{"DocumentoEntrega", "DocumentoRecibe"} {
+			if numero, ok := valorCampo(extension, campo); ok {
+				if err := ValidarDocumentoPersona(numero); err != nil {
+					errores = append(errores, ErrorCampo{Hoja: "Extension", Fila: fila + 1, Campo: campo, Mensaje: err.Error()})
+				}
+			}
+		}
+	}
+
+	return errores
+}
+
+// ResumenErrores une los errores en un único mensaje legible
+func ResumenErrores(errores []ErrorCampo) string {
+	mensajes := make([]string, 0, len(errores))
+	for _, e := range errores {
+		mensajes = append(mensajes, e.Error())
+	}
+	return strings.Join(mensajes, "; ")
+}
+
+func validarPar(fila map[string]interface{}, hoja string, indice int, par parDocumento) []ErrorCampo {
+	numero, tieneNumero := valorCampo(fila, par.numero)
+	tipo, tieneTipo := valorCampo(fila, par.tipo)
+	if !tieneNumero && !tieneTipo {
+		return nil
+	}
+	if !tieneTipo {
+		return []ErrorCampo{{Hoja: hoja, Fila: indice + 1, Campo: par.tipo, Mensaje: fmt.Sprintf("falta el tipo de documento para %s", par.numero)}}
+	}
+	if err := ValidarDocumentoIdentificacion(tipo, numero); err != nil {
+		campo := par.numero
+		if !tiposDocumentoValidos[strings.TrimSpace(tipo)] {
+			campo = par.tipo
+		}
+		return []ErrorCampo{{Hoja: hoja, Fila: indice + 1, Campo: campo, Mensaje: err.Error()}}
+	}
+	return nil
+}
+
+// filasHoja devuelve las filas de una hoja, que puede venir como objeto o como lista de objetos
+func filasHoja(estructura map[string]interface{}, hoja string) []map[string]interface{} {
+	switch v := estructura[hoja].(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{v}
+	case []interface{}:
+		filas := make([]map[string]interface{}, 0, len(v))
+		for _, item := range v {
+			if fila, ok := item.(map[string]interface{}); ok {
+				filas = append(filas, fila)
+			}
+		}
+		return filas
+	}
+	return nil
+}
+
+// valorCampo obtiene el valor de un campo como texto, ignorando nulos y vacíos
+func valorCampo(fila map[string]interface{}, campo string) (string, bool) {
+	valor, ok := fila[campo]
+	if !ok || valor == nil {
+		return "", false
+	}
+	var texto string
+	switch v := valor.(type) {
+	case string:
+		texto = v
+	case float64:
+		texto = fmt.Sprintf("%.0f", v)
+	default:
+		texto = fmt.Sprintf("%v", v)
+	}
+	texto = strings.TrimSpace(texto)
+	return texto, texto != ""
+}
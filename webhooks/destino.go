@@ -0,0 +1,74 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var ErrDestinoNoPermitido = errors.New("la URL del webhook apunta a una dirección interna")
+
+// redCompartida es el rango 100.64.0.0/10 de NAT del proveedor, que tampoco es alcanzable desde internet
+var redCompartida = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// direccionPermitida rechaza las direcciones de loopback, privadas, de enlace local (incluida la de
+// metadatos 169.254.169.254), sin especificar y multicast, para que un webhook no alcance la red interna
+func direccionPermitida(ip net.IP) bool {
+	switch {
+	case ip.IsLoopback(), ip.IsPrivate(), ip.IsUnspecified(), ip.IsMulticast():
+		return false
+	case ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast(), ip.IsInterfaceLocalMulticast():
+		return false
+	case redCompartida.Contains(ip):
+		return false
+	}
+	return true
+}
+
+// validarDestino comprueba la URL del webhook y que todas las direcciones de su host sean públicas
+func validarDestino(direccion string) error {
+	destino, err := url.Parse(direccion)
+	if err != nil || (destino.Scheme != "http" && destino.Scheme != "https") || destino.Hostname() == "" {
+		return errors.New("la URL del webhook debe ser una dirección http o https")
+	}
+
+	ctx, cancelar := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelar()
+	direcciones, err := net.DefaultResolver.LookupIPAddr(ctx, destino.Hostname())
+	if err != nil {
+		return fmt.Errorf("no se pudo resolver el host del webhook %s: %v", destino.Hostname(), err)
+	}
+	for _, direccion := range direcciones {
+		if !direccionPermitida(direccion.IP) {
+			return ErrDestinoNoPermitido
+		}
+	}
+	return nil
+}
+
+// clienteEntrega devuelve el cliente para entregar las notificaciones. La dirección se revisa al conectar,
+// después de resolver el host, para que un cambio de DNS o una redirección no alcancen la red interna.
+func clienteEntrega(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network string, address string, conexion syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !direccionPermitida(ip) {
+				return ErrDestinoNoPermitido
+			}
+			return nil
+		},
+	}
+	transporte := http.DefaultTransport.(*http.Transport).Clone()
+	transporte.Proxy = nil
+	transporte.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transporte}
+}
@@ -0,0 +1,286 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Estados de una entrega
+const (
+	EntregaExitosa = "ENTREGADA"
+	EntregaFallida = "FALLIDA"
+)
+
+// Encabezados de las solicitudes del webhook
+const (
+	EncabezadoFirma   = "X-Webhook-Signature"
+	EncabezadoFecha   = "X-Webhook-Timestamp"
+	EncabezadoEvento  = "X-Webhook-Event"
+	EncabezadoEntrega = "X-Webhook-Delivery"
+)
+
+// maxEntregas es el número de entregas que se conservan en el registro de cada empresa
+const maxEntregas = 500
+
+// esperaInicial es la espera antes del primer reintento; se duplica en cada intento
+var esperaInicial = 2 * time.Second
+
+// capacidadCola es el número de entregas que pueden esperar a un trabajador; si la cola está llena la
+// entrega se registra como fallida en lugar de bloquear a quien dispara el evento
+const capacidadCola = 1000
+
+// entregaPendiente es una notificación que espera a un trabajador de la cola
+type entregaPendiente struct {
+	rdb         *redis.Client
+	empid       string
+	suscripcion Suscripcion
+	evento      string
+	datos       interface{}
+}
+
+var (
+	colaEntregas   chan entregaPendiente
+	iniciarEntrega sync.Once
+)
+
+// Notificacion es el cuerpo que recibe el webhook
+type Notificacion struct {
+	ID      string      `json:"id"`
+	Evento  string      `json:"evento"`
+	Empresa string      `json:"empresa"`
+	Fecha   time.Time   `json:"fecha"`
+	Datos   interface{} `json:"datos"`
+}
+
+// Entrega es el resultado del envío de una notificación a una suscripción
+type Entrega struct {
+	ID          string    `json:"id"`
+	Suscripcion string    `json:"suscripcion"`
+	URL         string    `json:"url"`
+	Evento      string    `json:"evento"`
+	Estado      string    `json:"estado"`
+	Intentos    int       `json:"intentos"`
+	Codigo      int       `json:"codigo"`
+	Error       string    `json:"error,omitempty"`
+	Fecha       time.Time `json:"fecha"`
+}
+
+func claveEntregas(empid string) string { return empid + "_webhooks_entregas" }
+
+// Firmar calcula la firma HMAC-SHA256 de "{timestamp}.{cuerpo}" con el secreto de la suscripción. El
+// receptor la compara con el encabezado X-Webhook-Signature, que lleva el prefijo "sha256=".
+func Firmar(secreto string, timestamp string, cuerpo []byte) string {
+	mac := hmac.New(sha256.New, []byte(secreto))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(cuerpo)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Disparar notifica el evento en segundo plano a las suscripciones de la empresa que lo reciben. Las
+// entregas pasan por una cola atendida por WEBHOOK_TRABAJADORES trabajadores (4 por defecto), así que los
+// reintentos de un webhook caído no multiplican las goroutines.
+func Disparar(rdb *redis.Client, empid string, evento string, datos interface{}) {
+	suscripciones, err := Listar(rdb, empid)
+	if err != nil {
+		log.Printf("Error al obtener los webhooks de la empresa %s: %v\n", empid, err)
+		return
+	}
+
+	for _, suscripcion := range suscripciones {
+		if !suscripcion.Recibe(evento) {
+			continue
+		}
+		encolar(entregaPendiente{rdb: rdb, empid: empid, suscripcion: suscripcion, evento: evento, datos: datos})
+	}
+}
+
+// encolar deja la entrega para los trabajadores, que se inician con la primera entrega
+func encolar(pendiente entregaPendiente) {
+	iniciarEntrega.Do(func() {
+		colaEntregas = make(chan entregaPendiente, capacidadCola)
+		trabajadores, err := strconv.Atoi(os.Getenv("WEBHOOK_TRABAJADORES"))
+		if err != nil || trabajadores <= 0 {
+			trabajadores = 4
+		}
+		for i := 0; i < trabajadores; i++ {
+			go atenderEntregas(colaEntregas)
+		}
+	})
+
+	select {
+	case colaEntregas <- pendiente:
+	default:
+		descartarEntrega(pendiente)
+	}
+}
+
+// atenderEntregas entrega las notificaciones de la cola una a una
+func atenderEntregas(cola <-chan entregaPendiente) {
+	for pendiente := range cola {
+		Entregar(pendiente.rdb, pendiente.empid, pendiente.suscripcion, pendiente.evento, pendiente.datos)
+	}
+}
+
+// descartarEntrega registra como fallida una entrega que no cupo en la cola
+func descartarEntrega(pendiente entregaPendiente) {
+	id, err := aleatorio(12)
+	if err != nil {
+		id = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	entrega := Entrega{
+		ID:          id,
+		Suscripcion: pendiente.suscripcion.ID,
+		URL:         pendiente.suscripcion.URL,
+		Evento:      pendiente.evento,
+		Estado:      EntregaFallida,
+		Error:       "la cola de entregas de webhooks está llena",
+		Fecha:       time.Now(),
+	}
+	registrarEntrega(pendiente.rdb, pendiente.empid, entrega)
+	log.Printf("No se pudo entregar el evento %s al webhook %s: %s\n", pendiente.evento, pendiente.suscripcion.URL, entrega.Error)
+}
+
+// Entregar envía la notificación a la suscripción, reintentando con espera exponencial, y registra el resultado
+func Entregar(rdb *redis.Client, empid string, suscripcion Suscripcion, evento string, datos interface{}) Entrega {
+	id, err := aleatorio(12)
+	if err != nil {
+		id = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	notificacion := Notificacion{
+		ID:      id,
+		Evento:  evento,
+		Empresa: empid,
+		Fecha:   time.Now(),
+		Datos:   datos,
+	}
+
+	entrega := entregarConReintentos(clienteEntrega(10*time.Second), suscripcion, notificacion)
+	registrarEntrega(rdb, empid, entrega)
+	if entrega.Estado == EntregaFallida {
+		log.Printf("No se pudo entregar el evento %s al webhook %s: %s\n", evento, suscripcion.URL, entrega.Error)
+	}
+	return entrega
+}
+
+// ListarEntregas devuelve las últimas entregas de la empresa, de la más reciente a la más antigua
+func ListarEntregas(rdb *redis.Client, empid string) ([]Entrega, error) {
+	valores, err := rdb.LRange(context.Background(), claveEntregas(empid), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener las entregas de los webhooks: %v", err)
+	}
+
+	entregas := make([]Entrega, 0, len(valores))
+	for _, valor := range valores {
+		var entrega Entrega
+		if err := json.Unmarshal([]byte(valor), &entrega); err == nil {
+			entregas = append(entregas, entrega)
+		}
+	}
+	return entregas, nil
+}
+
+// entregarConReintentos envía la notificación hasta WEBHOOK_INTENTOS veces (5 por defecto). Solo se
+// reintentan los errores de red, los 5xx, el 408 y el 429.
+func entregarConReintentos(cliente *http.Client, suscripcion Suscripcion, notificacion Notificacion) Entrega {
+	entrega := Entrega{
+		ID:          notificacion.ID,
+		Suscripcion: suscripcion.ID,
+		URL:         suscripcion.URL,
+		Evento:      notificacion.Evento,
+		Fecha:       notificacion.Fecha,
+	}
+
+	cuerpo, err := json.Marshal(notificacion)
+	if err != nil {
+		entrega.Estado = EntregaFallida
+		entrega.Error = fmt.Sprintf("error al serializar la notificación: %v", err)
+		return entrega
+	}
+
+	intentos, err := strconv.Atoi(os.Getenv("WEBHOOK_INTENTOS"))
+	if err != nil || intentos <= 0 {
+		intentos = 5
+	}
+
+	espera := esperaInicial
+	for entrega.Intentos < intentos {
+		if entrega.Intentos > 0 {
+			time.Sleep(espera)
+			espera *= 2
+		}
+		entrega.Intentos++
+
+		codigo, err := enviar(cliente, suscripcion, notificacion, cuerpo)
+		entrega.Codigo = codigo
+		if err == nil && codigo >= 200 && codigo < 300 {
+			entrega.Estado = EntregaExitosa
+			entrega.Error = ""
+			return entrega
+		}
+		if err != nil {
+			entrega.Error = err.Error()
+		} else {
+			entrega.Error = fmt.Sprintf("el webhook respondió con el código %d", codigo)
+		}
+		if err == nil && codigo < 500 && codigo != http.StatusRequestTimeout && codigo != http.StatusTooManyRequests {
+			break
+		}
+	}
+
+	entrega.Estado = EntregaFallida
+	return entrega
+}
+
+// enviar realiza un intento de entrega firmado y devuelve el código de la respuesta
+func enviar(cliente *http.Client, suscripcion Suscripcion, notificacion Notificacion, cuerpo []byte) (int, error) {
+	req, err := http.NewRequest("POST", suscripcion.URL, bytes.NewReader(cuerpo))
+	if err != nil {
+		return 0, fmt.Errorf("error al crear la solicitud del webhook: %v", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EncabezadoEvento, notificacion.Evento)
+	req.Header.Set(EncabezadoEntrega, notificacion.ID)
+	req.Header.Set(EncabezadoFecha, timestamp)
+	req.Header.Set(EncabezadoFirma, "sha256="+Firmar(suscripcion.Secreto, timestamp, cuerpo))
+
+	respuesta, err := cliente.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error al enviar el webhook: %v", err)
+	}
+	defer respuesta.Body.Close()
+	io.Copy(ioutil.Discard, respuesta.Body)
+
+	return respuesta.StatusCode, nil
+}
+
+func registrarEntrega(rdb *redis.Client, empid string, entrega Entrega) {
+	contenido, err := json.Marshal(entrega)
+	if err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	pipe := rdb.TxPipeline()
+	pipe.LPush(ctx, claveEntregas(empid), contenido)
+	pipe.LTrim(ctx, claveEntregas(empid), 0, maxEntregas-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error al registrar la entrega del webhook %s: %v\n", entrega.ID, err)
+	}
+}
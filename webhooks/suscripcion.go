@@ -0,0 +1,168 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Eventos del ciclo de vida de un lote que se pueden suscribir
+const (
+	EventoLoteConvertido    = "lote.converted"
+	EventoConversionFallida = "lote.conversion_failed"
+	EventoIddteProcesado    = "iddte.processed"
+	EventoIddteRechazado    = "iddte.rejected"
+	EventoLoteCompletado    = "lote.completed"
+)
+
+// EventoPrueba se envía desde el endpoint de prueba sin importar los eventos de la suscripción
+const EventoPrueba = "webhook.test"
+
+// Eventos son todos los eventos que se pueden suscribir
+var Eventos = []string{
+	EventoLoteConvertido,
+	EventoConversionFallida,
+	EventoIddteProcesado,
+	EventoIddteRechazado,
+	EventoLoteCompletado,
+}
+
+var ErrSuscripcionNoExiste = errors.New("la suscripción no existe")
+
+// Suscripcion es un webhook registrado por una empresa
+type Suscripcion struct {
+	ID      string    `json:"id"`
+	URL     string    `json:"url"`
+	Secreto string    `json:"secreto,omitempty"`
+	Eventos []string  `json:"eventos"`
+	Fecha   time.Time `json:"fecha"`
+}
+
+// Recibe indica si la suscripción está suscrita al evento
+func (s Suscripcion) Recibe(evento string) bool {
+	for _, suscrito := range s.Eventos {
+		if suscrito == evento {
+			return true
+		}
+	}
+	return false
+}
+
+func claveSuscripciones(empid string) string { return empid + "_webhooks" }
+
+// Crear registra una suscripción. Sin eventos se suscribe a todos y sin secreto se genera uno. La URL
+// debe resolver a direcciones públicas.
+func Crear(rdb *redis.Client, empid string, direccion string, secreto string, eventos []string) (*Suscripcion, error) {
+	if err := validarDestino(direccion); err != nil {
+		return nil, err
+	}
+
+	if len(eventos) == 0 {
+		eventos = Eventos
+	}
+	for _, evento := range eventos {
+		if !eventoValido(evento) {
+			return nil, fmt.Errorf("evento no válido: %s. Los eventos disponibles son %s", evento, strings.Join(Eventos, ", "))
+		}
+	}
+
+	var err error
+	if secreto == "" {
+		if secreto, err = aleatorio(32); err != nil {
+			return nil, err
+		}
+	}
+	id, err := aleatorio(8)
+	if err != nil {
+		return nil, err
+	}
+
+	suscripcion := &Suscripcion{
+		ID:      id,
+		URL:     direccion,
+		Secreto: secreto,
+		Eventos: eventos,
+		Fecha:   time.Now(),
+	}
+	contenido, err := json.Marshal(suscripcion)
+	if err != nil {
+		return nil, fmt.Errorf("error al serializar la suscripción: %v", err)
+	}
+	if err := rdb.HSet(context.Background(), claveSuscripciones(empid), id, contenido).Err(); err != nil {
+		return nil, fmt.Errorf("error al guardar la suscripción: %v", err)
+	}
+	return suscripcion, nil
+}
+
+// Obtener devuelve una suscripción de la empresa con su secreto
+func Obtener(rdb *redis.Client, empid string, id string) (*Suscripcion, error) {
+	contenido, err := rdb.HGet(context.Background(), claveSuscripciones(empid), id).Result()
+	if err == redis.Nil {
+		return nil, ErrSuscripcionNoExiste
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener la suscripción: %v", err)
+	}
+
+	var suscripcion Suscripcion
+	if err := json.Unmarshal([]byte(contenido), &suscripcion); err != nil {
+		return nil, fmt.Errorf("error al analizar la suscripción: %v", err)
+	}
+	return &suscripcion, nil
+}
+
+// Listar devuelve las suscripciones de la empresa, de la más antigua a la más reciente, con sus secretos
+func Listar(rdb *redis.Client, empid string) ([]Suscripcion, error) {
+	valores, err := rdb.HGetAll(context.Background(), claveSuscripciones(empid)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener las suscripciones: %v", err)
+	}
+
+	suscripciones := make([]Suscripcion, 0, len(valores))
+	for _, valor := range valores {
+		var suscripcion Suscripcion
+		if err := json.Unmarshal([]byte(valor), &suscripcion); err == nil {
+			suscripciones = append(suscripciones, suscripcion)
+		}
+	}
+	sort.Slice(suscripciones, func(i, j int) bool { return suscripciones[i].Fecha.Before(suscripciones[j].Fecha) })
+	return suscripciones, nil
+}
+
+// Eliminar borra una suscripción de la empresa
+func Eliminar(rdb *redis.Client, empid string, id string) error {
+	eliminadas, err := rdb.HDel(context.Background(), claveSuscripciones(empid), id).Result()
+	if err != nil {
+		return fmt.Errorf("error al eliminar la suscripción: %v", err)
+	}
+	if eliminadas == 0 {
+		return ErrSuscripcionNoExiste
+	}
+	return nil
+}
+
+func eventoValido(evento string) bool {
+	for _, valido := range Eventos {
+		if evento == valido {
+			return true
+		}
+	}
+	return false
+}
+
+// aleatorio genera n bytes aleatorios en hexadecimal
+func aleatorio(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error al generar el identificador: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,98 @@
+package webhooks
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEntregaFirmadaConReintentos(t *testing.T) {
+	esperaInicial = time.Millisecond
+	defer func() { esperaInicial = 2 * time.Second }()
+
+	suscripcion := Suscripcion{ID: "1", Secreto: "secreto", Eventos: Eventos}
+	intentos := 0
+	servidor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		intentos++
+		cuerpo, _ := ioutil.ReadAll(r.Body)
+		firma := "sha256=" + Firmar(suscripcion.Secreto, r.Header.Get(EncabezadoFecha), cuerpo)
+		if r.Header.Get(EncabezadoFirma) != firma {
+			t.Errorf("Firma %q, se esperaba %q", r.Header.Get(EncabezadoFirma), firma)
+		}
+		if r.Header.Get(EncabezadoEvento) != EventoLoteCompletado {
+			t.Errorf("Evento %q, se esperaba %q", r.Header.Get(EncabezadoEvento), EventoLoteCompletado)
+		}
+		// La primera entrega falla para forzar un reintento
+		if intentos == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer servidor.Close()
+	suscripcion.URL = servidor.URL
+
+	entrega := entregarConReintentos(servidor.Client(), suscripcion, Notificacion{ID: "abc", Evento: EventoLoteCompletado, Datos: map[string]int{"total": 1}})
+	if entrega.Estado != EntregaExitosa || entrega.Intentos != 2 || entrega.Codigo != http.StatusNoContent {
+		t.Errorf("Entrega inesperada: %+v", entrega)
+	}
+}
+
+func TestEntregaSinReintentoEn4xx(t *testing.T) {
+	esperaInicial = time.Millisecond
+	defer func() { esperaInicial = 2 * time.Second }()
+
+	intentos := 0
+	servidor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		intentos++
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer servidor.Close()
+
+	entrega := entregarConReintentos(servidor.Client(), Suscripcion{URL: servidor.URL}, Notificacion{Evento: EventoPrueba})
+	if entrega.Estado != EntregaFallida || intentos != 1 {
+		t.Errorf("Se esperaba un único intento fallido, hubo %d: %+v", intentos, entrega)
+	}
+	if !strings.Contains(entrega.Error, "410") {
+		t.Errorf("El error debería indicar el código de la respuesta: %q", entrega.Error)
+	}
+}
+
+func TestDestinosInternosRechazados(t *testing.T) {
+	internos := []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.10/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]/hook",
+		"http://[fd00:ec2::254]/hook",
+		"http://0.0.0.0/hook",
+	}
+	for _, direccion := range internos {
+		if err := validarDestino(direccion); err == nil {
+			t.Errorf("La URL %s debería rechazarse", direccion)
+		}
+	}
+
+	if err := validarDestino("https://93.184.216.34/hook"); err != nil {
+		t.Errorf("Una dirección pública debería aceptarse: %v", err)
+	}
+}
+
+func TestEntregaNoAlcanzaRedInterna(t *testing.T) {
+	llamado := false
+	servidor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		llamado = true
+	}))
+	defer servidor.Close()
+
+	t.Setenv("WEBHOOK_INTENTOS", "1")
+	entrega := entregarConReintentos(clienteEntrega(time.Second), Suscripcion{URL: servidor.URL}, Notificacion{Evento: EventoPrueba})
+	if entrega.Estado != EntregaFallida || llamado {
+		t.Errorf("La entrega a una dirección de loopback debería fallar sin conectarse: %+v", entrega)
+	}
+}